@@ -17,6 +17,10 @@ package caddy
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"expvar"
@@ -55,6 +59,13 @@ type AdminConfig struct {
 	// parsed by Caddy. Default: localhost:2019
 	Listen string `json:"listen,omitempty"`
 
+	// If set, the /healthz (liveness) and /readyz (readiness)
+	// endpoints are additionally served on a dedicated listener
+	// at this address, without the admin API's host and origin
+	// checks, so orchestrator probes can reach them directly.
+	// They are always available on the admin endpoint itself.
+	HealthListen string `json:"health_listen,omitempty"`
+
 	// If true, CORS headers will be emitted, and requests to the
 	// API will be rejected if their `Host` and `Origin` headers
 	// do not match the expected value(s). Use `origins` to
@@ -72,6 +83,327 @@ type AdminConfig struct {
 
 	// Options related to configuration management.
 	Config *ConfigSettings `json:"config,omitempty"`
+
+	// If set, the admin endpoint will be secured with TLS and
+	// required client certificates, making it safe to bind to
+	// non-loopback interfaces so fleets can be managed centrally
+	// without SSH tunnels.
+	Remote *RemoteAdmin `json:"remote,omitempty"`
+
+	// If true, the admin API will reject any request that could
+	// mutate configuration or process state (such as loading
+	// config or stopping the process), while keeping read and
+	// introspection endpoints available. Useful for hardened
+	// production instances whose config is managed exclusively
+	// by files.
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// If set, requests to the admin API must present one of
+	// these bearer tokens, each of which is scoped to allowed
+	// methods and path prefixes. For example, a CI deployment
+	// token might only be permitted to POST under the config
+	// path of a single server. Denied attempts are logged.
+	AccessTokens []AdminToken `json:"access_tokens,omitempty"`
+}
+
+// AdminToken is a bearer token that grants scoped access to
+// the admin API.
+type AdminToken struct {
+	// A name identifying this token in audit logs. Required.
+	Name string `json:"name,omitempty"`
+
+	// The secret token value, presented by clients in the
+	// Authorization header as a bearer token. Required.
+	Token string `json:"token,omitempty"`
+
+	// The HTTP methods allowed. An entry of "*" (the default
+	// if empty) allows any method.
+	Methods []string `json:"methods,omitempty"`
+
+	// The URI path prefixes allowed, for example
+	// "/config/apps/http/servers/site1". An entry of "*"
+	// (the default if empty) allows any path.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// RemoteAdmin secures the admin endpoint with TLS and client
+// certificate authentication, optionally restricting what each
+// client identity may do.
+type RemoteAdmin struct {
+	// The path to the PEM-encoded certificate the admin
+	// endpoint presents to clients. Required.
+	Certificate string `json:"certificate,omitempty"`
+
+	// The path to the PEM-encoded private key for the
+	// certificate. Required.
+	Key string `json:"key,omitempty"`
+
+	// Paths to PEM-encoded CA certificates used to verify
+	// client certificates. Clients must present a valid
+	// certificate signed by one of these CAs. Required.
+	ClientCAs []string `json:"client_cas,omitempty"`
+
+	// What each client identity (certificate subject common
+	// name) is permitted to do. If empty, every verified
+	// client has full access; if set, clients whose identity
+	// matches no entry are denied.
+	Permissions []AdminPermission `json:"permissions,omitempty"`
+}
+
+// AdminPermission grants access to parts of the admin API for
+// certain client identities.
+type AdminPermission struct {
+	// The client certificate subject common names this
+	// permission applies to. An entry of "*" matches any
+	// identity.
+	Identities []string `json:"identities,omitempty"`
+
+	// The HTTP methods allowed. An entry of "*" (the default
+	// if empty) allows any method.
+	Methods []string `json:"methods,omitempty"`
+
+	// The URI path prefixes allowed, for example "/config/".
+	// An entry of "*" (the default if empty) allows any path.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// tlsConfig builds the TLS configuration for the admin listener.
+func (remote *RemoteAdmin) tlsConfig() (*tls.Config, error) {
+	if remote.Certificate == "" || remote.Key == "" {
+		return nil, fmt.Errorf("remote admin requires a certificate and key")
+	}
+	if len(remote.ClientCAs) == 0 {
+		return nil, fmt.Errorf("remote admin requires at least one client CA")
+	}
+	cert, err := tls.LoadX509KeyPair(remote.Certificate, remote.Key)
+	if err != nil {
+		return nil, fmt.Errorf("loading admin certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	for _, caFile := range remote.ClientCAs {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", caFile)
+		}
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// allowed returns true if the client with the given identity
+// may perform the request.
+func (remote *RemoteAdmin) allowed(identity string, r *http.Request) bool {
+	if len(remote.Permissions) == 0 {
+		return true
+	}
+	for _, perm := range remote.Permissions {
+		if !matchAdminList(perm.Identities, identity, false) {
+			continue
+		}
+		if !matchAdminList(perm.Methods, r.Method, false) {
+			continue
+		}
+		if !matchAdminList(perm.Paths, r.URL.Path, true) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// matchAdminList returns true if val matches any entry of list
+// ("*" matches anything, and an empty list allows everything);
+// if prefix is true, entries match as prefixes of val.
+func matchAdminList(list []string, val string, prefix bool) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, entry := range list {
+		if entry == "*" || entry == val {
+			return true
+		}
+		if prefix && strings.HasPrefix(val, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapAdminHandler layers the configured access controls over
+// the admin handler: read-only enforcement innermost, then
+// access tokens, then remote client-certificate permissions
+// outermost, so that every path to the mux passes through each
+// configured layer no matter how the request authenticated.
+func (admin AdminConfig) wrapAdminHandler(handler http.Handler) (http.Handler, error) {
+	srvHandler := handler
+	if admin.ReadOnly {
+		srvHandler = readOnlyAdminHandler{inner: srvHandler}
+	}
+	if len(admin.AccessTokens) > 0 {
+		for _, token := range admin.AccessTokens {
+			if token.Name == "" || token.Token == "" {
+				return nil, fmt.Errorf("admin access tokens require both a name and a token value")
+			}
+		}
+		srvHandler = tokenAdminHandler{tokens: admin.AccessTokens, inner: srvHandler}
+	}
+	if admin.Remote != nil {
+		srvHandler = remoteAdminHandler{remote: admin.Remote, inner: srvHandler}
+	}
+	return srvHandler, nil
+}
+
+// readOnlyAdminHandler rejects requests that could mutate
+// configuration or process state, leaving only read and
+// introspection endpoints usable.
+type readOnlyAdminHandler struct {
+	inner http.Handler
+}
+
+func (h readOnlyAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		h.inner.ServeHTTP(w, r)
+	default:
+		Log().Named("admin").Warn("mutation rejected: admin endpoint is read-only",
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("method", r.Method),
+			zap.String("uri", r.RequestURI))
+		http.Error(w, "admin endpoint is read-only", http.StatusForbidden)
+	}
+}
+
+// tokenAdminHandler authenticates requests with the configured
+// access tokens and enforces their scopes, logging denials for
+// auditing.
+type tokenAdminHandler struct {
+	tokens []AdminToken
+	inner  http.Handler
+}
+
+func (h tokenAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := Log().Named("admin.auth")
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		logger.Warn("request denied: no bearer token",
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("method", r.Method),
+			zap.String("uri", r.RequestURI))
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "access token required", http.StatusUnauthorized)
+		return
+	}
+	presented := auth[len("Bearer "):]
+
+	for _, token := range h.tokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token.Token)) != 1 {
+			continue
+		}
+		if matchAdminList(token.Methods, r.Method, false) &&
+			matchAdminList(token.Paths, r.URL.Path, true) {
+			ctx := context.WithValue(r.Context(), adminIdentityCtxKey, "token:"+token.Name)
+			h.inner.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		logger.Warn("request denied: token not permitted",
+			zap.String("token", token.Name),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("method", r.Method),
+			zap.String("uri", r.RequestURI))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	logger.Warn("request denied: unrecognized token",
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("method", r.Method),
+		zap.String("uri", r.RequestURI))
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "invalid access token", http.StatusUnauthorized)
+}
+
+// remoteAdminHandler enforces client certificate identity
+// permissions before passing requests to the admin mux.
+type remoteAdminHandler struct {
+	remote *RemoteAdmin
+	inner  http.Handler
+}
+
+func (h remoteAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		// shouldn't happen with required client certs, but
+		// don't take any chances
+		http.Error(w, "client certificate required", http.StatusForbidden)
+		return
+	}
+	identity := r.TLS.PeerCertificates[0].Subject.CommonName
+	if !h.remote.allowed(identity, r) {
+		Log().Named("admin.remote").Warn("request denied",
+			zap.String("identity", identity),
+			zap.String("method", r.Method),
+			zap.String("uri", r.RequestURI))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	ctx := context.WithValue(r.Context(), adminIdentityCtxKey, "cert:"+identity)
+	h.inner.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// adminIdentityCtxKey is the request context key under which the
+// authenticated identity of an admin API request, if any, is stored.
+const adminIdentityCtxKey CtxKey = "admin_identity"
+
+// AdminRequestActor returns a string describing who is making the
+// given admin API request, suitable for audit logging: the remote
+// address, plus the authenticated identity if there is one.
+func AdminRequestActor(r *http.Request) string {
+	actor := r.RemoteAddr
+	if identity, ok := r.Context().Value(adminIdentityCtxKey).(string); ok && identity != "" {
+		actor += " (" + identity + ")"
+	}
+	return actor
+}
+
+// auditConfigChange records a config mutation attempt to the audit
+// logger, including who made it, what part of the config it touched,
+// and (on success) the affected subtree before and after the change.
+func auditConfigChange(actor, method, path string, before, after []byte, err error) {
+	if actor == "" {
+		actor = "internal"
+	}
+	fields := []zap.Field{
+		zap.String("actor", actor),
+		zap.String("method", method),
+		zap.String("path", path),
+	}
+	logger := Log().Named("admin.audit")
+	if err != nil {
+		logger.Error("config change failed", append(fields, zap.Error(err))...)
+		return
+	}
+	fields = append(fields,
+		zap.Reflect("before", rawJSONOrNull(before)),
+		zap.Reflect("after", rawJSONOrNull(after)),
+	)
+	logger.Info("config changed", fields...)
+}
+
+// rawJSONOrNull returns b as raw JSON for embedding in a log entry,
+// or JSON null if b is empty (e.g. the path did not exist).
+func rawJSONOrNull(b []byte) json.RawMessage {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(b)
 }
 
 // ConfigSettings configures the, uh, configuration... and
@@ -79,6 +411,41 @@ type AdminConfig struct {
 type ConfigSettings struct {
 	// Whether to keep a copy of the active config on disk. Default is true.
 	Persist *bool `json:"persist,omitempty"`
+
+	// How many replaced configs to keep on disk for rollbacks.
+	// Default: 10.
+	MaxHistory int `json:"max_history,omitempty"`
+
+	// How long to watch a newly-applied config before declaring
+	// it good. If any of the health checks fail for the whole
+	// window, the previous config is automatically restored.
+	// Default: no monitoring.
+	GraceWindow Duration `json:"grace_window,omitempty"`
+
+	// URLs that must respond with a status below 400 for a
+	// newly-applied config to be considered healthy. Only used
+	// if a grace window is configured.
+	HealthChecks []string `json:"health_checks,omitempty"`
+
+	// A module that can load the config from elsewhere, such as
+	// an HTTP endpoint. It is invoked once the config that set
+	// it up is running and, if a load interval is configured,
+	// re-polled for changes, which are applied through the
+	// normal load path. This enables centralized distribution
+	// of config from a bootstrap config.
+	LoadRaw json.RawMessage `json:"load,omitempty" caddy:"namespace=caddy.config_loaders inline_key=module"`
+
+	// How often to re-poll the config source for changes.
+	// Default: the config is only loaded once.
+	LoadInterval Duration `json:"load_interval,omitempty"`
+
+	// Whether to require an If-Match precondition on requests
+	// that mutate the config. With this enabled, clients must
+	// GET the part of the config they want to change and present
+	// the response's ETag with their mutation, so concurrent
+	// automation tools can't silently clobber each other's
+	// changes.
+	RequireIfMatch bool `json:"require_if_match,omitempty"`
 }
 
 // listenAddr extracts a singular listen address from ac.Listen,
@@ -139,8 +506,17 @@ func (admin AdminConfig) newAdminHandler(addr NetworkAddress) adminHandler {
 	// register standard config control endpoints
 	addRoute("/"+rawConfigKey+"/", handlerLabel, AdminHandlerFunc(handleConfig))
 	addRoute("/id/", handlerLabel, AdminHandlerFunc(handleConfigID))
+	addRoute("/"+rawConfigKey+"/batch", handlerLabel, AdminHandlerFunc(handleConfigBatch))
+	addRoute("/"+rawConfigKey+"/history", handlerLabel, AdminHandlerFunc(handleConfigHistory))
+	addRoute("/"+rawConfigKey+"/rollback/", handlerLabel, AdminHandlerFunc(handleConfigRollback))
+	addRoute("/schema", handlerLabel, AdminHandlerFunc(handleSchema))
 	addRoute("/stop", handlerLabel, AdminHandlerFunc(handleStop))
 
+	// register process health and status endpoints
+	addRoute("/healthz", handlerLabel, AdminHandlerFunc(handleHealthz))
+	addRoute("/readyz", handlerLabel, AdminHandlerFunc(handleReadyz))
+	addRoute("/status", handlerLabel, AdminHandlerFunc(handleStatus))
+
 	// register debugging endpoints
 	addRouteWithMetrics("/debug/pprof/", handlerLabel, http.HandlerFunc(pprof.Index))
 	addRouteWithMetrics("/debug/pprof/cmdline", handlerLabel, http.HandlerFunc(pprof.Cmdline))
@@ -248,8 +624,22 @@ func replaceAdmin(cfg *Config) error {
 		return err
 	}
 
+	srvHandler, err := adminConfig.wrapAdminHandler(handler)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	if adminConfig.Remote != nil {
+		tlsCfg, err := adminConfig.Remote.tlsConfig()
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("setting up remote admin endpoint: %v", err)
+		}
+		ln = tls.NewListener(ln, tlsCfg)
+	}
+
 	adminServer = &http.Server{
-		Handler:           handler,
+		Handler:           srvHandler,
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
 		IdleTimeout:       60 * time.Second,
@@ -268,7 +658,9 @@ func replaceAdmin(cfg *Config) error {
 		zap.Bool("enforce_origin", adminConfig.EnforceOrigin),
 		zap.Strings("origins", handler.allowedOrigins))
 
-	if !handler.enforceHost {
+	if adminConfig.Remote != nil {
+		adminLogger.Info("admin endpoint secured with TLS and client certificates")
+	} else if !handler.enforceHost {
 		adminLogger.Warn("admin endpoint on open interface; host checking disabled",
 			zap.String("address", addr.String()))
 	}
@@ -478,11 +870,20 @@ func handleConfig(w http.ResponseWriter, r *http.Request) error {
 	case http.MethodGet:
 		w.Header().Set("Content-Type", "application/json")
 
-		err := readConfig(r.URL.Path, w)
+		// buffer the response so a strong ETag can be computed
+		// from it before any of it is written to the client
+		buf := bufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer bufPool.Put(buf)
+
+		err := readConfig(r.URL.Path, buf)
 		if err != nil {
 			return APIError{Code: http.StatusBadRequest, Err: err}
 		}
 
+		w.Header().Set("Etag", makeEtag(r.URL.Path, buf.Bytes()))
+		_, _ = w.Write(buf.Bytes())
+
 		return nil
 
 	case http.MethodPost,
@@ -514,9 +915,16 @@ func handleConfig(w http.ResponseWriter, r *http.Request) error {
 			body = buf.Bytes()
 		}
 
+		// honor the If-Match precondition, if the client gave one
+		// or strict concurrency control is enabled
+		err := checkIfMatch(r)
+		if err != nil {
+			return err
+		}
+
 		forceReload := r.Header.Get("Cache-Control") == "must-revalidate"
 
-		err := changeConfig(r.Method, r.URL.Path, body, forceReload)
+		err = changeConfig(r.Method, r.URL.Path, body, AdminRequestActor(r), forceReload)
 		if err != nil {
 			return err
 		}
@@ -531,6 +939,101 @@ func handleConfig(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// handleConfigBatch applies a batch of config operations
+// atomically: either all of them succeed and the resulting
+// config is loaded, or none of them take effect.
+func handleConfigBatch(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+	if ct := r.Header.Get("Content-Type"); !strings.Contains(ct, "/json") {
+		return APIError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("unacceptable content-type: %v; 'application/json' required", ct),
+		}
+	}
+
+	var ops []ConfigOp
+	err := json.NewDecoder(r.Body).Decode(&ops)
+	if err != nil {
+		return APIError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("decoding operations: %v", err),
+		}
+	}
+
+	// honor the If-Match precondition, if the client gave one
+	// or strict concurrency control is enabled
+	err = checkIfMatch(r)
+	if err != nil {
+		return err
+	}
+
+	forceReload := r.Header.Get("Cache-Control") == "must-revalidate"
+
+	return changeConfigBatch(ops, AdminRequestActor(r), forceReload)
+}
+
+// makeEtag returns a strong ETag covering the config subtree at
+// path with the given JSON encoding. The path is part of the tag
+// so that a tag obtained from one part of the config cannot
+// satisfy a precondition on another.
+func makeEtag(path string, contents []byte) string {
+	return fmt.Sprintf(`"%s %x"`, path, sha256.Sum256(contents))
+}
+
+// checkIfMatch enforces the If-Match precondition on a mutating
+// config request: the ETag presented by the client must still
+// describe the part of the config it was obtained from. Without
+// an If-Match header, the request is allowed through unless the
+// config settings require the precondition.
+func checkIfMatch(r *http.Request) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		currentCfgMu.RLock()
+		required := historySettings().RequireIfMatch
+		currentCfgMu.RUnlock()
+		if !required {
+			return nil
+		}
+		return APIError{
+			Code: http.StatusPreconditionRequired,
+			Err:  fmt.Errorf("If-Match header required for config changes"),
+		}
+	}
+
+	// a valid ETag from us is quoted and has two parts: a config
+	// path and a hash of the contents at that path
+	parts := strings.Fields(strings.Trim(ifMatch, `"`))
+	if len(parts) != 2 {
+		return APIError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("malformed If-Match header"),
+		}
+	}
+
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufPool.Put(buf)
+
+	err := readConfig(parts[0], buf)
+	if err != nil {
+		return APIError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if makeEtag(parts[0], buf.Bytes()) != ifMatch {
+		return APIError{
+			Code: http.StatusPreconditionFailed,
+			Err:  fmt.Errorf("config changed since last read"),
+		}
+	}
+
+	return nil
+}
+
 func handleConfigID(w http.ResponseWriter, r *http.Request) error {
 	idPath := r.URL.Path
 
@@ -559,6 +1062,8 @@ func handleConfigID(w http.ResponseWriter, r *http.Request) error {
 }
 
 func handleStop(w http.ResponseWriter, r *http.Request) error {
+	setShuttingDown()
+	notifyStopping()
 	err := handleUnload(w, r)
 	if err != nil {
 		Log().Named("admin.api").Error("unload error", zap.Error(err))
@@ -15,7 +15,12 @@
 package caddy
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 )
@@ -130,3 +135,68 @@ func BenchmarkLoad(b *testing.B) {
 		Load(cfg, true)
 	}
 }
+
+func TestAdminAccessControlComposition(t *testing.T) {
+	// the access control layers must compose so that remote
+	// client-certificate auth cannot bypass access tokens or
+	// read-only enforcement
+	var muxHits int
+	mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		muxHits++
+	})
+
+	admin := AdminConfig{
+		ReadOnly:     true,
+		AccessTokens: []AdminToken{{Name: "ci", Token: "secret"}},
+		Remote:       &RemoteAdmin{},
+	}
+	handler, err := admin.wrapAdminHandler(mux)
+	if err != nil {
+		t.Fatalf("wrapping admin handler: %v", err)
+	}
+
+	makeReq := func(method, token string, withCert bool) *http.Request {
+		r := httptest.NewRequest(method, "/config/", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if withCert {
+			r.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{
+					{Subject: pkix.Name{CommonName: "deployer"}},
+				},
+			}
+		}
+		return r
+	}
+
+	for i, tc := range []struct {
+		method     string
+		token      string
+		withCert   bool
+		wantStatus int
+	}{
+		// no client certificate: rejected by the remote layer
+		{method: "GET", token: "secret", withCert: false, wantStatus: http.StatusForbidden},
+		// valid certificate but no token: rejected by the token layer
+		{method: "GET", token: "", withCert: true, wantStatus: http.StatusUnauthorized},
+		// valid certificate but wrong token
+		{method: "GET", token: "wrong", withCert: true, wantStatus: http.StatusUnauthorized},
+		// certificate and token, read request: allowed
+		{method: "GET", token: "secret", withCert: true, wantStatus: http.StatusOK},
+		// certificate and token, mutation: rejected by the read-only layer
+		{method: "POST", token: "secret", withCert: true, wantStatus: http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, makeReq(tc.method, tc.token, tc.withCert))
+		if w.Code != tc.wantStatus {
+			t.Errorf("Test %d: %s with token '%s' (cert: %v): expected status %d but got %d",
+				i, tc.method, tc.token, tc.withCert, tc.wantStatus, w.Code)
+		}
+	}
+
+	// only the authorized read request should have reached the mux
+	if muxHits != 1 {
+		t.Errorf("Expected exactly 1 request to reach the mux, got %d", muxHits)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -58,6 +59,11 @@ import (
 // care to populate the JSON-encodable fields of the struct (i.e. the fields
 // with `json` struct tags) if employing the module lifecycle (e.g. Provision
 // method calls).
+//
+// Configs are decoded strictly: unrecognized keys anywhere in the
+// document (including within module configs) are rejected with an
+// error rather than silently ignored, so typos cannot quietly
+// disable the setting they were meant to configure.
 type Config struct {
 	Admin   *AdminConfig `json:"admin,omitempty"`
 	Logging *Logging     `json:"logging,omitempty"`
@@ -69,17 +75,33 @@ type Config struct {
 	// [depends on the OS and environment](/docs/conventions#data-directory).
 	StorageRaw json.RawMessage `json:"storage,omitempty" caddy:"namespace=caddy.storage inline_key=module"`
 
+	// PlaceholdersRaw configures placeholder provider modules,
+	// which make new global placeholders available to every
+	// replacer while this config is running. The module name
+	// is the key.
+	PlaceholdersRaw ModuleMap `json:"placeholders,omitempty" caddy:"namespace=caddy.placeholders"`
+
 	// AppsRaw are the apps that Caddy will load and run. The
 	// app module name is the key, and the app's config is the
 	// associated value.
 	AppsRaw ModuleMap `json:"apps,omitempty" caddy:"namespace="`
 
-	apps    map[string]App
-	storage certmagic.Storage
+	apps         map[string]App
+	storage      certmagic.Storage
+	placeholders []PlaceholderProvider
+	configLoader ConfigLoader
 
 	cancelFunc context.CancelFunc
 }
 
+// ConfigLoader is a type that can load a Caddy config, e.g.
+// from a remote source for centralized config distribution.
+// A nil config with a nil error means the source has not
+// changed since the last load.
+type ConfigLoader interface {
+	LoadConfig(Context) ([]byte, error)
+}
+
 // App is a thing that Caddy runs.
 type App interface {
 	Start() error
@@ -99,7 +121,14 @@ func Run(cfg *Config) error {
 // if it is different from the current config or
 // forceReload is true.
 func Load(cfgJSON []byte, forceReload bool) error {
-	return changeConfig(http.MethodPost, "/"+rawConfigKey, cfgJSON, forceReload)
+	return changeConfig(http.MethodPost, "/"+rawConfigKey, cfgJSON, "", forceReload)
+}
+
+// LoadWithActor is like Load, but attributes the config change to
+// actor in the audit log; for example, the remote address and
+// authenticated identity of an admin API request.
+func LoadWithActor(cfgJSON []byte, forceReload bool, actor string) error {
+	return changeConfig(http.MethodPost, "/"+rawConfigKey, cfgJSON, actor, forceReload)
 }
 
 // changeConfig changes the current config (rawCfg) according to the
@@ -107,8 +136,9 @@ func Load(cfgJSON []byte, forceReload bool) error {
 // the new value (if applicable; i.e. "DELETE" doesn't have an input).
 // If the resulting config is the same as the previous, no reload will
 // occur unless forceReload is true. This function is safe for
-// concurrent use.
-func changeConfig(method, path string, input []byte, forceReload bool) error {
+// concurrent use. Every attempt, successful or not, is recorded
+// in the config audit log along with the actor it came from.
+func changeConfig(method, path string, input []byte, actor string, forceReload bool) (err error) {
 	switch method {
 	case http.MethodGet,
 		http.MethodHead,
@@ -121,11 +151,117 @@ func changeConfig(method, path string, input []byte, forceReload bool) error {
 	currentCfgMu.Lock()
 	defer currentCfgMu.Unlock()
 
-	err := unsyncedConfigAccess(method, path, input, nil)
+	// capture the affected part of the config before and after the
+	// mutation so the audit log can include a meaningful diff
+	var before, after bytes.Buffer
+	_ = unsyncedConfigAccess(http.MethodGet, path, nil, &before)
+	defer func() {
+		_ = unsyncedConfigAccess(http.MethodGet, path, nil, &after)
+		auditConfigChange(actor, method, path, before.Bytes(), after.Bytes(), err)
+	}()
+
+	err = unsyncedConfigAccess(method, path, input, nil)
 	if err != nil {
 		return err
 	}
 
+	return unsyncedApplyConfig(forceReload)
+}
+
+// changeConfigBatch applies a batch of operations to the current
+// config atomically: either every operation succeeds and the
+// resulting config is run, or none of them take effect. This
+// function is safe for concurrent use.
+func changeConfigBatch(ops []ConfigOp, actor string, forceReload bool) (err error) {
+	if len(ops) == 0 {
+		return fmt.Errorf("no operations")
+	}
+
+	currentCfgMu.Lock()
+	defer currentCfgMu.Unlock()
+
+	// the batch can touch anything, so audit the whole config
+	var before, after bytes.Buffer
+	_ = unsyncedConfigAccess(http.MethodGet, "/"+rawConfigKey, nil, &before)
+	defer func() {
+		_ = unsyncedConfigAccess(http.MethodGet, "/"+rawConfigKey, nil, &after)
+		auditConfigChange(actor, "BATCH", "/"+rawConfigKey, before.Bytes(), after.Bytes(), err)
+	}()
+
+	for i, op := range ops {
+		method, err2 := op.method()
+		if err2 == nil {
+			err2 = unsyncedConfigAccess(method, op.Path, op.Value, nil)
+		}
+		if err2 != nil {
+			// roll back the in-memory raw config so the earlier
+			// operations of this batch don't take effect either
+			unsyncedRestoreRawCfg()
+			return APIError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("operation %d (%s %s): %v", i, op.Op, op.Path, err2),
+			}
+		}
+	}
+
+	return unsyncedApplyConfig(forceReload)
+}
+
+// ConfigOp is a single operation of a batch config change. It is
+// styled after JSON Patch operations, mapped onto the methods of
+// the config API.
+type ConfigOp struct {
+	// The operation to perform: "set", "add", "replace", or
+	// "remove", corresponding to the POST, PUT, PATCH, and
+	// DELETE methods of the config API, respectively.
+	Op string `json:"op"`
+
+	// The config path to apply the operation to, in the same
+	// form the config API uses (e.g. "/config/apps/http").
+	Path string `json:"path"`
+
+	// The new value, for all operations except "remove".
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// method returns the config API method equivalent to op.
+func (op ConfigOp) method() (string, error) {
+	switch op.Op {
+	case "set":
+		return http.MethodPost, nil
+	case "add":
+		return http.MethodPut, nil
+	case "replace":
+		return http.MethodPatch, nil
+	case "remove":
+		return http.MethodDelete, nil
+	}
+	return "", fmt.Errorf("unrecognized op '%s'", op.Op)
+}
+
+// unsyncedRestoreRawCfg reverts the in-memory raw config to the
+// config that is actually running, discarding any mutations that
+// have not been applied. A write lock on currentCfgMu is required.
+func unsyncedRestoreRawCfg() {
+	if len(rawCfgJSON) == 0 {
+		rawCfg[rawConfigKey] = nil
+		return
+	}
+	// we need to unmarshal it again because it's likely that
+	// pointers deep in our rawCfg map were modified
+	var oldCfg interface{}
+	if err := json.Unmarshal(rawCfgJSON, &oldCfg); err != nil {
+		Log().Error("restoring old config", zap.Error(err))
+		return
+	}
+	rawCfg[rawConfigKey] = oldCfg
+}
+
+// unsyncedApplyConfig encodes the mutated raw config and runs it,
+// reverting the raw config if it fails. It is the common tail of
+// changeConfig and changeConfigBatch; a write lock on currentCfgMu
+// is required.
+func unsyncedApplyConfig(forceReload bool) error {
 	// the mutation is complete, so encode the entire config as JSON
 	newCfg, err := json.Marshal(rawCfg[rawConfigKey])
 	if err != nil {
@@ -171,11 +307,25 @@ func changeConfig(method, path string, input []byte, forceReload bool) error {
 		return fmt.Errorf("loading new config: %v", err)
 	}
 
-	// success, so update our stored copy of the encoded
-	// config to keep it consistent with what caddy is now
-	// running (storing an encoded copy is not strictly
-	// necessary, but avoids an extra json.Marshal for
-	// each config change)
+	// success; keep the outgoing config in the on-disk history
+	// so it can be rolled back to, and if a grace window with
+	// health checks is configured, watch the new config and
+	// restore the old one if the checks don't pass in time
+	configGeneration++
+	settings := historySettings()
+	if len(rawCfgJSON) > 0 {
+		saveConfigVersion(rawCfgJSON, settings.MaxHistory)
+		if settings.GraceWindow > 0 && len(settings.HealthChecks) > 0 {
+			prevCfg := append([]byte(nil), rawCfgJSON...)
+			go monitorNewConfig(configGeneration, prevCfg,
+				time.Duration(settings.GraceWindow), settings.HealthChecks)
+		}
+	}
+
+	// update our stored copy of the encoded config to keep it
+	// consistent with what caddy is now running (storing an
+	// encoded copy is not strictly necessary, but avoids an
+	// extra json.Marshal for each config change)
 	rawCfgJSON = newCfg
 	rawCfgIndex = idx
 
@@ -239,12 +389,27 @@ func unsyncedDecodeAndRun(cfgJSON []byte) error {
 	// loading to break since the field wouldn't be recognized
 	strippedCfgJSON := RemoveMetaFields(cfgJSON)
 
+	// resolve load-time placeholders (like {env.*} and {file.*})
+	// only in the copy we are about to decode, so the resolved
+	// values end up in the running config but never in the stored
+	// or autosaved JSON
+	strippedCfgJSON, err := resolveConfigSources(strippedCfgJSON)
+	if err != nil {
+		return fmt.Errorf("resolving config source placeholders: %v", err)
+	}
+
 	var newCfg *Config
-	err := strictUnmarshalJSON(strippedCfgJSON, &newCfg)
+	err = strictUnmarshalJSON(strippedCfgJSON, &newCfg)
 	if err != nil {
 		return err
 	}
 
+	// let the service manager know we are replacing the running
+	// config; a new READY notification follows once it is applied
+	if currentCfg != nil && newCfg != nil {
+		notifyReloading()
+	}
+
 	// run the new config and start all its apps
 	err = run(newCfg, true)
 	if err != nil {
@@ -280,6 +445,32 @@ func unsyncedDecodeAndRun(cfgJSON []byte) error {
 					zap.Error(err))
 			}
 		}
+
+		// if a storage module was explicitly configured, keep a
+		// copy of the config there too, so API-driven config can
+		// outlive the local file system and be inspected by other
+		// instances sharing the storage
+		if newCfg.StorageRaw != nil && newCfg.storage != nil {
+			err := newCfg.storage.Store(ConfigAutosaveStorageKey, cfgJSON)
+			if err == nil {
+				Log().Info("autosaved config to storage",
+					zap.String("key", ConfigAutosaveStorageKey))
+			} else {
+				Log().Error("unable to autosave config to storage",
+					zap.String("key", ConfigAutosaveStorageKey),
+					zap.Error(err))
+			}
+		}
+	}
+
+	// emit a structured report of what actually started, so
+	// operators can verify it at a glance; the same report is
+	// available from the admin endpoint at /status
+	if newCfg != nil {
+		report := unsyncedStatus(currentCfg)
+		Log().Info("startup report",
+			zap.String("admin", report.Admin),
+			zap.Any("apps", report.Apps))
 	}
 
 	return nil
@@ -315,9 +506,15 @@ func run(newCfg *Config, start bool) error {
 		if err != nil {
 			return fmt.Errorf("starting caddy administration endpoint: %v", err)
 		}
+		err = replaceHealthServer(newCfg)
+		if err != nil {
+			return fmt.Errorf("starting health endpoints: %v", err)
+		}
 	}
 
 	if newCfg == nil {
+		setConfigApplied(false)
+		setPlaceholderProviders(nil)
 		return nil
 	}
 
@@ -343,6 +540,9 @@ func run(newCfg *Config, start bool) error {
 			// also undo any other state changes we made
 			if currentCfg != nil {
 				certmagic.Default.Storage = currentCfg.storage
+				setPlaceholderProviders(currentCfg.placeholders)
+			} else {
+				setPlaceholderProviders(nil)
 			}
 		}
 	}()
@@ -382,6 +582,53 @@ func run(newCfg *Config, start bool) error {
 		return err
 	}
 
+	// set up the config loader, if any, which can fetch a
+	// config from elsewhere and poll the source for changes
+	err = func() error {
+		if newCfg.Admin == nil || newCfg.Admin.Config == nil || newCfg.Admin.Config.LoadRaw == nil {
+			return nil
+		}
+		val, err := ctx.LoadModule(newCfg.Admin.Config, "LoadRaw")
+		if err != nil {
+			return fmt.Errorf("loading config loader module: %v", err)
+		}
+		newCfg.configLoader = val.(ConfigLoader)
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	// load any global placeholder provider modules, which make
+	// new placeholders resolvable by every replacer while this
+	// config is running
+	err = func() error {
+		if newCfg.PlaceholdersRaw != nil {
+			vals, err := ctx.LoadModule(newCfg, "PlaceholdersRaw")
+			if err != nil {
+				return fmt.Errorf("loading placeholder provider modules: %v", err)
+			}
+			modNames := make([]string, 0, len(vals.(map[string]interface{})))
+			for modName := range vals.(map[string]interface{}) {
+				modNames = append(modNames, modName)
+			}
+			sort.Strings(modNames) // deterministic provider order
+			for _, modName := range modNames {
+				modIface := vals.(map[string]interface{})[modName]
+				prov, ok := modIface.(PlaceholderProvider)
+				if !ok {
+					return fmt.Errorf("placeholder provider module '%s' is not a PlaceholderProvider: %T", modName, modIface)
+				}
+				newCfg.placeholders = append(newCfg.placeholders, prov)
+			}
+		}
+		setPlaceholderProviders(newCfg.placeholders)
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+
 	// Load and Provision each app and their submodules
 	err = func() error {
 		for appName := range newCfg.AppsRaw {
@@ -418,10 +665,50 @@ func run(newCfg *Config, start bool) error {
 			}
 			started = append(started, name)
 		}
+
+		// with everything running, the config loader (if any)
+		// can fetch and apply a config from its source
+		if newCfg.configLoader != nil {
+			go pollConfigLoader(ctx, newCfg.configLoader,
+				time.Duration(newCfg.Admin.Config.LoadInterval))
+		}
+
+		// the process can now be considered ready
+		setConfigApplied(true)
+		notifyReady()
+
 		return nil
 	}()
 }
 
+// pollConfigLoader runs loader once right away and then, if a
+// positive interval is given, again on that interval until the
+// context is canceled (i.e. until the config that configured the
+// loader is replaced). Configs it obtains are applied through
+// the normal load path.
+func pollConfigLoader(ctx Context, loader ConfigLoader, interval time.Duration) {
+	logger := Log().Named("config_loader")
+	for {
+		cfgJSON, err := loader.LoadConfig(ctx)
+		if err != nil {
+			logger.Error("loading config from source", zap.Error(err))
+		} else if len(cfgJSON) > 0 {
+			err = LoadWithActor(cfgJSON, false, "config loader")
+			if err != nil {
+				logger.Error("applying loaded config", zap.Error(err))
+			}
+		}
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // Stop stops running the current configuration.
 // It is the antithesis of Run(). This function
 // will log any errors that occur during the
@@ -431,6 +718,7 @@ func run(newCfg *Config, start bool) error {
 func Stop() error {
 	currentCfgMu.Lock()
 	defer currentCfgMu.Unlock()
+	setConfigApplied(false)
 	unsyncedStop(currentCfg)
 	currentCfg = nil
 	rawCfgJSON = nil
@@ -595,6 +883,11 @@ var (
 	// rawCfgIndex is the map of user-assigned ID to expanded
 	// path, for converting /id/ paths to /config/ paths.
 	rawCfgIndex map[string]string
+
+	// configGeneration counts successful config changes, so
+	// delayed operations (like grace-window health monitoring)
+	// can tell whether the config they acted on is still current.
+	configGeneration int64
 )
 
 // ImportPath is the package import path for Caddy core.
@@ -38,9 +38,18 @@ type (
 		File string
 		Line int
 		Text string
+
+		wasQuoted rune // enclosing quote character, if any
 	}
 )
 
+// Quoted returns true if the token was enclosed in quotes
+// or backticks when it was lexed, which distinguishes, for
+// example, a literal string from a keyword or module name.
+func (t Token) Quoted() bool {
+	return t.wasQuoted > 0
+}
+
 // load prepares the lexer to scan an input for tokens.
 // It discards any leading byte order mark.
 func (l *lexer) load(input io.Reader) error {
@@ -153,10 +162,12 @@ func (l *lexer) next() bool {
 			l.token = Token{Line: l.line}
 			if ch == '"' {
 				quoted = true
+				l.token.wasQuoted = ch
 				continue
 			}
 			if ch == '`' {
 				btQuoted = true
+				l.token.wasQuoted = ch
 				continue
 			}
 		}
@@ -16,12 +16,20 @@ package caddyfile
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/caddyserver/caddy/v2"
 )
@@ -34,7 +42,9 @@ import (
 // pass in nil instead.
 //
 // Environment variables in {$ENVIRONMENT_VARIABLE} notation
-// will be replaced before parsing begins.
+// will be replaced before parsing begins. A default value for
+// when the variable is unset may be given after a colon, as in
+// {$ENVIRONMENT_VARIABLE:default}.
 func Parse(filename string, input []byte) ([]ServerBlock, error) {
 	tokens, err := allTokens(filename, input)
 	if err != nil {
@@ -285,8 +295,8 @@ func (p *parser) directives() error {
 }
 
 // doImport swaps out the import directive and its argument
-// (a total of 2 tokens) with the tokens in the specified file
-// or globbing pattern. When the function returns, the cursor
+// (a total of 2 tokens) with the tokens in the specified file,
+// URL, or globbing pattern. When the function returns, the cursor
 // is on the token before where the import directive was. In
 // other words, call Next() to access the first token that was
 // imported.
@@ -303,10 +313,18 @@ func (p *parser) doImport() error {
 	// grab remaining args as placeholder replacements
 	args := p.RemainingArgs()
 
-	// add args to the replacer
+	// add args to the replacer; an argument of the form name=value
+	// becomes a named argument ({args.name}), and all others are
+	// positional ({args.0}, {args.1}, ...) in the order given
 	repl := caddy.NewReplacer()
-	for index, arg := range args {
+	index := 0
+	for _, arg := range args {
+		if name, value, ok := namedImportArg(arg); ok {
+			repl.Set("args."+name, value)
+			continue
+		}
 		repl.Set("args."+strconv.Itoa(index), arg)
+		index++
 	}
 
 	// splice out the import directive and its arguments
@@ -318,6 +336,13 @@ func (p *parser) doImport() error {
 	// first check snippets. That is a simple, non-recursive replacement
 	if p.definedSnippets != nil && p.definedSnippets[importPattern] != nil {
 		importedTokens = p.definedSnippets[importPattern]
+	} else if strings.HasPrefix(importPattern, "http://") || strings.HasPrefix(importPattern, "https://") {
+		// import from a URL, so shared snippets can be centrally hosted
+		newTokens, err := p.doRemoteImport(importPattern)
+		if err != nil {
+			return err
+		}
+		importedTokens = newTokens
 	} else {
 		// make path relative to the file of the _token_ being processed rather
 		// than current working directory (issue #867) and then use glob to get
@@ -344,6 +369,11 @@ func (p *parser) doImport() error {
 		if err != nil {
 			return p.Errf("Failed to use import pattern %s: %v", importPattern, err)
 		}
+
+		// import matching files in lexical order so that globbed
+		// imports expand deterministically, regardless of how the
+		// underlying file system lists them
+		sort.Strings(matches)
 		if len(matches) == 0 {
 			if strings.ContainsAny(globPattern, "*?[]") {
 				log.Printf("[WARNING] No files matching import glob pattern: %s", importPattern)
@@ -381,6 +411,26 @@ func (p *parser) doImport() error {
 	return nil
 }
 
+// namedImportArg splits arg into a name and value if it is a named
+// import argument of the form name=value, where the name is a letter
+// or underscore followed by letters, digits, or underscores. Values
+// that merely contain an equals sign (like URLs with query strings)
+// don't qualify, so they stay positional.
+func namedImportArg(arg string) (name, value string, ok bool) {
+	eq := strings.IndexByte(arg, '=')
+	if eq < 1 {
+		return "", "", false
+	}
+	name, value = arg[:eq], arg[eq+1:]
+	for i, r := range name {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			continue
+		}
+		return "", "", false
+	}
+	return name, value, true
+}
+
 // doSingleImport lexes the individual file at importFile and returns
 // its tokens or an error, if any.
 func (p *parser) doSingleImport(importFile string) ([]Token, error) {
@@ -419,6 +469,65 @@ func (p *parser) doSingleImport(importFile string) ([]Token, error) {
 	return importedTokens, nil
 }
 
+// Remote imports are bounded in time and size so that a hung or
+// hostile import URL cannot stall every config load and adaptation
+// or balloon its memory.
+const (
+	remoteImportTimeout = 30 * time.Second
+	remoteImportMaxSize = 5 * 1024 * 1024
+)
+
+// doRemoteImport fetches the file at importURL over HTTP(S) and returns
+// its tokens or an error, if any. The URL fragment may pin the expected
+// content with a hex-encoded SHA-256 digest of the file, for example
+// #sha256=<hex>; the import fails if the content does not match.
+func (p *parser) doRemoteImport(importURL string) ([]Token, error) {
+	u, err := url.Parse(importURL)
+	if err != nil {
+		return nil, p.Errf("Invalid import URL %s: %v", importURL, err)
+	}
+
+	var pinnedSum string
+	if u.Fragment != "" {
+		if !strings.HasPrefix(u.Fragment, "sha256=") {
+			return nil, p.Errf("Unsupported checksum pin '%s' (expecting sha256=<hex>)", u.Fragment)
+		}
+		pinnedSum = strings.ToLower(strings.TrimPrefix(u.Fragment, "sha256="))
+		u.Fragment = ""
+	}
+
+	client := &http.Client{Timeout: remoteImportTimeout}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, p.Errf("Could not import %s: %v", importURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, p.Errf("Could not import %s: HTTP %d", importURL, resp.StatusCode)
+	}
+
+	input, err := ioutil.ReadAll(io.LimitReader(resp.Body, remoteImportMaxSize+1))
+	if err != nil {
+		return nil, p.Errf("Could not read imported URL %s: %v", importURL, err)
+	}
+	if len(input) > remoteImportMaxSize {
+		return nil, p.Errf("Could not import %s: response exceeds %d bytes", importURL, remoteImportMaxSize)
+	}
+
+	if pinnedSum != "" {
+		actualSum := fmt.Sprintf("%x", sha256.Sum256(input))
+		if actualSum != pinnedSum {
+			return nil, p.Errf("Import %s does not match pinned checksum: content is sha256=%s", importURL, actualSum)
+		}
+	}
+
+	importedTokens, err := allTokens(u.String(), input)
+	if err != nil {
+		return nil, p.Errf("Could not read tokens while importing %s: %v", importURL, err)
+	}
+	return importedTokens, nil
+}
+
 // directive collects tokens until the directive's scope
 // closes (either end of line or end of curly brace block).
 // It expects the currently-loaded token to be a directive
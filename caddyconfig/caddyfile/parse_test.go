@@ -16,9 +16,14 @@ package caddyfile
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -193,6 +198,11 @@ func TestParseOneAndImport(t *testing.T) {
 		{`import testdata/import_args1.txt a b`, false, []string{"a", "b"}, []int{}},
 		{`import testdata/import_args*.txt a b`, false, []string{"a"}, []int{2}},
 
+		// import with named args; positional numbering skips them,
+		// and values that merely contain '=' stay positional
+		{`import testdata/import_named_args.txt name=b a`, false, []string{"b", "a"}, []int{}},
+		{`import testdata/import_args0.txt http://localhost/?a=b`, false, []string{"http://localhost/?a=b"}, []int{}},
+
 		// test cases found by fuzzing!
 		{`import }{$"`, true, []string{}, []int{}},
 		{`import /*/*.txt`, true, []string{}, []int{}},
@@ -678,6 +688,51 @@ func TestSnippetAcrossMultipleFiles(t *testing.T) {
 	}
 }
 
+func TestImportFromURL(t *testing.T) {
+	snippet := "gzip foo\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, snippet)
+	}))
+	defer ts.Close()
+
+	p := testParser(`
+		http://example.com {
+			import ` + ts.URL + `/common.caddyfile
+		}
+	`)
+	blocks, err := p.parseAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("Expect exactly one server block. Got %d.", len(blocks))
+	}
+	if actual, expected := blocks[0].Segments[0][0].Text, "gzip"; expected != actual {
+		t.Errorf("Expected argument to be '%s' but was '%s'", expected, actual)
+	}
+
+	// a matching checksum pin should be accepted
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(snippet)))
+	p = testParser(`
+		http://example.com {
+			import ` + ts.URL + `/common.caddyfile#sha256=` + sum + `
+		}
+	`)
+	if _, err := p.parseAll(); err != nil {
+		t.Errorf("Expected pinned import to succeed, got: %v", err)
+	}
+
+	// a mismatched checksum pin should be rejected
+	p = testParser(`
+		http://example.com {
+			import ` + ts.URL + `/common.caddyfile#sha256=` + strings.Repeat("0", 64) + `
+		}
+	`)
+	if _, err := p.parseAll(); err == nil {
+		t.Error("Expected error for mismatched checksum pin, but got none")
+	}
+}
+
 func testParser(input string) parser {
 	return parser{Dispenser: NewTestDispenser(input)}
 }
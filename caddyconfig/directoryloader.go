@@ -0,0 +1,154 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyconfig
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(DirectoryLoader{})
+}
+
+// DirectoryLoader assembles a config from a directory of JSON
+// fragments, such as one file per site. The fragments are
+// deep-merged in lexical filename order: objects are merged key
+// by key, arrays are concatenated, and fragments that assign
+// conflicting values to the same field are reported as errors
+// naming the field and the file. This allows large multi-tenant
+// configs to be managed as many small files.
+type DirectoryLoader struct {
+	// The directory to read config fragments from. Every file
+	// with a .json extension is included in the merge.
+	Dir string `json:"dir,omitempty"`
+
+	// checksum of the last loaded config, so re-polls can
+	// report an unchanged config cheaply
+	lastSum [sha256.Size]byte
+}
+
+// CaddyModule returns the Caddy module information.
+func (DirectoryLoader) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.config_loaders.directory",
+		New: func() caddy.Module { return new(DirectoryLoader) },
+	}
+}
+
+// LoadConfig merges the fragments in the directory into one
+// config. A nil return value with a nil error means the merged
+// config has not changed since the last load.
+func (dl *DirectoryLoader) LoadConfig(ctx caddy.Context) ([]byte, error) {
+	infos, err := ioutil.ReadDir(dl.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged interface{}
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		fragment, err := ioutil.ReadFile(filepath.Join(dl.Dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(fragment, &decoded); err != nil {
+			return nil, fmt.Errorf("%s: %v", info.Name(), err)
+		}
+		merged, err = mergeValues(merged, decoded, "")
+		if err != nil {
+			return nil, fmt.Errorf("merging %s: %v", info.Name(), err)
+		}
+	}
+	if merged == nil {
+		return nil, fmt.Errorf("no config fragments in %s", dl.Dir)
+	}
+
+	cfgJSON, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(cfgJSON)
+	if sum == dl.lastSum {
+		return nil, nil
+	}
+	dl.lastSum = sum
+
+	return cfgJSON, nil
+}
+
+// mergeValues deep-merges src into dst and returns the result;
+// path identifies where in the config the merge is happening,
+// for error messages. Objects merge recursively, arrays append,
+// and equal scalars are tolerated, but diverging values for the
+// same field are a conflict.
+func mergeValues(dst, src interface{}, path string) (interface{}, error) {
+	if dst == nil {
+		return src, nil
+	}
+	if src == nil {
+		return dst, nil
+	}
+
+	switch dstVal := dst.(type) {
+	case map[string]interface{}:
+		srcVal, ok := src.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("conflict at %s: object vs. %T", fieldPath(path), src)
+		}
+		for key, val := range srcVal {
+			mergedVal, err := mergeValues(dstVal[key], val, path+"/"+key)
+			if err != nil {
+				return nil, err
+			}
+			dstVal[key] = mergedVal
+		}
+		return dstVal, nil
+
+	case []interface{}:
+		srcVal, ok := src.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("conflict at %s: array vs. %T", fieldPath(path), src)
+		}
+		return append(dstVal, srcVal...), nil
+	}
+
+	if !reflect.DeepEqual(dst, src) {
+		return nil, fmt.Errorf("conflict at %s: %v vs. %v", fieldPath(path), dst, src)
+	}
+	return dst, nil
+}
+
+// fieldPath renders a merge path for error messages.
+func fieldPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// Interface guard
+var _ caddy.ConfigLoader = (*DirectoryLoader)(nil)
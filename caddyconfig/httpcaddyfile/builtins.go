@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/caddyserver/caddy/v2"
@@ -38,10 +39,13 @@ func init() {
 	RegisterDirective("bind", parseBind)
 	RegisterDirective("tls", parseTLS)
 	RegisterHandlerDirective("root", parseRoot)
+	RegisterHandlerDirective("vars", parseVars)
+	RegisterHandlerDirective("uri_normalize", parseURINormalize)
 	RegisterHandlerDirective("redir", parseRedir)
 	RegisterHandlerDirective("respond", parseRespond)
 	RegisterHandlerDirective("route", parseRoute)
 	RegisterHandlerDirective("handle", parseHandle)
+	RegisterHandlerDirective("invoke", parseInvoke)
 	RegisterDirective("handle_errors", parseHandleErrors)
 	RegisterDirective("log", parseLog)
 }
@@ -441,6 +445,71 @@ func parseRoot(h Helper) (caddyhttp.MiddlewareHandler, error) {
 	return caddyhttp.VarsMiddleware{"root": root}, nil
 }
 
+// parseVars parses the vars directive. Syntax:
+//
+//     vars [<matcher>] [<name> <value>] {
+//         <name> <value>
+//     }
+//
+func parseVars(h Helper) (caddyhttp.MiddlewareHandler, error) {
+	v := make(caddyhttp.VarsMiddleware)
+	for h.Next() {
+		args := h.RemainingArgs()
+		if len(args) > 0 {
+			if len(args) != 2 {
+				return nil, h.ArgErr()
+			}
+			v[args[0]] = args[1]
+		}
+		for h.NextBlock(0) {
+			name := h.Val()
+			var value string
+			if !h.AllArgs(&value) {
+				return nil, h.ArgErr()
+			}
+			v[name] = value
+		}
+	}
+	if len(v) == 0 {
+		return nil, h.Err("expected at least one variable name-value pair")
+	}
+	return v, nil
+}
+
+// parseURINormalize parses the uri_normalize directive. Syntax:
+//
+//     uri_normalize [<matcher>] [lowercase] [reject_encoded_traversal]
+//
+func parseURINormalize(h Helper) (caddyhttp.MiddlewareHandler, error) {
+	var n caddyhttp.NormalizeURI
+	for h.Next() {
+		for _, arg := range h.RemainingArgs() {
+			switch arg {
+			case "lowercase":
+				n.LowercasePath = true
+			case "reject_encoded_traversal":
+				n.RejectEncodedTraversal = true
+			default:
+				return nil, h.Errf("unrecognized option '%s'", arg)
+			}
+		}
+	}
+	return n, nil
+}
+
+// parseInvoke parses the invoke directive. Syntax:
+//
+//     invoke [<matcher>] <name>
+//
+func parseInvoke(h Helper) (caddyhttp.MiddlewareHandler, error) {
+	i := new(caddyhttp.Invoke)
+	err := i.UnmarshalCaddyfile(h.Dispenser)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
 // parseRedir parses the redir directive. Syntax:
 //
 //     redir [<matcher>] <to> [<code>]
@@ -531,11 +600,66 @@ func parseHandle(h Helper) (caddyhttp.MiddlewareHandler, error) {
 	return ParseSegmentAsSubroute(h)
 }
 
+// parseHandleErrors parses the handle_errors directive. Syntax:
+//
+//     handle_errors [<status_codes...>] {
+//         <directives...>
+//     }
+//
+// Status codes are either exact codes (404) or classes (4xx);
+// without any, the routes apply to all errors. Inside the block,
+// the error is available via the http.error.* placeholders.
 func parseHandleErrors(h Helper) ([]ConfigValue, error) {
-	subroute, err := ParseSegmentAsSubroute(h)
+	// build a matcher expression from any status code args, and
+	// strip the args from the dispenser so the segment can still
+	// be parsed as a subroute
+	var expression string
+	if h.Next() {
+		var codes []string
+		for h.NextArg() {
+			val := h.Val()
+			if strings.HasSuffix(val, "xx") && len(val) == 3 {
+				if _, err := strconv.Atoi(val[:1]); err != nil {
+					return nil, h.Errf("bad status value '%s'", val)
+				}
+				if expression != "" {
+					expression += " || "
+				}
+				expression += fmt.Sprintf("{http.error.status_code} >= %s00 && {http.error.status_code} <= %s99", val[:1], val[:1])
+				h.Dispenser.Delete()
+				continue
+			}
+			if _, err := strconv.Atoi(val); err != nil {
+				return nil, h.Errf("bad status value '%s'", val)
+			}
+			codes = append(codes, val)
+			h.Dispenser.Delete()
+		}
+		if len(codes) > 0 {
+			if expression != "" {
+				expression += " || "
+			}
+			expression += "{http.error.status_code} in [" + strings.Join(codes, ", ") + "]"
+		}
+	}
+	h.Dispenser.Reset() // pretend the args were never there
+
+	handler, err := ParseSegmentAsSubroute(h)
 	if err != nil {
 		return nil, err
 	}
+	subroute := handler.(*caddyhttp.Subroute)
+
+	// scope the error routes to the given status codes, if any
+	if expression != "" {
+		statusMatcher := caddy.ModuleMap{
+			"expression": h.JSON(caddyhttp.MatchExpression{Expr: expression}),
+		}
+		for i := range subroute.Routes {
+			subroute.Routes[i].MatcherSetsRaw = []caddy.ModuleMap{statusMatcher}
+		}
+	}
+
 	return []ConfigValue{
 		{
 			Class: "error_route",
@@ -38,9 +38,24 @@ import (
 // can be manipulated before doing redirects.
 var directiveOrder = []string{
 	"map",
+	"vars",
+
+	// tracing wraps as much of the handler chain as possible
+	"tracing",
+
+	// body_capture comes early so it observes bodies as the
+	// client sent them and as they are returned
+	"body_capture",
+
+	// body_fields comes early too, so extracted values are
+	// available to routing and to later handlers
+	"body_fields",
+
+	"uri_normalize",
 	"root",
 
 	"header",
+	"cors",
 	"request_body",
 
 	"redir",
@@ -52,6 +67,8 @@ var directiveOrder = []string{
 
 	// middleware handlers; some wrap responses
 	"basicauth",
+	"authorize",
+	"signed_url",
 	"request_header",
 	"encode",
 	"templates",
@@ -60,8 +77,13 @@ var directiveOrder = []string{
 	"handle",
 	"handle_path",
 	"route",
+	"invoke",
 	"push",
 
+	// fetches routes for unknown hosts from a control plane,
+	// so it must come before the static responding handlers
+	"dynamic_routes",
+
 	// handlers that typically respond to requests
 	"respond",
 	"metrics",
@@ -103,7 +125,7 @@ func RegisterHandlerDirective(dir string, setupFunc UnmarshalHandlerFunc) {
 			return nil, h.ArgErr()
 		}
 
-		matcherSet, err := h.ExtractMatcherSet()
+		matcherSets, err := h.ExtractMatcherSet()
 		if err != nil {
 			return nil, err
 		}
@@ -113,7 +135,7 @@ func RegisterHandlerDirective(dir string, setupFunc UnmarshalHandlerFunc) {
 			return nil, err
 		}
 
-		return h.NewRoute(matcherSet, val), nil
+		return h.NewRoute(matcherSets, val), nil
 	})
 }
 
@@ -136,7 +158,7 @@ type Helper struct {
 	State        map[string]interface{}
 	options      map[string]interface{}
 	warnings     *[]caddyconfig.Warning
-	matcherDefs  map[string]caddy.ModuleMap
+	matcherDefs  map[string][]caddy.ModuleMap
 	parentBlock  caddyfile.ServerBlock
 	groupCounter counter
 }
@@ -171,23 +193,23 @@ func (h Helper) JSON(val interface{}) json.RawMessage {
 }
 
 // MatcherToken assumes the next argument token is (possibly) a matcher,
-// and if so, returns the matcher set along with a true value. If the next
-// token is not a matcher, nil and false is returned. Note that a true
-// value may be returned with a nil matcher set if it is a catch-all.
-func (h Helper) MatcherToken() (caddy.ModuleMap, bool, error) {
+// and if so, returns the matcher sets along with a true value. If the
+// next token is not a matcher, nil and false is returned. Note that a
+// true value may be returned with nil matcher sets if it is a catch-all.
+func (h Helper) MatcherToken() ([]caddy.ModuleMap, bool, error) {
 	if !h.NextArg() {
 		return nil, false, nil
 	}
-	return matcherSetFromMatcherToken(h.Dispenser.Token(), h.matcherDefs, h.warnings)
+	return matcherSetsFromMatcherToken(h.Dispenser.Token(), h.matcherDefs, h.warnings)
 }
 
 // ExtractMatcherSet is like MatcherToken, except this is a higher-level
-// method that returns the matcher set described by the matcher token,
+// method that returns the matcher sets described by the matcher token,
 // or nil if there is none, and deletes the matcher token from the
 // dispenser and resets it as if this look-ahead never happened. Useful
 // when wrapping a route (one or more handlers) in a user-defined matcher.
-func (h Helper) ExtractMatcherSet() (caddy.ModuleMap, error) {
-	matcherSet, hasMatcher, err := h.MatcherToken()
+func (h Helper) ExtractMatcherSet() ([]caddy.ModuleMap, error) {
+	matcherSets, hasMatcher, err := h.MatcherToken()
 	if err != nil {
 		return nil, err
 	}
@@ -200,11 +222,11 @@ func (h Helper) ExtractMatcherSet() (caddy.ModuleMap, error) {
 		h.Dispenser.Delete()
 	}
 	h.Dispenser.Reset() // pretend this lookahead never happened
-	return matcherSet, nil
+	return matcherSets, nil
 }
 
 // NewRoute returns config values relevant to creating a new HTTP route.
-func (h Helper) NewRoute(matcherSet caddy.ModuleMap,
+func (h Helper) NewRoute(matcherSets []caddy.ModuleMap,
 	handler caddyhttp.MiddlewareHandler) []ConfigValue {
 	mod, err := caddy.GetModule(caddy.GetModuleID(handler))
 	if err != nil {
@@ -215,15 +237,11 @@ func (h Helper) NewRoute(matcherSet caddy.ModuleMap,
 		})
 		return nil
 	}
-	var matcherSetsRaw []caddy.ModuleMap
-	if matcherSet != nil {
-		matcherSetsRaw = append(matcherSetsRaw, matcherSet)
-	}
 	return []ConfigValue{
 		{
 			Class: "route",
 			Value: caddyhttp.Route{
-				MatcherSetsRaw: matcherSetsRaw,
+				MatcherSetsRaw: matcherSets,
 				HandlersRaw:    []json.RawMessage{caddyconfig.JSONModuleObject(handler, "handler", mod.ID.Name(), h.warnings)},
 			},
 		},
@@ -295,7 +313,7 @@ func parseSegmentAsConfig(h Helper) ([]ConfigValue, error) {
 
 		// copy existing matcher definitions so we can augment
 		// new ones that are defined only in this scope
-		matcherDefs := make(map[string]caddy.ModuleMap, len(h.matcherDefs))
+		matcherDefs := make(map[string][]caddy.ModuleMap, len(h.matcherDefs))
 		for key, val := range h.matcherDefs {
 			matcherDefs[key] = val
 		}
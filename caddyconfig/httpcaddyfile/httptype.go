@@ -117,6 +117,37 @@ func (st ServerType) Setup(inputServerBlocks []caddyfile.ServerBlock,
 	}
 
 	for _, sb := range originalServerBlocks {
+		// wildcard labels in a site address may be referenced with the
+		// {wildcard} and {wildcard.N} shorthands, which resolve to the
+		// host label matched by the Nth wildcard (counted left-to-right)
+		// for the current request; the first site address containing a
+		// wildcard defines the label positions
+		var wildcards []string
+		for _, key := range sb.block.Keys {
+			addr, err := ParseAddress(key)
+			if err != nil {
+				continue // it will be caught when the keys are parsed
+			}
+			labels := strings.Split(addr.Host, ".")
+			for i, label := range labels {
+				if label == "*" {
+					wildcards = append(wildcards,
+						fmt.Sprintf("{http.request.host.labels.%d}", len(labels)-1-i))
+				}
+			}
+			if len(wildcards) > 0 {
+				break
+			}
+		}
+		var wildcardRepl *strings.Replacer
+		if len(wildcards) > 0 {
+			pairs := []string{"{wildcard}", wildcards[0]}
+			for i, wc := range wildcards {
+				pairs = append(pairs, fmt.Sprintf("{wildcard.%d}", i), wc)
+			}
+			wildcardRepl = strings.NewReplacer(pairs...)
+		}
+
 		for _, segment := range sb.block.Segments {
 			for i := 0; i < len(segment); i++ {
 				// simple string replacements
@@ -125,6 +156,12 @@ func (st ServerType) Setup(inputServerBlocks []caddyfile.ServerBlock,
 				for _, r := range regexpReplacements {
 					segment[i].Text = r.search.ReplaceAllString(segment[i].Text, r.replace)
 				}
+				// wildcard label replacements, which depend on the site address
+				if wildcardRepl != nil {
+					segment[i].Text = wildcardRepl.Replace(segment[i].Text)
+				} else if strings.Contains(segment[i].Text, "{wildcard") {
+					return nil, warnings, fmt.Errorf("%s:%d: {wildcard} placeholder used, but site address has no wildcard label", segment[i].File, segment[i].Line)
+				}
 			}
 		}
 
@@ -133,7 +170,7 @@ func (st ServerType) Setup(inputServerBlocks []caddyfile.ServerBlock,
 		}
 
 		// extract matcher definitions
-		matcherDefs := make(map[string]caddy.ModuleMap)
+		matcherDefs := make(map[string][]caddy.ModuleMap)
 		for _, segment := range sb.block.Segments {
 			if dir := segment.Directive(); strings.HasPrefix(dir, matcherPrefix) {
 				d := sb.block.DispenseDirective(dir)
@@ -991,11 +1028,11 @@ func consolidateRoutes(routes caddyhttp.RouteList) caddyhttp.RouteList {
 	return routes
 }
 
-func matcherSetFromMatcherToken(
+func matcherSetsFromMatcherToken(
 	tkn caddyfile.Token,
-	matcherDefs map[string]caddy.ModuleMap,
+	matcherDefs map[string][]caddy.ModuleMap,
 	warnings *[]caddyconfig.Warning,
-) (caddy.ModuleMap, bool, error) {
+) ([]caddy.ModuleMap, bool, error) {
 	// matcher tokens can be wildcards, simple path matchers,
 	// or refer to a pre-defined matcher by some name
 	if tkn.Text == "*" {
@@ -1003,11 +1040,14 @@ func matcherSetFromMatcherToken(
 		return nil, true, nil
 	} else if strings.HasPrefix(tkn.Text, "/") {
 		// convenient way to specify a single path match
-		return caddy.ModuleMap{
-			"path": caddyconfig.JSON(caddyhttp.MatchPath{tkn.Text}, warnings),
+		return []caddy.ModuleMap{
+			{
+				"path": caddyconfig.JSON(caddyhttp.MatchPath{tkn.Text}, warnings),
+			},
 		}, true, nil
 	} else if strings.HasPrefix(tkn.Text, matcherPrefix) {
-		// pre-defined matcher
+		// pre-defined matcher; it may consist of multiple
+		// matcher sets, which are OR'ed together
 		m, ok := matcherDefs[tkn.Text]
 		if !ok {
 			return nil, false, fmt.Errorf("unrecognized matcher name: %+v", tkn.Text)
@@ -1102,25 +1142,19 @@ func (st *ServerType) compileEncodedMatcherSets(sblock serverBlock) ([]caddy.Mod
 	return matcherSetsEnc, nil
 }
 
-func parseMatcherDefinitions(d *caddyfile.Dispenser, matchers map[string]caddy.ModuleMap) error {
+// parseMatcherDefinitions parses named matcher definitions into
+// matchers. The same name may be defined more than once; each
+// definition becomes its own matcher set, and a request matches
+// the name if any one of its sets matches, exactly like a route's
+// "match" list in the JSON config.
+func parseMatcherDefinitions(d *caddyfile.Dispenser, matchers map[string][]caddy.ModuleMap) error {
 	for d.Next() {
 		definitionName := d.Val()
+		matcherSet := make(caddy.ModuleMap)
 
-		if _, ok := matchers[definitionName]; ok {
-			return fmt.Errorf("matcher is defined more than once: %s", definitionName)
-		}
-		matchers[definitionName] = make(caddy.ModuleMap)
-
-		// in case there are multiple instances of the same matcher, concatenate
-		// their tokens (we expect that UnmarshalCaddyfile should be able to
-		// handle more than one segment); otherwise, we'd overwrite other
-		// instances of the matcher in this set
-		tokensByMatcherName := make(map[string][]caddyfile.Token)
-		for nesting := d.Nesting(); d.NextArg() || d.NextBlock(nesting); {
-			matcherName := d.Val()
-			tokensByMatcherName[matcherName] = append(tokensByMatcherName[matcherName], d.NextSegment()...)
-		}
-		for matcherName, tokens := range tokensByMatcherName {
+		// parse tokens as the given matcher module and
+		// add the result to this definition's matcher set
+		makeMatcher := func(matcherName string, tokens []caddyfile.Token) error {
 			mod, err := caddy.GetModule("http.matchers." + matcherName)
 			if err != nil {
 				return fmt.Errorf("getting matcher module '%s': %v", matcherName, err)
@@ -1137,8 +1171,48 @@ func parseMatcherDefinitions(d *caddyfile.Dispenser, matchers map[string]caddy.M
 			if !ok {
 				return fmt.Errorf("matcher module '%s' is not a request matcher", matcherName)
 			}
-			matchers[definitionName][matcherName] = caddyconfig.JSON(rm, nil)
+			matcherSet[matcherName] = caddyconfig.JSON(rm, nil)
+			return nil
+		}
+
+		// if the next token is quoted, we can assume it's not a matcher
+		// name and that it's probably a CEL expression
+		if d.NextArg() {
+			if d.Token().Quoted() {
+				// the token lacks the matcher name, so
+				// put one in front of the expression
+				err := makeMatcher("expression", []caddyfile.Token{
+					{Text: "expression", File: d.File(), Line: d.Line()},
+					d.Token(),
+				})
+				if err != nil {
+					return err
+				}
+				matchers[definitionName] = append(matchers[definitionName], matcherSet)
+				continue
+			}
+
+			// if it wasn't quoted, then we need to rewind after calling
+			// d.NextArg() so the below properly grabs the matcher name
+			d.Prev()
+		}
+
+		// in case there are multiple instances of the same matcher, concatenate
+		// their tokens (we expect that UnmarshalCaddyfile should be able to
+		// handle more than one segment); otherwise, we'd overwrite other
+		// instances of the matcher in this set
+		tokensByMatcherName := make(map[string][]caddyfile.Token)
+		for nesting := d.Nesting(); d.NextArg() || d.NextBlock(nesting); {
+			matcherName := d.Val()
+			tokensByMatcherName[matcherName] = append(tokensByMatcherName[matcherName], d.NextSegment()...)
+		}
+		for matcherName, tokens := range tokensByMatcherName {
+			err := makeMatcher(matcherName, tokens)
+			if err != nil {
+				return err
+			}
 		}
+		matchers[definitionName] = append(matchers[definitionName], matcherSet)
 	}
 	return nil
 }
@@ -83,79 +83,99 @@ func parseOptHTTPSPort(d *caddyfile.Dispenser) (interface{}, error) {
 }
 
 func parseOptOrder(d *caddyfile.Dispenser) (interface{}, error) {
-	newOrder := directiveOrder
-
 	for d.Next() {
-		// get directive name
-		if !d.Next() {
-			return nil, d.ArgErr()
+		// a single clause may follow the option name directly,
+		// or multiple clauses may be listed in a block
+		if d.NextArg() {
+			err := applyOrderClause(d)
+			if err != nil {
+				return nil, err
+			}
+			continue
 		}
-		dirName := d.Val()
-		if _, ok := registeredDirectives[dirName]; !ok {
-			return nil, d.Errf("%s is not a registered directive", dirName)
+		for nesting := d.Nesting(); d.NextBlock(nesting); {
+			err := applyOrderClause(d)
+			if err != nil {
+				return nil, err
+			}
 		}
+	}
+	return directiveOrder, nil
+}
 
-		// get positional token
-		if !d.Next() {
-			return nil, d.ArgErr()
-		}
-		pos := d.Val()
+// applyOrderClause reads one "<dir> first|last|before|after [<other>]"
+// ordering clause, with the cursor on the directive name, and applies
+// it to the directive order.
+func applyOrderClause(d *caddyfile.Dispenser) error {
+	// get directive name
+	dirName := d.Val()
+	if _, ok := registeredDirectives[dirName]; !ok {
+		return d.Errf("%s is not a registered directive", dirName)
+	}
 
-		// if directive exists, first remove it
-		for i, d := range newOrder {
-			if d == dirName {
-				newOrder = append(newOrder[:i], newOrder[i+1:]...)
-				break
-			}
-		}
+	// get positional token
+	if !d.NextArg() {
+		return d.ArgErr()
+	}
+	pos := d.Val()
 
-		// act on the positional
-		switch pos {
-		case "first":
-			newOrder = append([]string{dirName}, newOrder...)
-			if d.NextArg() {
-				return nil, d.ArgErr()
-			}
-			directiveOrder = newOrder
-			return newOrder, nil
-		case "last":
-			newOrder = append(newOrder, dirName)
-			if d.NextArg() {
-				return nil, d.ArgErr()
-			}
-			directiveOrder = newOrder
-			return newOrder, nil
-		case "before":
-		case "after":
-		default:
-			return nil, d.Errf("unknown positional '%s'", pos)
+	// copy the order so the default order, which later configs
+	// start from, is not corrupted by insertions and removals
+	newOrder := make([]string, len(directiveOrder))
+	copy(newOrder, directiveOrder)
+
+	// if directive exists, first remove it
+	for i, dir := range newOrder {
+		if dir == dirName {
+			newOrder = append(newOrder[:i], newOrder[i+1:]...)
+			break
 		}
+	}
 
+	// act on the positional
+	switch pos {
+	case "first":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		newOrder = append([]string{dirName}, newOrder...)
+	case "last":
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		newOrder = append(newOrder, dirName)
+	case "before", "after":
 		// get name of other directive
 		if !d.NextArg() {
-			return nil, d.ArgErr()
+			return d.ArgErr()
 		}
 		otherDir := d.Val()
 		if d.NextArg() {
-			return nil, d.ArgErr()
+			return d.ArgErr()
 		}
 
 		// insert directive into proper position
-		for i, d := range newOrder {
-			if d == otherDir {
+		var found bool
+		for i, dir := range newOrder {
+			if dir == otherDir {
 				if pos == "before" {
 					newOrder = append(newOrder[:i], append([]string{dirName}, newOrder[i:]...)...)
 				} else if pos == "after" {
 					newOrder = append(newOrder[:i+1], append([]string{dirName}, newOrder[i+1:]...)...)
 				}
+				found = true
 				break
 			}
 		}
+		if !found {
+			return d.Errf("directive '%s' is not in the order", otherDir)
+		}
+	default:
+		return d.Errf("unknown positional '%s'", pos)
 	}
 
 	directiveOrder = newOrder
-
-	return newOrder, nil
+	return nil
 }
 
 func parseOptStorage(d *caddyfile.Dispenser) (interface{}, error) {
@@ -277,6 +297,51 @@ func parseOptAdmin(d *caddyfile.Dispenser) (interface{}, error) {
 			case "origins":
 				adminCfg.Origins = d.RemainingArgs()
 
+			case "read_only":
+				adminCfg.ReadOnly = true
+
+			case "require_if_match":
+				if adminCfg.Config == nil {
+					adminCfg.Config = new(caddy.ConfigSettings)
+				}
+				adminCfg.Config.RequireIfMatch = true
+
+			case "max_history":
+				if !d.NextArg() {
+					return nil, d.ArgErr()
+				}
+				maxHistory, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return nil, d.Errf("invalid max_history: %v", err)
+				}
+				if adminCfg.Config == nil {
+					adminCfg.Config = new(caddy.ConfigSettings)
+				}
+				adminCfg.Config.MaxHistory = maxHistory
+
+			case "grace_window":
+				if !d.NextArg() {
+					return nil, d.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return nil, d.Errf("invalid grace_window: %v", err)
+				}
+				if adminCfg.Config == nil {
+					adminCfg.Config = new(caddy.ConfigSettings)
+				}
+				adminCfg.Config.GraceWindow = caddy.Duration(dur)
+
+			case "health_checks":
+				urls := d.RemainingArgs()
+				if len(urls) == 0 {
+					return nil, d.ArgErr()
+				}
+				if adminCfg.Config == nil {
+					adminCfg.Config = new(caddy.ConfigSettings)
+				}
+				adminCfg.Config.HealthChecks = append(adminCfg.Config.HealthChecks, urls...)
+
 			default:
 				return nil, d.Errf("unrecognized parameter '%s'", d.Val())
 			}
@@ -42,6 +42,7 @@ type serverOptions struct {
 	AllowH2C            bool
 	ExperimentalHTTP3   bool
 	StrictSNIHost       *bool
+	Metrics             *caddyhttp.Metrics
 }
 
 func unmarshalCaddyfileServerOptions(d *caddyfile.Dispenser) (interface{}, error) {
@@ -168,6 +169,24 @@ func unmarshalCaddyfileServerOptions(d *caddyfile.Dispenser) (interface{}, error
 					}
 				}
 
+			case "metrics":
+				if d.NextArg() {
+					return nil, d.ArgErr()
+				}
+				serverOpts.Metrics = new(caddyhttp.Metrics)
+				for nesting := d.Nesting(); d.NextBlock(nesting); {
+					switch d.Val() {
+					case "per_host":
+						if d.NextArg() {
+							return nil, d.ArgErr()
+						}
+						serverOpts.Metrics.PerHost = true
+
+					default:
+						return nil, d.Errf("unrecognized metrics option '%s'", d.Val())
+					}
+				}
+
 			default:
 				return nil, d.Errf("unrecognized servers option '%s'", d.Val())
 			}
@@ -229,6 +248,7 @@ func applyServerOptions(
 		server.AllowH2C = opts.AllowH2C
 		server.ExperimentalHTTP3 = opts.ExperimentalHTTP3
 		server.StrictSNIHost = opts.StrictSNIHost
+		server.Metrics = opts.Metrics
 	}
 
 	return nil
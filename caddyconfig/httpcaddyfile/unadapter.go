@@ -0,0 +1,534 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpcaddyfile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "unadapt",
+		Func:  cmdUnadapt,
+		Usage: "--config <path>",
+		Short: "Converts a JSON config to a best-effort Caddyfile",
+		Long: `
+Converts Caddy's native JSON config into a Caddyfile and writes the
+output to stdout, along with any warnings to stderr.
+
+This is a best-effort conversion: the Caddyfile cannot express every
+possible JSON config, so parts without a Caddyfile form are omitted
+and noted both in the warnings and as comments in the output. Always
+review the result (for example with 'caddy adapt') before replacing
+a working config with it.`,
+		Flags: func() *flag.FlagSet {
+			fs := flag.NewFlagSet("unadapt", flag.ExitOnError)
+			fs.String("config", "", "Input JSON configuration file (required)")
+			return fs
+		}(),
+	})
+}
+
+func cmdUnadapt(fl caddycmd.Flags) (int, error) {
+	inputFlag := fl.String("config")
+	if inputFlag == "" {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("input file required (use --config flag)")
+	}
+
+	input, err := ioutil.ReadFile(inputFlag)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("reading input file: %v", err)
+	}
+
+	output, warnings, err := Unadapt(input)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	// print warnings to stderr
+	for _, warn := range warnings {
+		fmt.Fprintf(os.Stderr, "[WARNING][unadapt] %s\n", warn.Message)
+	}
+
+	fmt.Print(string(output))
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+// Unadapt converts a JSON config into a best-effort Caddyfile. Handlers,
+// matchers, and apps that have no Caddyfile form are omitted; each
+// omission is reported as a warning and as a comment in the output.
+func Unadapt(cfgJSON []byte) ([]byte, []caddyconfig.Warning, error) {
+	var cfg caddy.Config
+	err := json.Unmarshal(cfgJSON, &cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding config: %v", err)
+	}
+
+	u := new(unadapter)
+
+	// global options
+	var globals []string
+	if cfg.Admin != nil {
+		if cfg.Admin.Disabled {
+			globals = append(globals, "admin off")
+		} else if cfg.Admin.Listen != "" && cfg.Admin.Listen != caddy.DefaultAdminListen {
+			globals = append(globals, "admin "+cfg.Admin.Listen)
+		}
+	}
+
+	var httpApp caddyhttp.App
+	if appRaw, ok := cfg.AppsRaw["http"]; ok {
+		err := json.Unmarshal(appRaw, &httpApp)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding http app: %v", err)
+		}
+	}
+	if httpApp.HTTPPort != 0 {
+		globals = append(globals, fmt.Sprintf("http_port %d", httpApp.HTTPPort))
+	}
+	if httpApp.HTTPSPort != 0 {
+		globals = append(globals, fmt.Sprintf("https_port %d", httpApp.HTTPSPort))
+	}
+
+	if len(globals) > 0 {
+		u.printf("{")
+		u.indent++
+		for _, g := range globals {
+			u.printf("%s", g)
+		}
+		u.indent--
+		u.printf("}")
+		u.printf("")
+	}
+
+	// other apps have no Caddyfile form (the tls app is mostly
+	// derived from the sites by automatic HTTPS anyway)
+	var otherApps []string
+	for appName := range cfg.AppsRaw {
+		if appName != "http" && appName != "tls" {
+			otherApps = append(otherApps, appName)
+		}
+	}
+	sort.Strings(otherApps)
+	for _, appName := range otherApps {
+		u.warnf("app '%s' has no Caddyfile form; omitted", appName)
+	}
+
+	// emit servers in a deterministic order
+	srvNames := make([]string, 0, len(httpApp.Servers))
+	for name := range httpApp.Servers {
+		srvNames = append(srvNames, name)
+	}
+	sort.Strings(srvNames)
+	for _, name := range srvNames {
+		u.server(name, httpApp.Servers[name])
+	}
+
+	return caddyfile.Format([]byte(u.out.String())), u.warnings, nil
+}
+
+// unadapter accumulates Caddyfile output and conversion warnings.
+type unadapter struct {
+	out          strings.Builder
+	indent       int
+	warnings     []caddyconfig.Warning
+	matcherCount int
+}
+
+// printf writes one line of output at the current indentation.
+func (u *unadapter) printf(format string, args ...interface{}) {
+	u.out.WriteString(strings.Repeat("\t", u.indent))
+	fmt.Fprintf(&u.out, format, args...)
+	u.out.WriteByte('\n')
+}
+
+// warnf records a conversion warning and leaves a matching
+// comment in the output so the omission is visible in context.
+func (u *unadapter) warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	u.warnings = append(u.warnings, caddyconfig.Warning{Message: msg})
+	u.printf("# unadapt: %s", msg)
+}
+
+// server writes the site blocks for one server. Routes that are
+// scoped to hosts become their own site blocks; all other routes
+// are gathered into a site keyed by the server's listen address.
+func (u *unadapter) server(name string, srv *caddyhttp.Server) {
+	var leftover caddyhttp.RouteList
+	for _, route := range srv.Routes {
+		hosts := siteBlockHosts(route)
+		if len(hosts) == 0 {
+			leftover = append(leftover, route)
+			continue
+		}
+		u.printf("%s {", strings.Join(hosts, ", "))
+		u.indent++
+		u.handlers("", route.HandlersRaw)
+		u.indent--
+		u.printf("}")
+		u.printf("")
+	}
+
+	if len(leftover) > 0 {
+		addr := ":80"
+		if len(srv.Listen) > 0 {
+			addr = srv.Listen[0]
+		}
+		u.printf("%s {", addr)
+		u.indent++
+		u.routes(leftover)
+		u.indent--
+		u.printf("}")
+		u.printf("")
+	}
+
+	if srv.Errors != nil {
+		u.warnf("server %s: error routes have no direct Caddyfile form; omitted", name)
+	}
+}
+
+// siteBlockHosts returns the hosts a route is scoped to, if the
+// route has the shape the Caddyfile adapter gives a site block:
+// a single host-only matcher set. Otherwise it returns nil.
+func siteBlockHosts(route caddyhttp.Route) []string {
+	if len(route.MatcherSetsRaw) != 1 {
+		return nil
+	}
+	set := route.MatcherSetsRaw[0]
+	if len(set) != 1 {
+		return nil
+	}
+	var hosts caddyhttp.MatchHost
+	if err := json.Unmarshal(set["host"], &hosts); err != nil {
+		return nil
+	}
+	return hosts
+}
+
+// routes writes the directives for a list of routes.
+func (u *unadapter) routes(routes caddyhttp.RouteList) {
+	for _, route := range routes {
+		matcher := u.matcherToken(route.MatcherSetsRaw)
+		u.handlers(matcher, route.HandlersRaw)
+	}
+}
+
+// handlers writes the directives for a route's handler chain,
+// all sharing the same matcher token.
+func (u *unadapter) handlers(matcher string, handlersRaw []json.RawMessage) {
+	for _, handlerRaw := range handlersRaw {
+		u.handler(matcher, handlerRaw)
+	}
+}
+
+// handler writes the directive(s) for a single handler, or a
+// warning if the handler has no Caddyfile form.
+func (u *unadapter) handler(matcher string, handlerRaw json.RawMessage) {
+	var probe struct {
+		Handler string `json:"handler"`
+	}
+	if err := json.Unmarshal(handlerRaw, &probe); err != nil {
+		u.warnf("undecodable handler; omitted: %v", err)
+		return
+	}
+
+	switch probe.Handler {
+	case "subroute":
+		var sub caddyhttp.Subroute
+		if err := json.Unmarshal(handlerRaw, &sub); err != nil {
+			u.warnf("undecodable subroute; omitted: %v", err)
+			return
+		}
+		if matcher == "" {
+			u.routes(sub.Routes)
+			return
+		}
+		u.printf("route %s {", matcher)
+		u.indent++
+		u.routes(sub.Routes)
+		u.indent--
+		u.printf("}")
+
+	case "static_response":
+		var sr caddyhttp.StaticResponse
+		if err := json.Unmarshal(handlerRaw, &sr); err != nil {
+			u.warnf("undecodable static_response; omitted: %v", err)
+			return
+		}
+		if loc := sr.Headers.Get("Location"); loc != "" {
+			args := []string{loc}
+			if sr.StatusCode != "" {
+				args = append(args, string(sr.StatusCode))
+			}
+			u.directive("redir", matcher, args...)
+			return
+		}
+		if len(sr.Headers) > 0 {
+			u.warnf("static_response headers have no respond form; omitted")
+		}
+		var args []string
+		if sr.Body != "" {
+			args = append(args, quoteArg(sr.Body))
+		}
+		if sr.StatusCode != "" {
+			args = append(args, string(sr.StatusCode))
+		}
+		u.directive("respond", matcher, args...)
+
+	case "vars":
+		var vars map[string]string
+		if err := json.Unmarshal(handlerRaw, &vars); err == nil {
+			delete(vars, "handler")
+			if root, ok := vars["root"]; ok && len(vars) == 1 {
+				u.directive("root", matcher, quoteArg(root))
+				return
+			}
+		}
+		u.warnf("vars handler sets more than the site root; omitted")
+
+	case "reverse_proxy":
+		var rp struct {
+			Upstreams []struct {
+				Dial string `json:"dial"`
+			} `json:"upstreams"`
+		}
+		if err := json.Unmarshal(handlerRaw, &rp); err != nil {
+			u.warnf("undecodable reverse_proxy; omitted: %v", err)
+			return
+		}
+		var fields map[string]json.RawMessage
+		_ = json.Unmarshal(handlerRaw, &fields)
+		delete(fields, "handler")
+		delete(fields, "upstreams")
+		if len(fields) > 0 {
+			u.warnf("reverse_proxy options beyond upstream addresses were not converted")
+		}
+		var dials []string
+		for _, up := range rp.Upstreams {
+			dials = append(dials, up.Dial)
+		}
+		u.directive("reverse_proxy", matcher, dials...)
+
+	case "file_server":
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(handlerRaw, &fields); err != nil {
+			u.warnf("undecodable file_server; omitted: %v", err)
+			return
+		}
+		var args []string
+		if _, ok := fields["browse"]; ok {
+			args = append(args, "browse")
+		}
+		delete(fields, "handler")
+		delete(fields, "browse")
+		delete(fields, "hide")
+		delete(fields, "root")
+		if len(fields) > 0 {
+			u.warnf("some file_server options were not converted")
+		}
+		u.directive("file_server", matcher, args...)
+
+	case "encode":
+		var enc struct {
+			EncodingsRaw caddy.ModuleMap `json:"encodings"`
+		}
+		if err := json.Unmarshal(handlerRaw, &enc); err != nil {
+			u.warnf("undecodable encode; omitted: %v", err)
+			return
+		}
+		var formats []string
+		for format := range enc.EncodingsRaw {
+			formats = append(formats, format)
+		}
+		sort.Strings(formats)
+		u.directive("encode", matcher, formats...)
+
+	case "rewrite":
+		var rw struct {
+			URI             string `json:"uri"`
+			StripPathPrefix string `json:"strip_path_prefix"`
+			StripPathSuffix string `json:"strip_path_suffix"`
+		}
+		if err := json.Unmarshal(handlerRaw, &rw); err != nil {
+			u.warnf("undecodable rewrite; omitted: %v", err)
+			return
+		}
+		switch {
+		case rw.URI != "" && rw.StripPathPrefix == "" && rw.StripPathSuffix == "":
+			u.directive("rewrite", matcher, rw.URI)
+		case rw.URI == "" && rw.StripPathPrefix != "" && rw.StripPathSuffix == "":
+			u.directive("uri", matcher, "strip_prefix", rw.StripPathPrefix)
+		case rw.URI == "" && rw.StripPathPrefix == "" && rw.StripPathSuffix != "":
+			u.directive("uri", matcher, "strip_suffix", rw.StripPathSuffix)
+		default:
+			u.warnf("rewrite form not representable in the Caddyfile; omitted")
+		}
+
+	case "headers":
+		var ops struct {
+			Response *struct {
+				Set    http.Header `json:"set"`
+				Add    http.Header `json:"add"`
+				Delete []string    `json:"delete"`
+			} `json:"response"`
+			Request json.RawMessage `json:"request"`
+		}
+		if err := json.Unmarshal(handlerRaw, &ops); err != nil {
+			u.warnf("undecodable headers; omitted: %v", err)
+			return
+		}
+		if ops.Request != nil {
+			u.warnf("request header ops were not converted")
+		}
+		if ops.Response == nil {
+			return
+		}
+		for _, field := range sortedHeaderFields(ops.Response.Set) {
+			for _, val := range ops.Response.Set[field] {
+				u.directive("header", matcher, field, quoteArg(val))
+			}
+		}
+		for _, field := range sortedHeaderFields(ops.Response.Add) {
+			for _, val := range ops.Response.Add[field] {
+				u.directive("header", matcher, "+"+field, quoteArg(val))
+			}
+		}
+		for _, field := range ops.Response.Delete {
+			u.directive("header", matcher, "-"+field)
+		}
+
+	default:
+		u.warnf("no Caddyfile form for handler '%s'; omitted", probe.Handler)
+	}
+}
+
+// directive writes one directive line with an optional matcher token.
+func (u *unadapter) directive(name, matcher string, args ...string) {
+	parts := []string{name}
+	if matcher != "" {
+		parts = append(parts, matcher)
+	}
+	parts = append(parts, args...)
+	u.printf("%s", strings.Join(parts, " "))
+}
+
+// matcherToken converts a route's matcher sets into a matcher token:
+// an empty string for no matcher, an inline path for a single-path
+// matcher, or a named matcher whose definitions are written first.
+// Matcher modules that cannot be converted are dropped with a warning.
+func (u *unadapter) matcherToken(sets []caddy.ModuleMap) string {
+	if len(sets) == 0 {
+		return ""
+	}
+
+	// single path matcher can be inlined
+	if len(sets) == 1 && len(sets[0]) == 1 {
+		var paths caddyhttp.MatchPath
+		if err := json.Unmarshal(sets[0]["path"], &paths); err == nil &&
+			len(paths) == 1 && strings.HasPrefix(paths[0], "/") {
+			return paths[0]
+		}
+	}
+
+	// otherwise, write named matcher definitions; multiple sets
+	// become multiple definitions of the same name, which are OR'ed
+	name := "@match" + strconv.Itoa(u.matcherCount)
+	u.matcherCount++
+	for _, set := range sets {
+		var lines []string
+		modNames := make([]string, 0, len(set))
+		for modName := range set {
+			modNames = append(modNames, modName)
+		}
+		sort.Strings(modNames)
+		for _, modName := range modNames {
+			line, ok := u.matcherLine(modName, set[modName])
+			if !ok {
+				u.warnf("matcher '%s' has no Caddyfile form; dropped from %s", modName, name)
+				continue
+			}
+			lines = append(lines, line)
+		}
+		switch len(lines) {
+		case 0:
+			continue
+		case 1:
+			u.printf("%s %s", name, lines[0])
+		default:
+			u.printf("%s {", name)
+			u.indent++
+			for _, line := range lines {
+				u.printf("%s", line)
+			}
+			u.indent--
+			u.printf("}")
+		}
+	}
+	return name
+}
+
+// matcherLine converts one matcher module's JSON into a line of
+// Caddyfile matcher syntax, if the module has a known form.
+func (u *unadapter) matcherLine(modName string, raw json.RawMessage) (string, bool) {
+	switch modName {
+	case "path", "method", "host":
+		var vals []string
+		if err := json.Unmarshal(raw, &vals); err != nil {
+			return "", false
+		}
+		return modName + " " + strings.Join(vals, " "), true
+	case "expression":
+		var expr string
+		if err := json.Unmarshal(raw, &expr); err != nil {
+			return "", false
+		}
+		return "expression `" + expr + "`", true
+	}
+	return "", false
+}
+
+// sortedHeaderFields returns the field names of h in sorted order.
+func sortedHeaderFields(h http.Header) []string {
+	fields := make([]string, 0, len(h))
+	for field := range h {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// quoteArg quotes s if it would not survive tokenizing as a
+// single argument; otherwise it is returned unchanged.
+func quoteArg(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"#{}") {
+		return strconv.Quote(s)
+	}
+	return s
+}
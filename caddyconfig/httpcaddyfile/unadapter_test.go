@@ -0,0 +1,211 @@
+package httpcaddyfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+)
+
+// unadaptForTest runs Unadapt and fails the test on a hard error.
+func unadaptForTest(t *testing.T, cfgJSON string) (string, []caddyconfig.Warning) {
+	t.Helper()
+	out, warnings, err := Unadapt([]byte(cfgJSON))
+	if err != nil {
+		t.Fatalf("unadapting: %v", err)
+	}
+	return string(out), warnings
+}
+
+// warningsContain reports whether any warning message contains substr.
+func warningsContain(warnings []caddyconfig.Warning, substr string) bool {
+	for _, warn := range warnings {
+		if strings.Contains(warn.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUnadaptGlobalsAndApps(t *testing.T) {
+	out, warnings := unadaptForTest(t, `{
+		"admin": {"disabled": true},
+		"apps": {
+			"http": {
+				"http_port": 8080,
+				"https_port": 8443,
+				"servers": {}
+			},
+			"pprof": {}
+		}
+	}`)
+
+	for _, want := range []string{"admin off", "http_port 8080", "https_port 8443"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected global option '%s' in output:\n%s", want, out)
+		}
+	}
+	if !warningsContain(warnings, "app 'pprof'") {
+		t.Errorf("expected warning about the pprof app, got %v", warnings)
+	}
+	// omissions must also be visible in the output itself
+	if !strings.Contains(out, "# unadapt:") {
+		t.Errorf("expected omission comment in output:\n%s", out)
+	}
+}
+
+func TestUnadaptSiteBlocks(t *testing.T) {
+	out, warnings := unadaptForTest(t, `{
+		"apps": {
+			"http": {
+				"servers": {
+					"srv0": {
+						"listen": [":8080"],
+						"routes": [
+							{
+								"match": [{"host": ["example.com"]}],
+								"handle": [{
+									"handler": "subroute",
+									"routes": [
+										{
+											"match": [{"path": ["/api/*"]}],
+											"handle": [{
+												"handler": "reverse_proxy",
+												"upstreams": [{"dial": "localhost:9000"}]
+											}]
+										},
+										{
+											"handle": [{"handler": "file_server", "browse": {}}]
+										}
+									]
+								}]
+							},
+							{
+								"handle": [
+									{"handler": "vars", "root": "/var/www"},
+									{"handler": "file_server"}
+								]
+							}
+						]
+					}
+				}
+			}
+		}
+	}`)
+
+	if len(warnings) > 0 {
+		t.Errorf("expected no warnings, got %v", warnings)
+	}
+
+	// the host-scoped route becomes its own site block; the
+	// leftover route is keyed by the listen address
+	for _, want := range []string{
+		"example.com {",
+		"reverse_proxy /api/* localhost:9000",
+		"file_server browse",
+		":8080 {",
+		"root /var/www",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected '%s' in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnadaptDirectives(t *testing.T) {
+	out, warnings := unadaptForTest(t, `{
+		"apps": {
+			"http": {
+				"servers": {
+					"srv0": {
+						"routes": [{
+							"match": [{"host": ["example.com"]}],
+							"handle": [{
+								"handler": "subroute",
+								"routes": [
+									{
+										"match": [{"path": ["/old"]}],
+										"handle": [{
+											"handler": "static_response",
+											"headers": {"Location": ["/new"]},
+											"status_code": 302
+										}]
+									},
+									{"handle": [{"handler": "encode", "encodings": {"gzip": {}, "zstd": {}}}]},
+									{"handle": [{"handler": "rewrite", "strip_path_prefix": "/prefix"}]},
+									{"handle": [{
+										"handler": "headers",
+										"response": {
+											"set": {"X-Frame-Options": ["DENY"]},
+											"delete": ["Server"]
+										}
+									}]},
+									{"handle": [{"handler": "static_response", "body": "hello world", "status_code": "404"}]}
+								]
+							}]
+						}]
+					}
+				}
+			}
+		}
+	}`)
+
+	if len(warnings) > 0 {
+		t.Errorf("expected no warnings, got %v", warnings)
+	}
+	for _, want := range []string{
+		"redir /old /new 302",
+		"encode gzip zstd",
+		"uri strip_prefix /prefix",
+		"header X-Frame-Options DENY",
+		"header -Server",
+		`respond "hello world" 404`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected '%s' in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnadaptNamedMatchers(t *testing.T) {
+	out, warnings := unadaptForTest(t, `{
+		"apps": {
+			"http": {
+				"servers": {
+					"srv0": {
+						"routes": [{
+							"match": [{
+								"method": ["GET", "POST"],
+								"path": ["/a", "/b"],
+								"remote_ip": {"ranges": ["10.0.0.0/8"]}
+							}],
+							"handle": [{"handler": "static_response", "body": "ok"}]
+						}]
+					}
+				}
+			}
+		}
+	}`)
+
+	// the multi-module matcher set becomes a named matcher whose
+	// convertible modules are written as definition lines
+	for _, want := range []string{
+		"@match0 {",
+		"method GET POST",
+		"path /a /b",
+		"respond @match0 ok",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected '%s' in output:\n%s", want, out)
+		}
+	}
+	if !warningsContain(warnings, "matcher 'remote_ip'") {
+		t.Errorf("expected warning about the remote_ip matcher, got %v", warnings)
+	}
+}
+
+func TestUnadaptErrors(t *testing.T) {
+	if _, _, err := Unadapt([]byte(`{not json`)); err == nil {
+		t.Error("expected error unadapting invalid JSON, got none")
+	}
+}
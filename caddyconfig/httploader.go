@@ -0,0 +1,169 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(HTTPLoader{})
+}
+
+// HTTPLoader can load Caddy configs over HTTP(S). It can adapt
+// to config changes at the source: if the server supports ETags,
+// unchanged responses are detected cheaply with If-None-Match;
+// otherwise, identical configs are simply not reloaded.
+type HTTPLoader struct {
+	// The method for the request. Default: GET
+	Method string `json:"method,omitempty"`
+
+	// The URL of the request.
+	URL string `json:"url,omitempty"`
+
+	// HTTP headers to add to the request.
+	Headers http.Header `json:"header,omitempty"`
+
+	// Maximum time allowed for a complete connection and request.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	// TLS connection configuration, including optional client
+	// certificate authentication.
+	TLS *struct {
+		// The path to the client certificate to present to the server.
+		ClientCertificateFile string `json:"client_certificate_file,omitempty"`
+
+		// The path to the private key of the client certificate.
+		ClientCertificateKeyFile string `json:"client_certificate_key_file,omitempty"`
+
+		// List of PEM-encoded CA certificate files to add to the
+		// trust store used to verify the server.
+		RootCAPEMFiles []string `json:"root_ca_pem_files,omitempty"`
+
+		// DANGEROUS: do not verify the server's certificate.
+		InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	} `json:"tls,omitempty"`
+
+	// the ETag of the last response, so re-polls can use
+	// If-None-Match to detect an unchanged config cheaply
+	etag string
+}
+
+// CaddyModule returns the Caddy module information.
+func (HTTPLoader) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.config_loaders.http",
+		New: func() caddy.Module { return new(HTTPLoader) },
+	}
+}
+
+// LoadConfig loads a Caddy config. A nil return value with a nil
+// error means the server reported the config as unchanged since
+// the last load.
+func (hl *HTTPLoader) LoadConfig(ctx caddy.Context) ([]byte, error) {
+	client, err := hl.makeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	method := hl.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(method, hl.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = make(http.Header)
+	for name, vals := range hl.Headers {
+		for _, val := range vals {
+			req.Header.Add(name, val)
+		}
+	}
+	if hl.etag != "" {
+		req.Header.Set("If-None-Match", hl.etag)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("server responded with HTTP %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	hl.etag = resp.Header.Get("Etag")
+
+	return body, nil
+}
+
+// makeClient builds the HTTP client with which to get the config.
+func (hl *HTTPLoader) makeClient() (*http.Client, error) {
+	client := &http.Client{
+		Timeout: time.Duration(hl.Timeout),
+	}
+
+	if hl.TLS != nil {
+		tlsCfg := new(tls.Config)
+
+		// client authentication
+		if hl.TLS.ClientCertificateFile != "" && hl.TLS.ClientCertificateKeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(hl.TLS.ClientCertificateFile, hl.TLS.ClientCertificateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("loading client certificate: %v", err)
+			}
+			tlsCfg.Certificates = []tls.Certificate{cert}
+		}
+
+		// trusted server certs
+		if len(hl.TLS.RootCAPEMFiles) > 0 {
+			rootPool := x509.NewCertPool()
+			for _, pemFile := range hl.TLS.RootCAPEMFiles {
+				pemData, err := ioutil.ReadFile(pemFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed reading ca cert: %v", err)
+				}
+				rootPool.AppendCertsFromPEM(pemData)
+			}
+			tlsCfg.RootCAs = rootPool
+		}
+
+		tlsCfg.InsecureSkipVerify = hl.TLS.InsecureSkipVerify
+
+		client.Transport = &http.Transport{TLSClientConfig: tlsCfg}
+	}
+
+	return client, nil
+}
+
+// Interface guard
+var _ caddy.ConfigLoader = (*HTTPLoader)(nil)
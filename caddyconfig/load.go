@@ -51,13 +51,17 @@ func (adminLoad) CaddyModule() caddy.ModuleInfo {
 	}
 }
 
-// Routes returns a route for the /load endpoint.
+// Routes returns routes for the /load and /adapt endpoints.
 func (al adminLoad) Routes() []caddy.AdminRoute {
 	return []caddy.AdminRoute{
 		{
 			Pattern: "/load",
 			Handler: caddy.AdminHandlerFunc(al.handleLoad),
 		},
+		{
+			Pattern: "/adapt",
+			Handler: caddy.AdminHandlerFunc(al.handleAdapt),
+		},
 	}
 }
 
@@ -133,7 +137,7 @@ func (adminLoad) handleLoad(w http.ResponseWriter, r *http.Request) error {
 
 	forceReload := r.Header.Get("Cache-Control") == "must-revalidate"
 
-	err = caddy.Load(body, forceReload)
+	err = caddy.LoadWithActor(body, forceReload, caddy.AdminRequestActor(r))
 	if err != nil {
 		return caddy.APIError{
 			Code: http.StatusBadRequest,
@@ -146,6 +150,83 @@ func (adminLoad) handleLoad(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// handleAdapt adapts the given config to JSON and responds with
+// the result and any warnings, without loading the config. The
+// adapter is chosen by the Content-Type header the same way as
+// for /load; without one, the caddyfile adapter is assumed. This
+// lets tooling validate and preview configs remotely.
+func (adminLoad) handleAdapt(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufPool.Put(buf)
+
+	_, err := io.Copy(buf, r.Body)
+	if err != nil {
+		return caddy.APIError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("reading request body: %v", err),
+		}
+	}
+	body := buf.Bytes()
+
+	adapterName := "caddyfile"
+	if ctHeader := r.Header.Get("Content-Type"); ctHeader != "" {
+		ct, _, err := mime.ParseMediaType(ctHeader)
+		if err != nil {
+			return caddy.APIError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("invalid Content-Type: %v", err),
+			}
+		}
+		slashIdx := strings.Index(ct, "/")
+		if slashIdx < 0 {
+			return caddy.APIError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("malformed Content-Type"),
+			}
+		}
+		adapterName = ct[slashIdx+1:]
+	}
+
+	result, warnings := json.RawMessage(body), []Warning(nil)
+
+	// JSON is already adapted; anything else goes through its adapter
+	if adapterName != "json" {
+		cfgAdapter := GetAdapter(adapterName)
+		if cfgAdapter == nil {
+			return caddy.APIError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("unrecognized config adapter '%s'", adapterName),
+			}
+		}
+		result, warnings, err = cfgAdapter.Adapt(body, nil)
+		if err != nil {
+			return caddy.APIError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("adapting config using %s adapter: %v", adapterName, err),
+			}
+		}
+	}
+
+	out := struct {
+		Warnings []Warning       `json:"warnings,omitempty"`
+		Result   json.RawMessage `json:"result"`
+	}{
+		Warnings: warnings,
+		Result:   result,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(out)
+}
+
 var bufPool = sync.Pool{
 	New: func() interface{} {
 		return new(bytes.Buffer)
@@ -0,0 +1,564 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nginxconf translates common nginx.conf constructs into
+// Caddy JSON to ease migrations. The translation is best-effort:
+// directives without a Caddy equivalent are reported as warnings
+// and skipped, and nginx inheritance and location selection rules
+// are only approximated (locations are sorted most-specific-first
+// and made terminal). Always review the output before using it.
+package nginxconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+)
+
+func init() {
+	caddyconfig.RegisterAdapter("nginx", Adapter{})
+}
+
+// Adapter adapts an nginx config to Caddy JSON.
+type Adapter struct{}
+
+// Adapt converts the nginx config in body to Caddy JSON.
+func (Adapter) Adapt(body []byte, options map[string]interface{}) ([]byte, []caddyconfig.Warning, error) {
+	dirs, err := parse(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := converter{upstreams: make(map[string][]string)}
+	c.filename, _ = options["filename"].(string)
+
+	// gather server and upstream blocks; servers may appear
+	// inside an http block or (in config fragments) at the top
+	var serverDirs []directive
+	for _, dir := range dirs {
+		switch dir.name {
+		case "http":
+			for _, sub := range dir.block {
+				switch sub.name {
+				case "server":
+					serverDirs = append(serverDirs, sub)
+				case "upstream":
+					c.upstream(sub)
+				default:
+					c.warnf(sub, "not converted")
+				}
+			}
+		case "server":
+			serverDirs = append(serverDirs, dir)
+		case "events", "user", "worker_processes", "pid", "error_log":
+			// process-level directives; nothing to convert
+		default:
+			c.warnf(dir, "not converted")
+		}
+	}
+
+	// nginx servers that share a listen address merge into one
+	// Caddy server, with each becoming a host-matched subroute
+	servers := make(map[string]interface{})
+	serverIdx := make(map[string]string) // listen key -> server name
+	for _, srvDir := range serverDirs {
+		listens, hosts := c.listenAndHosts(srvDir)
+		route := map[string]interface{}{
+			"handle": []interface{}{map[string]interface{}{
+				"handler": "subroute",
+				"routes":  c.convertBody(srvDir.block),
+			}},
+			"terminal": true,
+		}
+		if len(hosts) > 0 {
+			route["match"] = []interface{}{map[string]interface{}{"host": hosts}}
+		}
+
+		key := strings.Join(listens, " ")
+		name, ok := serverIdx[key]
+		if !ok {
+			name = fmt.Sprintf("srv%d", len(servers))
+			serverIdx[key] = name
+			servers[name] = map[string]interface{}{
+				"listen": listens,
+				"routes": []interface{}{},
+			}
+		}
+		srv := servers[name].(map[string]interface{})
+		srv["routes"] = append(srv["routes"].([]interface{}), route)
+	}
+
+	cfg := map[string]interface{}{
+		"apps": map[string]interface{}{
+			"http": map[string]interface{}{
+				"servers": servers,
+			},
+		},
+	}
+	result, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, c.warnings, err
+	}
+	return result, c.warnings, nil
+}
+
+// converter accumulates state and warnings during a conversion.
+type converter struct {
+	filename  string
+	warnings  []caddyconfig.Warning
+	upstreams map[string][]string
+}
+
+// warnf records that a directive could not be (fully) converted.
+func (c *converter) warnf(dir directive, format string, args ...interface{}) {
+	c.warnings = append(c.warnings, caddyconfig.Warning{
+		File:      c.filename,
+		Line:      dir.line,
+		Directive: dir.name,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// upstream records the server addresses of an upstream block so
+// proxy_pass can refer to it by name.
+func (c *converter) upstream(dir directive) {
+	if len(dir.args) != 1 {
+		c.warnf(dir, "expected exactly one argument")
+		return
+	}
+	var dials []string
+	for _, sub := range dir.block {
+		if sub.name != "server" || len(sub.args) == 0 {
+			c.warnf(sub, "not converted")
+			continue
+		}
+		if len(sub.args) > 1 {
+			c.warnf(sub, "upstream server parameters not converted")
+		}
+		dials = append(dials, sub.args[0])
+	}
+	c.upstreams[dir.args[0]] = dials
+}
+
+// listenAndHosts extracts the listen addresses and hostnames
+// from a server block.
+func (c *converter) listenAndHosts(srvDir directive) (listens, hosts []string) {
+	for _, dir := range srvDir.block {
+		switch dir.name {
+		case "listen":
+			if len(dir.args) == 0 {
+				c.warnf(dir, "expected an address")
+				continue
+			}
+			// parameters like ssl, http2, or default_server have
+			// no bearing on the converted config
+			addr := dir.args[0]
+			if !strings.Contains(addr, ":") {
+				addr = ":" + addr
+			}
+			addr = strings.TrimPrefix(addr, "*")
+			addr = strings.TrimPrefix(addr, "0.0.0.0")
+			listens = append(listens, addr)
+		case "server_name":
+			for _, name := range dir.args {
+				if name == "_" || name == "" {
+					continue
+				}
+				if strings.HasPrefix(name, "~") {
+					c.warnf(dir, "regular expression server names are not supported")
+					continue
+				}
+				hosts = append(hosts, name)
+			}
+		}
+	}
+	if len(listens) == 0 {
+		listens = []string{":80"}
+	}
+	return
+}
+
+// convertBody converts the directives of a server or location
+// block into a list of Caddy routes. Location routes are sorted
+// most-specific-first and made terminal to approximate nginx's
+// single-location selection.
+func (c *converter) convertBody(dirs []directive) []interface{} {
+	routes := []interface{}{}
+	var locations []locationRoute
+	var indexNames []string
+	var hasRoot, servesFiles, handlesRequest bool
+
+	for _, dir := range dirs {
+		switch dir.name {
+		case "listen", "server_name":
+			// handled by listenAndHosts
+
+		case "root":
+			if len(dir.args) != 1 {
+				c.warnf(dir, "expected exactly one argument")
+				continue
+			}
+			hasRoot = true
+			routes = append(routes, handlerRoute(map[string]interface{}{
+				"handler": "vars",
+				"root":    dir.args[0],
+			}))
+
+		case "index":
+			indexNames = dir.args
+
+		case "try_files":
+			route, ok := c.tryFiles(dir)
+			if !ok {
+				continue
+			}
+			servesFiles = true
+			routes = append(routes, route)
+
+		case "proxy_pass":
+			handler, ok := c.proxyPass(dir)
+			if !ok {
+				continue
+			}
+			handlesRequest = true
+			routes = append(routes, handlerRoute(handler))
+
+		case "fastcgi_pass":
+			if len(dir.args) != 1 {
+				c.warnf(dir, "expected exactly one argument")
+				continue
+			}
+			handlesRequest = true
+			routes = append(routes, handlerRoute(map[string]interface{}{
+				"handler":   "reverse_proxy",
+				"upstreams": []interface{}{map[string]interface{}{"dial": dir.args[0]}},
+				"transport": map[string]interface{}{"protocol": "fastcgi"},
+			}))
+
+		case "return":
+			handler, ok := c.returnDirective(dir)
+			if !ok {
+				continue
+			}
+			handlesRequest = true
+			routes = append(routes, handlerRoute(handler))
+
+		case "rewrite":
+			route, ok := c.rewrite(dir)
+			if !ok {
+				continue
+			}
+			routes = append(routes, route)
+
+		case "add_header":
+			if len(dir.args) < 2 {
+				c.warnf(dir, "expected a field name and value")
+				continue
+			}
+			routes = append(routes, handlerRoute(map[string]interface{}{
+				"handler": "headers",
+				"response": map[string]interface{}{
+					"add": map[string]interface{}{dir.args[0]: []string{dir.args[1]}},
+				},
+			}))
+
+		case "gzip":
+			if len(dir.args) == 1 && dir.args[0] == "off" {
+				continue
+			}
+			routes = append(routes, handlerRoute(map[string]interface{}{
+				"handler":   "encode",
+				"encodings": map[string]interface{}{"gzip": map[string]interface{}{}},
+			}))
+
+		case "location":
+			loc, ok := c.location(dir)
+			if !ok {
+				continue
+			}
+			locations = append(locations, loc)
+
+		default:
+			c.warnf(dir, "not converted")
+		}
+	}
+
+	sort.SliceStable(locations, func(i, j int) bool {
+		if locations[i].class != locations[j].class {
+			return locations[i].class > locations[j].class
+		}
+		return len(locations[i].path) > len(locations[j].path)
+	})
+	for _, loc := range locations {
+		routes = append(routes, loc.route)
+	}
+
+	// nginx serves files implicitly once a root is set; Caddy
+	// needs an explicit file_server handler
+	if (hasRoot || servesFiles) && !handlesRequest {
+		fileServer := map[string]interface{}{"handler": "file_server"}
+		if len(indexNames) > 0 {
+			fileServer["index_names"] = indexNames
+		}
+		routes = append(routes, handlerRoute(fileServer))
+	}
+
+	return routes
+}
+
+// locationRoute is a converted location block along with the keys
+// used to order it: exact matches beat prefix matches, which beat
+// regular expression matches, and longer prefixes beat shorter ones.
+type locationRoute struct {
+	route interface{}
+	class int // 2 = exact, 1 = prefix, 0 = regexp
+	path  string
+}
+
+// location converts a location block into a terminal route.
+func (c *converter) location(dir directive) (locationRoute, bool) {
+	var loc locationRoute
+	modifier, path := "", ""
+	switch len(dir.args) {
+	case 1:
+		path = dir.args[0]
+	case 2:
+		modifier, path = dir.args[0], dir.args[1]
+	default:
+		c.warnf(dir, "expected a path, optionally preceded by a modifier")
+		return loc, false
+	}
+
+	var matcher map[string]interface{}
+	switch modifier {
+	case "=":
+		loc.class, loc.path = 2, path
+		matcher = map[string]interface{}{"path": []string{path}}
+	case "", "^~":
+		loc.class, loc.path = 1, path
+		if path != "/" {
+			// nginx prefix locations match by string prefix
+			matcher = map[string]interface{}{"path": []string{path + "*"}}
+		}
+	case "~", "~*":
+		pattern := path
+		if modifier == "~*" {
+			pattern = "(?i)" + pattern
+		}
+		matcher = map[string]interface{}{
+			"path_regexp": map[string]interface{}{"pattern": pattern},
+		}
+	default:
+		c.warnf(dir, "unrecognized location modifier '%s'", modifier)
+		return loc, false
+	}
+
+	route := map[string]interface{}{
+		"handle": []interface{}{map[string]interface{}{
+			"handler": "subroute",
+			"routes":  c.convertBody(dir.block),
+		}},
+		"terminal": true,
+	}
+	if matcher != nil {
+		route["match"] = []interface{}{matcher}
+	}
+	loc.route = route
+	return loc, true
+}
+
+// tryFiles converts a try_files directive into a file matcher
+// with a rewrite to the first file that exists.
+func (c *converter) tryFiles(dir directive) (interface{}, bool) {
+	if len(dir.args) == 0 {
+		c.warnf(dir, "expected at least one file")
+		return nil, false
+	}
+	var files []string
+	for _, arg := range dir.args {
+		if strings.HasPrefix(arg, "=") {
+			c.warnf(dir, "status code fallback '%s' not converted", arg)
+			continue
+		}
+		if strings.HasPrefix(arg, "@") {
+			c.warnf(dir, "named location fallback '%s' not converted", arg)
+			continue
+		}
+		files = append(files, replacePlaceholders(arg))
+	}
+	if len(files) == 0 {
+		return nil, false
+	}
+	return map[string]interface{}{
+		"match": []interface{}{map[string]interface{}{
+			"file": map[string]interface{}{"try_files": files},
+		}},
+		"handle": []interface{}{map[string]interface{}{
+			"handler": "rewrite",
+			"uri":     "{http.matchers.file.relative}",
+		}},
+	}, true
+}
+
+// proxyPass converts a proxy_pass directive into a reverse_proxy
+// handler. The target may be an upstream name defined earlier.
+func (c *converter) proxyPass(dir directive) (map[string]interface{}, bool) {
+	if len(dir.args) != 1 {
+		c.warnf(dir, "expected exactly one argument")
+		return nil, false
+	}
+	target, err := url.Parse(dir.args[0])
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		c.warnf(dir, "unsupported proxy_pass target '%s'", dir.args[0])
+		return nil, false
+	}
+	if target.Path != "" && target.Path != "/" {
+		c.warnf(dir, "URI part '%s' of proxy_pass target not converted", target.Path)
+	}
+
+	dials, ok := c.upstreams[target.Host]
+	if !ok {
+		host := target.Host
+		if target.Port() == "" {
+			if target.Scheme == "https" {
+				host += ":443"
+			} else {
+				host += ":80"
+			}
+		}
+		dials = []string{host}
+	}
+
+	upstreams := make([]interface{}, len(dials))
+	for i, dial := range dials {
+		upstreams[i] = map[string]interface{}{"dial": dial}
+	}
+	handler := map[string]interface{}{
+		"handler":   "reverse_proxy",
+		"upstreams": upstreams,
+	}
+	if target.Scheme == "https" {
+		handler["transport"] = map[string]interface{}{
+			"protocol": "http",
+			"tls":      map[string]interface{}{},
+		}
+	}
+	return handler, true
+}
+
+// returnDirective converts a return directive into a
+// static_response handler, as a redirect if the status and
+// arguments indicate one.
+func (c *converter) returnDirective(dir directive) (map[string]interface{}, bool) {
+	if len(dir.args) == 0 || len(dir.args) > 2 {
+		c.warnf(dir, "expected a status code and optional body or URL")
+		return nil, false
+	}
+	code, err := strconv.Atoi(dir.args[0])
+	if err != nil {
+		c.warnf(dir, "bad status code '%s'", dir.args[0])
+		return nil, false
+	}
+	handler := map[string]interface{}{
+		"handler":     "static_response",
+		"status_code": code,
+	}
+	if len(dir.args) == 2 {
+		arg := replacePlaceholders(dir.args[1])
+		if code >= 300 && code < 400 {
+			handler["headers"] = map[string]interface{}{"Location": []string{arg}}
+		} else {
+			handler["body"] = arg
+		}
+	}
+	return handler, true
+}
+
+// nginxCaptures matches the positional capture variables $1-$9.
+var nginxCaptures = regexp.MustCompile(`\$([1-9])`)
+
+// rewrite converts a rewrite directive into a path_regexp-matched
+// route that either rewrites the URI or issues a redirect.
+func (c *converter) rewrite(dir directive) (interface{}, bool) {
+	if len(dir.args) < 2 || len(dir.args) > 3 {
+		c.warnf(dir, "expected a pattern and replacement with optional flag")
+		return nil, false
+	}
+	replacement := nginxCaptures.ReplaceAllString(replacePlaceholders(dir.args[1]), "{http.regexp.$1}")
+
+	var handler map[string]interface{}
+	flag := ""
+	if len(dir.args) == 3 {
+		flag = dir.args[2]
+	}
+	switch flag {
+	case "", "last", "break":
+		handler = map[string]interface{}{
+			"handler": "rewrite",
+			"uri":     replacement,
+		}
+	case "redirect", "permanent":
+		code := 302
+		if flag == "permanent" {
+			code = 301
+		}
+		handler = map[string]interface{}{
+			"handler":     "static_response",
+			"status_code": code,
+			"headers":     map[string]interface{}{"Location": []string{replacement}},
+		}
+	default:
+		c.warnf(dir, "unrecognized flag '%s'", flag)
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"match": []interface{}{map[string]interface{}{
+			"path_regexp": map[string]interface{}{"pattern": dir.args[0]},
+		}},
+		"handle": []interface{}{handler},
+	}, true
+}
+
+// nginxVariables maps the most common nginx variables to their
+// Caddy placeholder equivalents.
+var nginxVariables = strings.NewReplacer(
+	"$uri", "{http.request.uri.path}",
+	"$request_uri", "{http.request.uri}",
+	"$args", "{http.request.uri.query}",
+	"$query_string", "{http.request.uri.query}",
+	"$host", "{http.request.host}",
+	"$scheme", "{http.request.scheme}",
+	"$remote_addr", "{http.request.remote.host}",
+)
+
+// replacePlaceholders rewrites common nginx variables in s to
+// Caddy placeholders; unknown variables pass through unchanged.
+func replacePlaceholders(s string) string {
+	return nginxVariables.Replace(s)
+}
+
+// handlerRoute wraps a single handler in a route.
+func handlerRoute(handler map[string]interface{}) interface{} {
+	return map[string]interface{}{"handle": []interface{}{handler}}
+}
+
+// Interface guard
+var _ caddyconfig.Adapter = (*Adapter)(nil)
@@ -0,0 +1,131 @@
+package nginxconf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	dirs, err := parse([]byte(`
+# comment
+user www-data;
+http {
+	server {
+		listen 80;
+		add_header X-Foo "quoted value; with punctuation";
+		location /static/ {
+			root /var/www;
+		}
+	}
+}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dirs) != 2 {
+		t.Fatalf("expected 2 top-level directives, got %d", len(dirs))
+	}
+	srv := dirs[1].block[0]
+	if srv.name != "server" || len(srv.block) != 3 {
+		t.Fatalf("unexpected server block: %+v", srv)
+	}
+	if got := srv.block[1].args[1]; got != "quoted value; with punctuation" {
+		t.Errorf("bad quoted argument: %s", got)
+	}
+	if loc := srv.block[2]; loc.args[0] != "/static/" || loc.block[0].name != "root" {
+		t.Errorf("bad location block: %+v", loc)
+	}
+
+	for i, badInput := range []string{
+		`server {`,
+		`}`,
+		`listen 80`,
+		`root "/var/www;`,
+	} {
+		if _, err := parse([]byte(badInput)); err == nil {
+			t.Errorf("Test %d: expected error for %q", i, badInput)
+		}
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	input := `
+http {
+	upstream backend {
+		server 10.0.0.1:8080;
+		server 10.0.0.2:8080;
+	}
+	server {
+		listen 80;
+		server_name example.com www.example.com;
+		root /var/www;
+		location /api/ {
+			proxy_pass http://backend;
+		}
+		location = /old {
+			return 301 /new;
+		}
+		ssl_certificate /etc/ssl/cert.pem;
+	}
+}
+`
+	result, warnings, err := (Adapter{}).Adapt([]byte(input), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var cfg struct {
+		Apps struct {
+			HTTP struct {
+				Servers map[string]struct {
+					Listen []string          `json:"listen"`
+					Routes []json.RawMessage `json:"routes"`
+				} `json:"servers"`
+			} `json:"http"`
+		} `json:"apps"`
+	}
+	if err := json.Unmarshal(result, &cfg); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	srv, ok := cfg.Apps.HTTP.Servers["srv0"]
+	if !ok {
+		t.Fatalf("expected server srv0; got: %s", result)
+	}
+	if len(srv.Listen) != 1 || srv.Listen[0] != ":80" {
+		t.Errorf("unexpected listen addresses: %v", srv.Listen)
+	}
+	if len(srv.Routes) != 1 {
+		t.Fatalf("expected 1 route, got %d", len(srv.Routes))
+	}
+	for _, expect := range []string{
+		`"host":["example.com","www.example.com"]`,
+		`"root":"/var/www"`,
+		`"dial":"10.0.0.1:8080"`,
+		`"dial":"10.0.0.2:8080"`,
+		`"path":["/api/*"]`,
+		`"path":["/old"]`,
+		`"status_code":301`,
+		`"handler":"file_server"`,
+	} {
+		if !strings.Contains(string(result), expect) {
+			t.Errorf("expected output to contain %s; got: %s", expect, result)
+		}
+	}
+
+	// the exact-match location must sort before the prefix location
+	if old, api := strings.Index(string(result), "/old"), strings.Index(string(result), "/api/"); old > api {
+		t.Errorf("expected exact location before prefix location; got: %s", result)
+	}
+
+	// ssl_certificate has no equivalent and must be reported
+	var warned bool
+	for _, warn := range warnings {
+		if warn.Directive == "ssl_certificate" {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Errorf("expected a warning for ssl_certificate; got: %+v", warnings)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nginxconf
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// directive is one nginx directive: a name, its arguments, and,
+// for block directives like server or location, nested directives.
+type directive struct {
+	name  string
+	args  []string
+	line  int
+	block []directive // non-nil only if the directive had a { } block
+}
+
+// parse tokenizes and parses an nginx config body into a
+// directive tree.
+func parse(body []byte) ([]directive, error) {
+	tokens, err := tokenize(body)
+	if err != nil {
+		return nil, err
+	}
+	dirs, rest, err := parseDirectives(tokens, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected '%s'", rest[0].line, rest[0].text)
+	}
+	return dirs, nil
+}
+
+// token is a single nginx config token: a word, quoted string,
+// or one of the punctuation characters { } ;
+type token struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+// tokenize splits an nginx config into tokens. Comments run
+// from '#' to the end of the line.
+func tokenize(body []byte) ([]token, error) {
+	var tokens []token
+	line := 1
+	input := string(body)
+	for i := 0; i < len(input); i++ {
+		ch := rune(input[i])
+		switch {
+		case ch == '\n':
+			line++
+		case unicode.IsSpace(ch):
+		case ch == '#':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+			line++
+		case ch == '{' || ch == '}' || ch == ';':
+			tokens = append(tokens, token{text: string(ch), line: line})
+		case ch == '"' || ch == '\'':
+			quote := input[i]
+			var sb strings.Builder
+			i++
+			for ; i < len(input) && input[i] != quote; i++ {
+				if input[i] == '\\' && i+1 < len(input) {
+					i++
+				}
+				if input[i] == '\n' {
+					line++
+				}
+				sb.WriteByte(input[i])
+			}
+			if i >= len(input) {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+			}
+			tokens = append(tokens, token{text: sb.String(), line: line, quoted: true})
+		default:
+			start := i
+			for i < len(input) && !strings.ContainsRune("{};#'\"", rune(input[i])) &&
+				!unicode.IsSpace(rune(input[i])) {
+				i++
+			}
+			tokens = append(tokens, token{text: input[start:i], line: line})
+			i--
+		}
+	}
+	return tokens, nil
+}
+
+// parseDirectives parses tokens into directives until the tokens
+// are exhausted or, if inBlock, a closing brace is found. It
+// returns the directives and the unconsumed tokens.
+func parseDirectives(tokens []token, inBlock bool) ([]directive, []token, error) {
+	var dirs []directive
+	for len(tokens) > 0 {
+		tkn := tokens[0]
+		if tkn.text == "}" && !tkn.quoted {
+			if !inBlock {
+				return nil, nil, fmt.Errorf("line %d: unexpected '}'", tkn.line)
+			}
+			return dirs, tokens[1:], nil
+		}
+		if (tkn.text == "{" || tkn.text == ";") && !tkn.quoted {
+			return nil, nil, fmt.Errorf("line %d: unexpected '%s'", tkn.line, tkn.text)
+		}
+
+		dir := directive{name: tkn.text, line: tkn.line}
+		tokens = tokens[1:]
+
+		// gather arguments until the directive is terminated
+		// by a semicolon or opens a block
+	args:
+		for {
+			if len(tokens) == 0 {
+				return nil, nil, fmt.Errorf("line %d: unexpected end of input in directive '%s'", dir.line, dir.name)
+			}
+			tkn = tokens[0]
+			tokens = tokens[1:]
+			switch {
+			case tkn.text == ";" && !tkn.quoted:
+				break args
+			case tkn.text == "{" && !tkn.quoted:
+				var err error
+				dir.block, tokens, err = parseDirectives(tokens, true)
+				if err != nil {
+					return nil, nil, err
+				}
+				if dir.block == nil {
+					dir.block = []directive{}
+				}
+				break args
+			case tkn.text == "}" && !tkn.quoted:
+				return nil, nil, fmt.Errorf("line %d: unexpected '}'", tkn.line)
+			default:
+				dir.args = append(dir.args, tkn.text)
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	if inBlock {
+		return nil, nil, fmt.Errorf("unexpected end of input; unclosed block")
+	}
+	return dirs, tokens, nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tomlconfig
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/naoina/toml"
+)
+
+func init() {
+	caddyconfig.RegisterAdapter("toml", Adapter{})
+}
+
+// Adapter adapts TOML config to Caddy JSON. The TOML document
+// must have the same structure as Caddy's native JSON config;
+// this adapter only converts the encoding, not the schema.
+type Adapter struct{}
+
+// Adapt converts the TOML config in body to Caddy JSON.
+func (Adapter) Adapt(body []byte, options map[string]interface{}) ([]byte, []caddyconfig.Warning, error) {
+	var decoded map[string]interface{}
+	err := toml.Unmarshal(body, &decoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding TOML: %v", err)
+	}
+
+	result, err := json.Marshal(decoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encoding JSON: %v", err)
+	}
+
+	return result, nil, nil
+}
+
+// Interface guard
+var _ caddyconfig.Adapter = (*Adapter)(nil)
@@ -0,0 +1,45 @@
+package tomlconfig
+
+import "testing"
+
+func TestAdapt(t *testing.T) {
+	for i, tc := range []struct {
+		input     string
+		expect    string
+		shouldErr bool
+	}{
+		{
+			input: `
+[apps.http.servers.srv0]
+listen = [":80"]
+`,
+			expect: `{"apps":{"http":{"servers":{"srv0":{"listen":[":80"]}}}}}`,
+		},
+		{
+			input: `
+[admin]
+listen = "localhost:2020"
+`,
+			expect: `{"admin":{"listen":"localhost:2020"}}`,
+		},
+		{
+			input:     `listen = `,
+			shouldErr: true,
+		},
+	} {
+		result, _, err := (Adapter{}).Adapt([]byte(tc.input), nil)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, got: %s", i, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if string(result) != tc.expect {
+			t.Errorf("Test %d: expected %s but got %s", i, tc.expect, result)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamlconfig
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	caddyconfig.RegisterAdapter("yaml", Adapter{})
+}
+
+// Adapter adapts YAML config to Caddy JSON. The YAML document
+// must have the same structure as Caddy's native JSON config;
+// this adapter only converts the encoding, not the schema.
+type Adapter struct{}
+
+// Adapt converts the YAML config in body to Caddy JSON.
+func (Adapter) Adapt(body []byte, options map[string]interface{}) ([]byte, []caddyconfig.Warning, error) {
+	var decoded interface{}
+	err := yaml.Unmarshal(body, &decoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding YAML: %v", err)
+	}
+
+	decoded, err = jsonCompatible(decoded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := json.Marshal(decoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encoding JSON: %v", err)
+	}
+
+	return result, nil, nil
+}
+
+// jsonCompatible converts val, as decoded by the YAML package,
+// into a value that can be marshaled as JSON. YAML allows map
+// keys of any type, but JSON object keys must be strings.
+func jsonCompatible(val interface{}) (interface{}, error) {
+	switch val := val.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			keyStr, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-string key not allowed: %v", k)
+			}
+			convVal, err := jsonCompatible(v)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %v", keyStr, err)
+			}
+			converted[keyStr] = convVal
+		}
+		return converted, nil
+	case []interface{}:
+		for i, v := range val {
+			convVal, err := jsonCompatible(v)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %v", i, err)
+			}
+			val[i] = convVal
+		}
+		return val, nil
+	}
+	return val, nil
+}
+
+// Interface guard
+var _ caddyconfig.Adapter = (*Adapter)(nil)
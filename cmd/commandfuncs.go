@@ -505,6 +505,7 @@ func cmdAdaptConfig(fl Flags) (int, error) {
 func cmdValidateConfig(fl Flags) (int, error) {
 	validateCmdConfigFlag := fl.String("config")
 	validateCmdAdapterFlag := fl.String("adapter")
+	validateCmdProbeFlag := fl.Bool("probe")
 
 	input, _, err := loadConfig(validateCmdConfigFlag, validateCmdAdapterFlag)
 	if err != nil {
@@ -523,6 +524,17 @@ func cmdValidateConfig(fl Flags) (int, error) {
 		return caddy.ExitCodeFailedStartup, err
 	}
 
+	if validateCmdProbeFlag {
+		findings := probeConfig(input)
+		for _, finding := range findings {
+			fmt.Fprintf(os.Stderr, "[PROBE] %s\n", finding)
+		}
+		if len(findings) > 0 {
+			return caddy.ExitCodeFailedStartup,
+				fmt.Errorf("%d environment probe(s) failed", len(findings))
+		}
+	}
+
 	fmt.Println("Valid configuration")
 
 	return caddy.ExitCodeSuccess, nil
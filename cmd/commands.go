@@ -240,16 +240,23 @@ zero exit status will be returned.`,
 	RegisterCommand(Command{
 		Name:  "validate",
 		Func:  cmdValidateConfig,
-		Usage: "--config <path> [--adapter <name>]",
+		Usage: "--config <path> [--adapter <name>] [--probe]",
 		Short: "Tests whether a configuration file is valid",
 		Long: `
 Loads and provisions the provided config, but does not start running it.
 This reveals any errors with the configuration through the loading and
-provisioning stages.`,
+provisioning stages.
+
+If --probe is used, the environment the config refers to is also checked
+with non-destructive probes: upstream hostnames are resolved, root
+directories are checked for existence, certificate and key files are
+parsed, and listener addresses are briefly bound to confirm they are
+available. All findings are reported, not just the first.`,
 		Flags: func() *flag.FlagSet {
 			fs := flag.NewFlagSet("load", flag.ExitOnError)
 			fs.String("config", "", "Input configuration file")
 			fs.String("adapter", "", "Name of config adapter")
+			fs.Bool("probe", false, "Also probe the runtime environment")
 			return fs
 		}(),
 	})
@@ -27,12 +27,14 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/certmagic"
 	"go.uber.org/zap"
 )
@@ -59,6 +61,20 @@ func Main() {
 		os.Args = append(os.Args, "help")
 	}
 
+	// if the service manager started this process, hand control
+	// to it; it runs the subcommand itself and translates service
+	// control requests (Windows only; a no-op elsewhere)
+	if serviceMode() {
+		runService()
+		return
+	}
+
+	runSubcommand()
+}
+
+// runSubcommand dispatches the subcommand named by the process
+// arguments and exits with its exit code.
+func runSubcommand() {
 	subcommandName := os.Args[1]
 	subcommand, ok := commands[subcommandName]
 	if !ok {
@@ -194,7 +210,12 @@ func loadConfig(configFile, adapterName string) ([]byte, string, error) {
 }
 
 // watchConfigFile watches the config file at filename for changes
-// and reloads the config if the file was updated. This function
+// and reloads the config if the file was updated. For Caddyfile
+// configs, files pulled in by import directives are watched too,
+// since editing an imported file should also trigger a reload.
+// Reloads are debounced so a burst of writes (as editors often
+// produce) causes a single reload, and a change that fails to
+// adapt or apply leaves the previous config running. This function
 // blocks indefinitely; it only quits if the poller has errors for
 // long enough time. The filename passed in must be the actual
 // config file used, not one to be discovered.
@@ -213,15 +234,43 @@ func watchConfigFile(filename, adapterName string) {
 			With(zap.String("config_file", filename))
 	}
 
-	// get the initial timestamp on the config file
-	info, err := os.Stat(filename)
-	if err != nil {
+	// stamp records the last-modified time of each file;
+	// files that cannot be statted keep the zero time
+	stamp := func(files []string) map[string]time.Time {
+		stamps := make(map[string]time.Time, len(files))
+		for _, file := range files {
+			if info, err := os.Stat(file); err == nil {
+				stamps[file] = info.ModTime()
+			}
+		}
+		return stamps
+	}
+	changed := func(old, new map[string]time.Time) bool {
+		if len(old) != len(new) {
+			return true
+		}
+		for file, modTime := range new {
+			if !old[file].Equal(modTime) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// make sure the config file is there before we settle in
+	if _, err := os.Stat(filename); err != nil {
 		logger().Error("cannot watch config file", zap.Error(err))
 		return
 	}
-	lastModified := info.ModTime()
 
-	logger().Info("watching config file for changes")
+	// the watched set is the config file plus any files it
+	// imports; it is re-discovered after every successful
+	// reload, since a change may add or remove imports
+	watched := configWatchFiles(filename, adapterName, logger())
+	lastStamps := stamp(watched)
+
+	logger().Info("watching config file for changes",
+		zap.Int("watched_files", len(watched)))
 
 	// if the file disappears or something, we can
 	// stop polling if the error lasts long enough
@@ -242,9 +291,8 @@ func watchConfigFile(filename, adapterName string) {
 	// begin poller
 	//nolint:staticcheck
 	for range time.Tick(1 * time.Second) {
-		// get the file info
-		info, err := os.Stat(filename)
-		if err != nil {
+		// the config file itself must remain accessible
+		if _, err := os.Stat(filename); err != nil {
 			if finalError(err) {
 				return
 			}
@@ -252,29 +300,124 @@ func watchConfigFile(filename, adapterName string) {
 		}
 		lastErr = time.Time{} // no error, so clear any memory of one
 
-		// if it hasn't changed, nothing to do
-		if !info.ModTime().After(lastModified) {
+		// if nothing has changed, nothing to do
+		stamps := stamp(watched)
+		if !changed(lastStamps, stamps) {
 			continue
 		}
 
-		logger().Info("config file changed; reloading")
+		// debounce: editors often write files in several steps,
+		// so wait for the files to settle before reloading
+		for {
+			time.Sleep(500 * time.Millisecond)
+			next := stamp(watched)
+			if !changed(stamps, next) {
+				break
+			}
+			stamps = next
+		}
+		lastStamps = stamps
 
-		// remember this timestamp
-		lastModified = info.ModTime()
+		logger().Info("config file changed; reloading")
 
 		// load the contents of the file
 		config, _, err := loadConfig(filename, adapterName)
 		if err != nil {
-			logger().Error("unable to load latest config", zap.Error(err))
+			logger().Error("unable to load latest config; previous config still running",
+				zap.Error(err))
 			continue
 		}
 
 		// apply the updated config
 		err = caddy.Load(config, false)
 		if err != nil {
-			logger().Error("applying latest config", zap.Error(err))
+			logger().Error("applying latest config; previous config still running",
+				zap.Error(err))
 			continue
 		}
+
+		// the new config may import a different set of files
+		watched = configWatchFiles(filename, adapterName, logger())
+		lastStamps = stamp(watched)
+	}
+}
+
+// configWatchFiles returns the set of files that --watch should
+// monitor for the given config file: the file itself and, for
+// Caddyfile configs, any files pulled in by import directives,
+// discovered recursively. Discovery problems are logged and the
+// affected file skipped, since a genuinely broken import will
+// surface properly when the config is adapted.
+func configWatchFiles(filename, adapterName string, logger *zap.Logger) []string {
+	// assume the Caddyfile adapter the same way loadConfig does
+	if adapterName == "" &&
+		strings.HasPrefix(filepath.Base(filename), "Caddyfile") &&
+		filepath.Ext(filename) != ".json" {
+		adapterName = "caddyfile"
+	}
+
+	files := map[string]bool{filename: true}
+	if adapterName == "caddyfile" {
+		caddyfileImports(filename, files, logger)
+	}
+
+	watched := make([]string, 0, len(files))
+	for file := range files {
+		watched = append(watched, file)
+	}
+	sort.Strings(watched)
+
+	return watched
+}
+
+// caddyfileImports adds to files the files imported by the
+// Caddyfile at filename, recursively. Import arguments may be
+// globs, and relative paths are resolved against the directory
+// of the importing file, like the caddyfile adapter does.
+func caddyfileImports(filename string, files map[string]bool, logger *zap.Logger) {
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		logger.Warn("unable to read file for import discovery",
+			zap.String("file", filename), zap.Error(err))
+		return
+	}
+	tokens, err := caddyfile.Tokenize(input, filename)
+	if err != nil {
+		logger.Warn("unable to tokenize file for import discovery",
+			zap.String("file", filename), zap.Error(err))
+		return
+	}
+
+	for i := 0; i < len(tokens)-1; i++ {
+		if tokens[i].Text != "import" || tokens[i].Quoted() {
+			continue
+		}
+		arg := tokens[i+1]
+		if arg.Line != tokens[i].Line {
+			continue
+		}
+
+		pattern := arg.Text
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filename), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			logger.Warn("unable to expand import pattern",
+				zap.String("pattern", pattern), zap.Error(err))
+			continue
+		}
+		for _, match := range matches {
+			if files[match] {
+				continue
+			}
+			info, err := os.Stat(match)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			files[match] = true
+			caddyfileImports(match, files, logger)
+		}
 	}
 }
 
@@ -327,6 +470,18 @@ func (f Flags) Duration(name string) time.Duration {
 	return val
 }
 
+// StringSlice is a flag.Value that accumulates every
+// value of a repeatable flag into a slice.
+type StringSlice []string
+
+func (ss StringSlice) String() string { return "[" + strings.Join(ss, " ") + "]" }
+
+// Set appends value to the slice.
+func (ss *StringSlice) Set(value string) error {
+	*ss = append(*ss, value)
+	return nil
+}
+
 // flagHelp returns the help text for fs.
 func flagHelp(fs *flag.FlagSet) string {
 	if fs == nil {
@@ -0,0 +1,166 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddycmd
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// probeConfig performs non-destructive runtime probes against the
+// environment a config refers to: it resolves upstream hostnames,
+// checks that root directories exist, verifies that certificate and
+// key files parse, and confirms that listener addresses are bindable.
+// All problems found are returned rather than just the first one.
+// The config is inspected structurally, so probes work regardless of
+// which modules are plugged in.
+func probeConfig(cfgJSON []byte) []string {
+	var decoded interface{}
+	err := json.Unmarshal(cfgJSON, &decoded)
+	if err != nil {
+		return []string{fmt.Sprintf("decoding config: %v", err)}
+	}
+
+	p := prober{probed: make(map[string]bool)}
+	p.walk(decoded)
+	return p.findings
+}
+
+// prober accumulates probe findings while walking a decoded config.
+type prober struct {
+	findings []string
+	probed   map[string]bool // avoid repeating a probe (and its finding)
+}
+
+func (p *prober) findf(format string, args ...interface{}) {
+	p.findings = append(p.findings, fmt.Sprintf(format, args...))
+}
+
+// walk descends into val and runs probes on the config
+// properties it recognizes.
+func (p *prober) walk(val interface{}) {
+	switch val := val.(type) {
+	case map[string]interface{}:
+		if dial, ok := val["dial"].(string); ok {
+			p.probeOnce("dial "+dial, func() { p.probeDial(dial) })
+		}
+		if root, ok := val["root"].(string); ok {
+			p.probeOnce("root "+root, func() { p.probeRoot(root) })
+		}
+		if listen, ok := val["listen"].([]interface{}); ok {
+			for _, addr := range listen {
+				if addr, ok := addr.(string); ok {
+					p.probeOnce("listen "+addr, func() { p.probeListen(addr) })
+				}
+			}
+		}
+		certFile, haveCert := val["certificate"].(string)
+		keyFile, haveKey := val["key"].(string)
+		if haveCert && haveKey {
+			p.probeOnce("keypair "+certFile, func() { p.probeKeyPair(certFile, keyFile) })
+		}
+
+		// keep output deterministic
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			p.walk(val[key])
+		}
+	case []interface{}:
+		for _, elem := range val {
+			p.walk(elem)
+		}
+	}
+}
+
+func (p *prober) probeOnce(key string, probe func()) {
+	if p.probed[key] {
+		return
+	}
+	p.probed[key] = true
+	probe()
+}
+
+// probeDial checks that the host part of an upstream
+// dial address resolves.
+func (p *prober) probeDial(dial string) {
+	host, _, err := net.SplitHostPort(dial)
+	if err != nil {
+		// not all dial addresses are host:port (e.g. unix sockets)
+		return
+	}
+	if net.ParseIP(host) != nil || strings.Contains(host, "{") {
+		return
+	}
+	if _, err := net.LookupHost(host); err != nil {
+		p.findf("upstream %s: hostname does not resolve: %v", dial, err)
+	}
+}
+
+// probeRoot checks that a site root exists and is a directory.
+func (p *prober) probeRoot(root string) {
+	if strings.Contains(root, "{") {
+		return // placeholders are only known at request time
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		p.findf("root %s: %v", root, err)
+		return
+	}
+	if !info.IsDir() {
+		p.findf("root %s: not a directory", root)
+	}
+}
+
+// probeListen checks that a listener address can actually be
+// bound, by briefly binding and releasing it.
+func (p *prober) probeListen(addr string) {
+	na, err := caddy.ParseNetworkAddress(addr)
+	if err != nil {
+		p.findf("listen %s: %v", addr, err)
+		return
+	}
+	if !strings.HasPrefix(na.Network, "tcp") {
+		// binding a unix socket would leave a file behind, and
+		// packet listeners are not probed
+		return
+	}
+	for portOffset := uint(0); portOffset < na.PortRangeSize(); portOffset++ {
+		ln, err := net.Listen(na.Network, na.JoinHostPort(portOffset))
+		if err != nil {
+			p.findf("listen %s: cannot bind: %v", addr, err)
+			continue
+		}
+		ln.Close()
+	}
+}
+
+// probeKeyPair checks that a certificate and key file
+// load as a valid TLS key pair.
+func (p *prober) probeKeyPair(certFile, keyFile string) {
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		p.findf("certificate %s with key %s: %v", certFile, keyFile, err)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddycmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func init() {
+	RegisterCommand(Command{
+		Name:  "service-install",
+		Func:  cmdServiceInstall,
+		Usage: "[--name <name>] [--config <path> [--adapter <name>]]",
+		Short: "Installs Caddy as a Windows service",
+		Long: `
+Registers this Caddy binary with the Windows service control manager so it
+starts automatically at boot and can be managed with the standard service
+tools. The service runs 'caddy run' with the given config file, if any.
+
+The config file path is made absolute before it is stored with the service,
+since services do not start in this directory.`,
+		Flags: func() *flag.FlagSet {
+			fs := flag.NewFlagSet("service-install", flag.ExitOnError)
+			fs.String("name", defaultServiceName, "Name of the service")
+			fs.String("config", "", "Configuration file the service should run with")
+			fs.String("adapter", "", "Name of config adapter to apply")
+			return fs
+		}(),
+	})
+
+	RegisterCommand(Command{
+		Name:  "service-uninstall",
+		Func:  cmdServiceUninstall,
+		Usage: "[--name <name>]",
+		Short: "Uninstalls the Caddy Windows service",
+		Flags: func() *flag.FlagSet {
+			fs := flag.NewFlagSet("service-uninstall", flag.ExitOnError)
+			fs.String("name", defaultServiceName, "Name of the service")
+			return fs
+		}(),
+	})
+
+	RegisterCommand(Command{
+		Name:  "service-start",
+		Func:  cmdServiceStart,
+		Usage: "[--name <name>]",
+		Short: "Starts the Caddy Windows service",
+		Flags: func() *flag.FlagSet {
+			fs := flag.NewFlagSet("service-start", flag.ExitOnError)
+			fs.String("name", defaultServiceName, "Name of the service")
+			return fs
+		}(),
+	})
+
+	RegisterCommand(Command{
+		Name:  "service-stop",
+		Func:  cmdServiceStop,
+		Usage: "[--name <name>]",
+		Short: "Stops the Caddy Windows service",
+		Flags: func() *flag.FlagSet {
+			fs := flag.NewFlagSet("service-stop", flag.ExitOnError)
+			fs.String("name", defaultServiceName, "Name of the service")
+			return fs
+		}(),
+	})
+}
+
+// defaultServiceName is the name the service is registered
+// under unless --name is given.
+const defaultServiceName = "caddy"
+
+func cmdServiceInstall(fl Flags) (int, error) {
+	name := fl.String("name")
+	configFlag := fl.String("config")
+	adapterFlag := fl.String("adapter")
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	// the service does not start in this directory, so
+	// a relative config path would not resolve for it
+	args := []string{"run"}
+	if configFlag != "" {
+		absConfig, err := filepath.Abs(configFlag)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, err
+		}
+		args = append(args, "--config", absConfig)
+	}
+	if adapterFlag != "" {
+		args = append(args, "--adapter", adapterFlag)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("connecting to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err == nil {
+		s.Close()
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("service %s already exists", name)
+	}
+
+	s, err = m.CreateService(name, exePath, mgr.Config{
+		DisplayName: "Caddy",
+		Description: "Caddy web server",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("creating service: %v", err)
+	}
+	defer s.Close()
+
+	fmt.Printf("Service %s installed; start it with: caddy service-start\n", name)
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+func cmdServiceUninstall(fl Flags) (int, error) {
+	name := fl.String("name")
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("connecting to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	err = s.Delete()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("deleting service: %v", err)
+	}
+
+	fmt.Printf("Service %s uninstalled\n", name)
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+func cmdServiceStart(fl Flags) (int, error) {
+	name := fl.String("name")
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("connecting to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	err = s.Start()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("starting service: %v", err)
+	}
+
+	fmt.Printf("Service %s started\n", name)
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+func cmdServiceStop(fl Flags) (int, error) {
+	name := fl.String("name")
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("connecting to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("stopping service: %v", err)
+	}
+
+	// the stop control only requests the stop; wait for
+	// the service to actually finish shutting down
+	deadline := time.Now().Add(30 * time.Second)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return caddy.ExitCodeFailedQuit, fmt.Errorf("timed out waiting for service to stop")
+		}
+		time.Sleep(300 * time.Millisecond)
+		status, err = s.Query()
+		if err != nil {
+			return caddy.ExitCodeFailedQuit, fmt.Errorf("querying service status: %v", err)
+		}
+	}
+
+	fmt.Printf("Service %s stopped\n", name)
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+// serviceMode reports whether the process was started by the
+// Windows service control manager rather than interactively.
+func serviceMode() bool {
+	interactive, err := svc.IsAnInteractiveSession()
+	return err == nil && !interactive
+}
+
+// runService runs the subcommand the service was registered
+// with (normally 'caddy run') under service manager control,
+// translating SCM control requests into the corresponding
+// caddy operations: a stop or shutdown request stops the
+// config gracefully, and a parameter-change request reloads
+// the config file the service was started with.
+func runService() {
+	err := svc.Run("", caddyService{})
+	if err != nil {
+		caddy.Log().Named("service").Error("service run failed", zap.Error(err))
+		os.Exit(caddy.ExitCodeFailedStartup)
+	}
+}
+
+type caddyService struct{}
+
+func (caddyService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	// run the subcommand in the background; it blocks
+	// indefinitely, and exits the process on failure,
+	// which the service manager reports as a crash
+	go runSubcommand()
+
+	const accepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for req := range r {
+		switch req.Cmd {
+		case svc.Interrogate:
+			changes <- req.CurrentStatus
+		case svc.ParamChange:
+			err := reloadServiceConfig()
+			if err != nil {
+				caddy.Log().Named("service").Error("reloading config", zap.Error(err))
+			}
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			err := caddy.Stop()
+			if err != nil {
+				caddy.Log().Named("service").Error("stopping config", zap.Error(err))
+				return false, uint32(caddy.ExitCodeFailedQuit)
+			}
+			return false, 0
+		}
+	}
+
+	return false, 0
+}
+
+// reloadServiceConfig re-reads the config file the service was
+// registered with and applies it to the running instance.
+func reloadServiceConfig() error {
+	configFile, adapterName := serviceConfigFlags()
+	if configFile == "" {
+		return fmt.Errorf("no config file to reload (service was started without --config)")
+	}
+	cfgJSON, _, err := loadConfig(configFile, adapterName)
+	if err != nil {
+		return err
+	}
+	return caddy.Load(cfgJSON, false)
+}
+
+// serviceConfigFlags extracts the --config and --adapter flag
+// values from the arguments the service was started with.
+func serviceConfigFlags() (configFile, adapterName string) {
+	for i, arg := range os.Args {
+		if i+1 >= len(os.Args) {
+			break
+		}
+		switch arg {
+		case "--config", "-config":
+			configFile = os.Args[i+1]
+		case "--adapter", "-adapter":
+			adapterName = os.Args[i+1]
+		}
+	}
+	return
+}
@@ -0,0 +1,264 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultMaxConfigHistory is how many replaced configs are kept
+// on disk when the limit is not configured explicitly.
+const defaultMaxConfigHistory = 10
+
+// ConfigVersion describes one entry of the config history.
+type ConfigVersion struct {
+	// The version number; 1 is the most recently replaced config,
+	// larger numbers are progressively older.
+	Number int `json:"number"`
+
+	// When the config was replaced, i.e. saved to the history.
+	Saved time.Time `json:"saved"`
+
+	// The size of the config JSON, in bytes.
+	Size int64 `json:"size"`
+}
+
+// configHistoryDir is where replaced configs are persisted.
+func configHistoryDir() string {
+	return filepath.Join(AppConfigDir(), "config_history")
+}
+
+// historySettings returns the config management settings of the
+// currently-running config, or zero-value settings if there are
+// none. A lock on currentCfgMu is required.
+func historySettings() *ConfigSettings {
+	if currentCfg == nil || currentCfg.Admin == nil || currentCfg.Admin.Config == nil {
+		return new(ConfigSettings)
+	}
+	return currentCfg.Admin.Config
+}
+
+// saveConfigVersion writes cfgJSON to the config history and
+// prunes versions beyond max (<= 0 means the default limit).
+// Errors are logged rather than returned because a full disk
+// should not prevent a config change from taking effect.
+func saveConfigVersion(cfgJSON []byte, max int) {
+	if max <= 0 {
+		max = defaultMaxConfigHistory
+	}
+	dir := configHistoryDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		Log().Error("unable to create config history folder",
+			zap.String("dir", dir),
+			zap.Error(err))
+		return
+	}
+	filename := filepath.Join(dir, fmt.Sprintf("%d.json", time.Now().UnixNano()))
+	if err := ioutil.WriteFile(filename, cfgJSON, 0600); err != nil {
+		Log().Error("unable to save config to history",
+			zap.String("file", filename),
+			zap.Error(err))
+		return
+	}
+	stamps, err := configHistoryStamps(dir)
+	if err != nil {
+		return
+	}
+	for i := max; i < len(stamps); i++ {
+		os.Remove(filepath.Join(dir, fmt.Sprintf("%d.json", stamps[i])))
+	}
+}
+
+// configHistoryStamps returns the timestamps of the stored config
+// versions in dir, newest first.
+func configHistoryStamps(dir string) ([]int64, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var stamps []int64
+	for _, info := range infos {
+		ts, err := strconv.ParseInt(strings.TrimSuffix(info.Name(), ".json"), 10, 64)
+		if err != nil || !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		stamps = append(stamps, ts)
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] > stamps[j] })
+	return stamps, nil
+}
+
+// listConfigHistory returns the stored config versions, newest first.
+func listConfigHistory() ([]ConfigVersion, error) {
+	dir := configHistoryDir()
+	stamps, err := configHistoryStamps(dir)
+	if os.IsNotExist(err) {
+		return []ConfigVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]ConfigVersion, 0, len(stamps))
+	for i, ts := range stamps {
+		version := ConfigVersion{
+			Number: i + 1,
+			Saved:  time.Unix(0, ts),
+		}
+		if info, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%d.json", ts))); err == nil {
+			version.Size = info.Size()
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// loadConfigVersion reads config version n from the history,
+// where 1 is the most recently replaced config.
+func loadConfigVersion(n int) ([]byte, error) {
+	dir := configHistoryDir()
+	stamps, err := configHistoryStamps(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if n < 1 || n > len(stamps) {
+		return nil, fmt.Errorf("no config version %d in history", n)
+	}
+	return ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.json", stamps[n-1])))
+}
+
+// handleConfigHistory responds to GET /config/history with the
+// list of stored config versions.
+func handleConfigHistory(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+	versions, err := listConfigHistory()
+	if err != nil {
+		return APIError{
+			Code: http.StatusInternalServerError,
+			Err:  fmt.Errorf("reading config history: %v", err),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(versions)
+}
+
+// handleConfigRollback responds to POST /config/rollback/{n} by
+// loading config version n from the history.
+func handleConfigRollback(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"+rawConfigKey+"/rollback/"))
+	if err != nil || n < 1 {
+		return APIError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("invalid config version number"),
+		}
+	}
+	cfgJSON, err := loadConfigVersion(n)
+	if err != nil {
+		return APIError{
+			Code: http.StatusNotFound,
+			Err:  fmt.Errorf("loading config version %d: %v", n, err),
+		}
+	}
+	err = LoadWithActor(cfgJSON, true, AdminRequestActor(r))
+	if err != nil {
+		return APIError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("rolling back to config version %d: %v", n, err),
+		}
+	}
+	Log().Named("admin.api").Info("rolled back config", zap.Int("version", n))
+	return nil
+}
+
+// monitorNewConfig watches a newly-applied config for the duration
+// of the grace window, requiring each health check URL to respond
+// with a status below 400 at least once before the window closes;
+// if any does not, the previous config prevCfg is restored. The
+// rollback is skipped if yet another config was applied meanwhile
+// (i.e. the generation advanced past gen).
+func monitorNewConfig(gen int64, prevCfg []byte, window time.Duration, checks []string) {
+	logger := Log().Named("admin.config")
+
+	remaining := make(map[string]struct{}, len(checks))
+	for _, url := range checks {
+		remaining[url] = struct{}{}
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(window)
+	for len(remaining) > 0 && time.Now().Before(deadline) {
+		for url := range remaining {
+			resp, err := client.Get(url)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode < 400 {
+				delete(remaining, url)
+			}
+		}
+		if len(remaining) > 0 {
+			time.Sleep(1 * time.Second)
+		}
+	}
+	if len(remaining) == 0 {
+		logger.Info("new config passed health checks",
+			zap.Duration("grace_window", window))
+		return
+	}
+
+	failed := make([]string, 0, len(remaining))
+	for url := range remaining {
+		failed = append(failed, url)
+	}
+	sort.Strings(failed)
+
+	// don't stomp on a config that was applied while we were watching
+	currentCfgMu.RLock()
+	stale := gen != configGeneration
+	currentCfgMu.RUnlock()
+	if stale {
+		logger.Warn("health checks failed, but config changed again; not rolling back",
+			zap.Strings("failed", failed))
+		return
+	}
+
+	logger.Error("new config failed health checks within grace window; rolling back",
+		zap.Strings("failed", failed),
+		zap.Duration("grace_window", window))
+	if err := LoadWithActor(prevCfg, true, "health monitor"); err != nil {
+		logger.Error("rolling back config", zap.Error(err))
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterModule(EnvConfigSource{})
+	RegisterModule(FileConfigSource{})
+}
+
+// ConfigSource is a module that resolves config placeholders at
+// load time. A module named <name> in the caddy.config_sources
+// namespace handles placeholders of the form {<name>.<key>}.
+// Resolution happens on a copy of the config that is about to be
+// decoded and run, so resolved values (such as secrets) never
+// appear in the stored or autosaved config JSON, and sources are
+// consulted again on every reload.
+type ConfigSource interface {
+	ResolveConfigValue(key string) (string, error)
+}
+
+// configSourcePlaceholder matches {<source>.<key>} placeholders.
+// Keys cannot contain braces, quotes, or backslashes, so runtime
+// placeholders inside JSON strings are left intact unless their
+// prefix names a registered config source.
+var configSourcePlaceholder = regexp.MustCompile(`\{(\w+)\.([^{}"\\]+)\}`)
+
+// resolveConfigSources replaces the placeholders in cfgJSON that
+// are handled by registered config source modules, leaving all
+// other placeholders alone. Each distinct placeholder is resolved
+// only once per call, and values are JSON-escaped so they can be
+// substituted into string values safely.
+func resolveConfigSources(cfgJSON []byte) ([]byte, error) {
+	sources := make(map[string]ConfigSource)
+	for _, mod := range GetModules("caddy.config_sources") {
+		if src, ok := mod.New().(ConfigSource); ok {
+			sources[mod.ID.Name()] = src
+		}
+	}
+	if len(sources) == 0 {
+		return cfgJSON, nil
+	}
+
+	cache := make(map[string]string)
+	var firstErr error
+	out := configSourcePlaceholder.ReplaceAllFunc(cfgJSON, func(match []byte) []byte {
+		if firstErr != nil {
+			return match
+		}
+		if cached, ok := cache[string(match)]; ok {
+			return []byte(cached)
+		}
+		groups := configSourcePlaceholder.FindSubmatch(match)
+		src, ok := sources[string(groups[1])]
+		if !ok {
+			// not a config source; leave for runtime replacers
+			return match
+		}
+		val, err := src.ResolveConfigValue(string(groups[2]))
+		if err != nil {
+			firstErr = fmt.Errorf("resolving %s: %v", match, err)
+			return match
+		}
+		escaped := jsonEscape(val)
+		cache[string(match)] = escaped
+		return []byte(escaped)
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// jsonEscape escapes s for substitution into a JSON string value.
+func jsonEscape(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+// EnvConfigSource resolves {env.*} placeholders at config load
+// time from the environment. Unset variables resolve to an empty
+// string, like the runtime replacer.
+type EnvConfigSource struct{}
+
+// CaddyModule returns the Caddy module information.
+func (EnvConfigSource) CaddyModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "caddy.config_sources.env",
+		New: func() Module { return new(EnvConfigSource) },
+	}
+}
+
+// ResolveConfigValue returns the value of the environment variable key.
+func (EnvConfigSource) ResolveConfigValue(key string) (string, error) {
+	return os.Getenv(key), nil
+}
+
+// FileConfigSource resolves {file.*} placeholders at config load
+// time by reading the file at the path given as the key, so
+// secrets can live in tightly-permissioned files instead of the
+// config itself. Trailing newlines are trimmed.
+type FileConfigSource struct{}
+
+// CaddyModule returns the Caddy module information.
+func (FileConfigSource) CaddyModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "caddy.config_sources.file",
+		New: func() Module { return new(FileConfigSource) },
+	}
+}
+
+// ResolveConfigValue returns the contents of the file at key.
+func (FileConfigSource) ResolveConfigValue(key string) (string, error) {
+	contents, err := ioutil.ReadFile(key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
+// Interface guards
+var (
+	_ ConfigSource = (*EnvConfigSource)(nil)
+	_ ConfigSource = (*FileConfigSource)(nil)
+)
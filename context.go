@@ -430,5 +430,10 @@ func (ctx Context) Storage() certmagic.Storage {
 
 // Logger returns a logger that can be used by mod.
 func (ctx Context) Logger(mod Module) *zap.Logger {
+	if ctx.cfg == nil {
+		// often the case in tests, which provision modules
+		// with a zero-value context
+		return Log()
+	}
 	return ctx.cfg.Logging.Logger(mod)
 }
@@ -0,0 +1,165 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Health and readiness endpoints for the process, for use with
+// orchestrator probes (e.g. Kubernetes liveness and readiness
+// probes). The /healthz endpoint answers 200 as long as the
+// process is alive; the /readyz endpoint answers 200 only while
+// a config is successfully applied and the process is not
+// shutting down. Both are served on the admin endpoint and,
+// if the admin config's health_listen is set, on a dedicated
+// listener without the admin API's host and origin checks.
+
+// readiness tracks whether the process should be considered
+// ready to receive traffic.
+var readiness struct {
+	sync.RWMutex
+	configApplied bool
+	shuttingDown  bool
+}
+
+// setConfigApplied records whether a config is currently
+// applied and running.
+func setConfigApplied(applied bool) {
+	readiness.Lock()
+	readiness.configApplied = applied
+	readiness.Unlock()
+}
+
+// setShuttingDown marks the process as draining; readiness
+// checks fail from this point on, which lets load balancers
+// remove the instance before its listeners actually close.
+func setShuttingDown() {
+	readiness.Lock()
+	readiness.shuttingDown = true
+	readiness.Unlock()
+}
+
+// Ready reports whether the process is ready to receive
+// traffic: a config is applied and no shutdown is in progress.
+func Ready() bool {
+	readiness.RLock()
+	defer readiness.RUnlock()
+	return readiness.configApplied && !readiness.shuttingDown
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "OK")
+	return nil
+}
+
+func handleReadyz(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "not ready")
+		return nil
+	}
+	fmt.Fprintln(w, "OK")
+	return nil
+}
+
+// writeHealthError translates a handler error into a status
+// write, as the admin mux's error handler does for the same
+// endpoints on the admin listener; without it, rejected methods
+// would get an empty 200.
+func writeHealthError(w http.ResponseWriter, err error) {
+	if err == nil {
+		return
+	}
+	apiErr, ok := err.(APIError)
+	if !ok {
+		apiErr = APIError{Code: http.StatusInternalServerError, Err: err}
+	}
+	if apiErr.Code == 0 {
+		apiErr.Code = http.StatusInternalServerError
+	}
+	if apiErr.Message == "" && apiErr.Err != nil {
+		apiErr.Message = apiErr.Err.Error()
+	}
+	http.Error(w, apiErr.Message, apiErr.Code)
+}
+
+// healthServer is the current dedicated health listener, if any.
+var healthServer *http.Server
+
+// replaceHealthServer starts (or stops) the dedicated health
+// endpoint listener according to the admin config in cfg. Unlike
+// the admin endpoint, it serves only /healthz and /readyz and
+// performs no host or origin checks, since probes are typically
+// sent with the pod IP as the host.
+func replaceHealthServer(cfg *Config) error {
+	// always stop the old listener; its address may have changed
+	if healthServer != nil {
+		healthServer.Close()
+		healthServer = nil
+	}
+
+	if cfg == nil || cfg.Admin == nil || cfg.Admin.HealthListen == "" {
+		return nil
+	}
+
+	addr, err := ParseNetworkAddress(cfg.Admin.HealthListen)
+	if err != nil {
+		return fmt.Errorf("parsing health listener address: %v", err)
+	}
+	ln, err := Listen(addr.Network, addr.JoinHostPort(0))
+	if err != nil {
+		return fmt.Errorf("binding health listener: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealthError(w, handleHealthz(w, r))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealthError(w, handleReadyz(w, r))
+	})
+
+	healthServer = &http.Server{Handler: mux}
+	go func() {
+		err := healthServer.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			Log().Named("admin.health").Error("health server shutdown", zap.Error(err))
+		}
+	}()
+
+	Log().Named("admin.health").Info("health endpoints serving",
+		zap.String("address", addr.String()))
+
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -156,7 +157,7 @@ func (logging *Logging) setupNewDefault(ctx Context) error {
 	if err != nil {
 		return fmt.Errorf("setting up default log: %v", err)
 	}
-	newDefault.logger = zap.New(newDefault.CustomLog.core)
+	newDefault.logger = zap.New(zapcore.NewTee(newDefault.CustomLog.core, globalWatchingCore))
 
 	// redirect the default caddy logs
 	defaultLoggerMu.Lock()
@@ -189,6 +190,13 @@ func (logging *Logging) setupNewDefault(ctx Context) error {
 // A successful call to openLogs calls this automatically
 // when the context is canceled.
 func (logging *Logging) closeLogs() error {
+	// stop async background writers before closing the
+	// writers they flush to
+	for _, l := range logging.Logs {
+		if l.asyncCore != nil {
+			l.asyncCore.stop()
+		}
+	}
 	for _, key := range logging.writerKeys {
 		_, err := writers.Delete(key)
 		if err != nil {
@@ -215,6 +223,9 @@ func (logging *Logging) Logger(mod Module) *zap.Logger {
 		}
 	}
 
+	// feed the admin API's live log stream, if anyone is watching
+	cores = append(cores, globalWatchingCore)
+
 	multiCore := zapcore.NewTee(cores...)
 
 	return zap.New(multiCore).Named(modID)
@@ -332,11 +343,25 @@ type CustomLog struct {
 	// HTTP access logs, you would exclude "http.log.access".
 	Exclude []string `json:"exclude,omitempty"`
 
+	// If true, entries are encoded and written by a background
+	// goroutine instead of on the calling goroutine. This
+	// decouples emission from the request path at high RPS.
+	// If the background writer cannot keep up, entries are
+	// dropped rather than blocking callers, and the number of
+	// dropped entries is reported once the writer catches up.
+	Async bool `json:"async,omitempty"`
+
+	// How many entries may be buffered for the background
+	// writer before new entries are dropped. Only used with
+	// async. Default: 4096.
+	AsyncBufferSize int `json:"async_buffer_size,omitempty"`
+
 	writerOpener WriterOpener
 	writer       io.WriteCloser
 	encoder      zapcore.Encoder
 	levelEnabler zapcore.LevelEnabler
 	core         zapcore.Core
+	asyncCore    *asyncCore
 }
 
 func (cl *CustomLog) provision(ctx Context, logging *Logging) error {
@@ -461,6 +486,13 @@ func (cl *CustomLog) buildCore() {
 		c = zapcore.NewSamplerWithOptions(c, cl.Sampling.Interval,
 			cl.Sampling.First, cl.Sampling.Thereafter)
 	}
+	if cl.Async {
+		if cl.AsyncBufferSize == 0 {
+			cl.AsyncBufferSize = 4096
+		}
+		cl.asyncCore = newAsyncCore(c, cl.AsyncBufferSize)
+		c = cl.asyncCore
+	}
 	cl.core = c
 }
 
@@ -557,6 +589,148 @@ func (fc *filteringCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapco
 	return ce
 }
 
+// asyncCore moves encoding and writing of log entries off the
+// calling goroutine: checked entries are placed in a bounded
+// ring and processed by a background goroutine. When the ring
+// is full, entries are dropped (never blocking the caller) and
+// the drop count is reported once writing resumes.
+type asyncCore struct {
+	inner   zapcore.Core
+	entries chan asyncLogEntry
+	done    chan struct{}
+	stopped chan struct{}
+
+	// dropped is a pointer so that cores derived via With()
+	// share the same counter; accessed atomically
+	dropped *uint64
+}
+
+// asyncLogEntry carries one queued log entry; the core is
+// recorded per entry because With() derives new inner cores
+// that share the same queue. A non-nil sync channel marks a
+// flush request instead of an entry.
+type asyncLogEntry struct {
+	core   zapcore.Core
+	ent    zapcore.Entry
+	fields []zapcore.Field
+	sync   chan struct{}
+}
+
+func newAsyncCore(inner zapcore.Core, bufferSize int) *asyncCore {
+	ac := &asyncCore{
+		inner:   inner,
+		entries: make(chan asyncLogEntry, bufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		dropped: new(uint64),
+	}
+	go ac.loop()
+	return ac
+}
+
+// Enabled is part of the zapcore.Core interface.
+func (ac *asyncCore) Enabled(lvl zapcore.Level) bool {
+	return ac.inner.Enabled(lvl)
+}
+
+// With derives a core with the given fields; it shares the
+// queue and background goroutine of ac.
+func (ac *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	return &asyncCore{
+		inner:   ac.inner.With(fields),
+		entries: ac.entries,
+		done:    ac.done,
+		stopped: ac.stopped,
+		dropped: ac.dropped,
+	}
+}
+
+// Check is part of the zapcore.Core interface.
+func (ac *asyncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ac.Enabled(ent.Level) {
+		return ce.AddCore(ent, ac)
+	}
+	return ce
+}
+
+// Write queues the entry for the background goroutine; if the
+// queue is full, the entry is counted as dropped instead of
+// blocking the caller.
+func (ac *asyncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	select {
+	case ac.entries <- asyncLogEntry{core: ac.inner, ent: ent, fields: fields}:
+	default:
+		atomic.AddUint64(ac.dropped, 1)
+	}
+	return nil
+}
+
+// Sync blocks until all currently-queued entries are written,
+// then syncs the inner core.
+func (ac *asyncCore) Sync() error {
+	flushed := make(chan struct{})
+	select {
+	case ac.entries <- asyncLogEntry{sync: flushed}:
+		select {
+		case <-flushed:
+		case <-ac.stopped:
+		}
+	case <-ac.stopped:
+	}
+	return nil
+}
+
+// stop drains the queue, writes any remaining entries, and
+// terminates the background goroutine. Only the core originally
+// returned by newAsyncCore should be stopped.
+func (ac *asyncCore) stop() {
+	close(ac.done)
+	<-ac.stopped
+}
+
+// loop is the background goroutine that writes queued entries.
+func (ac *asyncCore) loop() {
+	defer close(ac.stopped)
+	for {
+		select {
+		case e := <-ac.entries:
+			ac.process(e)
+		case <-ac.done:
+			// write out anything still queued, then exit
+			for {
+				select {
+				case e := <-ac.entries:
+					ac.process(e)
+				default:
+					ac.inner.Sync() //nolint:errcheck
+					return
+				}
+			}
+		}
+	}
+}
+
+// process writes one queued entry (or services a flush request)
+// and reports any entries dropped since the last write.
+func (ac *asyncCore) process(e asyncLogEntry) {
+	if e.sync != nil {
+		ac.inner.Sync() //nolint:errcheck
+		close(e.sync)
+		return
+	}
+	if err := e.core.Write(e.ent, e.fields); err != nil {
+		log.Printf("[ERROR] writing async log entry: %v", err)
+	}
+	if dropped := atomic.SwapUint64(ac.dropped, 0); dropped > 0 {
+		ac.inner.Write(zapcore.Entry{ //nolint:errcheck
+			Level:      zapcore.WarnLevel,
+			Time:       time.Now(),
+			LoggerName: e.ent.LoggerName,
+			Message:    "dropped log entries because async buffer was full",
+		}, []zapcore.Field{zap.Uint64("count", dropped)})
+	}
+}
+
 // LogSampling configures log entry sampling.
 type LogSampling struct {
 	// The window over which to conduct sampling.
@@ -0,0 +1,146 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogWatchFilter decides whether a watcher wants entries from
+// the named logger at the given level.
+type LogWatchFilter func(loggerName string, level zapcore.Level) bool
+
+// logWatcher is one live subscriber to the log stream.
+type logWatcher struct {
+	entries chan []byte
+	filter  LogWatchFilter
+}
+
+// logWatchers is the registry of live log subscribers. The
+// count is kept separately (atomically) so the hot path can
+// skip all work when nobody is watching.
+var logWatchers = struct {
+	sync.Mutex
+	m      map[int]*logWatcher
+	nextID int
+	count  int32 // accessed atomically
+}{m: make(map[int]*logWatcher)}
+
+// WatchLogs subscribes to a live feed of log entries, encoded
+// as JSON, from all loggers attached to this process. A nil
+// filter receives everything. Watchers that do not keep up
+// have entries dropped rather than slowing down logging. The
+// returned cancel function must be called to unsubscribe.
+//
+// This is used by the admin API to stream logs; it is not
+// intended as a general log delivery mechanism (use a writer
+// module for that).
+func WatchLogs(filter LogWatchFilter) (<-chan []byte, func()) {
+	w := &logWatcher{
+		entries: make(chan []byte, 256),
+		filter:  filter,
+	}
+
+	logWatchers.Lock()
+	id := logWatchers.nextID
+	logWatchers.nextID++
+	logWatchers.m[id] = w
+	logWatchers.Unlock()
+	atomic.AddInt32(&logWatchers.count, 1)
+
+	cancel := func() {
+		logWatchers.Lock()
+		if _, ok := logWatchers.m[id]; ok {
+			delete(logWatchers.m, id)
+			atomic.AddInt32(&logWatchers.count, -1)
+		}
+		logWatchers.Unlock()
+	}
+	return w.entries, cancel
+}
+
+// watchingCore is a zapcore.Core that feeds entries to the
+// registered log watchers. It is enabled only while at least
+// one watcher exists, so it costs almost nothing otherwise.
+type watchingCore struct {
+	enc zapcore.Encoder
+}
+
+func newWatchingCore() *watchingCore {
+	encCfg := zap.NewProductionEncoderConfig()
+	return &watchingCore{enc: zapcore.NewJSONEncoder(encCfg)}
+}
+
+// Enabled is part of the zapcore.Core interface.
+func (wc *watchingCore) Enabled(lvl zapcore.Level) bool {
+	return atomic.LoadInt32(&logWatchers.count) > 0
+}
+
+// With derives a core with the given fields pre-encoded.
+func (wc *watchingCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := wc.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &watchingCore{enc: enc}
+}
+
+// Check is part of the zapcore.Core interface.
+func (wc *watchingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if wc.Enabled(ent.Level) {
+		return ce.AddCore(ent, wc)
+	}
+	return ce
+}
+
+// Write encodes the entry once and offers it to each watcher
+// whose filter accepts it.
+func (wc *watchingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := wc.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	logWatchers.Lock()
+	for _, w := range logWatchers.m {
+		if w.filter != nil && !w.filter(ent.LoggerName, ent.Level) {
+			continue
+		}
+		entry := append([]byte(nil), buf.Bytes()...)
+		select {
+		case w.entries <- entry:
+		default:
+			// watcher is not keeping up; drop
+		}
+	}
+	logWatchers.Unlock()
+
+	return nil
+}
+
+// Sync is part of the zapcore.Core interface.
+func (wc *watchingCore) Sync() error { return nil }
+
+// globalWatchingCore is attached to every logger so watchers
+// see entries from the whole process.
+var globalWatchingCore = newWatchingCore()
+
+// Interface guard
+var _ zapcore.Core = (*watchingCore)(nil)
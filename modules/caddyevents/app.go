@@ -0,0 +1,189 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caddyevents provides a simple eventing subsystem for
+// Caddy. Apps and modules emit named events with associated data;
+// users bind handler modules to events with subscriptions, filtered
+// by event name and data. This decouples "something happened" from
+// "what to do about it": the same certificate-obtained event can
+// trigger a webhook for one user and a shell command for another.
+package caddyevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(App{})
+}
+
+// App is the event dispatcher. Other apps obtain it with
+// ctx.App("events") and call Emit to publish events; handlers
+// bound by subscriptions receive them.
+type App struct {
+	// The bindings of handlers to the events they are
+	// interested in.
+	Subscriptions []*Subscription `json:"subscriptions,omitempty"`
+
+	logger *zap.Logger
+}
+
+// Event is a single occurrence of something notable.
+type Event struct {
+	// The name of the event; lowercase with underscores
+	// by convention (e.g. "cert_obtained").
+	Name string `json:"name"`
+
+	// When the event was emitted.
+	Timestamp time.Time `json:"timestamp"`
+
+	// The module that emitted the event, if known.
+	Origin string `json:"origin,omitempty"`
+
+	// Arbitrary data describing the event.
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Handler is a module that reacts to events.
+type Handler interface {
+	Handle(Event) error
+}
+
+// Subscription binds handlers to events.
+type Subscription struct {
+	// The names of the events to subscribe to.
+	// An empty list subscribes to all events.
+	Events []string `json:"events,omitempty"`
+
+	// Only dispatch events whose data contains these keys with
+	// these exact values (compared as strings). An empty map
+	// applies no data filtering.
+	Filters map[string]string `json:"filters,omitempty"`
+
+	// The handler modules to invoke for matching events,
+	// in order. A handler error is logged but does not stop
+	// the remaining handlers.
+	HandlersRaw []json.RawMessage `json:"handle,omitempty" caddy:"namespace=events.handlers inline_key=handler"`
+
+	handlers []Handler
+}
+
+// CaddyModule returns the Caddy module information.
+func (App) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "events",
+		New: func() caddy.Module { return new(App) },
+	}
+}
+
+// Provision sets up the app.
+func (app *App) Provision(ctx caddy.Context) error {
+	app.logger = ctx.Logger(app)
+	for i, sub := range app.Subscriptions {
+		handlersIface, err := ctx.LoadModule(sub, "HandlersRaw")
+		if err != nil {
+			return fmt.Errorf("subscription %d: loading event handler modules: %v", i, err)
+		}
+		for _, handlerIface := range handlersIface.([]interface{}) {
+			handler, ok := handlerIface.(Handler)
+			if !ok {
+				return fmt.Errorf("subscription %d: module is not an event handler: %T", i, handlerIface)
+			}
+			sub.handlers = append(sub.handlers, handler)
+		}
+		// normalize event names so matching is case-insensitive
+		for j, eventName := range sub.Events {
+			sub.Events[j] = strings.ToLower(eventName)
+		}
+	}
+	return nil
+}
+
+// Start starts the app and announces that the config is running.
+func (app *App) Start() error {
+	app.Emit("config_loaded", "events", nil)
+	return nil
+}
+
+// Stop stops the app.
+func (app *App) Stop() error {
+	return nil
+}
+
+// Emit publishes an event to all matching subscriptions. It is safe
+// to call from any goroutine; handlers run synchronously, and their
+// errors are logged rather than returned so that emitting an event
+// can never fail the operation that caused it.
+func (app *App) Emit(eventName, origin string, data map[string]interface{}) {
+	event := Event{
+		Name:      strings.ToLower(eventName),
+		Timestamp: time.Now(),
+		Origin:    origin,
+		Data:      data,
+	}
+
+	app.logger.Debug("event",
+		zap.String("name", event.Name),
+		zap.String("origin", event.Origin),
+		zap.Any("data", event.Data))
+
+	for _, sub := range app.Subscriptions {
+		if !sub.matches(event) {
+			continue
+		}
+		for _, handler := range sub.handlers {
+			if err := handler.Handle(event); err != nil {
+				app.logger.Error("event handler",
+					zap.String("event", event.Name),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// matches returns true if event satisfies the
+// subscription's name and data filters.
+func (sub *Subscription) matches(event Event) bool {
+	if len(sub.Events) > 0 {
+		var found bool
+		for _, eventName := range sub.Events {
+			if eventName == event.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for key, val := range sub.Filters {
+		dataVal, ok := event.Data[key]
+		if !ok || fmt.Sprintf("%v", dataVal) != val {
+			return false
+		}
+	}
+	return true
+}
+
+// Interface guards
+var (
+	_ caddy.App         = (*App)(nil)
+	_ caddy.Provisioner = (*App)(nil)
+)
@@ -0,0 +1,198 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyevents
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(ExecHandler{})
+	caddy.RegisterModule(WebhookHandler{})
+	caddy.RegisterModule(LogHandler{})
+}
+
+// ExecHandler runs a command when an event occurs. The event is
+// serialized to JSON and written to the command's standard input.
+type ExecHandler struct {
+	// The command to run.
+	Command string `json:"command,omitempty"`
+
+	// Arguments to the command.
+	Args []string `json:"args,omitempty"`
+
+	// How long to allow the command to run before
+	// killing it. Default: 30s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (ExecHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "events.handlers.exec",
+		New: func() caddy.Module { return new(ExecHandler) },
+	}
+}
+
+// Provision sets up the handler.
+func (eh *ExecHandler) Provision(ctx caddy.Context) error {
+	eh.logger = ctx.Logger(eh)
+	if eh.Timeout == 0 {
+		eh.Timeout = caddy.Duration(30 * time.Second)
+	}
+	return nil
+}
+
+// Validate ensures the handler is configured properly.
+func (eh *ExecHandler) Validate() error {
+	if eh.Command == "" {
+		return fmt.Errorf("command is required")
+	}
+	return nil
+}
+
+// Handle runs the command.
+func (eh *ExecHandler) Handle(event Event) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(eh.Command, eh.Args...)
+	cmd.Stdin = bytes.NewReader(eventJSON)
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("starting command: %v", err)
+	}
+
+	// enforce the timeout without leaving the process behind
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	timer := time.NewTimer(time.Duration(eh.Timeout))
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		cmd.Process.Kill()
+		<-done
+		return fmt.Errorf("command timed out after %s", time.Duration(eh.Timeout))
+	}
+}
+
+// WebhookHandler POSTs the event as JSON to a URL.
+type WebhookHandler struct {
+	// The URL to send the event to.
+	URL string `json:"url,omitempty"`
+
+	// How long to wait for the endpoint to accept
+	// the event. Default: 10s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	httpClient *http.Client
+}
+
+// CaddyModule returns the Caddy module information.
+func (WebhookHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "events.handlers.webhook",
+		New: func() caddy.Module { return new(WebhookHandler) },
+	}
+}
+
+// Provision sets up the handler.
+func (wh *WebhookHandler) Provision(ctx caddy.Context) error {
+	if wh.Timeout == 0 {
+		wh.Timeout = caddy.Duration(10 * time.Second)
+	}
+	wh.httpClient = &http.Client{Timeout: time.Duration(wh.Timeout)}
+	return nil
+}
+
+// Validate ensures the handler is configured properly.
+func (wh *WebhookHandler) Validate() error {
+	if wh.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	return nil
+}
+
+// Handle sends the event to the webhook endpoint.
+func (wh *WebhookHandler) Handle(event Event) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := wh.httpClient.Post(wh.URL, "application/json", bytes.NewReader(eventJSON))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// LogHandler writes the event to Caddy's structured log.
+type LogHandler struct {
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (LogHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "events.handlers.log",
+		New: func() caddy.Module { return new(LogHandler) },
+	}
+}
+
+// Provision sets up the handler.
+func (lh *LogHandler) Provision(ctx caddy.Context) error {
+	lh.logger = ctx.Logger(lh)
+	return nil
+}
+
+// Handle logs the event.
+func (lh *LogHandler) Handle(event Event) error {
+	lh.logger.Info("event",
+		zap.String("name", event.Name),
+		zap.String("origin", event.Origin),
+		zap.Any("data", event.Data))
+	return nil
+}
+
+// Interface guards
+var (
+	_ Handler           = (*ExecHandler)(nil)
+	_ Handler           = (*WebhookHandler)(nil)
+	_ Handler           = (*LogHandler)(nil)
+	_ caddy.Provisioner = (*ExecHandler)(nil)
+	_ caddy.Provisioner = (*WebhookHandler)(nil)
+	_ caddy.Provisioner = (*LogHandler)(nil)
+	_ caddy.Validator   = (*ExecHandler)(nil)
+	_ caddy.Validator   = (*WebhookHandler)(nil)
+)
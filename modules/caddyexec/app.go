@@ -0,0 +1,272 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caddyexec provides an app that starts and supervises
+// companion processes (a PHP-FPM pool, a backend binary) alongside
+// Caddy, so single-container or single-binary deployments don't
+// need a separate init system: processes start with the config,
+// are restarted with backoff if they crash, and are signaled to
+// stop when the config is unloaded.
+package caddyexec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(App{})
+}
+
+// App supervises a set of commands for the duration of the config.
+type App struct {
+	// The commands to run and supervise.
+	Commands []*Command `json:"commands,omitempty"`
+
+	logger *zap.Logger
+	wg     *sync.WaitGroup
+}
+
+// Command is a process to run and keep running.
+type Command struct {
+	// The command to run.
+	Command string `json:"command,omitempty"`
+
+	// Arguments to the command.
+	Args []string `json:"args,omitempty"`
+
+	// The working directory for the process.
+	// Defaults to Caddy's working directory.
+	Dir string `json:"dir,omitempty"`
+
+	// Environment variables to set for the process, in addition to
+	// Caddy's own environment, in the form `KEY=value`.
+	Env []string `json:"env,omitempty"`
+
+	// When to restart the process after it exits: "always",
+	// "on_failure" (nonzero exit), or "never". Restarts are
+	// delayed with exponential backoff. Default: always.
+	RestartPolicy string `json:"restart_policy,omitempty"`
+
+	// How long to wait for the process to exit after being asked
+	// to stop, before it is forcibly killed. Default: 5s.
+	StopTimeout caddy.Duration `json:"stop_timeout,omitempty"`
+
+	logger   *zap.Logger
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	exited   chan struct{} // closed when the current process has been reaped
+	stopping bool
+}
+
+// restart policies
+const (
+	restartAlways    = "always"
+	restartOnFailure = "on_failure"
+	restartNever     = "never"
+)
+
+// restart backoff tuning
+const (
+	minRestartDelay   = 1 * time.Second
+	maxRestartDelay   = 1 * time.Minute
+	stableRunDuration = 10 * time.Second
+)
+
+// CaddyModule returns the Caddy module information.
+func (App) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "exec",
+		New: func() caddy.Module { return new(App) },
+	}
+}
+
+// Provision sets up the app.
+func (a *App) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger(a)
+	a.wg = new(sync.WaitGroup)
+	for i, cmd := range a.Commands {
+		if cmd.Command == "" {
+			return fmt.Errorf("command %d: command is required", i)
+		}
+		switch cmd.RestartPolicy {
+		case "":
+			cmd.RestartPolicy = restartAlways
+		case restartAlways, restartOnFailure, restartNever:
+		default:
+			return fmt.Errorf("command %d: unrecognized restart policy '%s'", i, cmd.RestartPolicy)
+		}
+		if cmd.StopTimeout == 0 {
+			cmd.StopTimeout = caddy.Duration(5 * time.Second)
+		}
+		cmd.logger = a.logger.With(zap.String("command", cmd.Command))
+	}
+	return nil
+}
+
+// Start starts all the commands and begins supervising them.
+func (a *App) Start() error {
+	for _, cmd := range a.Commands {
+		a.wg.Add(1)
+		go func(cmd *Command) {
+			defer a.wg.Done()
+			cmd.supervise()
+		}(cmd)
+	}
+	return nil
+}
+
+// Stop signals all processes to stop and waits for them to exit.
+func (a *App) Stop() error {
+	for _, cmd := range a.Commands {
+		cmd.stop()
+	}
+	a.wg.Wait()
+	return nil
+}
+
+// supervise runs the command, restarting it according to its
+// restart policy with exponential backoff, until stopped.
+func (c *Command) supervise() {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := c.run()
+
+		c.mu.Lock()
+		stopping := c.stopping
+		c.mu.Unlock()
+		if stopping {
+			return
+		}
+
+		exitedCleanly := err == nil
+		if err != nil {
+			c.logger.Error("process exited", zap.Error(err))
+		} else {
+			c.logger.Info("process exited")
+		}
+
+		switch c.RestartPolicy {
+		case restartNever:
+			return
+		case restartOnFailure:
+			if exitedCleanly {
+				return
+			}
+		}
+
+		// a process that ran for a while before dying gets a
+		// prompt restart; a crash loop backs off exponentially
+		if time.Since(started) >= stableRunDuration {
+			delay = minRestartDelay
+		}
+		c.logger.Info("restarting process", zap.Duration("delay", delay))
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// run starts the process and waits for it to exit.
+func (c *Command) run() error {
+	cmd := exec.Command(c.Command, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = append(os.Environ(), c.Env...)
+
+	// route the process's output through our logs
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	go logLines(stdout, c.logger.Info)
+	go logLines(stderr, c.logger.Warn)
+
+	c.mu.Lock()
+	if c.stopping {
+		c.mu.Unlock()
+		return nil
+	}
+	err = cmd.Start()
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.cmd = cmd
+	exited := make(chan struct{})
+	c.exited = exited
+	c.mu.Unlock()
+
+	c.logger.Info("process started", zap.Int("pid", cmd.Process.Pid))
+	err = cmd.Wait()
+	close(exited)
+	return err
+}
+
+// stop asks the running process to terminate gracefully,
+// then kills it if it takes too long.
+func (c *Command) stop() {
+	c.mu.Lock()
+	c.stopping = true
+	cmd := c.cmd
+	exited := c.exited
+	c.mu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+
+	err := cmd.Process.Signal(os.Interrupt)
+	if err != nil {
+		// signaling is not supported everywhere
+		cmd.Process.Kill()
+		return
+	}
+
+	// give it a chance to exit on its own; the supervisor's
+	// cmd.Wait reaps it and signals completion
+	select {
+	case <-exited:
+	case <-time.After(time.Duration(c.StopTimeout)):
+		c.logger.Warn("process did not exit in time; killing")
+		cmd.Process.Kill()
+	}
+}
+
+// logLines logs each line read from r with logFn.
+func logLines(r io.Reader, logFn func(string, ...zap.Field)) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		logFn(scanner.Text())
+	}
+}
+
+// Interface guards
+var (
+	_ caddy.App         = (*App)(nil)
+	_ caddy.Provisioner = (*App)(nil)
+)
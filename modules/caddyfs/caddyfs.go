@@ -0,0 +1,121 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caddyfs provides pluggable file system backends in the
+// caddy.fs module namespace. Modules in this namespace implement
+// http.FileSystem and provide a read-only view of their backing
+// store; Open is called with rooted, slash-separated, cleaned
+// paths. Errors from Open should satisfy os.IsNotExist or
+// os.IsPermission where applicable so that callers can map them
+// to meaningful HTTP status codes.
+//
+// The http handlers that access files (such as file_server) can
+// be configured to use any of these backends instead of the OS
+// file system.
+package caddyfs
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(OSFS{})
+	caddy.RegisterModule(OverlayFS{})
+}
+
+// OSFS is a file system backed by a directory on disk.
+// It is functionally the same as serving from the OS file
+// system directly, but as a module it can compose with
+// other backends such as the overlay.
+type OSFS struct {
+	// The path to the root of the file system.
+	// Default: current working directory.
+	Root string `json:"root,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (OSFS) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.fs.os",
+		New: func() caddy.Module { return new(OSFS) },
+	}
+}
+
+// Provision sets up the file system.
+func (osfs *OSFS) Provision(_ caddy.Context) error {
+	if osfs.Root == "" {
+		osfs.Root = "."
+	}
+	return nil
+}
+
+// Open opens the named file within the root.
+func (osfs OSFS) Open(name string) (http.File, error) {
+	return http.Dir(osfs.Root).Open(name)
+}
+
+// OverlayFS is a read-only overlay of multiple roots on disk:
+// a file is opened from the first root that contains it. This
+// enables patterns like local overrides layered over a shared
+// asset directory.
+type OverlayFS struct {
+	// The roots to search, in order. At least one is required.
+	Roots []string `json:"roots,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (OverlayFS) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.fs.overlay",
+		New: func() caddy.Module { return new(OverlayFS) },
+	}
+}
+
+// Validate ensures ofs has at least one root.
+func (ofs OverlayFS) Validate() error {
+	if len(ofs.Roots) == 0 {
+		return fmt.Errorf("overlay file system requires at least one root")
+	}
+	return nil
+}
+
+// Open opens the named file from the first root that has it.
+func (ofs OverlayFS) Open(name string) (http.File, error) {
+	var firstErr error
+	for _, root := range ofs.Roots {
+		file, err := http.Dir(root).Open(name)
+		if err == nil {
+			return file, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = os.ErrNotExist
+	}
+	return nil, firstErr
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner = (*OSFS)(nil)
+	_ http.FileSystem   = (*OSFS)(nil)
+	_ caddy.Validator   = (*OverlayFS)(nil)
+	_ http.FileSystem   = (*OverlayFS)(nil)
+)
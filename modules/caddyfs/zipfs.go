@@ -0,0 +1,186 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(ZipFS{})
+}
+
+// ZipFS is a read-only file system backed by a zip archive,
+// useful for serving a site or artifact bundle as a single
+// file. The archive's table of contents is indexed when the
+// module is provisioned; file contents are read from the
+// archive on each open.
+type ZipFS struct {
+	// The path to the zip archive. Required.
+	Path string `json:"path,omitempty"`
+
+	reader *zip.ReadCloser
+	index  map[string]*zip.File
+	dirs   map[string][]os.FileInfo
+}
+
+// CaddyModule returns the Caddy module information.
+func (ZipFS) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.fs.zip",
+		New: func() caddy.Module { return new(ZipFS) },
+	}
+}
+
+// Provision opens the archive and indexes its contents.
+func (zfs *ZipFS) Provision(_ caddy.Context) error {
+	if zfs.Path == "" {
+		return fmt.Errorf("zip file system requires a path")
+	}
+
+	reader, err := zip.OpenReader(zfs.Path)
+	if err != nil {
+		return fmt.Errorf("opening zip archive: %v", err)
+	}
+	zfs.reader = reader
+
+	zfs.index = make(map[string]*zip.File)
+	zfs.dirs = make(map[string][]os.FileInfo)
+	for _, f := range reader.File {
+		name := path.Clean("/" + f.Name)
+		if name == "/" {
+			continue
+		}
+		zfs.index[name] = f
+		zfs.dirs[path.Dir(name)] = append(zfs.dirs[path.Dir(name)], f.FileInfo())
+	}
+	for dir := range zfs.dirs {
+		sort.Slice(zfs.dirs[dir], func(i, j int) bool {
+			return zfs.dirs[dir][i].Name() < zfs.dirs[dir][j].Name()
+		})
+	}
+
+	return nil
+}
+
+// Cleanup closes the archive.
+func (zfs *ZipFS) Cleanup() error {
+	if zfs.reader != nil {
+		return zfs.reader.Close()
+	}
+	return nil
+}
+
+// Open opens the named file or directory within the archive.
+func (zfs *ZipFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+
+	if entries, ok := zfs.dirs[name]; ok {
+		return &zipDir{name: path.Base(name), entries: entries}, nil
+	}
+
+	f, ok := zfs.index[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if f.FileInfo().IsDir() {
+		return &zipDir{name: path.Base(name), entries: zfs.dirs[name]}, nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// buffer the contents so the returned file can seek,
+	// which http.ServeContent requires for range requests
+	contents, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipFile{
+		Reader: bytes.NewReader(contents),
+		info:   f.FileInfo(),
+	}, nil
+}
+
+// zipFile is an open, fully-buffered file from a zip archive.
+type zipFile struct {
+	*bytes.Reader
+	info os.FileInfo
+}
+
+func (f *zipFile) Close() error                             { return nil }
+func (f *zipFile) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *zipFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+
+// zipDir is an open directory within a zip archive.
+type zipDir struct {
+	name    string
+	entries []os.FileInfo
+	pos     int
+}
+
+func (d *zipDir) Close() error                   { return nil }
+func (d *zipDir) Read([]byte) (int, error)       { return 0, os.ErrInvalid }
+func (d *zipDir) Seek(int64, int) (int64, error) { return 0, os.ErrInvalid }
+func (d *zipDir) Stat() (os.FileInfo, error)     { return zipDirInfo{d.name}, nil }
+
+func (d *zipDir) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		entries := d.entries[d.pos:]
+		d.pos = len(d.entries)
+		return entries, nil
+	}
+	if d.pos >= len(d.entries) {
+		return nil, os.ErrNotExist
+	}
+	if d.pos+count > len(d.entries) {
+		count = len(d.entries) - d.pos
+	}
+	entries := d.entries[d.pos : d.pos+count]
+	d.pos += count
+	return entries, nil
+}
+
+// zipDirInfo describes a directory within a zip archive,
+// which may exist only implicitly as a path prefix.
+type zipDirInfo struct{ name string }
+
+func (i zipDirInfo) Name() string       { return i.name }
+func (i zipDirInfo) Size() int64        { return 0 }
+func (i zipDirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (i zipDirInfo) ModTime() time.Time { return time.Time{} }
+func (i zipDirInfo) IsDir() bool        { return true }
+func (i zipDirInfo) Sys() interface{}   { return nil }
+
+// Interface guards
+var (
+	_ caddy.Provisioner  = (*ZipFS)(nil)
+	_ caddy.CleanerUpper = (*ZipFS)(nil)
+	_ http.FileSystem    = (*ZipFS)(nil)
+)
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -164,6 +165,10 @@ func (app *App) Provision(ctx caddy.Context) error {
 		// only enable access logs if configured
 		if srv.Logs != nil {
 			srv.accessLogger = app.logger.Named("log.access")
+			err := srv.Logs.provision(ctx)
+			if err != nil {
+				return fmt.Errorf("server %s: setting up access logs: %v", srvName, err)
+			}
 		}
 
 		// if not explicitly configured by the user, disallow TLS
@@ -224,6 +229,18 @@ func (app *App) Provision(ctx caddy.Context) error {
 			}
 		}
 
+		// set up named matcher sets so routes can reference them
+		err = srv.provisionNamedMatcherSets(ctx)
+		if err != nil {
+			return fmt.Errorf("server %s: setting up named matcher sets: %v", srvName, err)
+		}
+
+		// set up named routes so handlers can invoke them
+		err = srv.provisionNamedRoutes(ctx)
+		if err != nil {
+			return fmt.Errorf("server %s: setting up named routes: %v", srvName, err)
+		}
+
 		// pre-compile the primary handler chain, and be sure to wrap it in our
 		// route handler so that important security checks are done, etc.
 		primaryRoute := emptyHandler
@@ -406,11 +423,15 @@ func (app *App) Start() error {
 		return fmt.Errorf("finalizing automatic HTTPS: %v", err)
 	}
 
+	// make this app available to the request tracing admin endpoint
+	setActiveTraceApp(app)
+
 	return nil
 }
 
 // Stop gracefully shuts down the HTTP server.
 func (app *App) Stop() error {
+	clearActiveTraceApp(app)
 	ctx := context.Background()
 	if app.GracePeriod > 0 {
 		var cancel context.CancelFunc
@@ -453,6 +474,44 @@ func (app *App) Stop() error {
 	return nil
 }
 
+// Status returns a summary of each server for the startup
+// report and the admin /status endpoint: its listeners, the
+// hostnames it serves (from host matchers in its routes), and
+// its automatic HTTPS configuration.
+func (app *App) Status() interface{} {
+	type serverStatus struct {
+		Listen    []string         `json:"listen,omitempty"`
+		Hosts     []string         `json:"hosts,omitempty"`
+		AutoHTTPS *AutoHTTPSConfig `json:"automatic_https,omitempty"`
+	}
+	servers := make(map[string]serverStatus)
+	for srvName, srv := range app.Servers {
+		hostSet := make(map[string]struct{})
+		for _, route := range srv.Routes {
+			for _, matcherSet := range route.MatcherSets {
+				for _, m := range matcherSet {
+					if hm, ok := m.(*MatchHost); ok {
+						for _, d := range *hm {
+							hostSet[d] = struct{}{}
+						}
+					}
+				}
+			}
+		}
+		hosts := make([]string, 0, len(hostSet))
+		for d := range hostSet {
+			hosts = append(hosts, d)
+		}
+		sort.Strings(hosts)
+		servers[srvName] = serverStatus{
+			Listen:    srv.Listen,
+			Hosts:     hosts,
+			AutoHTTPS: srv.AutoHTTPS,
+		}
+	}
+	return servers
+}
+
 func (app *App) httpPort() int {
 	if app.HTTPPort == 0 {
 		return DefaultHTTPPort
@@ -475,7 +534,8 @@ const defaultIdleTimeout = caddy.Duration(5 * time.Minute)
 
 // Interface guards
 var (
-	_ caddy.App         = (*App)(nil)
-	_ caddy.Provisioner = (*App)(nil)
-	_ caddy.Validator   = (*App)(nil)
+	_ caddy.App            = (*App)(nil)
+	_ caddy.Provisioner    = (*App)(nil)
+	_ caddy.Validator      = (*App)(nil)
+	_ caddy.StatusReporter = (*App)(nil)
 )
@@ -0,0 +1,102 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorize
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Authorize{})
+}
+
+// Authorize is a middleware which makes an allow/deny decision
+// for each request by evaluating a [CEL](https://github.com/google/cel-spec)
+// policy expression. The expression has access to the request and,
+// through placeholders, to authentication metadata set by earlier
+// handlers (for example `{http.auth.user.id}`) and TLS client
+// certificate fields (`{http.request.tls.client.*}`), enabling
+// fine-grained per-route access control.
+//
+// Requests for which the policy does not evaluate to true are
+// rejected with a configurable HTTP status code.
+type Authorize struct {
+	// The CEL policy expression to evaluate for each request.
+	// The request is authorized only if the expression evaluates
+	// to true. Caddy placeholders may be used in the expression.
+	Expression string `json:"expression"`
+
+	// The HTTP status code to respond with when a request is
+	// denied. Must be a 4xx or 5xx status; default is 403.
+	StatusCode caddyhttp.WeakString `json:"status_code,omitempty"`
+
+	policy     caddyhttp.MatchExpression
+	statusCode int
+	logger     *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (Authorize) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.authorize",
+		New: func() caddy.Module { return new(Authorize) },
+	}
+}
+
+// Provision sets up a.
+func (a *Authorize) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger(a)
+
+	if a.Expression == "" {
+		return fmt.Errorf("a policy expression is required")
+	}
+	a.policy = caddyhttp.MatchExpression{Expr: a.Expression}
+	err := a.policy.Provision(ctx)
+	if err != nil {
+		return fmt.Errorf("compiling policy expression: %v", err)
+	}
+
+	a.statusCode = http.StatusForbidden
+	if a.StatusCode != "" {
+		a.statusCode = a.StatusCode.Int()
+	}
+	if a.statusCode < 400 || a.statusCode > 599 {
+		return fmt.Errorf("status code %d is not an error status", a.statusCode)
+	}
+
+	return nil
+}
+
+func (a Authorize) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if !a.policy.Match(r) {
+		a.logger.Debug("request denied by policy",
+			zap.String("expression", a.Expression),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("uri", r.RequestURI))
+		return caddyhttp.Error(a.statusCode, fmt.Errorf("request denied by authorization policy"))
+	}
+	return next.ServeHTTP(w, r)
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Authorize)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Authorize)(nil)
+)
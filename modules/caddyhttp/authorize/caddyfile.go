@@ -0,0 +1,58 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorize
+
+import (
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	httpcaddyfile.RegisterHandlerDirective("authorize", parseCaddyfile)
+}
+
+// parseCaddyfile unmarshals tokens from h into a new Authorize.
+// Syntax:
+//
+//     authorize [<matcher>] <expression...> {
+//         status_code <code>
+//     }
+//
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	a := new(Authorize)
+
+	for h.Next() {
+		a.Expression = strings.Join(h.RemainingArgs(), " ")
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "status_code":
+				var codeStr string
+				if !h.AllArgs(&codeStr) {
+					return nil, h.ArgErr()
+				}
+				a.StatusCode = caddyhttp.WeakString(codeStr)
+			default:
+				return nil, h.Errf("unrecognized subdirective '%s'", h.Val())
+			}
+		}
+	}
+	if a.Expression == "" {
+		return nil, h.Err("an authorization policy expression is required")
+	}
+
+	return a, nil
+}
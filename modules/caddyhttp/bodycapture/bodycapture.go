@@ -0,0 +1,166 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bodycapture
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+}
+
+// Handler is a debugging middleware that captures request and/or
+// response bodies of matched requests, up to a size cap, and
+// emits them to this handler's logger. It is intended for
+// temporary use when reproducing client-specific bugs; capturing
+// bodies of all traffic is costly and may log sensitive data.
+type Handler struct {
+	// The maximum number of bytes of each body to capture.
+	// Bodies larger than this are truncated in the log (the
+	// request itself is unaffected). Default: 16384.
+	MaxSize int64 `json:"max_size,omitempty"`
+
+	// Whether to capture request bodies.
+	Request bool `json:"request,omitempty"`
+
+	// Whether to capture response bodies.
+	Response bool `json:"response,omitempty"`
+
+	// If true, captured bodies are logged base64-encoded,
+	// which is lossless for binary payloads. Otherwise bodies
+	// are logged as text with invalid UTF-8 replaced.
+	Base64 bool `json:"base64,omitempty"`
+
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.body_capture",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision sets up the handler.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	h.logger = ctx.Logger(h)
+	if h.MaxSize == 0 {
+		h.MaxSize = 16384
+	}
+	if !h.Request && !h.Response {
+		// capturing nothing would make the handler pointless
+		h.Request, h.Response = true, true
+	}
+	return nil
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	var reqBody, respBody bytes.Buffer
+
+	if h.Request && r.Body != nil {
+		r.Body = teeBody{
+			body: r.Body,
+			tee:  io.TeeReader(r.Body, limitedWriter{&reqBody, h.MaxSize}),
+		}
+	}
+	if h.Response {
+		w = &captureWriter{
+			ResponseWriterWrapper: &caddyhttp.ResponseWriterWrapper{ResponseWriter: w},
+			buf:                   limitedWriter{&respBody, h.MaxSize},
+		}
+	}
+
+	err := next.ServeHTTP(w, r)
+
+	fields := []zap.Field{
+		zap.String("method", r.Method),
+		zap.String("uri", r.RequestURI),
+	}
+	if h.Request {
+		fields = append(fields, zap.String("request_body", h.encode(reqBody.Bytes())))
+	}
+	if h.Response {
+		fields = append(fields, zap.String("response_body", h.encode(respBody.Bytes())))
+	}
+	h.logger.Info("captured bodies", fields...)
+
+	return err
+}
+
+// encode prepares a captured body for logging.
+func (h Handler) encode(body []byte) string {
+	if h.Base64 {
+		return base64.StdEncoding.EncodeToString(body)
+	}
+	return strings.ToValidUTF8(string(body), "�")
+}
+
+// teeBody wraps a request body so reads by later handlers are
+// copied into the capture buffer, while Close still reaches the
+// original body.
+type teeBody struct {
+	body io.ReadCloser
+	tee  io.Reader
+}
+
+func (tb teeBody) Read(p []byte) (int, error) { return tb.tee.Read(p) }
+func (tb teeBody) Close() error               { return tb.body.Close() }
+
+// limitedWriter absorbs writes but only keeps the first max
+// bytes, so captures are bounded regardless of body size.
+type limitedWriter struct {
+	buf *bytes.Buffer
+	max int64
+}
+
+func (lw limitedWriter) Write(p []byte) (int, error) {
+	if remaining := lw.max - int64(lw.buf.Len()); remaining > 0 {
+		if int64(len(p)) > remaining {
+			lw.buf.Write(p[:remaining])
+		} else {
+			lw.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// captureWriter copies response writes into the capture buffer
+// on their way to the client.
+type captureWriter struct {
+	*caddyhttp.ResponseWriterWrapper
+	buf limitedWriter
+}
+
+func (cw *captureWriter) Write(p []byte) (int, error) {
+	cw.buf.Write(p) //nolint:errcheck
+	return cw.ResponseWriterWrapper.Write(p)
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyhttp.HTTPInterfaces    = (*captureWriter)(nil)
+)
@@ -0,0 +1,63 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bodycapture
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	httpcaddyfile.RegisterHandlerDirective("body_capture", parseCaddyfile)
+}
+
+// parseCaddyfile sets up the handler from Caddyfile tokens. Syntax:
+//
+//     body_capture [<matcher>] {
+//         max_size <bytes>
+//         request
+//         response
+//         base64
+//     }
+//
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(Handler)
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "max_size":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				size, err := strconv.ParseInt(h.Val(), 10, 64)
+				if err != nil {
+					return nil, h.Errf("invalid max size: %v", err)
+				}
+				handler.MaxSize = size
+			case "request":
+				handler.Request = true
+			case "response":
+				handler.Response = true
+			case "base64":
+				handler.Base64 = true
+			default:
+				return nil, h.Errf("unrecognized subdirective '%s'", h.Val())
+			}
+		}
+	}
+	return handler, nil
+}
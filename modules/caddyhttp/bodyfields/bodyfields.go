@@ -0,0 +1,207 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bodyfields
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+}
+
+// Handler is a middleware that parses JSON or form request
+// bodies and exposes selected fields as placeholders, so later
+// handlers and matchers can route, log, or set headers based on
+// body content — for example, a tenant ID in a POST body. The
+// body is buffered up to a size cap and replayed, so later
+// handlers observe it unchanged.
+//
+// Each extracted field is available as a placeholder named
+// `{http.request.body.<field>}` and as a var named
+// `body.<field>`, so the vars matcher can route on it.
+//
+// Only bodies with a JSON or form-encoded Content-Type are
+// parsed; other requests, and bodies larger than the size cap,
+// pass through with no fields extracted.
+type Handler struct {
+	// The names of the fields to extract. For JSON bodies,
+	// nested fields can be addressed with dot notation, like
+	// "customer.id". For form bodies, the name is the form
+	// field name. Required.
+	Fields []string `json:"fields,omitempty"`
+
+	// The maximum number of body bytes to buffer and parse.
+	// Default: 65536.
+	MaxSize int64 `json:"max_size,omitempty"`
+
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.body_fields",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision sets up the handler.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	h.logger = ctx.Logger(h)
+	if h.MaxSize == 0 {
+		h.MaxSize = 65536
+	}
+	return nil
+}
+
+// Validate ensures the handler is configured properly.
+func (h Handler) Validate() error {
+	if len(h.Fields) == 0 {
+		return fmt.Errorf("no fields to extract")
+	}
+	return nil
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Body == nil {
+		return next.ServeHTTP(w, r)
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil ||
+		(contentType != "application/json" && contentType != "application/x-www-form-urlencoded") {
+		return next.ServeHTTP(w, r)
+	}
+
+	// buffer the body up to the cap, then replay it so later
+	// handlers read the body exactly as the client sent it;
+	// reading one extra byte tells us whether it was too big
+	buf, err := ioutil.ReadAll(io.LimitReader(r.Body, h.MaxSize+1))
+	r.Body = replayedBody{
+		Reader: io.MultiReader(bytes.NewReader(buf), r.Body),
+		closer: r.Body,
+	}
+	if err != nil {
+		h.logger.Debug("reading request body", zap.Error(err))
+		return next.ServeHTTP(w, r)
+	}
+	if int64(len(buf)) > h.MaxSize {
+		h.logger.Debug("request body exceeds max_size; not parsing",
+			zap.Int64("max_size", h.MaxSize))
+		return next.ServeHTTP(w, r)
+	}
+
+	var extract func(field string) (string, bool)
+	switch contentType {
+	case "application/json":
+		var decoded interface{}
+		if err := json.Unmarshal(buf, &decoded); err != nil {
+			h.logger.Debug("parsing JSON body", zap.Error(err))
+			return next.ServeHTTP(w, r)
+		}
+		extract = func(field string) (string, bool) {
+			return jsonField(decoded, field)
+		}
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(buf))
+		if err != nil {
+			h.logger.Debug("parsing form body", zap.Error(err))
+			return next.ServeHTTP(w, r)
+		}
+		extract = func(field string) (string, bool) {
+			if _, ok := form[field]; !ok {
+				return "", false
+			}
+			return form.Get(field), true
+		}
+	}
+
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	for _, field := range h.Fields {
+		val, ok := extract(field)
+		if !ok {
+			continue
+		}
+		repl.Set("http.request.body."+field, val)
+		caddyhttp.SetVar(r.Context(), "body."+field, val)
+	}
+
+	return next.ServeHTTP(w, r)
+}
+
+// jsonField extracts the field at the dot-separated path from
+// decoded JSON. Scalar values become their usual string forms;
+// objects and arrays are re-encoded as JSON.
+func jsonField(decoded interface{}, field string) (string, bool) {
+	current := decoded
+	for _, part := range strings.Split(field, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		current, ok = obj[part]
+		if !ok {
+			return "", false
+		}
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case nil:
+		return "", true
+	default:
+		enc, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(enc), true
+	}
+}
+
+// replayedBody stitches the buffered bytes back in front of
+// whatever remains of the original body, while Close still
+// reaches the original body.
+type replayedBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (rb replayedBody) Close() error { return rb.closer.Close() }
+
+// Interface guards
+var (
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.Validator             = (*Handler)(nil)
+)
@@ -0,0 +1,269 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botblock
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/internal/lists"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(BotBlock{})
+}
+
+// BotBlock is a middleware which blocks unwanted clients by
+// user-agent pattern or by membership in IP reputation lists.
+// Patterns and lists may be given inline or fetched from URLs
+// which are re-downloaded on a refresh interval, so externally
+// maintained block lists stay current without config reloads.
+//
+// Blocked requests receive a configurable status code (403 by
+// default, or 429 for rate-limit semantics) and can optionally
+// be tarpitted: the response is delayed to slow down abusive
+// scanners without consuming significant resources.
+type BotBlock struct {
+	// Regular expressions matched against the User-Agent
+	// header; a match blocks the request.
+	UserAgents []string `json:"user_agents,omitempty"`
+
+	// URLs serving newline-delimited user-agent regular
+	// expressions. Lines beginning with "#" are ignored.
+	UserAgentListURLs []string `json:"user_agent_list_urls,omitempty"`
+
+	// URLs serving newline-delimited IPs or CIDR ranges to
+	// block (IP reputation lists). Lines beginning with "#"
+	// are ignored.
+	IPListURLs []string `json:"ip_list_urls,omitempty"`
+
+	// How often to re-download the configured list URLs.
+	// Default: 1h.
+	RefreshInterval caddy.Duration `json:"refresh_interval,omitempty"`
+
+	// How long to stall a blocked request before responding.
+	// This "tarpit" slows down scanners cheaply. Default: no
+	// delay.
+	TarpitDuration caddy.Duration `json:"tarpit_duration,omitempty"`
+
+	// The HTTP status code for blocked requests. Default: 403.
+	StatusCode caddyhttp.WeakString `json:"status_code,omitempty"`
+
+	inlineRegexps []*regexp.Regexp
+	statusCode    int
+	logger        *zap.Logger
+
+	mu            *sync.RWMutex
+	listedRegexps []*regexp.Regexp
+	listedNets    []*net.IPNet
+
+	done chan struct{}
+}
+
+// CaddyModule returns the Caddy module information.
+func (BotBlock) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.bot_block",
+		New: func() caddy.Module { return new(BotBlock) },
+	}
+}
+
+// Provision sets up b.
+func (b *BotBlock) Provision(ctx caddy.Context) error {
+	b.logger = ctx.Logger(b)
+	b.mu = new(sync.RWMutex)
+
+	for _, pattern := range b.UserAgents {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("compiling user-agent pattern '%s': %v", pattern, err)
+		}
+		b.inlineRegexps = append(b.inlineRegexps, re)
+	}
+
+	b.statusCode = http.StatusForbidden
+	if b.StatusCode != "" {
+		b.statusCode = b.StatusCode.Int()
+	}
+	if b.RefreshInterval == 0 {
+		b.RefreshInterval = caddy.Duration(time.Hour)
+	}
+
+	if len(b.UserAgentListURLs) > 0 || len(b.IPListURLs) > 0 {
+		// fetch the lists once up front, then keep them fresh
+		// in the background; a failed refresh keeps the last
+		// good copy rather than dropping protection
+		b.refreshLists()
+		b.done = make(chan struct{})
+		go b.refreshLoop()
+	}
+
+	return nil
+}
+
+// Cleanup stops the background list refresher.
+func (b *BotBlock) Cleanup() error {
+	if b.done != nil {
+		close(b.done)
+	}
+	return nil
+}
+
+func (b *BotBlock) refreshLoop() {
+	ticker := time.NewTicker(time.Duration(b.RefreshInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.refreshLists()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// refreshLists downloads all configured list URLs and swaps in
+// the parsed results.
+func (b *BotBlock) refreshLists() {
+	var regexps []*regexp.Regexp
+	for _, url := range b.UserAgentListURLs {
+		lines, err := lists.FetchLines(url, lists.DefaultTimeout)
+		if err != nil {
+			b.logger.Error("refreshing user-agent list",
+				zap.String("url", url), zap.Error(err))
+			return
+		}
+		for _, line := range lines {
+			re, err := regexp.Compile(line)
+			if err != nil {
+				b.logger.Warn("skipping bad user-agent pattern",
+					zap.String("url", url),
+					zap.String("pattern", line),
+					zap.Error(err))
+				continue
+			}
+			regexps = append(regexps, re)
+		}
+	}
+
+	var nets []*net.IPNet
+	for _, url := range b.IPListURLs {
+		lines, err := lists.FetchLines(url, lists.DefaultTimeout)
+		if err != nil {
+			b.logger.Error("refreshing IP list",
+				zap.String("url", url), zap.Error(err))
+			return
+		}
+		for _, line := range lines {
+			if !strings.Contains(line, "/") {
+				if strings.Contains(line, ":") {
+					line += "/128"
+				} else {
+					line += "/32"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(line)
+			if err != nil {
+				b.logger.Warn("skipping bad IP or CIDR",
+					zap.String("url", url),
+					zap.String("value", line),
+					zap.Error(err))
+				continue
+			}
+			nets = append(nets, ipNet)
+		}
+	}
+
+	b.mu.Lock()
+	b.listedRegexps = regexps
+	b.listedNets = nets
+	b.mu.Unlock()
+
+	b.logger.Debug("refreshed block lists",
+		zap.Int("user_agent_patterns", len(regexps)),
+		zap.Int("ip_ranges", len(nets)))
+}
+
+func (b *BotBlock) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	reason := b.blockReason(r)
+	if reason == "" {
+		return next.ServeHTTP(w, r)
+	}
+
+	b.logger.Info("blocked request",
+		zap.String("reason", reason),
+		zap.String("user_agent", r.Header.Get("User-Agent")),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("uri", r.RequestURI))
+
+	if b.TarpitDuration > 0 {
+		select {
+		case <-time.After(time.Duration(b.TarpitDuration)):
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+
+	return caddyhttp.Error(b.statusCode, fmt.Errorf("client blocked: %s", reason))
+}
+
+// blockReason returns a short description of why r should be
+// blocked, or empty string if it should be allowed.
+func (b *BotBlock) blockReason(r *http.Request) string {
+	ua := r.Header.Get("User-Agent")
+	for _, re := range b.inlineRegexps {
+		if re.MatchString(ua) {
+			return "user-agent pattern " + re.String()
+		}
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, re := range b.listedRegexps {
+		if re.MatchString(ua) {
+			return "listed user-agent pattern " + re.String()
+		}
+	}
+	if len(b.listedNets) > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			for _, ipNet := range b.listedNets {
+				if ipNet.Contains(ip) {
+					return "IP listed in " + ipNet.String()
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*BotBlock)(nil)
+	_ caddy.CleanerUpper          = (*BotBlock)(nil)
+	_ caddyhttp.MiddlewareHandler = (*BotBlock)(nil)
+)
@@ -18,6 +18,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"reflect"
 	"regexp"
@@ -57,7 +58,12 @@ func init() {
 type MatchExpression struct {
 	// The CEL expression to evaluate. Any Caddy placeholders
 	// will be expanded and situated into proper CEL function
-	// calls before evaluating.
+	// calls before evaluating. For convenience, the variables
+	// `path`, `method`, `host`, `scheme`, and `remote_ip` are
+	// defined, as are the functions `header('Name')` and
+	// `query('key')`, so common conditions such as
+	// `header('X-Env') == 'prod' && path.startsWith('/api')`
+	// do not require placeholder syntax.
 	Expr string
 
 	expandedExpr string
@@ -89,6 +95,11 @@ func (m *MatchExpression) Provision(_ caddy.Context) error {
 	// light (and possibly naïve) syntactic sugar
 	m.expandedExpr = placeholderRegexp.ReplaceAllString(m.Expr, placeholderExpansion)
 
+	// similar sugar for the header() and query() convenience
+	// functions, which are lookups in the same replacer
+	m.expandedExpr = headerFuncRegexp.ReplaceAllString(m.expandedExpr, headerFuncExpansion)
+	m.expandedExpr = queryFuncRegexp.ReplaceAllString(m.expandedExpr, queryFuncExpansion)
+
 	// our type adapter expands CEL's standard type support
 	m.ta = celTypeAdapter{}
 
@@ -96,6 +107,11 @@ func (m *MatchExpression) Provision(_ caddy.Context) error {
 	env, err := cel.NewEnv(
 		cel.Declarations(
 			decls.NewVar("request", httpRequestObjectType),
+			decls.NewVar("path", decls.String),
+			decls.NewVar("method", decls.String),
+			decls.NewVar("host", decls.String),
+			decls.NewVar("scheme", decls.String),
+			decls.NewVar("remote_ip", decls.String),
 			decls.NewFunction(placeholderFuncName,
 				decls.NewOverload(placeholderFuncName+"_httpRequest_string",
 					[]*exprpb.Type{httpRequestObjectType, decls.String},
@@ -138,8 +154,21 @@ func (m *MatchExpression) Provision(_ caddy.Context) error {
 
 // Match returns true if r matches m.
 func (m MatchExpression) Match(r *http.Request) bool {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
 	out, _, _ := m.prg.Eval(map[string]interface{}{
-		"request": celHTTPRequest{r},
+		"request":   celHTTPRequest{r},
+		"path":      r.URL.Path,
+		"method":    r.Method,
+		"host":      r.Host,
+		"scheme":    scheme,
+		"remote_ip": remoteIP,
 	})
 	if outBool, ok := out.Value().(bool); ok {
 		return outBool
@@ -245,6 +274,12 @@ func (celTypeAdapter) NativeToValue(value interface{}) ref.Val {
 var (
 	placeholderRegexp    = regexp.MustCompile(`{([\w.-]+)}`)
 	placeholderExpansion = `caddyPlaceholder(request, "${1}")`
+
+	headerFuncRegexp    = regexp.MustCompile(`\bheader\(\s*'([\w-]+)'\s*\)`)
+	headerFuncExpansion = `caddyPlaceholder(request, "http.request.header.${1}")`
+
+	queryFuncRegexp    = regexp.MustCompile(`\bquery\(\s*'([^']+)'\s*\)`)
+	queryFuncExpansion = `caddyPlaceholder(request, "http.request.uri.query.${1}")`
 )
 
 var httpRequestObjectType = decls.NewObjectType("http.Request")
@@ -45,6 +45,13 @@ func TestMatchExpressionProvision(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "convenience variables and functions compile",
+			expression: &MatchExpression{
+				Expr: "header('X-Env') == 'prod' && path.startsWith('/api')",
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -86,6 +93,27 @@ eqp31wM9il1n+guTNyxJd+FzVAH+hCZE5K+tCgVDdVFUlDEHHbS/wqb2PSIoouLV
 			clientCertificate: clientCert,
 			wantResult:        true,
 		},
+		{
+			name: "path variable matches the request path",
+			expression: &MatchExpression{
+				Expr: "path.startsWith('/foo')",
+			},
+			wantResult: true,
+		},
+		{
+			name: "method and host variables match",
+			expression: &MatchExpression{
+				Expr: "method == 'GET' && host == 'example.com'",
+			},
+			wantResult: true,
+		},
+		{
+			name: "header function reads request headers",
+			expression: &MatchExpression{
+				Expr: "header('X-Env') == 'prod'",
+			},
+			wantResult: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
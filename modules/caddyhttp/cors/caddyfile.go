@@ -0,0 +1,88 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cors
+
+import (
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	httpcaddyfile.RegisterHandlerDirective("cors", parseCaddyfile)
+}
+
+// parseCaddyfile unmarshals tokens from h into a new CORS handler.
+// Syntax:
+//
+//     cors [<matcher>] [<origins...>] {
+//         origins_regexp    <patterns...>
+//         methods           <methods...>
+//         headers           <headers...>
+//         expose_headers    <headers...>
+//         allow_credentials
+//         max_age           <duration>
+//     }
+//
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	c := new(CORS)
+
+	for h.Next() {
+		c.AllowOrigins = h.RemainingArgs()
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "origins_regexp":
+				c.AllowOriginsRegexp = h.RemainingArgs()
+				if len(c.AllowOriginsRegexp) == 0 {
+					return nil, h.ArgErr()
+				}
+			case "methods":
+				c.AllowMethods = h.RemainingArgs()
+				if len(c.AllowMethods) == 0 {
+					return nil, h.ArgErr()
+				}
+			case "headers":
+				c.AllowHeaders = h.RemainingArgs()
+				if len(c.AllowHeaders) == 0 {
+					return nil, h.ArgErr()
+				}
+			case "expose_headers":
+				c.ExposeHeaders = h.RemainingArgs()
+				if len(c.ExposeHeaders) == 0 {
+					return nil, h.ArgErr()
+				}
+			case "allow_credentials":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				c.AllowCredentials = true
+			case "max_age":
+				var ageStr string
+				if !h.AllArgs(&ageStr) {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(ageStr)
+				if err != nil {
+					return nil, h.Errf("parsing max_age: %v", err)
+				}
+				c.MaxAge = caddy.Duration(dur)
+			default:
+				return nil, h.Errf("unrecognized subdirective '%s'", h.Val())
+			}
+		}
+	}
+
+	return c, nil
+}
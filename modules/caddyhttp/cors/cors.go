@@ -0,0 +1,203 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(CORS{})
+}
+
+// CORS is a middleware which implements Cross-Origin Resource
+// Sharing: it answers preflight (OPTIONS) requests without
+// invoking later handlers, and decorates actual responses with
+// the appropriate Access-Control-* headers. Using this handler
+// instead of manual header manipulation ensures preflights are
+// handled correctly and that Vary is always set.
+type CORS struct {
+	// The origins allowed to make cross-origin requests.
+	// An origin may be an exact value ("https://example.com"),
+	// "*" to allow any origin, or contain a wildcard as the
+	// leftmost label ("https://*.example.com"). Default: "*".
+	AllowOrigins []string `json:"allow_origins,omitempty"`
+
+	// Regular expressions that allowed origins must match
+	// entirely. These are checked in addition to allow_origins.
+	AllowOriginsRegexp []string `json:"allow_origins_regexp,omitempty"`
+
+	// The methods to permit in preflight responses.
+	// Default: "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS".
+	AllowMethods []string `json:"allow_methods,omitempty"`
+
+	// The request headers to permit in preflight responses.
+	// If empty, the headers requested by the client in
+	// Access-Control-Request-Headers are echoed back.
+	AllowHeaders []string `json:"allow_headers,omitempty"`
+
+	// Response headers to make readable to the client.
+	ExposeHeaders []string `json:"expose_headers,omitempty"`
+
+	// Whether to allow credentialed requests. When enabled,
+	// the allowed origin is always echoed back rather than
+	// using "*", as the Fetch spec requires.
+	AllowCredentials bool `json:"allow_credentials,omitempty"`
+
+	// How long preflight results may be cached by the client.
+	MaxAge caddy.Duration `json:"max_age,omitempty"`
+
+	originRegexps []*regexp.Regexp
+}
+
+// CaddyModule returns the Caddy module information.
+func (CORS) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.cors",
+		New: func() caddy.Module { return new(CORS) },
+	}
+}
+
+// Provision sets up c.
+func (c *CORS) Provision(_ caddy.Context) error {
+	if len(c.AllowOrigins) == 0 && len(c.AllowOriginsRegexp) == 0 {
+		c.AllowOrigins = []string{"*"}
+	}
+	if len(c.AllowMethods) == 0 {
+		c.AllowMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	}
+	for _, pattern := range c.AllowOriginsRegexp {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("compiling origin pattern '%s': %v", pattern, err)
+		}
+		c.originRegexps = append(c.originRegexps, re)
+	}
+	return nil
+}
+
+// Validate ensures c has a sane configuration.
+func (c *CORS) Validate() error {
+	if c.AllowCredentials {
+		for _, o := range c.AllowOrigins {
+			if o == "*" {
+				return fmt.Errorf("allow_credentials cannot be used with a wildcard origin")
+			}
+		}
+	}
+	return nil
+}
+
+func (c CORS) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return next.ServeHTTP(w, r)
+	}
+
+	// the response depends on the Origin header regardless
+	// of whether this origin is allowed, so always vary
+	w.Header().Add("Vary", "Origin")
+
+	allowed, wildcard := c.originAllowed(origin)
+	if !allowed {
+		if isPreflight(r) {
+			// an unallowed preflight gets a definitive answer here;
+			// passing it through would only confuse later handlers
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		return next.ServeHTTP(w, r)
+	}
+
+	allowOrigin := origin
+	if wildcard && !c.AllowCredentials {
+		allowOrigin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+	if c.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if isPreflight(r) {
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.AllowMethods, ", "))
+		if len(c.AllowHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.AllowHeaders, ", "))
+		} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+			w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if c.MaxAge > 0 {
+			secs := int(time.Duration(c.MaxAge) / time.Second)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(secs))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	if len(c.ExposeHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.ExposeHeaders, ", "))
+	}
+
+	return next.ServeHTTP(w, r)
+}
+
+// originAllowed returns whether origin is permitted, and whether
+// it was permitted by the "*" wildcard (in which case the header
+// may be reduced to "*" for cacheability).
+func (c CORS) originAllowed(origin string) (allowed, wildcard bool) {
+	for _, o := range c.AllowOrigins {
+		if o == "*" {
+			return true, true
+		}
+		if strings.EqualFold(o, origin) {
+			return true, false
+		}
+		// wildcard in leftmost label, e.g. https://*.example.com
+		if i := strings.Index(o, "://*."); i >= 0 {
+			scheme, suffix := o[:i], o[i+len("://*"):]
+			if strings.HasPrefix(origin, scheme+"://") &&
+				strings.HasSuffix(origin, suffix) &&
+				len(origin) > len(scheme)+len("://")+len(suffix) {
+				return true, false
+			}
+		}
+	}
+	for _, re := range c.originRegexps {
+		if re.MatchString(origin) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*CORS)(nil)
+	_ caddy.Validator             = (*CORS)(nil)
+	_ caddyhttp.MiddlewareHandler = (*CORS)(nil)
+)
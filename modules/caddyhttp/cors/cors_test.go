@@ -0,0 +1,85 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cors
+
+import (
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	for i, tc := range []struct {
+		allowOrigins  []string
+		regexps       []string
+		origin        string
+		expectAllowed bool
+	}{
+		{
+			allowOrigins:  []string{"*"},
+			origin:        "https://example.com",
+			expectAllowed: true,
+		},
+		{
+			allowOrigins:  []string{"https://example.com"},
+			origin:        "https://example.com",
+			expectAllowed: true,
+		},
+		{
+			allowOrigins:  []string{"https://example.com"},
+			origin:        "https://evil.example.net",
+			expectAllowed: false,
+		},
+		{
+			allowOrigins:  []string{"https://*.example.com"},
+			origin:        "https://api.example.com",
+			expectAllowed: true,
+		},
+		{
+			allowOrigins:  []string{"https://*.example.com"},
+			origin:        "https://example.com",
+			expectAllowed: false,
+		},
+		{
+			allowOrigins:  []string{"https://*.example.com"},
+			origin:        "http://api.example.com",
+			expectAllowed: false,
+		},
+		{
+			regexps:       []string{`https://\w+\.example\.com`},
+			origin:        "https://api.example.com",
+			expectAllowed: true,
+		},
+		{
+			regexps:       []string{`https://\w+\.example\.com`},
+			origin:        "https://api.example.com.evil.net",
+			expectAllowed: false,
+		},
+	} {
+		c := CORS{
+			AllowOrigins:       tc.allowOrigins,
+			AllowOriginsRegexp: tc.regexps,
+		}
+		err := c.Provision(caddy.Context{})
+		if err != nil {
+			t.Fatalf("Test %d: provisioning: %v", i, err)
+		}
+		allowed, _ := c.originAllowed(tc.origin)
+		if allowed != tc.expectAllowed {
+			t.Errorf("Test %d: origin '%s' with allowed %v: expected %t but got %t",
+				i, tc.origin, tc.allowOrigins, tc.expectAllowed, allowed)
+		}
+	}
+}
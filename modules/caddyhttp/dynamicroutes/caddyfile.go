@@ -0,0 +1,91 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamicroutes
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	httpcaddyfile.RegisterHandlerDirective("dynamic_routes", parseCaddyfile)
+}
+
+// parseCaddyfile sets up the handler from Caddyfile tokens. Syntax:
+//
+//     dynamic_routes [<matcher>] <endpoint> {
+//         ttl <duration>
+//         negative_ttl <duration>
+//         timeout <duration>
+//         max_entries <count>
+//     }
+//
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(Handler)
+	for h.Next() {
+		if h.NextArg() {
+			handler.Endpoint = h.Val()
+		}
+		if h.NextArg() {
+			return nil, h.ArgErr()
+		}
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "ttl":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid ttl: %v", err)
+				}
+				handler.TTL = caddy.Duration(dur)
+			case "negative_ttl":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid negative ttl: %v", err)
+				}
+				handler.NegativeTTL = caddy.Duration(dur)
+			case "timeout":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid timeout: %v", err)
+				}
+				handler.Timeout = caddy.Duration(dur)
+			case "max_entries":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				count, err := strconv.Atoi(h.Val())
+				if err != nil {
+					return nil, h.Errf("invalid max entries: %v", err)
+				}
+				handler.MaxEntries = count
+			default:
+				return nil, h.Errf("unrecognized subdirective '%s'", h.Val())
+			}
+		}
+	}
+	return handler, nil
+}
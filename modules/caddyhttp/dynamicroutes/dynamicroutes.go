@@ -0,0 +1,281 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamicroutes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+}
+
+// Handler fetches route definitions at request time for hosts
+// that are not part of the static config, by asking a backend
+// control plane. Fetched definitions are cached with a TTL.
+// Together with on-demand TLS, this enables fully dynamic
+// multi-tenant hosting: a catch-all server can serve any number
+// of hosts whose routing lives in an external system.
+type Handler struct {
+	// The control plane URL to fetch route definitions from.
+	// The host being looked up is appended as the "host" query
+	// parameter. The endpoint must respond with a JSON array of
+	// routes (the same format as a server's "routes" config),
+	// or with status 204 or 404 if it has none for the host.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// How long fetched route definitions are reused before the
+	// control plane is consulted again. Default: 1m.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	// How long a "no routes for this host" answer is cached.
+	// Default: same as the TTL.
+	NegativeTTL caddy.Duration `json:"negative_ttl,omitempty"`
+
+	// Maximum time for a control plane request. Default: 5s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	// Maximum number of hosts to cache routes for; when full,
+	// expired entries are evicted and uncacheable lookups are
+	// simply not stored. Default: 10000.
+	MaxEntries int `json:"max_entries,omitempty"`
+
+	ctx    caddy.Context
+	logger *zap.Logger
+	client *http.Client
+
+	mu    *sync.RWMutex
+	cache map[string]*cacheEntry
+}
+
+// cacheEntry is a cached control plane answer for one host; nil
+// routes means the control plane has no routes for the host. The
+// cancel func releases the context the routes were provisioned
+// in. Entries are reference-counted: the cache holds one
+// reference and every request serving from the entry holds
+// another, so that evicting or replacing an entry never cleans
+// up routes that an in-flight request is still executing.
+type cacheEntry struct {
+	routes  caddyhttp.RouteList
+	expires time.Time
+	cancel  context.CancelFunc
+	refs    int32 // accessed atomically
+}
+
+// acquire adds a reference to the entry. The caller must already
+// hold a reference, or the cache's read lock (which excludes the
+// locked paths that drop the cache's own reference).
+func (e *cacheEntry) acquire() {
+	atomic.AddInt32(&e.refs, 1)
+}
+
+// release drops a reference to the entry; when the last one is
+// gone, the provisioning context of the entry's routes is
+// cancelled and their module instances are cleaned up.
+func (e *cacheEntry) release() {
+	if atomic.AddInt32(&e.refs, -1) == 0 && e.cancel != nil {
+		e.cancel()
+	}
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.dynamic_routes",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision sets up the handler.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	if h.Endpoint == "" {
+		return fmt.Errorf("an endpoint is required")
+	}
+	if h.TTL == 0 {
+		h.TTL = caddy.Duration(1 * time.Minute)
+	}
+	if h.NegativeTTL == 0 {
+		h.NegativeTTL = h.TTL
+	}
+	if h.Timeout == 0 {
+		h.Timeout = caddy.Duration(5 * time.Second)
+	}
+	if h.MaxEntries == 0 {
+		h.MaxEntries = 10000
+	}
+	h.ctx = ctx
+	h.logger = ctx.Logger(h)
+	h.client = &http.Client{Timeout: time.Duration(h.Timeout)}
+	h.mu = new(sync.RWMutex)
+	h.cache = make(map[string]*cacheEntry)
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	host := r.Host
+	if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+		host = hostOnly
+	}
+	host = strings.ToLower(host)
+
+	h.mu.RLock()
+	entry, cached := h.cache[host]
+	if cached {
+		// hold a reference for the duration of this request so a
+		// concurrent eviction cannot clean up the routes while we
+		// are still executing them
+		entry.acquire()
+		defer entry.release()
+	}
+	h.mu.RUnlock()
+
+	if !cached || time.Now().After(entry.expires) {
+		routes, cancel, err := h.fetchRoutes(host)
+		if err != nil {
+			// the control plane being unreachable should not take
+			// every dynamic host down; fall through to the rest of
+			// the handler chain
+			h.logger.Error("fetching routes",
+				zap.String("host", host),
+				zap.Error(err))
+			return next.ServeHTTP(w, r)
+		}
+		ttl := h.TTL
+		if routes == nil {
+			ttl = h.NegativeTTL
+		}
+		entry = &cacheEntry{routes: routes, expires: time.Now().Add(time.Duration(ttl)), cancel: cancel, refs: 1}
+		defer entry.release()
+		h.store(host, entry)
+	}
+
+	if entry.routes == nil {
+		return next.ServeHTTP(w, r)
+	}
+
+	// compile against the rest of the chain so unmatched requests
+	// still continue through it
+	return entry.routes.Compile(next).ServeHTTP(w, r)
+}
+
+// fetchRoutes asks the control plane for the routes of host and
+// provisions them in a context derived from the handler's, whose
+// returned cancel func unloads the provisioned modules. A nil
+// route list with a nil error means the control plane has no
+// routes for the host.
+func (h *Handler) fetchRoutes(host string) (caddyhttp.RouteList, context.CancelFunc, error) {
+	endpoint := h.Endpoint
+	if strings.Contains(endpoint, "?") {
+		endpoint += "&host=" + url.QueryEscape(host)
+	} else {
+		endpoint += "?host=" + url.QueryEscape(host)
+	}
+
+	resp, err := h.client.Get(endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotFound {
+		return nil, nil, nil
+	}
+	if resp.StatusCode >= 400 {
+		return nil, nil, fmt.Errorf("control plane responded with HTTP %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var routes caddyhttp.RouteList
+	if err := json.Unmarshal(body, &routes); err != nil {
+		return nil, nil, fmt.Errorf("decoding routes: %v", err)
+	}
+	if len(routes) == 0 {
+		return nil, nil, nil
+	}
+
+	// provision in a child context so the module instances can be
+	// released when the cache entry expires, instead of living in
+	// the config's context until the next reload
+	ctx, cancel := caddy.NewContext(h.ctx)
+	if err := routes.Provision(ctx); err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("provisioning routes: %v", err)
+	}
+
+	return routes, cancel, nil
+}
+
+// store caches entry for host, evicting expired entries if the
+// cache is full; if it is still full, the entry is not cached.
+// The cache takes its own reference to stored entries and drops
+// its reference to any it evicts or replaces; requests still
+// serving from those keep them alive until they finish.
+func (h *Handler) store(host string, entry *cacheEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.cache) >= h.MaxEntries {
+		now := time.Now()
+		for cachedHost, cachedEntry := range h.cache {
+			if now.After(cachedEntry.expires) {
+				cachedEntry.release()
+				delete(h.cache, cachedHost)
+			}
+		}
+		if len(h.cache) >= h.MaxEntries {
+			return
+		}
+	}
+	if old, ok := h.cache[host]; ok {
+		old.release()
+	}
+	entry.acquire()
+	h.cache[host] = entry
+}
+
+// Cleanup releases all cached route sets.
+func (h *Handler) Cleanup() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for host, entry := range h.cache {
+		entry.release()
+		delete(h.cache, host)
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.CleanerUpper          = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+)
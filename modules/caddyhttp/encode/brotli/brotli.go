@@ -0,0 +1,101 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddybrotli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/andybalholm/brotli"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/encode"
+)
+
+func init() {
+	caddy.RegisterModule(Brotli{})
+}
+
+// Brotli can create brotli encoders. This uses a pure-Go
+// implementation of the algorithm, so compressing on the
+// fly is slower than gzip at comparable ratios; prefer
+// lower quality settings for dynamic responses.
+type Brotli struct {
+	Quality *int `json:"quality,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (Brotli) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.encoders.br",
+		New: func() caddy.Module { return new(Brotli) },
+	}
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+func (b *Brotli) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if !d.NextArg() {
+			continue
+		}
+		qualityStr := d.Val()
+		quality, err := strconv.Atoi(qualityStr)
+		if err != nil {
+			return err
+		}
+		b.Quality = &quality
+	}
+	return nil
+}
+
+// Validate validates b's configuration.
+func (b Brotli) Validate() error {
+	if b.Quality != nil {
+		quality := *b.Quality
+		if quality < brotli.BestSpeed {
+			return fmt.Errorf("quality too low; must be >= %d", brotli.BestSpeed)
+		}
+		if quality > brotli.BestCompression {
+			return fmt.Errorf("quality too high; must be <= %d", brotli.BestCompression)
+		}
+	}
+	return nil
+}
+
+// AcceptEncoding returns the name of the encoding as
+// used in the Accept-Encoding request headers.
+func (Brotli) AcceptEncoding() string { return "br" }
+
+// NewEncoder returns a new brotli writer.
+func (b Brotli) NewEncoder() encode.Encoder {
+	quality := defaultBrotliQuality
+	if b.Quality != nil {
+		quality = *b.Quality
+	}
+	return brotli.NewWriterLevel(nil, quality)
+}
+
+// defaultBrotliQuality is a lower quality than the brotli
+// default (6) because the pure-Go encoder gets very slow at
+// higher levels; 4 compresses comparably to gzip at similar
+// speed.
+var defaultBrotliQuality = 4
+
+// Interface guards
+var (
+	_ encode.Encoding       = (*Brotli)(nil)
+	_ caddy.Validator       = (*Brotli)(nil)
+	_ caddyfile.Unmarshaler = (*Brotli)(nil)
+)
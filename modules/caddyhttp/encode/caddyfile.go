@@ -16,6 +16,9 @@ package encode
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
@@ -40,8 +43,15 @@ func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error)
 // UnmarshalCaddyfile sets up the handler from Caddyfile tokens. Syntax:
 //
 //     encode [<matcher>] <formats...> {
-//         gzip [<level>]
-//         zstd
+//         gzip           [<level>]
+//         zstd           [<level>]
+//         br             [<quality>]
+//         prefer         <formats...>
+//         minimum_length <length>
+//         match {
+//             status <code...>
+//             header <field> [<value>]
+//         }
 //     }
 //
 // Specifying the formats on the first line will use those formats' defaults.
@@ -64,6 +74,31 @@ func (enc *Encode) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 
 		for d.NextBlock(0) {
 			name := d.Val()
+			switch name {
+			case "prefer":
+				enc.Prefer = d.RemainingArgs()
+				if len(enc.Prefer) == 0 {
+					return d.ArgErr()
+				}
+				continue
+			case "minimum_length":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				minLength, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return err
+				}
+				enc.MinLength = minLength
+				continue
+			case "match":
+				matcher, err := parseResponseMatcher(d)
+				if err != nil {
+					return err
+				}
+				enc.Matcher = matcher
+				continue
+			}
 			mod, err := caddy.GetModule("http.encoders." + name)
 			if err != nil {
 				return fmt.Errorf("getting encoder module '%s': %v", name, err)
@@ -90,5 +125,56 @@ func (enc *Encode) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 	return nil
 }
 
+// parseResponseMatcher parses the block following a "match"
+// subdirective into a response matcher. Syntax:
+//
+//     match {
+//         status <code...>
+//         header <field> [<value>]
+//     }
+//
+// A status code may use a trailing "xx" wildcard (e.g. 2xx)
+// to match the whole class.
+func parseResponseMatcher(d *caddyfile.Dispenser) (*caddyhttp.ResponseMatcher, error) {
+	matcher := new(caddyhttp.ResponseMatcher)
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "status":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return nil, d.ArgErr()
+			}
+			for _, arg := range args {
+				if len(arg) == 3 && strings.HasSuffix(arg, "xx") {
+					arg = arg[:1]
+				}
+				statusNum, err := strconv.Atoi(arg)
+				if err != nil {
+					return nil, d.Errf("bad status value '%s': %v", arg, err)
+				}
+				matcher.StatusCode = append(matcher.StatusCode, statusNum)
+			}
+		case "header":
+			if matcher.Headers == nil {
+				matcher.Headers = make(http.Header)
+			}
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			field := d.Val()
+			if d.NextArg() {
+				matcher.Headers.Add(field, d.Val())
+			} else {
+				// a non-nil but empty list of values
+				// means match if the field exists at all
+				matcher.Headers[http.CanonicalHeaderKey(field)] = []string{}
+			}
+		default:
+			return nil, d.Errf("unrecognized response matcher %s", d.Val())
+		}
+	}
+	return matcher, nil
+}
+
 // Interface guard
 var _ caddyfile.Unmarshaler = (*Encode)(nil)
@@ -21,6 +21,7 @@ package encode
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -43,13 +44,20 @@ type Encode struct {
 	// will be chosen based on the client's Accept-Encoding header.
 	EncodingsRaw caddy.ModuleMap `json:"encodings,omitempty" caddy:"namespace=http.encoders"`
 
-	// If the client has no strong preference, choose this encoding. TODO: Not yet implemented
-	// Prefer    []string `json:"prefer,omitempty"`
+	// If the client has no strong preference (identical quality values),
+	// choose these encodings in order, most preferred first.
+	Prefer []string `json:"prefer,omitempty"`
 
 	// Only encode responses that are at least this many bytes long.
 	MinLength int `json:"minimum_length,omitempty"`
 
-	writerPools map[string]*sync.Pool // TODO: these pools do not get reused through config reloads...
+	// Only encode responses that match against this ResponseMatcher.
+	// The default is a collection of text-based Content-Type headers;
+	// already-compressed types such as images, video, and archives
+	// gain nothing from being recompressed.
+	Matcher *caddyhttp.ResponseMatcher `json:"match,omitempty"`
+
+	writerPools map[string]*sync.Pool
 }
 
 // CaddyModule returns the Caddy module information.
@@ -75,11 +83,45 @@ func (enc *Encode) Provision(ctx caddy.Context) error {
 	if enc.MinLength == 0 {
 		enc.MinLength = defaultMinLength
 	}
+
+	if enc.Matcher == nil {
+		// common text-based content types
+		enc.Matcher = &caddyhttp.ResponseMatcher{
+			Headers: http.Header{
+				"Content-Type": []string{
+					"text/*",
+					"application/json*",
+					"application/javascript*",
+					"application/xhtml+xml*",
+					"application/atom+xml*",
+					"application/rss+xml*",
+					"application/wasm*",
+					"image/svg+xml*",
+				},
+			},
+		}
+	}
+
+	return nil
+}
+
+// Validate ensures that enc's configuration is valid.
+func (enc *Encode) Validate() error {
+	check := make(map[string]bool)
+	for _, encName := range enc.Prefer {
+		if _, ok := enc.writerPools[encName]; !ok {
+			return fmt.Errorf("encoding %s not enabled", encName)
+		}
+		if check[encName] {
+			return fmt.Errorf("encoding %s is duplicated in prefer", encName)
+		}
+		check[encName] = true
+	}
 	return nil
 }
 
 func (enc *Encode) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
-	for _, encName := range acceptedEncodings(r) {
+	for _, encName := range acceptedEncodings(r, enc.Prefer) {
 		if _, ok := enc.writerPools[encName]; !ok {
 			continue // encoding not offered
 		}
@@ -101,14 +143,48 @@ func (enc *Encode) addEncoding(e Encoding) error {
 	if enc.writerPools == nil {
 		enc.writerPools = make(map[string]*sync.Pool)
 	}
-	enc.writerPools[ae] = &sync.Pool{
+	enc.writerPools[ae] = encoderPool(ae, e)
+	return nil
+}
+
+// encoderPool returns the shared pool of writers for the given
+// encoding and its settings, creating the pool if needed. Pools
+// are package-level so that expensive compressor writers survive
+// config reloads, and they are keyed by the encoder's settings
+// as well as its name, because a pooled writer retains the
+// compression level it was created with.
+func encoderPool(ae string, e Encoding) *sync.Pool {
+	pool := &sync.Pool{
 		New: func() interface{} {
 			return e.NewEncoder()
 		},
 	}
-	return nil
+
+	// key by the encoder's JSON config, which is a stable value
+	// representation; printing the struct would render pointer
+	// fields as addresses, minting a new key (and leaking a pool)
+	// on every config reload
+	cfg, err := json.Marshal(e)
+	if err != nil {
+		// no stable key for this encoder; use an unshared pool
+		return pool
+	}
+	key := ae + "/" + string(cfg)
+
+	encoderPoolsMu.Lock()
+	defer encoderPoolsMu.Unlock()
+	if pool, ok := encoderPools[key]; ok {
+		return pool
+	}
+	encoderPools[key] = pool
+	return pool
 }
 
+var (
+	encoderPoolsMu sync.Mutex
+	encoderPools   = make(map[string]*sync.Pool)
+)
+
 // openResponseWriter creates a new response writer that may (or may not)
 // encode the response with encodingName. The returned response writer MUST
 // be closed after the handler completes.
@@ -142,6 +218,7 @@ type responseWriter struct {
 	buf          *bytes.Buffer
 	config       *Encode
 	statusCode   int
+	streamed     bool
 }
 
 // WriteHeader stores the status to write when the time comes
@@ -195,6 +272,46 @@ func (rw *responseWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// Flush implements http.Flusher. A flush is the telltale sign of
+// a streaming response (server-sent events, long-polling, chunked
+// output from a slow backend), so the first flush forces the
+// encoding decision with whatever has been written so far rather
+// than waiting for the minimum length, then disables buffering
+// for the rest of the response. The encoder, if one is in use, is
+// also flushed so that compressed data actually reaches the
+// client instead of sitting in the compressor's window.
+func (rw *responseWriter) Flush() {
+	rw.streamed = true
+
+	// stop buffering and write out anything we were holding back
+	if rw.buf != nil && rw.config.MinLength > 0 {
+		rw.init()
+		p := rw.buf.Bytes()
+		bufPool.Put(rw.buf)
+		rw.buf = nil
+		if rw.statusCode > 0 {
+			rw.ResponseWriter.WriteHeader(rw.statusCode)
+			rw.statusCode = 0
+		}
+		if rw.w != nil {
+			rw.w.Write(p)
+		} else {
+			rw.ResponseWriter.Write(p)
+		}
+	} else if rw.statusCode > 0 {
+		rw.ResponseWriter.WriteHeader(rw.statusCode)
+		rw.statusCode = 0
+	}
+
+	if rw.w != nil {
+		if f, ok := rw.w.(flusher); ok {
+			f.Flush()
+		}
+	}
+
+	rw.ResponseWriterWrapper.Flush()
+}
+
 // Close writes any remaining buffered response and
 // deallocates any active resources.
 func (rw *responseWriter) Close() error {
@@ -238,9 +355,24 @@ func (rw *responseWriter) Close() error {
 	return err
 }
 
+// Match returns true if the response qualifies for
+// encoding based on the configured response matcher.
+func (enc *Encode) Match(rw *responseWriter) bool {
+	statusCode := rw.statusCode
+	if statusCode == 0 {
+		// no WriteHeader call means an implicit 200
+		statusCode = http.StatusOK
+	}
+	return enc.Matcher.Match(statusCode, rw.Header())
+}
+
 // init should be called before we write a response, if rw.buf has contents.
 func (rw *responseWriter) init() {
-	if rw.Header().Get("Content-Encoding") == "" && rw.buf.Len() >= rw.config.MinLength {
+	// a streamed response has no known total length, so the
+	// minimum length requirement is waived for it
+	if rw.Header().Get("Content-Encoding") == "" &&
+		(rw.buf.Len() >= rw.config.MinLength || rw.streamed) &&
+		rw.config.Match(rw) {
 		rw.w = rw.config.writerPools[rw.encodingName].Get().(Encoder)
 		rw.w.Reset(rw.ResponseWriter)
 		rw.Header().Del("Content-Length") // https://github.com/golang/go/issues/14975
@@ -251,11 +383,13 @@ func (rw *responseWriter) init() {
 }
 
 // acceptedEncodings returns the list of encodings that the
-// client supports, in descending order of preference. If
+// client supports, in descending order of preference.
+// The client preference via q-factor and the server
+// preference via preferredOrder are taken into account. If
 // the Sec-WebSocket-Key header is present then non-identity
 // encodings are not considered. See
 // http://www.w3.org/Protocols/rfc2616/rfc2616-sec14.html.
-func acceptedEncodings(r *http.Request) []string {
+func acceptedEncodings(r *http.Request, preferredOrder []string) []string {
 	acceptEncHeader := r.Header.Get("Accept-Encoding")
 	websocketKey := r.Header.Get("Sec-WebSocket-Key")
 	if acceptEncHeader == "" {
@@ -292,18 +426,30 @@ func acceptedEncodings(r *http.Request) []string {
 			continue
 		}
 
+		// set server preference
+		prefOrder := -1
+		for i, p := range preferredOrder {
+			if encName == p {
+				prefOrder = len(preferredOrder) - i
+				break
+			}
+		}
+
 		prefs = append(prefs, encodingPreference{
-			encoding: encName,
-			q:        qFactor,
+			encoding:  encName,
+			q:         qFactor,
+			preferred: prefOrder,
 		})
 	}
 
-	// sort preferences by descending q-factor
-	sort.Slice(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
-
-	// TODO: If no preference, or same pref for all encodings,
-	// and not websocket, use default encoding ordering (enc.Prefer)
-	// for those which are accepted by the client
+	// sort preferences by descending q-factor first, then by
+	// server preference (configured order) to break ties
+	sort.SliceStable(prefs, func(i, j int) bool {
+		if prefs[i].q == prefs[j].q {
+			return prefs[i].preferred > prefs[j].preferred
+		}
+		return prefs[i].q > prefs[j].q
+	})
 
 	prefEncNames := make([]string, len(prefs))
 	for i := range prefs {
@@ -313,10 +459,12 @@ func acceptedEncodings(r *http.Request) []string {
 	return prefEncNames
 }
 
-// encodingPreference pairs an encoding with its q-factor.
+// encodingPreference pairs an encoding with its q-factor
+// and the server's own preference for it.
 type encodingPreference struct {
-	encoding string
-	q        float64
+	encoding  string
+	q         float64
+	preferred int
 }
 
 // Encoder is a type which can encode a stream of data.
@@ -325,6 +473,12 @@ type Encoder interface {
 	Reset(io.Writer)
 }
 
+// flusher is implemented by encoders which can flush any
+// partially-compressed data to their underlying writer.
+type flusher interface {
+	Flush() error
+}
+
 // Encoding is a type which can create encoders of its kind
 // and return the name used in the Accept-Encoding header.
 type Encoding interface {
@@ -344,6 +498,7 @@ const defaultMinLength = 512
 // Interface guards
 var (
 	_ caddy.Provisioner           = (*Encode)(nil)
+	_ caddy.Validator             = (*Encode)(nil)
 	_ caddyhttp.MiddlewareHandler = (*Encode)(nil)
 	_ caddyhttp.HTTPInterfaces    = (*responseWriter)(nil)
 )
@@ -1,6 +1,8 @@
 package encode
 
 import (
+	"net/http"
+	"reflect"
 	"testing"
 )
 
@@ -10,3 +12,44 @@ func BenchmarkOpenResponseWriter(b *testing.B) {
 		enc.openResponseWriter("test", nil)
 	}
 }
+
+func TestPreferOrder(t *testing.T) {
+	for i, tc := range []struct {
+		accept   string
+		prefer   []string
+		expected []string
+	}{
+		{
+			accept:   "gzip, zstd, br",
+			prefer:   nil,
+			expected: []string{"gzip", "zstd", "br"},
+		},
+		{
+			accept:   "gzip, zstd, br",
+			prefer:   []string{"zstd", "br"},
+			expected: []string{"zstd", "br", "gzip"},
+		},
+		{
+			accept:   "gzip;q=0.9, zstd, br",
+			prefer:   []string{"gzip"},
+			expected: []string{"zstd", "br", "gzip"},
+		},
+		{
+			accept:   "gzip;q=0.5, zstd;q=0.5, br;q=0.5",
+			prefer:   []string{"br", "gzip"},
+			expected: []string{"br", "gzip", "zstd"},
+		},
+		{
+			accept:   "gzip, zstd;q=0",
+			prefer:   []string{"zstd"},
+			expected: []string{"gzip"},
+		},
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tc.accept)
+		actual := acceptedEncodings(r, tc.prefer)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("Test %d: expected %v, got %v", i, tc.expected, actual)
+		}
+	}
+}
@@ -15,6 +15,9 @@
 package caddyzstd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp/encode"
@@ -26,7 +29,14 @@ func init() {
 }
 
 // Zstd can create Zstandard encoders.
-type Zstd struct{}
+type Zstd struct {
+	// The compression level. Accepted values: fastest,
+	// default, better, best. Higher levels trade speed
+	// for better compression. Default: default.
+	Level string `json:"level,omitempty"`
+
+	level zstd.EncoderLevel
+}
 
 // CaddyModule returns the Caddy module information.
 func (Zstd) CaddyModule() caddy.ModuleInfo {
@@ -38,6 +48,25 @@ func (Zstd) CaddyModule() caddy.ModuleInfo {
 
 // UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
 func (z *Zstd) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if !d.NextArg() {
+			continue
+		}
+		z.Level = d.Val()
+	}
+	return nil
+}
+
+// Provision provisions z's configuration.
+func (z *Zstd) Provision(ctx caddy.Context) error {
+	if z.Level == "" {
+		z.Level = zstd.SpeedDefault.String()
+	}
+	var ok bool
+	ok, z.level = zstd.EncoderLevelFromString(strings.ToLower(z.Level))
+	if !ok {
+		return fmt.Errorf("unrecognized compression level: %s", z.Level)
+	}
 	return nil
 }
 
@@ -45,14 +74,15 @@ func (z *Zstd) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 // used in the Accept-Encoding request headers.
 func (Zstd) AcceptEncoding() string { return "zstd" }
 
-// NewEncoder returns a new gzip writer.
+// NewEncoder returns a new Zstandard writer.
 func (z Zstd) NewEncoder() encode.Encoder {
-	writer, _ := zstd.NewWriter(nil)
+	writer, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(z.level))
 	return writer
 }
 
 // Interface guards
 var (
 	_ encode.Encoding       = (*Zstd)(nil)
+	_ caddy.Provisioner     = (*Zstd)(nil)
 	_ caddyfile.Unmarshaler = (*Zstd)(nil)
 )
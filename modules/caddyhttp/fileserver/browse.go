@@ -33,6 +33,11 @@ type Browse struct {
 	// Use this template file instead of the default browse template.
 	TemplateFile string `json:"template_file,omitempty"`
 
+	// If true, dotfiles (files and folders whose names begin
+	// with a dot) are omitted from listings. They can still be
+	// requested directly; use hide to block access entirely.
+	HideDotfiles bool `json:"hide_dotfiles,omitempty"`
+
 	template *template.Template
 }
 
@@ -73,10 +78,19 @@ func (fsrv *FileServer) serveBrowse(root, dirPath string, w http.ResponseWriter,
 
 	fsrv.browseApplyQueryParams(w, r, &listing)
 
-	// write response as either JSON or HTML
+	// write response as either JSON or HTML; the format query
+	// parameter overrides content negotiation so the JSON index
+	// is easy to request from scripts
 	var buf *bytes.Buffer
 	acceptHeader := strings.ToLower(strings.Join(r.Header["Accept"], ","))
-	if strings.Contains(acceptHeader, "application/json") {
+	wantsJSON := strings.Contains(acceptHeader, "application/json")
+	switch r.URL.Query().Get("format") {
+	case "json":
+		wantsJSON = true
+	case "html":
+		wantsJSON = false
+	}
+	if wantsJSON {
 		if buf, err = fsrv.browseWriteJSON(listing); err != nil {
 			return caddyhttp.Error(http.StatusInternalServerError, err)
 		}
@@ -93,7 +107,7 @@ func (fsrv *FileServer) serveBrowse(root, dirPath string, w http.ResponseWriter,
 	return nil
 }
 
-func (fsrv *FileServer) loadDirectoryContents(dir *os.File, root, urlPath string, repl *caddy.Replacer) (browseListing, error) {
+func (fsrv *FileServer) loadDirectoryContents(dir http.File, root, urlPath string, repl *caddy.Replacer) (browseListing, error) {
 	files, err := dir.Readdir(-1)
 	if err != nil {
 		return browseListing{}, err
@@ -113,6 +127,11 @@ func (fsrv *FileServer) browseApplyQueryParams(w http.ResponseWriter, r *http.Re
 	orderParam := r.URL.Query().Get("order")
 	limitParam := r.URL.Query().Get("limit")
 	offsetParam := r.URL.Query().Get("offset")
+	filterParam := r.URL.Query().Get("filter")
+
+	// narrow the listing before sorting and limiting so that
+	// limit/offset apply to the filtered results
+	listing.applyFilter(filterParam)
 
 	// first figure out what to sort by
 	switch sortParam {
@@ -39,6 +39,9 @@ func (fsrv *FileServer) directoryListing(files []os.FileInfo, canGoUp bool, root
 		if fileHidden(name, filesToHide) {
 			continue
 		}
+		if fsrv.Browse.HideDotfiles && strings.HasPrefix(name, ".") {
+			continue
+		}
 
 		isDir := f.IsDir() || isSymlinkTargetDir(f, root, urlPath)
 
@@ -102,6 +105,35 @@ type browseListing struct {
 
 	// Sorting order
 	Order string `json:"order,omitempty"`
+
+	// Filter applied to the item names, if any
+	Filter string `json:"filter,omitempty"`
+}
+
+// applyFilter narrows the listing to items whose name contains
+// filter, comparing case-insensitively. Counts are updated to
+// reflect the narrowed listing.
+func (l *browseListing) applyFilter(filter string) {
+	if filter == "" {
+		return
+	}
+	l.Filter = filter
+	filter = strings.ToLower(filter)
+
+	kept := l.Items[:0]
+	l.NumDirs, l.NumFiles = 0, 0
+	for _, item := range l.Items {
+		if !strings.Contains(strings.ToLower(item.Name), filter) {
+			continue
+		}
+		kept = append(kept, item)
+		if item.IsDir {
+			l.NumDirs++
+		} else {
+			l.NumFiles++
+		}
+	}
+	l.Items = kept
 }
 
 // Breadcrumbs returns l.Path where every element maps
@@ -0,0 +1,177 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileserver
+
+import (
+	"bytes"
+	"container/list"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// FileCache caches stat results and the full contents of small,
+// hot files in memory so that high-QPS static serving does not
+// repeat open and stat syscalls for every request. Entries are
+// evicted when they expire or when the total size cap is reached
+// (least recently used first). Because entries are trusted for
+// their whole TTL, changes to a cached file on disk may not be
+// visible until its entry expires.
+type FileCache struct {
+	// The largest file that may be cached in memory.
+	// Default: 512 KiB.
+	MaxFileSize int64 `json:"max_file_size,omitempty"`
+
+	// The cap on the total bytes of file contents held in
+	// memory at once. Default: 64 MiB.
+	MaxTotalSize int64 `json:"max_total_size,omitempty"`
+
+	// How long an entry may be served from memory before it
+	// is revalidated against the file system. Default: 1m.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	mu        sync.Mutex
+	entries   map[string]*fileCacheEntry
+	lru       *list.List // of filenames; front is most recent
+	totalSize int64
+}
+
+// fileCacheEntry is a cached file: its contents, its stat
+// result, and when it must be revalidated.
+type fileCacheEntry struct {
+	content []byte
+	info    os.FileInfo
+	expires time.Time
+	elem    *list.Element
+}
+
+const (
+	defaultCacheMaxFileSize  = 512 << 10
+	defaultCacheMaxTotalSize = 64 << 20
+	defaultCacheTTL          = caddy.Duration(time.Minute)
+)
+
+// provision applies default limits and initializes state.
+func (c *FileCache) provision() {
+	if c.MaxFileSize == 0 {
+		c.MaxFileSize = defaultCacheMaxFileSize
+	}
+	if c.MaxTotalSize == 0 {
+		c.MaxTotalSize = defaultCacheMaxTotalSize
+	}
+	if c.TTL == 0 {
+		c.TTL = defaultCacheTTL
+	}
+	c.entries = make(map[string]*fileCacheEntry)
+	c.lru = list.New()
+}
+
+// stat returns the cached stat result for filename, if fresh.
+func (c *FileCache) stat(filename string) (os.FileInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.fresh(filename)
+	if !ok {
+		return nil, false
+	}
+	return entry.info, true
+}
+
+// get returns an open file served from memory, if fresh.
+func (c *FileCache) get(filename string) (http.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.fresh(filename)
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(entry.elem)
+	return &memFile{bytes.NewReader(entry.content), entry.info}, true
+}
+
+// put reads file into the cache if it is eligible and returns a
+// file served from memory; otherwise it returns file unchanged.
+// The original file is closed when its contents were consumed.
+func (c *FileCache) put(filename string, info os.FileInfo, file http.File) (http.File, error) {
+	if info.Size() > c.MaxFileSize || info.Size() > c.MaxTotalSize {
+		return file, nil
+	}
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		// the file position is unknown now, so do not serve from it
+		file.Close()
+		return nil, err
+	}
+	file.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.entries[filename]; ok {
+		c.evict(filename, existing)
+	}
+	for c.totalSize+int64(len(content)) > c.MaxTotalSize && c.lru.Len() > 0 {
+		oldest := c.lru.Back()
+		oldestName := oldest.Value.(string)
+		c.evict(oldestName, c.entries[oldestName])
+	}
+
+	entry := &fileCacheEntry{
+		content: content,
+		info:    info,
+		expires: time.Now().Add(time.Duration(c.TTL)),
+	}
+	entry.elem = c.lru.PushFront(filename)
+	c.entries[filename] = entry
+	c.totalSize += int64(len(content))
+
+	return &memFile{bytes.NewReader(content), info}, nil
+}
+
+// fresh returns the entry for filename if it has not expired,
+// evicting it if it has. The caller must hold c.mu.
+func (c *FileCache) fresh(filename string) (*fileCacheEntry, bool) {
+	entry, ok := c.entries[filename]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		c.evict(filename, entry)
+		return nil, false
+	}
+	return entry, true
+}
+
+// evict removes the entry for filename. The caller must hold c.mu.
+func (c *FileCache) evict(filename string, entry *fileCacheEntry) {
+	c.lru.Remove(entry.elem)
+	delete(c.entries, filename)
+	c.totalSize -= int64(len(entry.content))
+}
+
+// memFile is an open file whose contents are held in memory.
+type memFile struct {
+	*bytes.Reader
+	info os.FileInfo
+}
+
+func (f *memFile) Close() error                             { return nil }
+func (f *memFile) Stat() (os.FileInfo, error)               { return f.info, nil }
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
@@ -16,6 +16,7 @@ package fileserver
 
 import (
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/caddyserver/caddy/v2"
@@ -34,9 +35,12 @@ func init() {
 //
 //    file_server [<matcher>] [browse] {
 //        root   <path>
+//        roots  <paths...>
 //	      hide   <files...>
 //	      index  <files...>
 //	      browse [<template_file>]
+//        canonical_uris [<status_code>|rewrite]
+//        hide_extensions <extensions...>
 //    }
 //
 func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
@@ -71,12 +75,73 @@ func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error)
 				if !h.Args(&fsrv.Root) {
 					return nil, h.ArgErr()
 				}
+			case "roots":
+				fsrv.Roots = h.RemainingArgs()
+				if len(fsrv.Roots) == 0 {
+					return nil, h.ArgErr()
+				}
 			case "browse":
 				if fsrv.Browse != nil {
 					return nil, h.Err("browsing is already configured")
 				}
 				fsrv.Browse = new(Browse)
-				h.Args(&fsrv.Browse.TemplateFile)
+				for _, arg := range h.RemainingArgs() {
+					if arg == "hide_dotfiles" {
+						fsrv.Browse.HideDotfiles = true
+						continue
+					}
+					if fsrv.Browse.TemplateFile != "" {
+						return nil, h.ArgErr()
+					}
+					fsrv.Browse.TemplateFile = arg
+				}
+			case "canonical_uris":
+				for _, arg := range h.RemainingArgs() {
+					if arg == "rewrite" {
+						fsrv.CanonicalRewrite = true
+						continue
+					}
+					statusCode, err := strconv.Atoi(arg)
+					if err != nil {
+						return nil, h.Errf("canonical_uris: expected 'rewrite' or a status code; got '%s'", arg)
+					}
+					fsrv.CanonicalStatusCode = statusCode
+				}
+			case "cache":
+				if fsrv.Cache != nil {
+					return nil, h.Err("caching is already configured")
+				}
+				fsrv.Cache = new(FileCache)
+				if h.NextArg() {
+					ttl, err := caddy.ParseDuration(h.Val())
+					if err != nil {
+						return nil, h.Errf("parsing cache TTL: %v", err)
+					}
+					fsrv.Cache.TTL = caddy.Duration(ttl)
+				}
+			case "hide_extensions":
+				fsrv.CanonicalExtensions = h.RemainingArgs()
+				if len(fsrv.CanonicalExtensions) == 0 {
+					return nil, h.ArgErr()
+				}
+			case "mime":
+				args := h.RemainingArgs()
+				if len(args) != 2 {
+					return nil, h.ArgErr()
+				}
+				if fsrv.MIMETypes == nil {
+					fsrv.MIMETypes = make(map[string]string)
+				}
+				fsrv.MIMETypes[args[0]] = args[1]
+			case "symlinks":
+				if !h.Args(&fsrv.SymlinkPolicy) {
+					return nil, h.ArgErr()
+				}
+			case "content_hash_etags":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				fsrv.ContentHashETags = true
 			default:
 				return nil, h.Errf("unknown subdirective '%s'", h.Val())
 			}
@@ -143,8 +208,10 @@ func parseTryFiles(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error)
 		handler := rewrite.Rewrite{
 			URI: "{http.matchers.file.relative}" + userQueryString,
 		}
-		matcherSet := caddy.ModuleMap{
-			"file": h.JSON(MatchFile{TryFiles: try}),
+		matcherSet := []caddy.ModuleMap{
+			{
+				"file": h.JSON(MatchFile{TryFiles: try}),
+			},
 		}
 		return h.NewRoute(matcherSet, handler)
 	}
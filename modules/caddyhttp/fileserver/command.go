@@ -15,16 +15,20 @@
 package fileserver
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
 	caddycmd "github.com/caddyserver/caddy/v2/cmd"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/caddyauth"
 	caddytpl "github.com/caddyserver/caddy/v2/modules/caddyhttp/templates"
 	"github.com/caddyserver/certmagic"
 )
@@ -33,7 +37,7 @@ func init() {
 	caddycmd.RegisterCommand(caddycmd.Command{
 		Name:  "file-server",
 		Func:  cmdFileServer,
-		Usage: "[--domain <example.com>] [--root <path>] [--listen <addr>] [--browse] [--access-log]",
+		Usage: "[--domain <example.com>] [--root <path>] [--listen <addr>] [--browse] [--access-log] [--basic-auth <user:pass>] [--precompressed] [--no-dotfiles]",
 		Short: "Spins up a production-ready file server",
 		Long: `
 A simple but production-ready file server. Useful for quick deployments,
@@ -47,15 +51,30 @@ a public domain, ensure A/AAAA records are properly configured before
 using this option.
 
 If --browse is enabled, requests for folders without an index file will
-respond with a file listing.`,
+respond with a file listing; --browse-template customizes the listing
+with your own template file (and implies --browse).
+
+If --basic-auth is set to a user:pass pair, all requests must carry
+matching HTTP basic authentication credentials.
+
+If --precompressed is enabled, files that have a compressed sidecar
+(.gz, .br, or .zst) are served in compressed form to clients that
+accept the encoding.
+
+If --no-dotfiles is enabled, files and folders whose names start with
+a dot are hidden as if they did not exist.`,
 		Flags: func() *flag.FlagSet {
 			fs := flag.NewFlagSet("file-server", flag.ExitOnError)
 			fs.String("domain", "", "Domain name at which to serve the files")
 			fs.String("root", "", "The path to the root of the site")
 			fs.String("listen", "", "The address to which to bind the listener")
 			fs.Bool("browse", false, "Enable directory browsing")
+			fs.String("browse-template", "", "Custom template file for the browse listing")
 			fs.Bool("templates", false, "Enable template rendering")
 			fs.Bool("access-log", false, "Enable the access log")
+			fs.String("basic-auth", "", "Require HTTP basic authentication with this user:pass pair")
+			fs.Bool("precompressed", false, "Serve precompressed sidecar files (.gz, .br, .zst)")
+			fs.Bool("no-dotfiles", false, "Hide files and folders with names that start with a dot")
 			return fs
 		}(),
 	})
@@ -68,19 +87,51 @@ func cmdFileServer(fs caddycmd.Flags) (int, error) {
 	root := fs.String("root")
 	listen := fs.String("listen")
 	browse := fs.Bool("browse")
+	browseTemplate := fs.String("browse-template")
 	templates := fs.Bool("templates")
 	accessLog := fs.Bool("access-log")
+	basicAuth := fs.String("basic-auth")
+	precompressed := fs.Bool("precompressed")
+	noDotfiles := fs.Bool("no-dotfiles")
 
 	var handlers []json.RawMessage
 
+	if basicAuth != "" {
+		parts := strings.SplitN(basicAuth, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("--basic-auth requires a user:pass pair")
+		}
+		hashed, err := caddyauth.BcryptHash{}.Hash([]byte(parts[1]), nil)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("hashing password: %v", err)
+		}
+		authHandler := caddyauth.Authentication{
+			ProvidersRaw: caddy.ModuleMap{
+				"http_basic": caddyconfig.JSON(caddyauth.HTTPBasicAuth{
+					AccountList: []caddyauth.Account{{
+						Username: parts[0],
+						Password: base64.StdEncoding.EncodeToString(hashed),
+					}},
+				}, nil),
+			},
+		}
+		handlers = append(handlers, caddyconfig.JSONModuleObject(authHandler, "handler", "authentication", nil))
+	}
+
 	if templates {
 		handler := caddytpl.Templates{FileRoot: root}
 		handlers = append(handlers, caddyconfig.JSONModuleObject(handler, "handler", "templates", nil))
 	}
 
 	handler := FileServer{Root: root}
-	if browse {
-		handler.Browse = new(Browse)
+	if browse || browseTemplate != "" {
+		handler.Browse = &Browse{TemplateFile: browseTemplate}
+	}
+	if precompressed {
+		handler.Precompressed = []string{"br", "zstd", "gzip"}
+	}
+	if noDotfiles {
+		handler.Hide = []string{".*"}
 	}
 
 	handlers = append(handlers, caddyconfig.JSONModuleObject(handler, "handler", "file_server", nil))
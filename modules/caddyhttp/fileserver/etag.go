@@ -0,0 +1,129 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// sidecarSuffix is appended to a file's name to locate a
+// precomputed checksum for it, in the format produced by
+// sha256sum: a hex digest optionally followed by a name.
+const sidecarSuffix = ".sha256"
+
+// etagCacheEntry remembers the content hash for one version
+// of a file, identified by its size and modification time.
+type etagCacheEntry struct {
+	size    int64
+	modTime int64
+	etag    string
+}
+
+// contentHashEtag returns a strong ETag derived from the SHA-256
+// hash of the file's contents. A precomputed digest is read from
+// a ".sha256" sidecar file if one exists; otherwise the file is
+// hashed, and the result is remembered until the file's size or
+// modification time changes.
+func (fsrv *FileServer) contentHashEtag(filename string, info os.FileInfo) (string, error) {
+	if cached, ok := fsrv.etags.Load(filename); ok {
+		entry := cached.(etagCacheEntry)
+		if entry.size == info.Size() && entry.modTime == info.ModTime().UnixNano() {
+			return entry.etag, nil
+		}
+	}
+
+	etag, err := fsrv.lookupSidecarEtag(filename)
+	if err != nil {
+		return "", err
+	}
+	if etag == "" {
+		etag, err = fsrv.hashFileEtag(filename)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	fsrv.etags.Store(filename, etagCacheEntry{
+		size:    info.Size(),
+		modTime: info.ModTime().UnixNano(),
+		etag:    etag,
+	})
+
+	return etag, nil
+}
+
+// lookupSidecarEtag reads the precomputed digest for filename
+// from its sidecar file, returning "" if there is no sidecar.
+func (fsrv *FileServer) lookupSidecarEtag(filename string) (string, error) {
+	var contents []byte
+	var err error
+	if fsrv.fileSystem != nil {
+		file, openErr := fsrv.fileSystem.Open(filename + sidecarSuffix)
+		if openErr != nil {
+			if os.IsNotExist(openErr) {
+				return "", nil
+			}
+			return "", openErr
+		}
+		defer file.Close()
+		contents, err = ioutil.ReadAll(file)
+	} else {
+		contents, err = ioutil.ReadFile(filename + sidecarSuffix)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	digest := strings.Fields(string(contents))
+	if len(digest) == 0 {
+		return "", fmt.Errorf("empty checksum sidecar: %s%s", filename, sidecarSuffix)
+	}
+	if _, err := hex.DecodeString(digest[0]); err != nil || len(digest[0]) != sha256.Size*2 {
+		return "", fmt.Errorf("malformed checksum sidecar: %s%s", filename, sidecarSuffix)
+	}
+
+	return `"` + digest[0] + `"`, nil
+}
+
+// hashFileEtag hashes the contents of filename.
+func (fsrv *FileServer) hashFileEtag(filename string) (string, error) {
+	var file io.ReadCloser
+	var err error
+	if fsrv.fileSystem != nil {
+		file, err = fsrv.fileSystem.Open(filename)
+	} else {
+		file, err = os.Open(filename)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
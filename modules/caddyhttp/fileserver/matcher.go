@@ -20,7 +20,6 @@ import (
 	"os"
 	"path"
 	"strings"
-	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
@@ -215,61 +214,67 @@ func (m MatchFile) selectFile(r *http.Request) (matched bool) {
 		}
 
 	case tryPolicyLargestSize:
-		var largestSize int64
 		var largestFilename string
 		var largestSuffix string
 		var remainder string
-		var info os.FileInfo
+		var largestInfo os.FileInfo
 		for _, f := range m.TryFiles {
 			suffix, fullpath, splitRemainder := prepareFilePath(f)
 			info, err := os.Stat(fullpath)
-			if err == nil && info.Size() > largestSize {
-				largestSize = info.Size()
+			if err == nil && (largestInfo == nil || info.Size() > largestInfo.Size()) {
 				largestFilename = fullpath
 				largestSuffix = suffix
+				largestInfo = info
 				remainder = splitRemainder
 			}
 		}
-		setPlaceholders(info, largestSuffix, largestFilename, remainder)
+		if largestInfo == nil {
+			return false
+		}
+		setPlaceholders(largestInfo, largestSuffix, largestFilename, remainder)
 		return true
 
 	case tryPolicySmallestSize:
-		var smallestSize int64
 		var smallestFilename string
 		var smallestSuffix string
 		var remainder string
-		var info os.FileInfo
+		var smallestInfo os.FileInfo
 		for _, f := range m.TryFiles {
 			suffix, fullpath, splitRemainder := prepareFilePath(f)
 			info, err := os.Stat(fullpath)
-			if err == nil && (smallestSize == 0 || info.Size() < smallestSize) {
-				smallestSize = info.Size()
+			if err == nil && (smallestInfo == nil || info.Size() < smallestInfo.Size()) {
 				smallestFilename = fullpath
 				smallestSuffix = suffix
+				smallestInfo = info
 				remainder = splitRemainder
 			}
 		}
-		setPlaceholders(info, smallestSuffix, smallestFilename, remainder)
+		if smallestInfo == nil {
+			return false
+		}
+		setPlaceholders(smallestInfo, smallestSuffix, smallestFilename, remainder)
 		return true
 
 	case tryPolicyMostRecentlyMod:
-		var recentDate time.Time
 		var recentFilename string
 		var recentSuffix string
 		var remainder string
-		var info os.FileInfo
+		var recentInfo os.FileInfo
 		for _, f := range m.TryFiles {
 			suffix, fullpath, splitRemainder := prepareFilePath(f)
 			info, err := os.Stat(fullpath)
 			if err == nil &&
-				(recentDate.IsZero() || info.ModTime().After(recentDate)) {
-				recentDate = info.ModTime()
+				(recentInfo == nil || info.ModTime().After(recentInfo.ModTime())) {
 				recentFilename = fullpath
 				recentSuffix = suffix
+				recentInfo = info
 				remainder = splitRemainder
 			}
 		}
-		setPlaceholders(info, recentSuffix, recentFilename, remainder)
+		if recentInfo == nil {
+			return false
+		}
+		setPlaceholders(recentInfo, recentSuffix, recentFilename, remainder)
 		return true
 	}
 
@@ -15,9 +15,13 @@
 package fileserver
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
@@ -204,6 +208,72 @@ func TestPHPFileMatcher(t *testing.T) {
 	}
 }
 
+func TestTryPolicies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "try_policy")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// create files with distinct sizes and modification times
+	for _, f := range []struct {
+		name string
+		size int
+	}{
+		{"small.txt", 1},
+		{"large.txt", 100},
+		{"recent.txt", 10},
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, f.name), make([]byte, f.size), 0600)
+		if err != nil {
+			t.Fatalf("writing %s: %v", f.name, err)
+		}
+	}
+	err = os.Chtimes(filepath.Join(dir, "recent.txt"),
+		time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("setting modification time: %v", err)
+	}
+
+	tryFiles := []string{"/small.txt", "/large.txt", "/recent.txt", "/missing.txt"}
+
+	for i, tc := range []struct {
+		policy   string
+		tryFiles []string
+		expect   string
+		matched  bool
+	}{
+		{policy: tryPolicyLargestSize, tryFiles: tryFiles, expect: "/large.txt", matched: true},
+		{policy: tryPolicySmallestSize, tryFiles: tryFiles, expect: "/small.txt", matched: true},
+		{policy: tryPolicyMostRecentlyMod, tryFiles: tryFiles, expect: "/recent.txt", matched: true},
+		{policy: tryPolicyLargestSize, tryFiles: []string{"/missing.txt"}, matched: false},
+		{policy: tryPolicySmallestSize, tryFiles: []string{"/missing.txt"}, matched: false},
+		{policy: tryPolicyMostRecentlyMod, tryFiles: []string{"/missing.txt"}, matched: false},
+	} {
+		m := &MatchFile{
+			Root:      dir,
+			TryFiles:  tc.tryFiles,
+			TryPolicy: tc.policy,
+		}
+
+		req := &http.Request{URL: &url.URL{Path: "/"}}
+		repl := caddyhttp.NewTestReplacer(req)
+
+		result := m.Match(req)
+		if result != tc.matched {
+			t.Fatalf("Test %d: expected match=%t, got %t", i, tc.matched, result)
+		}
+		if !result {
+			continue
+		}
+
+		rel, _ := repl.Get("http.matchers.file.relative")
+		if rel != tc.expect {
+			t.Errorf("Test %d: expected %s to be selected, got %v", i, tc.expect, rel)
+		}
+	}
+}
+
 func TestFirstSplit(t *testing.T) {
 	m := MatchFile{SplitPath: []string{".php"}}
 	actual, remainder := m.firstSplit("index.PHP/somewhere")
@@ -16,6 +16,7 @@ package fileserver
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
@@ -23,6 +24,7 @@ import (
 	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -43,9 +45,22 @@ func init() {
 // FileServer implements a static file server responder for Caddy.
 type FileServer struct {
 	// The path to the root of the site. Default is `{http.vars.root}` if set,
-	// or current working directory otherwise.
+	// or current working directory otherwise. Not used if a virtual file
+	// system is configured, since those are rooted at their backend.
 	Root string `json:"root,omitempty"`
 
+	// An ordered list of site roots to search: the first root that
+	// contains the requested file serves it, and the last root is
+	// used as the fallback for misses. This enables overlay layouts
+	// such as local overrides in front of shared assets. Mutually
+	// exclusive with root and with a virtual file system.
+	Roots []string `json:"roots,omitempty"`
+
+	// Optionally serve from a virtual file system (a module from the
+	// caddy.fs namespace) instead of the OS file system, for example
+	// a zip archive or a read-only overlay of multiple directories.
+	FileSystemRaw json.RawMessage `json:"file_system,omitempty" caddy:"namespace=caddy.fs inline_key=backend"`
+
 	// A list of files or folders to hide; the file server will pretend as if
 	// they don't exist. Accepts globular patterns like "*.ext" or "/foo/*/bar"
 	// as well as placeholders. Because site roots can be dynamic, this list
@@ -66,20 +81,74 @@ type FileServer struct {
 	// The names of files to try as index files if a folder is requested.
 	IndexNames []string `json:"index_names,omitempty"`
 
+	// Maps file extensions (with the leading dot) to Content-Type
+	// values, taking precedence over the OS mime database. The
+	// special key "*" sets the Content-Type for extensions that are
+	// not otherwise known.
+	MIMETypes map[string]string `json:"mime_types,omitempty"`
+
 	// Enables file listings if a directory was requested and no index
 	// file is present.
 	Browse *Browse `json:"browse,omitempty"`
 
+	// An optional in-memory cache of stat results and the contents
+	// of small, hot files. See the FileCache docs for limits and
+	// staleness caveats.
+	Cache *FileCache `json:"cache,omitempty"`
+
 	// Use redirects to enforce trailing slashes for directories, or to
 	// remove trailing slash from URIs for files. Default is true.
 	CanonicalURIs *bool `json:"canonical_uris,omitempty"`
 
+	// The status code to use for canonical redirects.
+	// Default: 308 Permanent Redirect.
+	CanonicalStatusCode int `json:"canonical_status_code,omitempty"`
+
+	// If true, canonical URIs are enforced by rewriting the request
+	// URI internally instead of issuing an external redirect.
+	CanonicalRewrite bool `json:"canonical_rewrite,omitempty"`
+
+	// If set, canonicalization also hides these file extensions:
+	// a request for an extensionless path is served from the first
+	// existing file with one of these extensions appended, and a
+	// request naming such a file explicitly is redirected (or
+	// rewritten) to the extensionless path. Include the leading
+	// dot, e.g. ".html".
+	CanonicalExtensions []string `json:"canonical_extensions,omitempty"`
+
 	// If pass-thru mode is enabled and a requested file is not found,
 	// it will invoke the next handler in the chain instead of returning
 	// a 404 error. By default, this is false (disabled).
 	PassThru bool `json:"pass_thru,omitempty"`
 
-	logger *zap.Logger
+	// How to handle symbolic links: "follow" (the default) follows
+	// all symlinks; "within_root" follows only symlinks whose
+	// targets remain within the site root; "refuse" does not follow
+	// symlinks at all. Refused requests get 403 Forbidden and are
+	// logged. Only applies when serving from the OS file system.
+	SymlinkPolicy string `json:"symlink_policy,omitempty"`
+
+	// If true, ETags are derived from a SHA-256 hash of the file
+	// contents instead of the modification time and size, so they
+	// stay correct even when files are copied around with their
+	// sizes preserved. A precomputed digest is read from a
+	// ".sha256" sidecar file if one exists, which avoids hashing
+	// large files; computed hashes are remembered until the file
+	// changes.
+	ContentHashETags bool `json:"content_hash_etags,omitempty"`
+
+	// A list of encodings, in order of preference, for which to
+	// check for precompressed sidecar files: if the client accepts
+	// one of the encodings and a file with the corresponding
+	// extension appended exists (e.g. "index.html.gz"), it is
+	// served with that Content-Encoding instead of the original.
+	// Supported encodings are "gzip" (.gz), "br" (.br), and
+	// "zstd" (.zst).
+	Precompressed []string `json:"precompressed,omitempty"`
+
+	fileSystem http.FileSystem
+	etags      *sync.Map
+	logger     *zap.Logger
 }
 
 // CaddyModule returns the Caddy module information.
@@ -94,6 +163,23 @@ func (FileServer) CaddyModule() caddy.ModuleInfo {
 func (fsrv *FileServer) Provision(ctx caddy.Context) error {
 	fsrv.logger = ctx.Logger(fsrv)
 
+	if fsrv.FileSystemRaw != nil {
+		mod, err := ctx.LoadModule(fsrv, "FileSystemRaw")
+		if err != nil {
+			return fmt.Errorf("loading file system backend: %v", err)
+		}
+		fsrv.fileSystem = mod.(http.FileSystem)
+	}
+
+	if len(fsrv.Roots) > 0 {
+		if fsrv.Root != "" {
+			return fmt.Errorf("root and roots are mutually exclusive")
+		}
+		if fsrv.fileSystem != nil {
+			return fmt.Errorf("roots cannot be used with a virtual file system")
+		}
+	}
+
 	if fsrv.Root == "" {
 		fsrv.Root = "{http.vars.root}"
 	}
@@ -102,6 +188,20 @@ func (fsrv *FileServer) Provision(ctx caddy.Context) error {
 		fsrv.IndexNames = defaultIndexNames
 	}
 
+	if fsrv.Cache != nil {
+		fsrv.Cache.provision()
+	}
+
+	if fsrv.ContentHashETags {
+		fsrv.etags = new(sync.Map)
+	}
+
+	switch fsrv.SymlinkPolicy {
+	case "", symlinkPolicyFollow, symlinkPolicyWithinRoot, symlinkPolicyRefuse:
+	default:
+		return fmt.Errorf("unrecognized symlink policy: %s", fsrv.SymlinkPolicy)
+	}
+
 	if fsrv.Browse != nil {
 		var tpl *template.Template
 		var err error
@@ -119,6 +219,22 @@ func (fsrv *FileServer) Provision(ctx caddy.Context) error {
 		fsrv.Browse.template = tpl
 	}
 
+	if fsrv.CanonicalStatusCode != 0 &&
+		(fsrv.CanonicalStatusCode < 300 || fsrv.CanonicalStatusCode > 399) {
+		return fmt.Errorf("canonical status code must be a redirect (3xx) status: %d", fsrv.CanonicalStatusCode)
+	}
+	for _, encoding := range fsrv.Precompressed {
+		if _, ok := precompressedExts[encoding]; !ok {
+			return fmt.Errorf("unrecognized precompressed encoding: %s", encoding)
+		}
+	}
+
+	for _, ext := range fsrv.CanonicalExtensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("canonical extension must include the leading dot: %s", ext)
+		}
+	}
+
 	// for hide paths that are static (i.e. no placeholders), we can transform them into
 	// absolute paths before the server starts for very slight performance improvement
 	for i, h := range fsrv.Hide {
@@ -140,6 +256,24 @@ func (fsrv *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request, next c
 	root := repl.ReplaceAll(fsrv.Root, ".")
 	suffix := repl.ReplaceAll(r.URL.Path, "")
 	filename := sanitizedPathJoin(root, suffix)
+	if len(fsrv.Roots) > 0 {
+		// search the ordered list of roots and serve from the first
+		// one that has the requested path; the last root is used as
+		// the fallback either way, so misses get consistent errors
+		for i, eachRoot := range fsrv.Roots {
+			candidateRoot := repl.ReplaceAll(eachRoot, ".")
+			candidate := sanitizedPathJoin(candidateRoot, suffix)
+			if _, err := os.Stat(candidate); err == nil || i == len(fsrv.Roots)-1 {
+				root, filename = candidateRoot, candidate
+				break
+			}
+		}
+	}
+	if fsrv.fileSystem != nil {
+		// virtual file systems are rooted at their backend, so the
+		// site root does not apply; they use slash-separated paths
+		filename = path.Clean("/" + suffix)
+	}
 
 	fsrv.logger.Debug("sanitized path join",
 		zap.String("site_root", root),
@@ -147,11 +281,28 @@ func (fsrv *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request, next c
 		zap.String("result", filename))
 
 	// get information about the file
-	info, err := os.Stat(filename)
+	info, err := fsrv.stat(filename)
 	if err != nil {
 		err = mapDirOpenError(err, filename)
 		if os.IsNotExist(err) {
-			return fsrv.notFound(w, r, next)
+			// the extensionless form of a path is canonical for the
+			// configured extensions, so try the file with each of
+			// them appended before giving up
+			if !strings.HasSuffix(r.URL.Path, "/") {
+				for _, ext := range fsrv.CanonicalExtensions {
+					extInfo, extErr := fsrv.stat(filename + ext)
+					if extErr == nil && !extInfo.IsDir() &&
+						!fileHidden(filename+ext, filesToHide) {
+						info = extInfo
+						filename += ext
+						err = nil
+						break
+					}
+				}
+			}
+			if err != nil {
+				return fsrv.notFound(w, r, next)
+			}
 		} else if os.IsPermission(err) {
 			return caddyhttp.Error(http.StatusForbidden, err)
 		}
@@ -165,6 +316,9 @@ func (fsrv *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request, next c
 	if info.IsDir() && len(fsrv.IndexNames) > 0 {
 		for _, indexPage := range fsrv.IndexNames {
 			indexPath := sanitizedPathJoin(filename, indexPage)
+			if fsrv.fileSystem != nil {
+				indexPath = path.Join(filename, indexPage)
+			}
 			if fileHidden(indexPath, filesToHide) {
 				// pretend this file doesn't exist
 				fsrv.logger.Debug("hiding index file",
@@ -173,7 +327,7 @@ func (fsrv *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request, next c
 				continue
 			}
 
-			indexInfo, err := os.Stat(indexPath)
+			indexInfo, err := fsrv.stat(indexPath)
 			if err != nil {
 				continue
 			}
@@ -217,39 +371,124 @@ func (fsrv *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request, next c
 		return fsrv.notFound(w, r, next)
 	}
 
+	// enforce the symlink policy before opening anything
+	if fsrv.fileSystem == nil &&
+		(fsrv.SymlinkPolicy == symlinkPolicyWithinRoot || fsrv.SymlinkPolicy == symlinkPolicyRefuse) {
+		if err := fsrv.enforceSymlinkPolicy(root, filename); err != nil {
+			if os.IsNotExist(err) {
+				return fsrv.notFound(w, r, next)
+			}
+			return caddyhttp.Error(http.StatusForbidden, err)
+		}
+	}
+
 	// if URL canonicalization is enabled, we need to enforce trailing
 	// slash convention: if a directory, trailing slash; if a file, no
 	// trailing slash - not enforcing this can break relative hrefs
-	// in HTML (see https://github.com/caddyserver/caddy/issues/2741)
+	// in HTML (see https://github.com/caddyserver/caddy/issues/2741);
+	// similarly, configured canonical extensions are hidden from URIs
 	if fsrv.CanonicalURIs == nil || *fsrv.CanonicalURIs {
+		var canonicalPath string
 		if implicitIndexFile && !strings.HasSuffix(r.URL.Path, "/") {
-			fsrv.logger.Debug("redirecting to canonical URI (adding trailing slash for directory)", zap.String("path", r.URL.Path))
-			return redirect(w, r, r.URL.Path+"/")
+			fsrv.logger.Debug("enforcing canonical URI (adding trailing slash for directory)", zap.String("path", r.URL.Path))
+			canonicalPath = r.URL.Path + "/"
 		} else if !implicitIndexFile && strings.HasSuffix(r.URL.Path, "/") {
-			fsrv.logger.Debug("redirecting to canonical URI (removing trailing slash for file)", zap.String("path", r.URL.Path))
-			return redirect(w, r, r.URL.Path[:len(r.URL.Path)-1])
+			fsrv.logger.Debug("enforcing canonical URI (removing trailing slash for file)", zap.String("path", r.URL.Path))
+			canonicalPath = r.URL.Path[:len(r.URL.Path)-1]
+		} else if !implicitIndexFile {
+			for _, ext := range fsrv.CanonicalExtensions {
+				if !strings.HasSuffix(r.URL.Path, ext) || len(r.URL.Path) <= len(ext) {
+					continue
+				}
+				// only canonicalize if the extensionless path does not
+				// name a different, existing file, which would be served
+				// instead after the redirect
+				if _, extlessErr := fsrv.stat(strings.TrimSuffix(filename, ext)); os.IsNotExist(extlessErr) {
+					fsrv.logger.Debug("enforcing canonical URI (hiding file extension)", zap.String("path", r.URL.Path))
+					canonicalPath = strings.TrimSuffix(r.URL.Path, ext)
+				}
+				break
+			}
+		}
+		if canonicalPath != "" {
+			if fsrv.CanonicalRewrite {
+				r.URL.Path = canonicalPath
+				r.RequestURI = r.URL.RequestURI()
+			} else {
+				statusCode := fsrv.CanonicalStatusCode
+				if statusCode == 0 {
+					statusCode = http.StatusPermanentRedirect
+				}
+				return redirect(w, r, canonicalPath, statusCode)
+			}
+		}
+	}
+
+	// serve a precompressed sidecar file instead, if the client
+	// accepts one of the configured encodings and one exists
+	if len(fsrv.Precompressed) > 0 {
+		if encFilename, encoding, encInfo, ok := fsrv.findPrecompressed(r, filename, filesToHide); ok {
+			fsrv.logger.Debug("serving precompressed sidecar",
+				zap.String("filename", encFilename),
+				zap.String("encoding", encoding))
+			w.Header().Set("Content-Encoding", encoding)
+			w.Header().Add("Vary", "Accept-Encoding")
+			// the Content-Type must describe the original file,
+			// not the compressed representation of it
+			if mtyp := fsrv.contentTypeForExt(filepath.Ext(filename)); mtyp != "" {
+				w.Header().Set("Content-Type", mtyp)
+			} else {
+				w.Header()["Content-Type"] = nil
+			}
+			filename, info = encFilename, encInfo
 		}
 	}
 
 	fsrv.logger.Debug("opening file", zap.String("filename", filename))
 
-	// open the file
-	file, err := fsrv.openFile(filename, w)
-	if err != nil {
-		if herr, ok := err.(caddyhttp.HandlerError); ok &&
-			herr.StatusCode == http.StatusNotFound {
-			return fsrv.notFound(w, r, next)
+	// open the file, preferring a cached in-memory copy
+	var file http.File
+	if fsrv.Cache != nil {
+		if cached, ok := fsrv.Cache.get(filename); ok {
+			file = cached
+		}
+	}
+	if file == nil {
+		file, err = fsrv.openFile(filename, w)
+		if err != nil {
+			if herr, ok := err.(caddyhttp.HandlerError); ok &&
+				herr.StatusCode == http.StatusNotFound {
+				return fsrv.notFound(w, r, next)
+			}
+			return err // error is already structured
+		}
+		if fsrv.Cache != nil {
+			file, err = fsrv.Cache.put(filename, info, file)
+			if err != nil {
+				return caddyhttp.Error(http.StatusInternalServerError, err)
+			}
 		}
-		return err // error is already structured
 	}
 	defer file.Close()
 
 	// set the ETag - note that a conditional If-None-Match request is handled
 	// by http.ServeContent below, which checks against this ETag value
-	w.Header().Set("ETag", calculateEtag(info))
+	etag := calculateEtag(info)
+	if fsrv.ContentHashETags {
+		hashed, err := fsrv.contentHashEtag(filename, info)
+		if err != nil {
+			// fall back to the mtime/size ETag rather than failing the request
+			fsrv.logger.Error("computing content-hash ETag",
+				zap.String("filename", filename),
+				zap.Error(err))
+		} else {
+			etag = hashed
+		}
+	}
+	w.Header().Set("ETag", etag)
 
-	if w.Header().Get("Content-Type") == "" {
-		mtyp := mime.TypeByExtension(filepath.Ext(filename))
+	if _, haveType := w.Header()["Content-Type"]; !haveType {
+		mtyp := fsrv.contentTypeForExt(filepath.Ext(filename))
 		if mtyp == "" {
 			// do not allow Go to sniff the content-type; see
 			// https://www.youtube.com/watch?v=8t8JYpt0egE
@@ -287,12 +526,38 @@ func (fsrv *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request, next c
 	return nil
 }
 
+// stat returns information about the named file from the configured
+// file system backend, or from the OS file system if none is configured.
+// Stat results for cached files are served from the cache while fresh.
+func (fsrv *FileServer) stat(filename string) (os.FileInfo, error) {
+	if fsrv.Cache != nil {
+		if info, ok := fsrv.Cache.stat(filename); ok {
+			return info, nil
+		}
+	}
+	if fsrv.fileSystem == nil {
+		return os.Stat(filename)
+	}
+	file, err := fsrv.fileSystem.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
 // openFile opens the file at the given filename. If there was an error,
 // the response is configured to inform the client how to best handle it
 // and a well-described handler error is returned (do not wrap the
 // returned error value).
-func (fsrv *FileServer) openFile(filename string, w http.ResponseWriter) (*os.File, error) {
-	file, err := os.Open(filename)
+func (fsrv *FileServer) openFile(filename string, w http.ResponseWriter) (http.File, error) {
+	var file http.File
+	var err error
+	if fsrv.fileSystem != nil {
+		file, err = fsrv.fileSystem.Open(filename)
+	} else {
+		file, err = os.Open(filename)
+	}
 	if err != nil {
 		err = mapDirOpenError(err, filename)
 		if os.IsNotExist(err) {
@@ -391,6 +656,68 @@ func sanitizedPathJoin(root, reqPath string) string {
 	return path
 }
 
+// precompressedExts maps supported precompression encodings to
+// the file extension of their sidecar files.
+var precompressedExts = map[string]string{
+	"gzip": ".gz",
+	"br":   ".br",
+	"zstd": ".zst",
+}
+
+// contentTypeForExt resolves the Content-Type for a file extension
+// from the configured MIME type overrides or the OS mime database.
+func (fsrv *FileServer) contentTypeForExt(ext string) string {
+	mtyp, ok := fsrv.MIMETypes[ext]
+	if !ok {
+		mtyp = mime.TypeByExtension(ext)
+	}
+	if mtyp == "" {
+		mtyp = fsrv.MIMETypes["*"]
+	}
+	return mtyp
+}
+
+// findPrecompressed returns the first precompressed sidecar of
+// filename, in the configured order of preference, whose encoding
+// the client accepts and which exists and is not hidden.
+func (fsrv *FileServer) findPrecompressed(r *http.Request, filename string, filesToHide []string) (string, string, os.FileInfo, bool) {
+	for _, encoding := range fsrv.Precompressed {
+		if !clientAcceptsEncoding(r, encoding) {
+			continue
+		}
+		encFilename := filename + precompressedExts[encoding]
+		if fileHidden(encFilename, filesToHide) {
+			continue
+		}
+		info, err := fsrv.stat(encFilename)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		return encFilename, encoding, info, true
+	}
+	return "", "", nil, false
+}
+
+// clientAcceptsEncoding reports whether the request's
+// Accept-Encoding header lists the given encoding.
+func clientAcceptsEncoding(r *http.Request, encoding string) bool {
+	for _, val := range r.Header.Values("Accept-Encoding") {
+		for _, directive := range strings.Split(val, ",") {
+			name := strings.TrimSpace(directive)
+			if semicolon := strings.Index(name, ";"); semicolon >= 0 {
+				if qval := strings.TrimSpace(name[semicolon+1:]); qval == "q=0" || qval == "q=0.0" {
+					continue
+				}
+				name = strings.TrimSpace(name[:semicolon])
+			}
+			if name == encoding {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // fileHidden returns true if filename is hidden according to the hide list.
 // filename must be a relative or absolute file system path, not a request
 // URI path. It is expected that all the paths in the hide list are absolute
@@ -442,6 +769,48 @@ func fileHidden(filename string, hide []string) bool {
 	return false
 }
 
+// enforceSymlinkPolicy returns an error if serving the named file
+// would follow a symlink that the configured policy forbids. It
+// resolves every link in the path, so symlinked parent directories
+// are covered as well.
+func (fsrv *FileServer) enforceSymlinkPolicy(root, filename string) error {
+	evaluated, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return err
+	}
+	if evaluated == filepath.Clean(filename) {
+		// no symlinks involved
+		return nil
+	}
+
+	switch fsrv.SymlinkPolicy {
+	case symlinkPolicyRefuse:
+		fsrv.logger.Warn("refusing to follow symlink",
+			zap.String("filename", filename),
+			zap.String("target", evaluated))
+		return fmt.Errorf("%s is or traverses a symlink", filename)
+
+	case symlinkPolicyWithinRoot:
+		evaluatedRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return err
+		}
+		if evaluated != evaluatedRoot &&
+			!strings.HasPrefix(evaluated, evaluatedRoot+separator) {
+			fsrv.logger.Warn("refusing to follow symlink out of site root",
+				zap.String("filename", filename),
+				zap.String("target", evaluated),
+				zap.String("root", evaluatedRoot))
+			return fmt.Errorf("%s resolves outside the site root", filename)
+		}
+		fsrv.logger.Debug("following symlink within site root",
+			zap.String("filename", filename),
+			zap.String("target", evaluated))
+	}
+
+	return nil
+}
+
 // notFound returns a 404 error or, if pass-thru is enabled,
 // it calls the next handler in the chain.
 func (fsrv *FileServer) notFound(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
@@ -462,12 +831,12 @@ func calculateEtag(d os.FileInfo) string {
 	return `"` + t + s + `"`
 }
 
-func redirect(w http.ResponseWriter, r *http.Request, to string) error {
+func redirect(w http.ResponseWriter, r *http.Request, to string, statusCode int) error {
 	for strings.HasPrefix(to, "//") {
 		// prevent path-based open redirects
 		to = strings.TrimPrefix(to, "/")
 	}
-	http.Redirect(w, r, to, http.StatusPermanentRedirect)
+	http.Redirect(w, r, to, statusCode)
 	return nil
 }
 
@@ -482,6 +851,10 @@ var bufPool = sync.Pool{
 const (
 	minBackoff, maxBackoff = 2, 5
 	separator              = string(filepath.Separator)
+
+	symlinkPolicyFollow     = "follow"
+	symlinkPolicyWithinRoot = "within_root"
+	symlinkPolicyRefuse     = "refuse"
 )
 
 // Interface guards
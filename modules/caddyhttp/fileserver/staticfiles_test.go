@@ -15,6 +15,7 @@
 package fileserver
 
 import (
+	"net/http"
 	"net/url"
 	"path/filepath"
 	"runtime"
@@ -212,3 +213,28 @@ func TestFileHidden(t *testing.T) {
 		}
 	}
 }
+
+func TestClientAcceptsEncoding(t *testing.T) {
+	for i, tc := range []struct {
+		acceptEncoding string
+		encoding       string
+		expect         bool
+	}{
+		{"gzip", "gzip", true},
+		{"br, gzip", "gzip", true},
+		{"br;q=1.0, gzip;q=0.8", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"br", "gzip", false},
+		{"", "gzip", false},
+		{"zstd , br", "zstd", true},
+	} {
+		r := &http.Request{Header: http.Header{}}
+		if tc.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+		}
+		if actual := clientAcceptsEncoding(r, tc.encoding); actual != tc.expect {
+			t.Errorf("Test %d: Accept-Encoding %q, encoding %q: got %t but expected %t",
+				i, tc.acceptEncoding, tc.encoding, actual, tc.expect)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(Invoke{})
+}
+
+// Invoke is a handler which executes a named route that was
+// defined on the server. Common middleware chains (for example
+// authentication, headers, and compression) can thus be defined
+// once and invoked from many routes or sites.
+type Invoke struct {
+	// The name of the route list to execute, as defined in the
+	// server's named_routes.
+	Name string `json:"name"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (Invoke) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.invoke",
+		New: func() caddy.Module { return new(Invoke) },
+	}
+}
+
+func (i Invoke) ServeHTTP(w http.ResponseWriter, r *http.Request, next Handler) error {
+	server := r.Context().Value(ServerCtxKey).(*Server)
+	routes, ok := server.NamedRoutes[i.Name]
+	if !ok {
+		return fmt.Errorf("invoking named route: no route named '%s'", i.Name)
+	}
+	return routes.Compile(next).ServeHTTP(w, r)
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler. Syntax:
+//
+//     invoke [<matcher>] <name>
+//
+func (i *Invoke) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if !d.AllArgs(&i.Name) {
+			return d.ArgErr()
+		}
+	}
+	return nil
+}
+
+// provisionNamedRoutes loads the server's named route lists so
+// they can be executed by the "invoke" handler.
+func (s *Server) provisionNamedRoutes(ctx caddy.Context) error {
+	for name, routes := range s.NamedRoutes {
+		err := routes.Provision(ctx)
+		if err != nil {
+			return fmt.Errorf("named route '%s': %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ MiddlewareHandler     = (*Invoke)(nil)
+	_ caddyfile.Unmarshaler = (*Invoke)(nil)
+)
@@ -0,0 +1,115 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(AdminIPFilter{})
+}
+
+// activeFilters tracks the currently-provisioned IP filters so
+// the admin endpoint can answer queries against live config.
+var (
+	activeFiltersMu sync.RWMutex
+	activeFilters   []*IPFilter
+)
+
+func registerFilter(f *IPFilter) {
+	activeFiltersMu.Lock()
+	activeFilters = append(activeFilters, f)
+	activeFiltersMu.Unlock()
+}
+
+func unregisterFilter(f *IPFilter) {
+	activeFiltersMu.Lock()
+	for i, other := range activeFilters {
+		if other == f {
+			activeFilters = append(activeFilters[:i], activeFilters[i+1:]...)
+			break
+		}
+	}
+	activeFiltersMu.Unlock()
+}
+
+// AdminIPFilter is a module that answers queries about whether
+// an IP address would be blocked by any of the currently-loaded
+// IP filters. It is mounted at "/ip_filter/check" on the admin
+// API; pass the address in the "ip" query parameter.
+type AdminIPFilter struct{}
+
+// CaddyModule returns the Caddy module information.
+func (AdminIPFilter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.ip_filter",
+		New: func() caddy.Module { return new(AdminIPFilter) },
+	}
+}
+
+// Routes returns a route for the /ip_filter/check endpoint.
+func (a *AdminIPFilter) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{{Pattern: "/ip_filter/check", Handler: caddy.AdminHandlerFunc(a.handleCheck)}}
+}
+
+func (a *AdminIPFilter) handleCheck(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+
+	ipStr := r.URL.Query().Get("ip")
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return caddy.APIError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("missing or invalid 'ip' query parameter"),
+		}
+	}
+
+	activeFiltersMu.RLock()
+	blocked := false
+	filters := 0
+	for _, f := range activeFilters {
+		filters++
+		if f.Blocked(ip) {
+			blocked = true
+		}
+	}
+	activeFiltersMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(struct {
+		IP      string `json:"ip"`
+		Blocked bool   `json:"blocked"`
+		Filters int    `json:"filters"`
+	}{
+		IP:      ip.String(),
+		Blocked: blocked,
+		Filters: filters,
+	})
+}
+
+// Interface guard
+var _ caddy.AdminRouter = (*AdminIPFilter)(nil)
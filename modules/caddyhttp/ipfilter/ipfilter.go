@@ -0,0 +1,351 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfilter
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/internal/lists"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(IPFilter{})
+}
+
+// IPFilter is a middleware which allows or denies requests based
+// on the client IP address. Address lists may be given inline as
+// CIDR ranges, loaded from local files (re-read when they change),
+// or fetched from remote URLs on a refresh interval. The deny list
+// is consulted first, then the allow list; addresses on neither
+// list get the configured default action.
+//
+// Denied requests are rejected with a status code, or handled by
+// a dedicated route list if one is configured (for custom error
+// pages or redirects).
+type IPFilter struct {
+	// IPs or CIDR ranges to allow.
+	Allow []string `json:"allow,omitempty"`
+
+	// IPs or CIDR ranges to deny.
+	Deny []string `json:"deny,omitempty"`
+
+	// Local files containing newline-delimited IPs or CIDR
+	// ranges to allow. Files are re-read when modified.
+	AllowFiles []string `json:"allow_files,omitempty"`
+
+	// Local files containing newline-delimited IPs or CIDR
+	// ranges to deny. Files are re-read when modified.
+	DenyFiles []string `json:"deny_files,omitempty"`
+
+	// Remote URLs serving newline-delimited IPs or CIDR ranges
+	// to allow, re-downloaded on the refresh interval.
+	AllowURLs []string `json:"allow_urls,omitempty"`
+
+	// Remote URLs serving newline-delimited IPs or CIDR ranges
+	// to deny, re-downloaded on the refresh interval.
+	DenyURLs []string `json:"deny_urls,omitempty"`
+
+	// What to do with addresses on neither list: "allow"
+	// (default) or "deny".
+	DefaultAction string `json:"default_action,omitempty"`
+
+	// How often to poll files for changes and re-download
+	// remote URLs. Default: 5m.
+	RefreshInterval caddy.Duration `json:"refresh_interval,omitempty"`
+
+	// The HTTP status code for denied requests when no deny
+	// routes are configured. Default: 403.
+	StatusCode caddyhttp.WeakString `json:"status_code,omitempty"`
+
+	// Routes to execute instead of returning an error when a
+	// request is denied, e.g. to serve a custom error page.
+	DenyRoutes caddyhttp.RouteList `json:"deny_routes,omitempty"`
+
+	statusCode int
+	logger     *zap.Logger
+
+	mu         *sync.RWMutex
+	allowNets  []*net.IPNet
+	denyNets   []*net.IPNet
+	fileMtimes map[string]time.Time
+
+	done chan struct{}
+}
+
+// CaddyModule returns the Caddy module information.
+func (IPFilter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.ip_filter",
+		New: func() caddy.Module { return new(IPFilter) },
+	}
+}
+
+// Provision sets up f.
+func (f *IPFilter) Provision(ctx caddy.Context) error {
+	f.logger = ctx.Logger(f)
+	f.mu = new(sync.RWMutex)
+	f.fileMtimes = make(map[string]time.Time)
+
+	switch f.DefaultAction {
+	case "":
+		f.DefaultAction = "allow"
+	case "allow", "deny":
+	default:
+		return fmt.Errorf("unrecognized default_action '%s'", f.DefaultAction)
+	}
+
+	f.statusCode = http.StatusForbidden
+	if f.StatusCode != "" {
+		f.statusCode = f.StatusCode.Int()
+	}
+	if f.RefreshInterval == 0 {
+		f.RefreshInterval = caddy.Duration(5 * time.Minute)
+	}
+
+	if f.DenyRoutes != nil {
+		err := f.DenyRoutes.Provision(ctx)
+		if err != nil {
+			return fmt.Errorf("setting up deny routes: %v", err)
+		}
+	}
+
+	err := f.reloadLists(true)
+	if err != nil {
+		return err
+	}
+
+	if len(f.AllowFiles) > 0 || len(f.DenyFiles) > 0 ||
+		len(f.AllowURLs) > 0 || len(f.DenyURLs) > 0 {
+		f.done = make(chan struct{})
+		go f.refreshLoop()
+	}
+
+	registerFilter(f)
+
+	return nil
+}
+
+// Cleanup stops the background refresher and unregisters f
+// from the admin query endpoint.
+func (f *IPFilter) Cleanup() error {
+	if f.done != nil {
+		close(f.done)
+	}
+	unregisterFilter(f)
+	return nil
+}
+
+func (f *IPFilter) refreshLoop() {
+	ticker := time.NewTicker(time.Duration(f.RefreshInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := f.reloadLists(false)
+			if err != nil {
+				f.logger.Error("refreshing IP lists", zap.Error(err))
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// reloadLists rebuilds the allow and deny sets from all sources.
+// Unless force is set, it is a no-op when no watched file has
+// changed and no URLs are configured.
+func (f *IPFilter) reloadLists(force bool) error {
+	changed := force || len(f.AllowURLs) > 0 || len(f.DenyURLs) > 0
+	for _, filename := range append(append([]string{}, f.AllowFiles...), f.DenyFiles...) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return fmt.Errorf("stat %s: %v", filename, err)
+		}
+		f.mu.RLock()
+		prev := f.fileMtimes[filename]
+		f.mu.RUnlock()
+		if !info.ModTime().Equal(prev) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	mtimes := make(map[string]time.Time)
+	gather := func(inline, files, urls []string) ([]*net.IPNet, error) {
+		var nets []*net.IPNet
+		for _, cidr := range inline {
+			ipNet, err := parseCIDROrIP(cidr)
+			if err != nil {
+				return nil, err
+			}
+			nets = append(nets, ipNet)
+		}
+		for _, filename := range files {
+			lines, mtime, err := readLinesFile(filename)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %v", filename, err)
+			}
+			mtimes[filename] = mtime
+			for _, line := range lines {
+				ipNet, err := parseCIDROrIP(line)
+				if err != nil {
+					f.logger.Warn("skipping bad entry",
+						zap.String("file", filename),
+						zap.String("value", line),
+						zap.Error(err))
+					continue
+				}
+				nets = append(nets, ipNet)
+			}
+		}
+		for _, url := range urls {
+			lines, err := lists.FetchLines(url, lists.DefaultTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("fetching %s: %v", url, err)
+			}
+			for _, line := range lines {
+				ipNet, err := parseCIDROrIP(line)
+				if err != nil {
+					f.logger.Warn("skipping bad entry",
+						zap.String("url", url),
+						zap.String("value", line),
+						zap.Error(err))
+					continue
+				}
+				nets = append(nets, ipNet)
+			}
+		}
+		return nets, nil
+	}
+
+	allowNets, err := gather(f.Allow, f.AllowFiles, f.AllowURLs)
+	if err != nil {
+		return err
+	}
+	denyNets, err := gather(f.Deny, f.DenyFiles, f.DenyURLs)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.allowNets = allowNets
+	f.denyNets = denyNets
+	f.fileMtimes = mtimes
+	f.mu.Unlock()
+
+	f.logger.Debug("loaded IP lists",
+		zap.Int("allowed_ranges", len(allowNets)),
+		zap.Int("denied_ranges", len(denyNets)))
+
+	return nil
+}
+
+func (f *IPFilter) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	if f.Blocked(ip) {
+		f.logger.Debug("denied request",
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("uri", r.RequestURI))
+		if f.DenyRoutes != nil {
+			return f.DenyRoutes.Compile(next).ServeHTTP(w, r)
+		}
+		return caddyhttp.Error(f.statusCode, fmt.Errorf("client IP not allowed"))
+	}
+
+	return next.ServeHTTP(w, r)
+}
+
+// Blocked returns whether ip would be denied by f. A nil
+// (unparseable) IP gets the default action.
+func (f *IPFilter) Blocked(ip net.IP) bool {
+	if ip == nil {
+		return f.DefaultAction == "deny"
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, ipNet := range f.denyNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	for _, ipNet := range f.allowNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return f.DefaultAction == "deny"
+}
+
+// parseCIDROrIP parses s as a CIDR range, or as a single IP
+// which is treated as a /32 (or /128) range.
+func parseCIDROrIP(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		if strings.Contains(s, ":") {
+			s += "/128"
+		} else {
+			s += "/32"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+// readLinesFile reads the non-empty, non-comment lines of
+// filename along with its modification time.
+func readLinesFile(filename string) ([]string, time.Time, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, info.ModTime(), scanner.Err()
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*IPFilter)(nil)
+	_ caddy.CleanerUpper          = (*IPFilter)(nil)
+	_ caddyhttp.MiddlewareHandler = (*IPFilter)(nil)
+)
@@ -25,10 +25,13 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"go.uber.org/zap"
+	"golang.org/x/net/idna"
 )
 
 type (
@@ -81,7 +84,16 @@ type (
 	// MatchMethod matches requests by the method.
 	MatchMethod []string
 
-	// MatchQuery matches requests by URI's query string.
+	// MatchQuery matches requests by the URI's query string. A
+	// request matches if any of the values for a key matches any
+	// value of that key in the query string. Values are compared
+	// exactly, except that `*` matches any value, a value may use
+	// the wildcard `*` character as a prefix, suffix, or both for
+	// fast substring matches, and a value prefixed with `~` is
+	// treated as an RE2 regular expression which the query value
+	// must match entirely. If a list is empty, the key must simply
+	// be present, regardless of its value. A key prefixed with `!`
+	// must not appear in the query string at all.
 	MatchQuery url.Values
 
 	// MatchHeader matches requests by header fields. It performs fast,
@@ -179,6 +191,13 @@ func (m *MatchHost) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 
 // Provision sets up and validates m, including making it more efficient for large lists.
 func (m MatchHost) Provision(_ caddy.Context) error {
+	// normalize the hostnames so that both forms of an IDN
+	// (unicode and punycode), FQDNs with a trailing dot, and
+	// mixed-case spellings all match the same way
+	for i, h := range m {
+		m[i] = normalizeHost(h)
+	}
+
 	// check for duplicates; they are nonsensical and reduce efficiency
 	// (we could just remove them, but the user should know their config is erroneous)
 	seen := make(map[string]int)
@@ -223,6 +242,10 @@ func (m MatchHost) Match(r *http.Request) bool {
 		reqHost = strings.TrimSuffix(reqHost, "]")
 	}
 
+	// normalize the incoming host the same way the configured
+	// hosts were normalized at provision time
+	reqHost = normalizeHost(reqHost)
+
 	if m.large() {
 		// fast path: locate exact match using binary search (about 100-1000x faster for large lists)
 		pos := sort.Search(len(m), func(i int) bool {
@@ -248,7 +271,7 @@ outer:
 			break
 		}
 
-		host = repl.ReplaceAll(host, "")
+		host = normalizeHost(repl.ReplaceAll(host, ""))
 		if strings.Contains(host, "*") {
 			patternParts := strings.Split(host, ".")
 			incomingParts := strings.Split(reqHost, ".")
@@ -276,6 +299,36 @@ outer:
 // hostname, e.g. has placeholders or wildcards.
 func (MatchHost) fuzzy(h string) bool { return strings.ContainsAny(h, "{*") }
 
+// normalizeHost returns a normalized form of h: lowercased, with
+// any trailing dot (FQDN form) removed, and with unicode (IDN)
+// labels converted to their punycode ASCII form. Wildcard labels
+// are preserved, and hostnames containing placeholders are
+// returned unchanged since they cannot be normalized until the
+// placeholders are replaced.
+func normalizeHost(h string) string {
+	if strings.Contains(h, "{") {
+		return h
+	}
+	h = strings.ToLower(strings.TrimSuffix(h, "."))
+	for i := 0; i < len(h); i++ {
+		if h[i] < utf8.RuneSelf {
+			continue
+		}
+		// slow path: at least one unicode label to convert
+		labels := strings.Split(h, ".")
+		for j, label := range labels {
+			if label == "*" {
+				continue
+			}
+			if ascii, err := idna.ToASCII(label); err == nil {
+				labels[j] = ascii
+			}
+		}
+		return strings.Join(labels, ".")
+	}
+	return h
+}
+
 // large returns true if m is considered to be large. Optimizing
 // the matcher for smaller lists has diminishing returns.
 // See related benchmark function in test file to conduct experiments.
@@ -433,7 +486,11 @@ func (m *MatchQuery) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 			}
 			parts := strings.SplitN(query, "=", 2)
 			if len(parts) != 2 {
-				return d.Errf("malformed query matcher token: %s; must be in param=val format", d.Val())
+				// a bare key is a presence (or, with !, absence) check
+				if _, ok := (*m)[query]; !ok {
+					(*m)[query] = []string{}
+				}
+				continue
 			}
 			url.Values(*m).Add(parts[0], parts[1])
 		}
@@ -447,21 +504,87 @@ func (m *MatchQuery) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 // Match returns true if r matches m. An empty m matches an empty query string.
 func (m MatchQuery) Match(r *http.Request) bool {
 	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	query := r.URL.Query()
 	for param, vals := range m {
 		param = repl.ReplaceAll(param, "")
-		paramVal, found := r.URL.Query()[param]
-		if found {
+		if strings.HasPrefix(param, "!") {
+			// negated key must be absent from the query string
+			if _, found := query[param[1:]]; found {
+				return false
+			}
+			continue
+		}
+		paramVals, found := query[param]
+		if !found {
+			return false
+		}
+		if len(vals) == 0 {
+			// empty list means mere presence suffices
+			continue
+		}
+		var match bool
+	paramVals:
+		for _, paramVal := range paramVals {
 			for _, v := range vals {
 				v = repl.ReplaceAll(v, "")
-				if paramVal[0] == v || v == "*" {
-					return true
+				if matchQueryValue(paramVal, v) {
+					match = true
+					break paramVals
 				}
 			}
 		}
+		if !match {
+			return false
+		}
+	}
+	if len(m) == 0 {
+		return len(query) == 0
+	}
+	return true
+}
+
+// matchQueryValue compares a single query string value against
+// the allowed value pattern, which may be an exact string, use
+// `*` wildcards at either end, or be a `~`-prefixed regular
+// expression.
+func matchQueryValue(actual, allowed string) bool {
+	switch {
+	case allowed == "*":
+		return true
+	case strings.HasPrefix(allowed, "~"):
+		re, err := queryValueRegexp(allowed[1:])
+		if err != nil {
+			return false
+		}
+		return re.MatchString(actual)
+	case strings.HasPrefix(allowed, "*") && strings.HasSuffix(allowed, "*"):
+		return strings.Contains(actual, allowed[1:len(allowed)-1])
+	case strings.HasPrefix(allowed, "*"):
+		return strings.HasSuffix(actual, allowed[1:])
+	case strings.HasSuffix(allowed, "*"):
+		return strings.HasPrefix(actual, allowed[:len(allowed)-1])
+	default:
+		return actual == allowed
 	}
-	return len(m) == 0 && len(r.URL.Query()) == 0
 }
 
+// queryValueRegexp compiles pattern anchored at both ends,
+// caching the result since patterns may contain placeholders
+// and thus cannot always be compiled at provision time.
+func queryValueRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := queryRegexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	queryRegexpCache.Store(pattern, re)
+	return re, nil
+}
+
+var queryRegexpCache sync.Map
+
 // CaddyModule returns the Caddy module information.
 func (MatchHeader) CaddyModule() caddy.ModuleInfo {
 	return caddy.ModuleInfo{
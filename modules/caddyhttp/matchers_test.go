@@ -142,6 +142,31 @@ func TestHostMatcher(t *testing.T) {
 			input:  "localhost",
 			expect: false,
 		},
+		{
+			match:  MatchHost{"example.com"},
+			input:  "example.com.",
+			expect: true,
+		},
+		{
+			match:  MatchHost{"example.com."},
+			input:  "example.com",
+			expect: true,
+		},
+		{
+			match:  MatchHost{"bücher.example"},
+			input:  "xn--bcher-kva.example",
+			expect: true,
+		},
+		{
+			match:  MatchHost{"xn--bcher-kva.example"},
+			input:  "bücher.example",
+			expect: true,
+		},
+		{
+			match:  MatchHost{"*.bücher.example"},
+			input:  "www.xn--bcher-kva.example",
+			expect: true,
+		},
 	} {
 		req := &http.Request{Host: tc.input}
 		repl := caddy.NewReplacer()
@@ -561,6 +586,60 @@ func TestQueryMatcher(t *testing.T) {
 			input:    "/?",
 			expect:   false,
 		},
+		{
+			scenario: "match against any of multiple allowed values",
+			match:    MatchQuery{"debug": []string{"1", "2"}},
+			input:    "/?debug=2",
+			expect:   true,
+		},
+		{
+			scenario: "match against any of multiple actual values",
+			match:    MatchQuery{"debug": []string{"2"}},
+			input:    "/?debug=1&debug=2",
+			expect:   true,
+		},
+		{
+			scenario: "match presence regardless of value",
+			match:    MatchQuery{"debug": []string{}},
+			input:    "/?debug=whatever",
+			expect:   true,
+		},
+		{
+			scenario: "match absence of a key",
+			match:    MatchQuery{"!debug": []string{}},
+			input:    "/?other=1",
+			expect:   true,
+		},
+		{
+			scenario: "non match when negated key is present",
+			match:    MatchQuery{"!debug": []string{}},
+			input:    "/?debug=1",
+			expect:   false,
+		},
+		{
+			scenario: "match a wildcard suffix",
+			match:    MatchQuery{"file": []string{"report-*"}},
+			input:    "/?file=report-2020",
+			expect:   true,
+		},
+		{
+			scenario: "match a regexp value",
+			match:    MatchQuery{"id": []string{"~[0-9]+"}},
+			input:    "/?id=42",
+			expect:   true,
+		},
+		{
+			scenario: "non match against a partial regexp value",
+			match:    MatchQuery{"id": []string{"~[0-9]+"}},
+			input:    "/?id=42abc",
+			expect:   false,
+		},
+		{
+			scenario: "non match when all keys must match",
+			match:    MatchQuery{"debug": []string{"1"}, "trace": []string{"1"}},
+			input:    "/?debug=1",
+			expect:   false,
+		},
 		{
 			scenario: "match against a placeholder value",
 			match:    MatchQuery{"debug": []string{"{http.vars.debug}"}},
@@ -620,6 +699,12 @@ func TestHeaderREMatcher(t *testing.T) {
 			input:  http.Header{"Field": []string{"barfoo", "foobar"}},
 			expect: true,
 		},
+		{
+			match:      MatchHeaderRE{"Field": &MatchRegexp{Pattern: "^foo(?P<suffix>.*)$", Name: "name"}},
+			input:      http.Header{"Field": []string{"foobar"}},
+			expect:     true,
+			expectRepl: map[string]string{"name.suffix": "bar"},
+		},
 		{
 			match:  MatchHeaderRE{"host": &MatchRegexp{Pattern: "^localhost$", Name: "name"}},
 			input:  http.Header{},
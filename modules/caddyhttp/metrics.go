@@ -12,6 +12,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// Metrics configures metrics observations for a server.
+type Metrics struct {
+	// Also label request metrics with the host part of the request's
+	// Host header. Because every distinct Host value creates its own
+	// time series, only enable this for servers with a bounded set
+	// of hostnames.
+	PerHost bool `json:"per_host,omitempty"`
+}
+
 var httpMetrics = struct {
 	init             sync.Once
 	requestInFlight  *prometheus.GaugeVec
@@ -52,7 +61,7 @@ func initHTTPMetrics() {
 	durationBuckets := prometheus.DefBuckets
 	sizeBuckets := prometheus.ExponentialBuckets(256, 4, 8)
 
-	httpLabels := []string{"server", "handler", "code", "method"}
+	httpLabels := []string{"server", "host", "handler", "code", "class", "method"}
 	httpMetrics.requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: ns,
 		Subsystem: sub,
@@ -107,12 +116,28 @@ func newMetricsInstrumentedHandler(handler string, mh MiddlewareHandler) *metric
 }
 
 func (h *metricsInstrumentedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next Handler) error {
+	srv, _ := r.Context().Value(ServerCtxKey).(*Server)
+
+	// metrics are opt-in per server
+	if srv != nil && srv.Metrics == nil {
+		return h.mh.ServeHTTP(w, r, next)
+	}
+
 	server := serverNameFromContext(r.Context())
 	labels := prometheus.Labels{"server": server, "handler": h.handler}
 	method := strings.ToUpper(r.Method)
-	// the "code" value is set later, but initialized here to eliminate the possibility
-	// of a panic
-	statusLabels := prometheus.Labels{"server": server, "handler": h.handler, "method": method, "code": ""}
+
+	var host string
+	if srv != nil && srv.Metrics.PerHost {
+		host = strings.ToLower(r.Host)
+		if idx := strings.LastIndex(host, ":"); idx > -1 && !strings.HasSuffix(host, "]") {
+			host = host[:idx]
+		}
+	}
+
+	// the "code" and "class" values are set later, but initialized here to
+	// eliminate the possibility of a panic
+	statusLabels := prometheus.Labels{"server": server, "host": host, "handler": h.handler, "method": method, "code": "", "class": ""}
 
 	inFlight := httpMetrics.requestInFlight.With(labels)
 	inFlight.Inc()
@@ -125,6 +150,7 @@ func (h *metricsInstrumentedHandler) ServeHTTP(w http.ResponseWriter, r *http.Re
 	// Effectively the same behaviour as promhttp.InstrumentHandlerTimeToWriteHeader.
 	writeHeaderRecorder := ShouldBufferFunc(func(status int, header http.Header) bool {
 		statusLabels["code"] = sanitizeCode(status)
+		statusLabels["class"] = statusClass(status)
 		ttfb := time.Since(start).Seconds()
 		httpMetrics.responseDuration.With(statusLabels).Observe(ttfb)
 		return false
@@ -144,6 +170,7 @@ func (h *metricsInstrumentedHandler) ServeHTTP(w http.ResponseWriter, r *http.Re
 		// we still sanitize it, even though it's likely to be 0. A 200 is
 		// returned on fallthrough so we want to reflect that.
 		statusLabels["code"] = sanitizeCode(wrec.Status())
+		statusLabels["class"] = statusClass(wrec.Status())
 	}
 
 	httpMetrics.requestDuration.With(statusLabels).Observe(dur)
@@ -160,6 +187,15 @@ func sanitizeCode(code int) string {
 	return strconv.Itoa(code)
 }
 
+// statusClass returns the class of a status code ("2xx", "5xx", ...).
+// An unwritten status counts as a 200, same as sanitizeCode.
+func statusClass(code int) string {
+	if code == 0 {
+		code = 200
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
 // taken from https://github.com/prometheus/client_golang/blob/6007b2b5cae01203111de55f753e76d8dac1f529/prometheus/promhttp/instrument_server.go#L298
 func computeApproximateRequestSize(r *http.Request) int {
 	s := 0
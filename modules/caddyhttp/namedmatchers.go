@@ -0,0 +1,103 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(MatchNamed{})
+}
+
+// MatchNamed matches requests by evaluating matcher sets that
+// were defined once on the server with a name. This avoids
+// duplicating identical matcher blobs across many routes in
+// large configurations. The matcher's JSON value is a list of
+// names; it matches if any of the referenced sets matches.
+type MatchNamed []string
+
+// CaddyModule returns the Caddy module information.
+func (MatchNamed) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.matchers.named",
+		New: func() caddy.Module { return new(MatchNamed) },
+	}
+}
+
+// Match returns true if r matches any of the named matcher
+// sets defined on the server handling r. References to names
+// that are not defined never match.
+func (m MatchNamed) Match(r *http.Request) bool {
+	server, ok := r.Context().Value(ServerCtxKey).(*Server)
+	if !ok {
+		return false
+	}
+	for _, name := range m {
+		if ms, ok := server.namedMatcherSets[name]; ok && ms.AnyMatch(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler.
+func (m *MatchNamed) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		*m = append(*m, d.RemainingArgs()...)
+	}
+	return nil
+}
+
+// provisionNamedMatcherSets loads the server's named matcher
+// sets so they can be referenced by the "named" matcher.
+func (s *Server) provisionNamedMatcherSets(ctx caddy.Context) error {
+	if len(s.NamedMatcherSetsRaw) == 0 {
+		return nil
+	}
+	s.namedMatcherSets = make(map[string]MatcherSets)
+	for name, rawSets := range s.NamedMatcherSetsRaw {
+		var matcherSets MatcherSets
+		for i, rawSet := range rawSets {
+			var matcherSet MatcherSet
+			for modName, rawMsg := range rawSet {
+				val, err := ctx.LoadModuleByID("http.matchers."+modName, rawMsg)
+				if err != nil {
+					return fmt.Errorf("named matcher set '%s' (set %d): loading matcher module '%s': %v",
+						name, i, modName, err)
+				}
+				reqMatcher, ok := val.(RequestMatcher)
+				if !ok {
+					return fmt.Errorf("named matcher set '%s' (set %d): module '%s' is not a request matcher",
+						name, i, modName)
+				}
+				matcherSet = append(matcherSet, reqMatcher)
+			}
+			matcherSets = append(matcherSets, matcherSet)
+		}
+		s.namedMatcherSets[name] = matcherSets
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ RequestMatcher        = (*MatchNamed)(nil)
+	_ caddyfile.Unmarshaler = (*MatchNamed)(nil)
+)
@@ -0,0 +1,108 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(MatchProbability{})
+}
+
+// MatchProbability matches a configurable fraction of requests,
+// which is useful for gradually rolling out new routes (canary
+// deployments) without a dedicated traffic-splitting subsystem.
+//
+// By default each request is decided independently at random. If
+// a sticky key is configured, the decision is derived from a hash
+// of that key's value instead, so a given client consistently gets
+// the same decision for the lifetime of the rollout percentage.
+type MatchProbability struct {
+	// The fraction of requests to match, from 0.0 to 1.0.
+	// For example, 0.05 matches 5% of requests.
+	Probability float64 `json:"probability"`
+
+	// An optional placeholder whose value determines the
+	// decision, such as "{http.request.remote.host}" for
+	// stickiness by client IP, or a cookie placeholder for
+	// stickiness by session. If empty, decisions are random.
+	StickyKey string `json:"sticky_key,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (MatchProbability) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.matchers.probability",
+		New: func() caddy.Module { return new(MatchProbability) },
+	}
+}
+
+// Validate ensures the probability is in range.
+func (m *MatchProbability) Validate() error {
+	if m.Probability < 0 || m.Probability > 1 {
+		return fmt.Errorf("probability must be between 0.0 and 1.0: %f", m.Probability)
+	}
+	return nil
+}
+
+// Match returns true for approximately the configured
+// fraction of requests.
+func (m MatchProbability) Match(r *http.Request) bool {
+	if m.StickyKey != "" {
+		repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+		key := repl.ReplaceAll(m.StickyKey, "")
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return float64(h.Sum32())/float64(1<<32) < m.Probability
+	}
+	return rand.Float64() < m.Probability
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler. Syntax:
+//
+//     probability <fraction> [<sticky_key>]
+//
+func (m *MatchProbability) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		var probStr string
+		if !d.Args(&probStr) {
+			return d.ArgErr()
+		}
+		prob, err := strconv.ParseFloat(probStr, 64)
+		if err != nil {
+			return d.Errf("parsing probability: %v", err)
+		}
+		m.Probability = prob
+		if d.NextArg() {
+			m.StickyKey = d.Val()
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddy.Validator       = (*MatchProbability)(nil)
+	_ RequestMatcher        = (*MatchProbability)(nil)
+	_ caddyfile.Unmarshaler = (*MatchProbability)(nil)
+)
@@ -21,6 +21,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"time"
 )
 
 // ResponseWriterWrapper wraps an underlying ResponseWriter and
@@ -62,6 +63,15 @@ func (rww *ResponseWriterWrapper) Push(target string, opts *http.PushOptions) er
 	return ErrNotImplemented
 }
 
+// Note that ResponseWriterWrapper deliberately does NOT implement
+// io.ReaderFrom: a promoted ReadFrom method would let io.Copy (and
+// things like http.ServeContent) write straight to the underlying
+// ResponseWriter, bypassing the embedding type's own Write method
+// and any logic it performs (deferred WriteHeader, encoding,
+// recording, etc.). Types that can safely pass the zero-copy fast
+// path through must implement ReadFrom themselves, the way
+// responseRecorder does below.
+
 // HTTPInterfaces mix all the interfaces that middleware ResponseWriters need to support.
 type HTTPInterfaces interface {
 	http.ResponseWriter
@@ -82,6 +92,7 @@ type responseRecorder struct {
 	size         int
 	wroteHeader  bool
 	stream       bool
+	firstWrite   time.Time
 }
 
 // NewResponseRecorder returns a new ResponseRecorder that can be
@@ -155,6 +166,7 @@ func (rr *responseRecorder) WriteHeader(statusCode int) {
 	}
 	rr.statusCode = statusCode
 	rr.wroteHeader = true
+	rr.firstWrite = time.Now()
 
 	// decide whether we should buffer the response
 	if rr.shouldBuffer == nil {
@@ -184,6 +196,28 @@ func (rr *responseRecorder) Write(data []byte) (int, error) {
 	return n, err
 }
 
+// ReadFrom implements io.ReaderFrom, preserving the underlying
+// writer's zero-copy path (sendfile/splice) when the response is
+// being streamed. This is safe here, and only here, because the
+// recorder writes its header and decides between streaming and
+// buffering before any bytes are copied.
+func (rr *responseRecorder) ReadFrom(r io.Reader) (int64, error) {
+	rr.WriteHeader(http.StatusOK)
+	var n int64
+	var err error
+	if rr.stream {
+		if rf, ok := rr.ResponseWriterWrapper.ResponseWriter.(io.ReaderFrom); ok {
+			n, err = rf.ReadFrom(r)
+		} else {
+			n, err = io.Copy(rr.ResponseWriterWrapper, r)
+		}
+	} else {
+		n, err = rr.buf.ReadFrom(r)
+	}
+	rr.size += int(n)
+	return n, err
+}
+
 // Status returns the status code that was written, if any.
 func (rr *responseRecorder) Status() int {
 	return rr.statusCode
@@ -195,6 +229,14 @@ func (rr *responseRecorder) Size() int {
 	return rr.size
 }
 
+// FirstWriteTime returns the time the response status was first
+// written (i.e. when the response started, useful for measuring
+// time to first byte), or the zero time if the handler never
+// wrote a response.
+func (rr *responseRecorder) FirstWriteTime() time.Time {
+	return rr.firstWrite
+}
+
 // Buffer returns the body buffer that rr was created with.
 // You should still have your original pointer, though.
 func (rr *responseRecorder) Buffer() *bytes.Buffer {
@@ -229,6 +271,7 @@ type ResponseRecorder interface {
 	Buffer() *bytes.Buffer
 	Buffered() bool
 	Size() int
+	FirstWriteTime() time.Time
 	WriteResponse() error
 }
 
@@ -0,0 +1,103 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readFromRecorder wraps httptest.ResponseRecorder and counts
+// how many times its ReadFrom method is invoked, so tests can
+// verify that the optimized copy path is actually reached.
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFromCalls int
+}
+
+func (r *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFromCalls++
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestResponseWriterWrapperDoesNotPromoteReadFrom(t *testing.T) {
+	// the shared wrapper must not implement io.ReaderFrom: a
+	// promoted ReadFrom would let io.Copy bypass the Write method
+	// of every type that embeds the wrapper (encode, headers,
+	// body_capture, ...); only types that manage their own header
+	// and size bookkeeping may pass the fast path through
+	var rww interface{} = &ResponseWriterWrapper{ResponseWriter: httptest.NewRecorder()}
+	if _, ok := rww.(io.ReaderFrom); ok {
+		t.Error("ResponseWriterWrapper must not implement io.ReaderFrom; embedders would inherit it and lose their Write logic")
+	}
+}
+
+func TestResponseRecorderReadFrom(t *testing.T) {
+	const body = "buffered or streamed"
+
+	// streaming recorder: ReadFrom should reach the underlying writer
+	underlying := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rec := NewResponseRecorder(underlying, nil, nil)
+	n, err := io.Copy(rec, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if n != int64(len(body)) {
+		t.Errorf("expected %d bytes copied, got %d", len(body), n)
+	}
+	if underlying.readFromCalls != 1 {
+		t.Errorf("expected underlying ReadFrom to be called once, got %d calls", underlying.readFromCalls)
+	}
+	if rec.Size() != len(body) {
+		t.Errorf("expected recorded size %d, got %d", len(body), rec.Size())
+	}
+
+	// buffering recorder: the body must land in the buffer, not the writer
+	underlying = &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	buf := new(bytes.Buffer)
+	rec = NewResponseRecorder(underlying, buf, func(int, http.Header) bool { return true })
+	_, err = io.Copy(rec, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if underlying.readFromCalls != 0 {
+		t.Errorf("expected underlying ReadFrom to not be called, got %d calls", underlying.readFromCalls)
+	}
+	if buf.String() != body {
+		t.Errorf("expected buffered body %q, got %q", body, buf.String())
+	}
+	if rec.Size() != len(body) {
+		t.Errorf("expected recorded size %d, got %d", len(body), rec.Size())
+	}
+}
+
+func BenchmarkResponseRecorderReadFromStreamed(b *testing.B) {
+	src := bytes.Repeat([]byte("benchmark body "), 1<<12) // ~60 KB
+	underlying := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rec := NewResponseRecorder(underlying, nil, nil)
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		underlying.Body.Reset()
+		_, err := io.Copy(rec, bytes.NewReader(src))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ajp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/reverseproxy"
+	"go.uber.org/zap"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(Transport{})
+}
+
+// Transport facilitates communication with Java servlet containers
+// (Tomcat, JBoss, and friends) over the AJP13 protocol, so legacy
+// deployments can be proxied without enabling their HTTP connectors.
+type Transport struct {
+	// The duration used to set a deadline when connecting to an upstream.
+	DialTimeout caddy.Duration `json:"dial_timeout,omitempty"`
+
+	// The duration used to set a deadline when reading from the AJP server.
+	ReadTimeout caddy.Duration `json:"read_timeout,omitempty"`
+
+	// The duration used to set a deadline when sending to the AJP server.
+	WriteTimeout caddy.Duration `json:"write_timeout,omitempty"`
+
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (Transport) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.reverse_proxy.transport.ajp",
+		New: func() caddy.Module { return new(Transport) },
+	}
+}
+
+// Provision sets up t.
+func (t *Transport) Provision(ctx caddy.Context) error {
+	t.logger = ctx.Logger(t)
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+
+	// extract dial information from request (should have been embedded by the reverse proxy)
+	network, address := "tcp", r.URL.Host
+	if dialInfo, ok := reverseproxy.GetDialInfo(ctx); ok {
+		network = dialInfo.Network
+		address = dialInfo.Address
+	}
+
+	t.logger.Debug("roundtrip",
+		zap.Object("request", caddyhttp.LoggableHTTPRequest{Request: r}),
+		zap.String("dial", address),
+	)
+
+	dialer := net.Dialer{Timeout: time.Duration(t.DialTimeout)}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("dialing backend: %v", err)
+	}
+
+	if t.WriteTimeout > 0 {
+		err = conn.SetWriteDeadline(time.Now().Add(time.Duration(t.WriteTimeout)))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("setting write timeout: %v", err)
+		}
+	}
+
+	reqHost, reqPort, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		// whatever, just assume there was no port
+		reqHost = r.Host
+		reqPort = ""
+	}
+
+	c := &client{conn: conn, br: bufio.NewReader(conn)}
+	if r.Body != nil && r.ContentLength != 0 {
+		c.reqBody = r.Body
+	}
+
+	err = c.forwardRequest(r, reqHost, reqPort)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sending request to backend: %v", err)
+	}
+
+	// the first body chunk is sent unsolicited; the container asks
+	// for the rest with GET_BODY_CHUNK packets
+	if c.reqBody != nil {
+		if err := c.sendBodyChunk(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("sending request body to backend: %v", err)
+		}
+	}
+
+	if t.ReadTimeout > 0 {
+		err = conn.SetReadDeadline(time.Now().Add(time.Duration(t.ReadTimeout)))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("setting read timeout: %v", err)
+		}
+	}
+
+	resp, err := c.readResponse(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading response from backend: %v", err)
+	}
+	// conn gets closed when the response body is closed (see bodyReader)
+
+	return resp, nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner = (*Transport)(nil)
+	_ http.RoundTripper = (*Transport)(nil)
+)
@@ -0,0 +1,276 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ajp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// client performs a single AJP13 request over conn.
+type client struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	reqBody io.Reader // remaining request body; nil once exhausted
+}
+
+// forwardRequest encodes and sends the FORWARD_REQUEST packet for r.
+func (c *client) forwardRequest(r *http.Request, serverName, serverPort string) error {
+	methodCode, ok := methodCodes[r.Method]
+	if !ok {
+		return fmt.Errorf("method %s cannot be represented in AJP13", r.Method)
+	}
+
+	// Separate remote IP and port; more lenient than net.SplitHostPort
+	var ip string
+	if idx := strings.LastIndex(r.RemoteAddr, ":"); idx > -1 {
+		ip = r.RemoteAddr[:idx]
+	} else {
+		ip = r.RemoteAddr
+	}
+	ip = strings.Replace(ip, "[", "", 1)
+	ip = strings.Replace(ip, "]", "", 1)
+
+	port := 80
+	if r.TLS != nil {
+		port = 443
+	}
+	if serverPort != "" {
+		if p, err := strconv.Atoi(serverPort); err == nil {
+			port = p
+		}
+	}
+
+	// the container learns the request body length from the
+	// content-length header, and Go promotes Host out of the header
+	// map, so make sure both are present
+	headers := make([][2]string, 0, len(r.Header)+2)
+	if r.Host != "" && r.Header.Get("Host") == "" {
+		headers = append(headers, [2]string{"host", r.Host})
+	}
+	if r.ContentLength > 0 && r.Header.Get("Content-Length") == "" {
+		headers = append(headers, [2]string{"content-length", strconv.FormatInt(r.ContentLength, 10)})
+	}
+	for field, vals := range r.Header {
+		for _, val := range vals {
+			headers = append(headers, [2]string{strings.ToLower(field), val})
+		}
+	}
+
+	var pkt packetWriter
+	pkt.writeByte(pktForwardRequest)
+	pkt.writeByte(methodCode)
+	pkt.writeString(r.Proto)
+	pkt.writeString(r.URL.Path)
+	pkt.writeString(ip)
+	pkt.writeString(ip) // remote host; lookups disabled, same as FastCGI
+	pkt.writeString(serverName)
+	pkt.writeUint16(uint16(port))
+	pkt.writeBool(r.TLS != nil)
+	pkt.writeUint16(uint16(len(headers)))
+	for _, header := range headers {
+		if code, ok := requestHeaderCodes[header[0]]; ok {
+			pkt.writeUint16(code)
+		} else {
+			pkt.writeString(header[0])
+		}
+		pkt.writeString(header[1])
+	}
+	if r.URL.RawQuery != "" {
+		pkt.writeByte(attrQueryString)
+		pkt.writeString(r.URL.RawQuery)
+	}
+	pkt.writeByte(attrTerminator)
+
+	return pkt.send(c.conn)
+}
+
+// sendBodyChunk sends the next chunk of the request body, or an
+// empty packet if the body is exhausted (which tells the container
+// there is no more data).
+func (c *client) sendBodyChunk() error {
+	var pkt packetWriter
+	if c.reqBody != nil {
+		chunk := make([]byte, maxBodyChunk)
+		n, err := io.ReadFull(c.reqBody, chunk)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.reqBody = nil
+		} else if err != nil {
+			return err
+		}
+		if n > 0 {
+			pkt.writeUint16(uint16(n))
+			pkt.buf.Write(chunk[:n])
+		}
+	}
+	return pkt.send(c.conn)
+}
+
+// readResponse processes container packets until the response
+// headers arrive, answering any requests for more request body
+// along the way.
+func (c *client) readResponse(r *http.Request) (*http.Response, error) {
+	for {
+		payload, err := readPacket(c.br)
+		if err != nil {
+			return nil, err
+		}
+		pr := &packetReader{data: payload}
+		prefix, err := pr.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch prefix {
+		case pktGetBodyChunk:
+			if err := c.sendBodyChunk(); err != nil {
+				return nil, err
+			}
+
+		case pktSendHeaders:
+			return c.parseHeaders(pr, r)
+
+		case pktEndResponse:
+			return nil, fmt.Errorf("backend ended response before sending headers")
+
+		default:
+			return nil, fmt.Errorf("unexpected packet type %d before response headers", prefix)
+		}
+	}
+}
+
+// parseHeaders decodes a SEND_HEADERS payload into an http.Response
+// whose body streams the remaining body chunk packets.
+func (c *client) parseHeaders(pr *packetReader, r *http.Request) (*http.Response, error) {
+	statusCode, err := pr.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	statusMsg, err := pr.readString()
+	if err != nil {
+		return nil, err
+	}
+	if statusMsg == "" {
+		statusMsg = http.StatusText(int(statusCode))
+	}
+	numHeaders, err := pr.readUint16()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header, numHeaders)
+	for i := 0; i < int(numHeaders); i++ {
+		var name string
+		code, err := pr.readUint16()
+		if err != nil {
+			return nil, err
+		}
+		if code>>8 == 0xA0 {
+			idx := int(code&0xFF) - 1
+			if idx < 0 || idx >= len(responseHeaderNames) {
+				return nil, fmt.Errorf("unknown response header code %#x", code)
+			}
+			name = responseHeaderNames[idx]
+		} else {
+			// the two bytes we read were actually a string length
+			if len(pr.data) < int(code)+1 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			name = string(pr.data[:code])
+			pr.data = pr.data[code+1:]
+		}
+		val, err := pr.readString()
+		if err != nil {
+			return nil, err
+		}
+		header.Add(name, val)
+	}
+
+	resp := &http.Response{
+		Proto:      r.Proto,
+		ProtoMajor: r.ProtoMajor,
+		ProtoMinor: r.ProtoMinor,
+		StatusCode: int(statusCode),
+		Status:     fmt.Sprintf("%d %s", statusCode, statusMsg),
+		Header:     header,
+		Request:    r,
+	}
+	resp.ContentLength, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	resp.Body = &bodyReader{c: c}
+	return resp, nil
+}
+
+// bodyReader streams SEND_BODY_CHUNK packets as the response body
+// until END_RESPONSE arrives.
+type bodyReader struct {
+	c     *client
+	chunk []byte
+	done  bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	for len(b.chunk) == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+		payload, err := readPacket(b.c.br)
+		if err != nil {
+			return 0, err
+		}
+		pr := &packetReader{data: payload}
+		prefix, err := pr.readByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch prefix {
+		case pktSendBodyChunk:
+			length, err := pr.readUint16()
+			if err != nil {
+				return 0, err
+			}
+			if len(pr.data) < int(length) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b.chunk = pr.data[:length]
+
+		case pktGetBodyChunk:
+			// a backend may still be reading our request body
+			// while it responds
+			if err := b.c.sendBodyChunk(); err != nil {
+				return 0, err
+			}
+
+		case pktEndResponse:
+			b.done = true
+
+		default:
+			return 0, fmt.Errorf("unexpected packet type %d in response body", prefix)
+		}
+	}
+
+	n := copy(p, b.chunk)
+	b.chunk = b.chunk[n:]
+	return n, nil
+}
+
+func (b *bodyReader) Close() error {
+	return b.c.conn.Close()
+}
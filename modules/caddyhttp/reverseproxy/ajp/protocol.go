@@ -0,0 +1,212 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ajp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// AJP13 exchanges fixed-size packets. Packets from the proxy to the
+// container start with the magic bytes 0x12 0x34; packets from the
+// container start with "AB". Either way, a big-endian uint16 payload
+// length follows, then the payload, whose first byte identifies the
+// message type.
+const (
+	maxPacketSize = 8192
+
+	// a body chunk needs 4 bytes of packet header plus a 2-byte
+	// chunk length inside the payload
+	maxBodyChunk = maxPacketSize - 6
+
+	// payload type codes
+	pktForwardRequest = 2 // proxy -> container
+	pktSendBodyChunk  = 3 // container -> proxy
+	pktSendHeaders    = 4 // container -> proxy
+	pktEndResponse    = 5 // container -> proxy
+	pktGetBodyChunk   = 6 // container -> proxy
+)
+
+// methodCodes maps HTTP methods to their AJP13 byte codes. The
+// protocol has no escape hatch for methods missing from this table.
+var methodCodes = map[string]byte{
+	"OPTIONS":   1,
+	"GET":       2,
+	"HEAD":      3,
+	"POST":      4,
+	"PUT":       5,
+	"DELETE":    6,
+	"TRACE":     7,
+	"PROPFIND":  8,
+	"PROPPATCH": 9,
+	"MKCOL":     10,
+	"COPY":      11,
+	"MOVE":      12,
+	"LOCK":      13,
+	"UNLOCK":    14,
+	"ACL":       15,
+	"REPORT":    16,
+	"SEARCH":    21,
+}
+
+// requestHeaderCodes maps common request header names (lowercased)
+// to their 2-byte codes; any other header is sent as a literal string.
+var requestHeaderCodes = map[string]uint16{
+	"accept":          0xA001,
+	"accept-charset":  0xA002,
+	"accept-encoding": 0xA003,
+	"accept-language": 0xA004,
+	"authorization":   0xA005,
+	"connection":      0xA006,
+	"content-type":    0xA007,
+	"content-length":  0xA008,
+	"cookie":          0xA009,
+	"cookie2":         0xA00A,
+	"host":            0xA00B,
+	"pragma":          0xA00C,
+	"referer":         0xA00D,
+	"user-agent":      0xA00E,
+}
+
+// responseHeaderNames is indexed by the low byte of a coded response
+// header name, minus one.
+var responseHeaderNames = []string{
+	"Content-Type",
+	"Content-Language",
+	"Content-Length",
+	"Date",
+	"Last-Modified",
+	"Location",
+	"Set-Cookie",
+	"Set-Cookie2",
+	"Servlet-Engine",
+	"Status",
+	"WWW-Authenticate",
+}
+
+// attribute type codes used in the forward request
+const (
+	attrQueryString = 0x05
+	attrTerminator  = 0xFF
+)
+
+// packetWriter accumulates a packet payload with AJP13 encoding.
+type packetWriter struct {
+	buf bytes.Buffer
+}
+
+func (p *packetWriter) writeByte(b byte) {
+	p.buf.WriteByte(b)
+}
+
+func (p *packetWriter) writeUint16(n uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], n)
+	p.buf.Write(b[:])
+}
+
+func (p *packetWriter) writeBool(b bool) {
+	if b {
+		p.buf.WriteByte(1)
+	} else {
+		p.buf.WriteByte(0)
+	}
+}
+
+// writeString encodes s as a length-prefixed, NUL-terminated string.
+func (p *packetWriter) writeString(s string) {
+	p.writeUint16(uint16(len(s)))
+	p.buf.WriteString(s)
+	p.buf.WriteByte(0)
+}
+
+// send frames the accumulated payload with the proxy-side magic
+// bytes and writes it to w.
+func (p *packetWriter) send(w io.Writer) error {
+	payload := p.buf.Bytes()
+	if len(payload)+4 > maxPacketSize {
+		return fmt.Errorf("ajp: packet too large (%d bytes)", len(payload)+4)
+	}
+	header := [4]byte{0x12, 0x34}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readPacket reads one container packet and returns its payload.
+func readPacket(br *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != 'A' || header[1] != 'B' {
+		return nil, fmt.Errorf("ajp: invalid packet magic %x", header[:2])
+	}
+	length := binary.BigEndian.Uint16(header[2:])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, err
+	}
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("ajp: empty packet")
+	}
+	return payload, nil
+}
+
+// packetReader walks a container packet payload.
+type packetReader struct {
+	data []byte
+}
+
+func (p *packetReader) readByte() (byte, error) {
+	if len(p.data) < 1 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := p.data[0]
+	p.data = p.data[1:]
+	return b, nil
+}
+
+func (p *packetReader) readUint16() (uint16, error) {
+	if len(p.data) < 2 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := binary.BigEndian.Uint16(p.data)
+	p.data = p.data[2:]
+	return n, nil
+}
+
+// readString decodes a length-prefixed, NUL-terminated string.
+func (p *packetReader) readString() (string, error) {
+	length, err := p.readUint16()
+	if err != nil {
+		return "", err
+	}
+	if length == 0xFFFF { // null string
+		return "", nil
+	}
+	if len(p.data) < int(length)+1 {
+		return "", io.ErrUnexpectedEOF
+	}
+	s := string(p.data[:length])
+	p.data = p.data[length+1:] // skip the NUL terminator too
+	return s, nil
+}
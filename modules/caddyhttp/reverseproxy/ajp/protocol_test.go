@@ -0,0 +1,321 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ajp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeConn is a net.Conn that records everything written to it;
+// reads are not supported.
+type fakeConn struct {
+	bytes.Buffer
+}
+
+func (fakeConn) Read(p []byte) (int, error)         { return 0, nil }
+func (fakeConn) Close() error                       { return nil }
+func (fakeConn) LocalAddr() net.Addr                { return nil }
+func (fakeConn) RemoteAddr() net.Addr               { return nil }
+func (fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// containerPacket frames payload the way a servlet container would.
+func containerPacket(payload []byte) []byte {
+	pkt := []byte{'A', 'B', 0, 0}
+	binary.BigEndian.PutUint16(pkt[2:], uint16(len(payload)))
+	return append(pkt, payload...)
+}
+
+func TestPacketWriterFraming(t *testing.T) {
+	var pkt packetWriter
+	pkt.writeByte(pktForwardRequest)
+	pkt.writeUint16(0xBEEF)
+	pkt.writeBool(true)
+	pkt.writeString("ab")
+
+	var buf bytes.Buffer
+	if err := pkt.send(&buf); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	want := []byte{
+		0x12, 0x34, // proxy-side magic
+		0x00, 0x09, // payload length
+		pktForwardRequest,
+		0xBE, 0xEF,
+		0x01,       // true
+		0x00, 0x02, // string length
+		'a', 'b', 0x00, // string bytes, NUL-terminated
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("expected packet %x but got %x", want, buf.Bytes())
+	}
+
+	// a payload that cannot fit in one packet must be refused
+	var big packetWriter
+	big.buf.Write(make([]byte, maxPacketSize))
+	if err := big.send(&buf); err == nil {
+		t.Error("expected error sending oversized packet, got none")
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	payload := []byte{pktEndResponse, 1}
+	got, err := readPacket(bufio.NewReader(bytes.NewReader(containerPacket(payload))))
+	if err != nil {
+		t.Fatalf("reading valid packet: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("expected payload %x but got %x", payload, got)
+	}
+
+	for i, bad := range [][]byte{
+		{0x12, 0x34, 0x00, 0x01, 0x05}, // proxy magic instead of container magic
+		containerPacket(nil),           // empty payload
+		{'A', 'B', 0x00, 0x05, 0x05},   // truncated payload
+		{'A', 'B'},                     // truncated header
+	} {
+		if _, err := readPacket(bufio.NewReader(bytes.NewReader(bad))); err == nil {
+			t.Errorf("Test %d: expected error reading malformed packet %x, got none", i, bad)
+		}
+	}
+}
+
+func TestPacketReaderStrings(t *testing.T) {
+	var pkt packetWriter
+	pkt.writeString("hello")
+	pkt.writeUint16(0xFFFF) // null string
+	pr := &packetReader{data: pkt.buf.Bytes()}
+
+	s, err := pr.readString()
+	if err != nil {
+		t.Fatalf("reading string: %v", err)
+	}
+	if s != "hello" {
+		t.Errorf("expected 'hello' but got '%s'", s)
+	}
+	s, err = pr.readString()
+	if err != nil {
+		t.Fatalf("reading null string: %v", err)
+	}
+	if s != "" {
+		t.Errorf("expected empty null string but got '%s'", s)
+	}
+
+	// a length prefix pointing past the end of the payload
+	pr = &packetReader{data: []byte{0x00, 0x10, 'x'}}
+	if _, err := pr.readString(); err == nil {
+		t.Error("expected error reading truncated string, got none")
+	}
+}
+
+func TestForwardRequestEncoding(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/app/page?id=42", nil)
+	req.RemoteAddr = "203.0.113.9:55555"
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("X-Custom", "yes")
+
+	conn := new(fakeConn)
+	c := &client{conn: conn}
+	if err := c.forwardRequest(req, "example.com", "8009"); err != nil {
+		t.Fatalf("forwarding request: %v", err)
+	}
+
+	raw := conn.Bytes()
+	if raw[0] != 0x12 || raw[1] != 0x34 {
+		t.Fatalf("expected proxy magic, got %x", raw[:2])
+	}
+	pr := &packetReader{data: raw[4:]}
+
+	mustByte := func(want byte, what string) {
+		t.Helper()
+		b, err := pr.readByte()
+		if err != nil {
+			t.Fatalf("reading %s: %v", what, err)
+		}
+		if b != want {
+			t.Errorf("expected %s %#x but got %#x", what, want, b)
+		}
+	}
+	mustString := func(want, what string) {
+		t.Helper()
+		s, err := pr.readString()
+		if err != nil {
+			t.Fatalf("reading %s: %v", what, err)
+		}
+		if s != want {
+			t.Errorf("expected %s '%s' but got '%s'", what, want, s)
+		}
+	}
+
+	mustByte(pktForwardRequest, "packet type")
+	mustByte(methodCodes["GET"], "method code")
+	mustString("HTTP/1.1", "protocol")
+	mustString("/app/page", "request path")
+	mustString("203.0.113.9", "remote address")
+	mustString("203.0.113.9", "remote host")
+	mustString("example.com", "server name")
+
+	port, err := pr.readUint16()
+	if err != nil {
+		t.Fatalf("reading port: %v", err)
+	}
+	if port != 8009 {
+		t.Errorf("expected port 8009 but got %d", port)
+	}
+	mustByte(0, "ssl flag")
+
+	numHeaders, err := pr.readUint16()
+	if err != nil {
+		t.Fatalf("reading header count: %v", err)
+	}
+	headers := make(map[string]string)
+	for i := 0; i < int(numHeaders); i++ {
+		code, err := pr.readUint16()
+		if err != nil {
+			t.Fatalf("reading header %d: %v", i, err)
+		}
+		var name string
+		if code>>8 == 0xA0 {
+			// coded common header; find its name in the code table
+			for n, c := range requestHeaderCodes {
+				if c == code {
+					name = n
+				}
+			}
+		} else {
+			// the two bytes were a literal name's length
+			name = string(pr.data[:code])
+			pr.data = pr.data[code+1:]
+		}
+		val, err := pr.readString()
+		if err != nil {
+			t.Fatalf("reading header %d value: %v", i, err)
+		}
+		headers[name] = val
+	}
+	if headers["host"] != "example.com" {
+		t.Errorf("expected host header to be filled in, got headers %v", headers)
+	}
+	if headers["user-agent"] != "test-agent" {
+		t.Errorf("expected coded user-agent header, got headers %v", headers)
+	}
+	if headers["x-custom"] != "yes" {
+		t.Errorf("expected literal x-custom header, got headers %v", headers)
+	}
+
+	mustByte(attrQueryString, "query string attribute")
+	mustString("id=42", "query string")
+	mustByte(attrTerminator, "attribute terminator")
+}
+
+func TestReadResponse(t *testing.T) {
+	// SEND_HEADERS: 200 OK with a coded and a literal header
+	var headersPkt packetWriter
+	headersPkt.writeByte(pktSendHeaders)
+	headersPkt.writeUint16(200)
+	headersPkt.writeString("OK")
+	headersPkt.writeUint16(2)
+	headersPkt.writeUint16(0xA001) // Content-Type
+	headersPkt.writeString("text/html")
+	headersPkt.writeString("X-Powered-By")
+	headersPkt.writeString("servlets")
+
+	var chunk1 packetWriter
+	chunk1.writeByte(pktSendBodyChunk)
+	chunk1.writeUint16(6)
+	chunk1.buf.WriteString("hello ")
+	var chunk2 packetWriter
+	chunk2.writeByte(pktSendBodyChunk)
+	chunk2.writeUint16(5)
+	chunk2.buf.WriteString("world")
+
+	var stream bytes.Buffer
+	stream.Write(containerPacket(headersPkt.buf.Bytes()))
+	stream.Write(containerPacket(chunk1.buf.Bytes()))
+	stream.Write(containerPacket(chunk2.buf.Bytes()))
+	stream.Write(containerPacket([]byte{pktEndResponse, 1}))
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	c := &client{conn: new(fakeConn), br: bufio.NewReader(&stream)}
+	resp, err := c.readResponse(req)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status 200 but got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/html" {
+		t.Errorf("expected decoded Content-Type header, got '%s'", ct)
+	}
+	if xp := resp.Header.Get("X-Powered-By"); xp != "servlets" {
+		t.Errorf("expected literal X-Powered-By header, got '%s'", xp)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response body: %v", err)
+	}
+	if string(body) != "hello world" {
+		t.Errorf("expected body 'hello world' but got '%s'", body)
+	}
+}
+
+func TestReadResponseAnswersBodyChunkRequests(t *testing.T) {
+	// the container asks for request body before responding
+	var headersPkt packetWriter
+	headersPkt.writeByte(pktSendHeaders)
+	headersPkt.writeUint16(204)
+	headersPkt.writeString("")
+	headersPkt.writeUint16(0)
+
+	var stream bytes.Buffer
+	stream.Write(containerPacket([]byte{pktGetBodyChunk, 0x7F, 0xF8}))
+	stream.Write(containerPacket(headersPkt.buf.Bytes()))
+
+	const reqBody = "field=value"
+	req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(reqBody))
+	conn := new(fakeConn)
+	c := &client{conn: conn, br: bufio.NewReader(&stream), reqBody: strings.NewReader(reqBody)}
+	resp, err := c.readResponse(req)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if resp.StatusCode != 204 {
+		t.Errorf("expected status 204 but got %d", resp.StatusCode)
+	}
+	if resp.Status != "204 No Content" {
+		t.Errorf("expected status text to be filled in, got '%s'", resp.Status)
+	}
+
+	// the body chunk sent in reply must carry the request body
+	sent := conn.Bytes()
+	wantChunk := []byte{
+		0x12, 0x34,
+		0x00, byte(2 + len(reqBody)),
+		0x00, byte(len(reqBody)),
+	}
+	wantChunk = append(wantChunk, reqBody...)
+	if !bytes.Equal(sent, wantChunk) {
+		t.Errorf("expected body chunk packet %x but got %x", wantChunk, sent)
+	}
+}
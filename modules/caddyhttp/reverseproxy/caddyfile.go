@@ -73,6 +73,7 @@ func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error)
 //         # streaming
 //         flush_interval <duration>
 //         buffer_requests
+//         decompress_upstream
 //
 //         # header manipulation
 //         header_up   [+|-]<field> [<value|regexp> [<replacement>]]
@@ -482,6 +483,12 @@ func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 				}
 				h.BufferRequests = true
 
+			case "decompress_upstream":
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				h.DecompressUpstream = true
+
 			case "header_up":
 				var err error
 
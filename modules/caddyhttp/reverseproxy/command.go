@@ -21,6 +21,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
@@ -34,13 +35,15 @@ func init() {
 	caddycmd.RegisterCommand(caddycmd.Command{
 		Name:  "reverse-proxy",
 		Func:  cmdReverseProxy,
-		Usage: "[--from <addr>] [--to <addr>] [--change-host-header]",
+		Usage: "[--from <addr>] [--to <addr>] [--change-host-header] [--insecure] [--access-log] [--header-up <field:value>] [--header-down <field:value>]",
 		Short: "A quick and production-ready reverse proxy",
 		Long: `
 A simple but production-ready reverse proxy. Useful for quick deployments,
 demos, and development.
 
 Simply shuttles HTTP(S) traffic from the --from address to the --to address.
+Multiple --to addresses may be specified (or one with addresses separated
+by commas) to load-balance between several upstreams.
 
 Unless otherwise specified in the addresses, the --from address will be
 assumed to be HTTPS if a hostname is given, and the --to address will be
@@ -53,13 +56,22 @@ or port).
 If --change-host-header is set, the Host header on the request will be modified
 from its original incoming value to the address of the upstream. (Otherwise, by
 default, all incoming headers are passed through unmodified.)
+
+If --access-log is set, request logs are emitted for the proxy.
+
+The --header-up and --header-down flags set header fields on the request
+going up to the upstream and on the response coming back down to the
+client, respectively; both may be repeated.
 `,
 		Flags: func() *flag.FlagSet {
 			fs := flag.NewFlagSet("reverse-proxy", flag.ExitOnError)
 			fs.String("from", "localhost", "Address on which to receive traffic")
-			fs.String("to", "", "Upstream address to which to to proxy traffic")
+			fs.Var(new(caddycmd.StringSlice), "to", "Upstream address(es) to which to proxy traffic")
 			fs.Bool("change-host-header", false, "Set upstream Host header to address of upstream")
 			fs.Bool("insecure", false, "Disable TLS verification (WARNING: DISABLES SECURITY, WHY ARE YOU EVEN USING TLS?)")
+			fs.Bool("access-log", false, "Enable the access log")
+			fs.Var(new(caddycmd.StringSlice), "header-up", "Set a request header to send to the upstream (format: \"Field: value\")")
+			fs.Var(new(caddycmd.StringSlice), "header-down", "Set a response header to send back to the client (format: \"Field: value\")")
 			return fs
 		}(),
 	})
@@ -69,14 +81,18 @@ func cmdReverseProxy(fs caddycmd.Flags) (int, error) {
 	caddy.TrapSignals()
 
 	from := fs.String("from")
-	to := fs.String("to")
 	changeHost := fs.Bool("change-host-header")
 	insecure := fs.Bool("insecure")
+	accessLog := fs.Bool("access-log")
 
 	httpPort := strconv.Itoa(caddyhttp.DefaultHTTPPort)
 	httpsPort := strconv.Itoa(caddyhttp.DefaultHTTPSPort)
 
-	if to == "" {
+	var to []string
+	for _, val := range *fs.Lookup("to").Value.(*caddycmd.StringSlice) {
+		to = append(to, strings.Split(val, ",")...)
+	}
+	if len(to) == 0 {
 		return caddy.ExitCodeFailedStartup, fmt.Errorf("--to is required")
 	}
 
@@ -103,33 +119,44 @@ func cmdReverseProxy(fs caddycmd.Flags) (int, error) {
 		}
 	}
 
-	// set up the upstream address; assume missing information from given parts
-	toAddr, err := httpcaddyfile.ParseAddress(to)
-	if err != nil {
-		return caddy.ExitCodeFailedStartup, fmt.Errorf("invalid upstream address %s: %v", to, err)
-	}
-	if toAddr.Path != "" {
-		return caddy.ExitCodeFailedStartup, fmt.Errorf("paths are not allowed: %s", to)
-	}
-	if toAddr.Scheme == "" {
-		if toAddr.Port == httpsPort {
-			toAddr.Scheme = "https"
-		} else {
-			toAddr.Scheme = "http"
+	// set up the upstream addresses; assume missing information from given parts
+	var upstreamPool UpstreamPool
+	var toScheme string
+	for _, toLoc := range to {
+		toAddr, err := httpcaddyfile.ParseAddress(toLoc)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("invalid upstream address %s: %v", toLoc, err)
 		}
-	}
-	if toAddr.Port == "" {
-		if toAddr.Scheme == "http" {
-			toAddr.Port = httpPort
-		} else if toAddr.Scheme == "https" {
-			toAddr.Port = httpsPort
+		if toAddr.Path != "" {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("paths are not allowed: %s", toLoc)
+		}
+		if toAddr.Scheme == "" {
+			if toAddr.Port == httpsPort {
+				toAddr.Scheme = "https"
+			} else {
+				toAddr.Scheme = "http"
+			}
 		}
+		if toScheme == "" {
+			toScheme = toAddr.Scheme
+		} else if toScheme != toAddr.Scheme {
+			return caddy.ExitCodeFailedStartup,
+				fmt.Errorf("upstreams must all use the same scheme: %s differs", toLoc)
+		}
+		if toAddr.Port == "" {
+			if toAddr.Scheme == "http" {
+				toAddr.Port = httpPort
+			} else if toAddr.Scheme == "https" {
+				toAddr.Port = httpsPort
+			}
+		}
+		upstreamPool = append(upstreamPool, &Upstream{Dial: net.JoinHostPort(toAddr.Host, toAddr.Port)})
 	}
 
 	// proceed to build the handler and server
 
 	ht := HTTPTransport{}
-	if toAddr.Scheme == "https" {
+	if toScheme == "https" {
 		ht.TLS = new(TLSConfig)
 		if insecure {
 			ht.TLS.InsecureSkipVerify = true
@@ -138,16 +165,37 @@ func cmdReverseProxy(fs caddycmd.Flags) (int, error) {
 
 	handler := Handler{
 		TransportRaw: caddyconfig.JSONModuleObject(ht, "protocol", "http", nil),
-		Upstreams:    UpstreamPool{{Dial: net.JoinHostPort(toAddr.Host, toAddr.Port)}},
+		Upstreams:    upstreamPool,
 	}
 
+	requestHeaders := make(http.Header)
 	if changeHost {
-		handler.Headers = &headers.Handler{
-			Request: &headers.HeaderOps{
-				Set: http.Header{
-					"Host": []string{"{http.reverse_proxy.upstream.hostport}"},
-				},
-			},
+		requestHeaders.Set("Host", "{http.reverse_proxy.upstream.hostport}")
+	}
+	for _, pair := range *fs.Lookup("header-up").Value.(*caddycmd.StringSlice) {
+		field, value, err := splitHeaderFlag(pair)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, err
+		}
+		requestHeaders.Set(field, value)
+	}
+	responseHeaders := make(http.Header)
+	for _, pair := range *fs.Lookup("header-down").Value.(*caddycmd.StringSlice) {
+		field, value, err := splitHeaderFlag(pair)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, err
+		}
+		responseHeaders.Set(field, value)
+	}
+	if len(requestHeaders) > 0 || len(responseHeaders) > 0 {
+		handler.Headers = new(headers.Handler)
+		if len(requestHeaders) > 0 {
+			handler.Headers.Request = &headers.HeaderOps{Set: requestHeaders}
+		}
+		if len(responseHeaders) > 0 {
+			handler.Headers.Response = &headers.RespHeaderOps{
+				HeaderOps: &headers.HeaderOps{Set: responseHeaders},
+			}
 		}
 	}
 
@@ -168,6 +216,9 @@ func cmdReverseProxy(fs caddycmd.Flags) (int, error) {
 		Routes: caddyhttp.RouteList{route},
 		Listen: []string{":" + fromAddr.Port},
 	}
+	if accessLog {
+		server.Logs = new(caddyhttp.ServerLogConfig)
+	}
 
 	httpApp := caddyhttp.App{
 		Servers: map[string]*caddyhttp.Server{"proxy": server},
@@ -185,7 +236,21 @@ func cmdReverseProxy(fs caddycmd.Flags) (int, error) {
 		return caddy.ExitCodeFailedStartup, err
 	}
 
-	fmt.Printf("Caddy proxying %s -> %s\n", fromAddr.String(), toAddr.String())
+	for _, upstream := range upstreamPool {
+		fmt.Printf("Caddy proxying %s -> %s\n", fromAddr.String(), upstream.Dial)
+	}
+	if len(upstreamPool) > 1 {
+		fmt.Println("Load balancing policy: random")
+	}
 
 	select {}
 }
+
+// splitHeaderFlag splits a "Field: value" flag argument.
+func splitHeaderFlag(pair string) (string, string, error) {
+	parts := strings.SplitN(pair, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", fmt.Errorf("malformed header '%s' (expecting \"Field: value\")", pair)
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
@@ -43,6 +43,8 @@ func init() {
 //         dial_timeout <duration>
 //         read_timeout <duration>
 //         write_timeout <duration>
+//         max_idle_conns <count>
+//         idle_timeout <duration>
 //     }
 //
 func (t *Transport) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
@@ -107,6 +109,26 @@ func (t *Transport) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 				}
 				t.WriteTimeout = caddy.Duration(dur)
 
+			case "max_idle_conns":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				maxIdle, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("bad connection count %s: %v", d.Val(), err)
+				}
+				t.MaxIdleConns = maxIdle
+
+			case "idle_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("bad timeout value %s: %v", d.Val(), err)
+				}
+				t.IdleTimeout = caddy.Duration(dur)
+
 			default:
 				return d.Errf("unrecognized subdirective %s", d.Val())
 			}
@@ -151,6 +173,10 @@ func (t *Transport) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 // with a user's PHP requirements, they can use a manual approach based
 // on the example above to configure it precisely as they need.
 //
+// The default list of files to try can be overridden with the try_files
+// subdirective, the index file can be changed with index, and setting
+// the index to "off" disables the redirect and rewrite routes entirely.
+//
 // If a matcher is specified by the user, for example:
 //
 //     php_fastcgi /subpath localhost:7777
@@ -172,12 +198,16 @@ func parsePHPFastCGI(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error
 	// set the default index file for the try_files rewrites
 	indexFile := "index.php"
 
+	// the list of files to try for the rewrite; empty means
+	// the default list derived from the index file
+	var tryFiles []string
+
 	// if the user specified a matcher token, use that
 	// matcher in a route that wraps both of our routes;
 	// either way, strip the matcher token and pass
 	// the remaining tokens to the unmarshaler so that
 	// we can gain the rest of the reverse_proxy syntax
-	userMatcherSet, err := h.ExtractMatcherSet()
+	userMatcherSets, err := h.ExtractMatcherSet()
 	if err != nil {
 		return nil, err
 	}
@@ -237,6 +267,17 @@ func parsePHPFastCGI(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error
 				}
 				indexFile = args[0]
 
+			case "try_files":
+				args := dispenser.RemainingArgs()
+				dispenser.Delete()
+				for range args {
+					dispenser.Delete()
+				}
+				if len(args) < 1 {
+					return nil, dispenser.ArgErr()
+				}
+				tryFiles = args
+
 			case "resolve_root_symlink":
 				args := dispenser.RemainingArgs()
 				dispenser.Delete()
@@ -318,10 +359,15 @@ func parsePHPFastCGI(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error
 			HandlersRaw:    []json.RawMessage{caddyconfig.JSONModuleObject(redirHandler, "handler", "static_response", nil)},
 		}
 
-		// route to rewrite to PHP index file
+		// route to rewrite to PHP index file; the user can
+		// override the default list with the try_files
+		// subdirective, e.g. to add static file fallbacks
+		if len(tryFiles) == 0 {
+			tryFiles = []string{"{http.request.uri.path}", "{http.request.uri.path}/" + indexFile, indexFile}
+		}
 		rewriteMatcherSet := caddy.ModuleMap{
 			"file": h.JSON(fileserver.MatchFile{
-				TryFiles:  []string{"{http.request.uri.path}", "{http.request.uri.path}/" + indexFile, indexFile},
+				TryFiles:  tryFiles,
 				SplitPath: extensions,
 			}),
 		}
@@ -373,12 +419,12 @@ func parsePHPFastCGI(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error
 
 	// the user's matcher is a prerequisite for ours, so
 	// wrap ours in a subroute and return that
-	if userMatcherSet != nil {
+	if len(userMatcherSets) > 0 {
 		return []httpcaddyfile.ConfigValue{
 			{
 				Class: "route",
 				Value: caddyhttp.Route{
-					MatcherSetsRaw: []caddy.ModuleMap{userMatcherSet},
+					MatcherSetsRaw: userMatcherSets,
 					HandlersRaw:    []json.RawMessage{caddyconfig.JSONModuleObject(subroute, "handler", "subroute", nil)},
 				},
 			},
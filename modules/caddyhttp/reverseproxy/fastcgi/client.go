@@ -43,6 +43,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 // FCGIListenSockFileno describes listen socket file number.
@@ -155,10 +157,6 @@ func (rec *record) read(r io.Reader) (buf []byte, err error) {
 		err = errors.New("fcgi: invalid header version")
 		return
 	}
-	if rec.h.Type == EndRequest {
-		err = io.EOF
-		return
-	}
 	n := int(rec.h.ContentLength) + int(rec.h.PaddingLength)
 	if len(rec.rbuf) < n {
 		rec.rbuf = make([]byte, n)
@@ -166,6 +164,13 @@ func (rec *record) read(r io.Reader) (buf []byte, err error) {
 	if _, err = io.ReadFull(r, rec.rbuf[:n]); err != nil {
 		return
 	}
+	if rec.h.Type == EndRequest {
+		// the request is over; since we consumed the whole
+		// record, the connection is at a record boundary and
+		// may be reused for another request
+		err = io.EOF
+		return
+	}
 	buf = rec.rbuf[:int(rec.h.ContentLength)]
 
 	return
@@ -181,6 +186,35 @@ type FCGIClient struct {
 	stderr    bytes.Buffer
 	keepAlive bool
 	reqID     uint16
+	logger    *zap.Logger
+
+	// set by the transport when connection pooling is enabled;
+	// a completed keep-alive connection goes back into the pool
+	// instead of being closed
+	pool        *connPool
+	poolKey     string
+	reqComplete bool
+}
+
+// handleStderr collects FCGI_STDERR output and logs each complete
+// line at warn level. Scripts commonly use stderr for warnings and
+// notices that are essential when debugging errors, so discarding
+// them would be a disservice.
+func (c *FCGIClient) handleStderr(buf []byte) {
+	c.stderr.Write(buf)
+	if c.logger == nil {
+		return
+	}
+	for {
+		line, err := c.stderr.ReadString('\n')
+		if err != nil {
+			// incomplete line; the buffer is empty now, so put the
+			// partial line back and wait for the rest to arrive
+			c.stderr.WriteString(line)
+			break
+		}
+		c.logger.Warn("stderr from upstream", zap.String("line", strings.TrimRight(line, "\r\n")))
+	}
 }
 
 // DialWithDialerContext connects to the fcgi responder at the specified network address, using custom net.Dialer
@@ -350,11 +384,16 @@ func (w *streamReader) Read(p []byte) (n int, err error) {
 				var buf []byte
 				buf, err = rec.read(w.c.rwc)
 				if err != nil {
+					if err == io.EOF && rec.h.Type == EndRequest {
+						// clean end of request, not a dropped
+						// connection; safe to reuse
+						w.c.reqComplete = true
+					}
 					return
 				}
 				// standard error output
 				if rec.h.Type == Stderr {
-					w.c.stderr.Write(buf)
+					w.c.handleStderr(buf)
 					continue
 				}
 				w.buf = buf
@@ -376,7 +415,12 @@ func (w *streamReader) Read(p []byte) (n int, err error) {
 // Do made the request and returns a io.Reader that translates the data read
 // from fcgi responder out of fcgi packet before returning it.
 func (c *FCGIClient) Do(p map[string]string, req io.Reader) (r io.Reader, err error) {
-	err = c.writeBeginRequest(uint16(Responder), 0)
+	// ask the backend to leave the connection open if we intend to reuse it
+	var flags uint8
+	if c.keepAlive {
+		flags = FCGIKeepConn
+	}
+	err = c.writeBeginRequest(uint16(Responder), flags)
 	if err != nil {
 		return
 	}
@@ -403,7 +447,21 @@ type clientCloser struct {
 	io.Reader
 }
 
-func (f clientCloser) Close() error { return f.rwc.Close() }
+func (f clientCloser) Close() error {
+	// log any trailing stderr output that did not end in a newline
+	if leftover := f.FCGIClient.stderr.String(); leftover != "" && f.FCGIClient.logger != nil {
+		f.FCGIClient.logger.Warn("stderr from upstream", zap.String("line", strings.TrimRight(leftover, "\r\n")))
+		f.FCGIClient.stderr.Reset()
+	}
+	// if the request completed cleanly on a keep-alive connection,
+	// give it back to the pool for reuse instead of closing it
+	if f.FCGIClient.keepAlive && f.FCGIClient.reqComplete && f.FCGIClient.pool != nil {
+		if conn, ok := f.FCGIClient.rwc.(net.Conn); ok && f.FCGIClient.pool.put(f.FCGIClient.poolKey, conn) {
+			return nil
+		}
+	}
+	return f.rwc.Close()
+}
 
 // Request returns a HTTP Response with Header and Body
 // from fcgi responder
@@ -74,8 +74,21 @@ type Transport struct {
 	// The duration used to set a deadline when sending to the FastCGI server.
 	WriteTimeout caddy.Duration `json:"write_timeout,omitempty"`
 
+	// How many idle connections to keep open to each backend for reuse
+	// by later requests, to avoid paying a fresh connect per request.
+	// The FCGI_KEEP_CONN flag is set so that the backend leaves the
+	// connection open; backends that close it anyway simply get a new
+	// connection dialed as usual. Default: no connection reuse.
+	MaxIdleConns int `json:"max_idle_conns,omitempty"`
+
+	// How long a pooled connection may sit idle before it is closed
+	// instead of being reused. Only used when MaxIdleConns is greater
+	// than zero. Default: 30s.
+	IdleTimeout caddy.Duration `json:"idle_timeout,omitempty"`
+
 	serverSoftware string
 	logger         *zap.Logger
+	pool           *connPool
 }
 
 // CaddyModule returns the Caddy module information.
@@ -96,6 +109,20 @@ func (t *Transport) Provision(ctx caddy.Context) error {
 	if mod := caddy.GoModule(); mod.Version != "" {
 		t.serverSoftware += "/" + mod.Version
 	}
+	if t.MaxIdleConns > 0 {
+		if t.IdleTimeout == 0 {
+			t.IdleTimeout = caddy.Duration(30 * time.Second)
+		}
+		t.pool = newConnPool(t.MaxIdleConns, time.Duration(t.IdleTimeout))
+	}
+	return nil
+}
+
+// Cleanup closes any idle connections still held in the pool.
+func (t *Transport) Cleanup() error {
+	if t.pool != nil {
+		t.pool.closeAll()
+	}
 	return nil
 }
 
@@ -127,12 +154,31 @@ func (t Transport) RoundTrip(r *http.Request) (*http.Response, error) {
 		zap.Any("env", env), // TODO: this uses reflection I think
 	)
 
-	fcgiBackend, err := DialContext(ctx, network, address)
-	if err != nil {
-		// TODO: wrap in a special error type if the dial failed, so retries can happen if enabled
-		return nil, fmt.Errorf("dialing backend: %v", err)
+	// reuse an idle connection to this backend if one is pooled
+	var fcgiBackend *FCGIClient
+	poolKey := network + "|" + address
+	if t.pool != nil {
+		if conn := t.pool.get(poolKey); conn != nil {
+			fcgiBackend = &FCGIClient{rwc: conn, reqID: 1}
+		}
 	}
-	// fcgiBackend gets closed when response body is closed (see clientCloser)
+	if fcgiBackend == nil {
+		fcgiBackend, err = DialContext(ctx, network, address)
+		if err != nil {
+			// TODO: wrap in a special error type if the dial failed, so retries can happen if enabled
+			return nil, fmt.Errorf("dialing backend: %v", err)
+		}
+	}
+	if t.pool != nil {
+		fcgiBackend.keepAlive = true
+		fcgiBackend.pool = t.pool
+		fcgiBackend.poolKey = poolKey
+	}
+	// fcgiBackend gets closed when response body is closed (see clientCloser),
+	// or returned to the pool if the request completes cleanly
+
+	// tag stderr output from the script with the request it belongs to
+	fcgiBackend.logger = t.logger.With(zap.Object("request", caddyhttp.LoggableHTTPRequest{Request: r}))
 
 	// read/write timeouts
 	if err := fcgiBackend.SetReadTimeout(time.Duration(t.ReadTimeout)); err != nil {
@@ -369,6 +415,7 @@ var headerNameReplacer = strings.NewReplacer(" ", "_", "-", "_")
 
 // Interface guards
 var (
-	_ caddy.Provisioner = (*Transport)(nil)
-	_ http.RoundTripper = (*Transport)(nil)
+	_ caddy.Provisioner  = (*Transport)(nil)
+	_ caddy.CleanerUpper = (*Transport)(nil)
+	_ http.RoundTripper  = (*Transport)(nil)
 )
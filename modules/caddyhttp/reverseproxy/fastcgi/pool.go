@@ -0,0 +1,101 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fastcgi
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// connPool keeps idle backend connections open for reuse by later
+// requests, keyed by network and address. Connections only go back
+// into the pool after a request completed cleanly at a record
+// boundary, so a pooled connection is always ready for a new
+// BeginRequest.
+type connPool struct {
+	maxIdlePerHost int
+	idleTimeout    time.Duration
+
+	mu     sync.Mutex
+	idle   map[string][]poolConn
+	closed bool
+}
+
+// poolConn is an idle connection together with the time it
+// went idle, so stale connections can be discarded.
+type poolConn struct {
+	conn      net.Conn
+	idleSince time.Time
+}
+
+func newConnPool(maxIdlePerHost int, idleTimeout time.Duration) *connPool {
+	return &connPool{
+		maxIdlePerHost: maxIdlePerHost,
+		idleTimeout:    idleTimeout,
+		idle:           make(map[string][]poolConn),
+	}
+}
+
+// get returns an idle connection for key, or nil if none is
+// available. Connections that have been idle too long are closed
+// and skipped; most recently used connections are preferred, since
+// they are the least likely to have been closed by the backend.
+func (p *connPool) get(key string) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := p.idle[key]
+	for len(conns) > 0 {
+		pc := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		p.idle[key] = conns
+		if time.Since(pc.idleSince) > p.idleTimeout {
+			pc.conn.Close()
+			continue
+		}
+		return pc.conn
+	}
+	return nil
+}
+
+// put returns conn to the pool for reuse. It reports whether the
+// pool kept the connection; if not, the caller must close it.
+func (p *connPool) put(key string, conn net.Conn) bool {
+	// clear any deadlines set for the previous request
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.idle[key]) >= p.maxIdlePerHost {
+		return false
+	}
+	p.idle[key] = append(p.idle[key], poolConn{conn, time.Now()})
+	return true
+}
+
+// closeAll closes all idle connections and prevents any more
+// from being pooled.
+func (p *connPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for key, conns := range p.idle {
+		for _, pc := range conns {
+			pc.conn.Close()
+		}
+		delete(p.idle, key)
+	}
+}
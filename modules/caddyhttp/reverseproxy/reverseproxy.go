@@ -30,9 +30,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp/headers"
+	"github.com/klauspost/compress/gzip"
 	"go.uber.org/zap"
 	"golang.org/x/net/http/httpguts"
 )
@@ -52,6 +54,7 @@ func init() {
 // `{http.reverse_proxy.upstream.hostport}` | The host:port of the upstream
 // `{http.reverse_proxy.upstream.host}` | The host of the upstream
 // `{http.reverse_proxy.upstream.port}` | The port of the upstream
+// `{http.reverse_proxy.upstream.latency}` | How long it took the upstream to respond
 // `{http.reverse_proxy.upstream.requests}` | The approximate current number of requests to the upstream
 // `{http.reverse_proxy.upstream.max_requests}` | The maximum approximate number of requests allowed to the upstream
 // `{http.reverse_proxy.upstream.fails}` | The number of recent failed requests to the upstream
@@ -96,6 +99,16 @@ type Handler struct {
 	// be avoided if at all possible for performance reasons.
 	BufferRequests bool `json:"buffer_requests,omitempty"`
 
+	// If true, gzip- and brotli-compressed responses from the
+	// backend will be transparently decompressed before being
+	// written to the client. This is useful when the client did
+	// not ask for an encoding, or when middleware that operates
+	// on the response body needs the plaintext; re-compression
+	// toward the client can then be handled by the encode
+	// handler. Responses with other (or stacked) encodings are
+	// passed through unchanged.
+	DecompressUpstream bool `json:"decompress_upstream,omitempty"`
+
 	// List of handlers and their associated matchers to evaluate
 	// after successful roundtrips. The first handler that matches
 	// the response from a backend will be invoked. The response
@@ -530,6 +543,11 @@ func (h *Handler) reverseProxy(rw http.ResponseWriter, req *http.Request, di Dia
 	start := time.Now()
 	res, err := h.Transport.RoundTrip(req)
 	duration := time.Since(start)
+
+	// make the upstream latency available for logging
+	repl := req.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	repl.Set("http.reverse_proxy.upstream.latency", duration)
+
 	logger := h.logger.With(
 		zap.String("upstream", di.Upstream.String()),
 		zap.Object("request", caddyhttp.LoggableHTTPRequest{Request: req}),
@@ -611,6 +629,15 @@ func (h *Handler) reverseProxy(rw http.ResponseWriter, req *http.Request, di Dia
 		res.Header.Del(h)
 	}
 
+	// transparently decompress the body, if configured
+	if h.DecompressUpstream {
+		err := decompressResponse(res)
+		if err != nil {
+			return caddyhttp.Error(http.StatusBadGateway,
+				fmt.Errorf("decompressing response from upstream: %v", err))
+		}
+	}
+
 	// apply any response header operations
 	if h.Headers != nil && h.Headers.Response != nil {
 		if h.Headers.Response.Require == nil ||
@@ -762,6 +789,52 @@ func removeConnectionHeaders(h http.Header) {
 	}
 }
 
+// decompressResponse replaces the body of res with a stream that
+// decompresses it, if its Content-Encoding is a supported scheme,
+// and adjusts the response headers to match the plaintext body.
+// Responses with an unsupported encoding, or with multiple stacked
+// encodings, are left untouched.
+func decompressResponse(res *http.Response) error {
+	var decompressor io.Reader
+	switch strings.ToLower(res.Header.Get("Content-Encoding")) {
+	case "gzip":
+		gr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return err
+		}
+		decompressor = gr
+	case "br":
+		decompressor = brotli.NewReader(res.Body)
+	default:
+		return nil
+	}
+	res.Body = decompressedBody{r: decompressor, underlying: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length") // the plaintext length is unknown
+	res.ContentLength = -1
+	res.Uncompressed = true
+	return nil
+}
+
+// decompressedBody streams a decompressed response body while
+// retaining the original body so that it gets closed too, which
+// allows the upstream connection to be reused.
+type decompressedBody struct {
+	r          io.Reader
+	underlying io.ReadCloser
+}
+
+func (db decompressedBody) Read(p []byte) (int, error) {
+	return db.r.Read(p)
+}
+
+func (db decompressedBody) Close() error {
+	if c, ok := db.r.(io.Closer); ok {
+		c.Close()
+	}
+	return db.underlying.Close()
+}
+
 // statusError returns an error value that has a status code.
 func statusError(err error) error {
 	// errors proxying usually mean there is a problem with the upstream(s)
@@ -0,0 +1,74 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uwsgi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A uwsgi packet starts with a 4-byte header: modifier1, the size
+// of the packet body as a little-endian uint16, and modifier2. For
+// proxied HTTP requests both modifiers are 0 and the body is a
+// sequence of <size><key><size><value> pairs, with sizes also
+// little-endian uint16. The raw request body, if any, follows the
+// packet unframed.
+const (
+	// modifier1 value for a standard WSGI request
+	modifierWSGI = 0
+
+	// the packet body size field is a uint16, so the encoded
+	// variables cannot exceed this many bytes
+	maxVarsSize = 65535
+)
+
+// writeRequest encodes env as a uwsgi packet, writes it to w, and
+// streams body (which may be nil) after it.
+func writeRequest(w io.Writer, env map[string]string, body io.Reader) error {
+	var buf bytes.Buffer
+	sizeBuf := make([]byte, 2)
+	for k, v := range env {
+		if len(k) > maxVarsSize || len(v) > maxVarsSize {
+			return fmt.Errorf("uwsgi: variable %s too long", k)
+		}
+		binary.LittleEndian.PutUint16(sizeBuf, uint16(len(k)))
+		buf.Write(sizeBuf)
+		buf.WriteString(k)
+		binary.LittleEndian.PutUint16(sizeBuf, uint16(len(v)))
+		buf.Write(sizeBuf)
+		buf.WriteString(v)
+	}
+	if buf.Len() > maxVarsSize {
+		return fmt.Errorf("uwsgi: encoded variables exceed maximum packet size (%d > %d)", buf.Len(), maxVarsSize)
+	}
+
+	header := [4]byte{modifierWSGI, 0, 0, 0}
+	binary.LittleEndian.PutUint16(header[1:3], uint16(buf.Len()))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if body != nil {
+		if _, err := io.Copy(w, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
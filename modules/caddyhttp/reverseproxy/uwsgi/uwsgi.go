@@ -0,0 +1,232 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uwsgi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/reverseproxy"
+	"go.uber.org/zap"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(Transport{})
+}
+
+// Transport facilitates communication with backends speaking the
+// uwsgi protocol, the native binary protocol of the uWSGI
+// application server. The request is encoded as a single uwsgi
+// packet of CGI-style variables followed by the raw request body;
+// the backend replies with a plain HTTP/1.x response.
+type Transport struct {
+	// Extra environment variables.
+	EnvVars map[string]string `json:"env,omitempty"`
+
+	// The duration used to set a deadline when connecting to an upstream.
+	DialTimeout caddy.Duration `json:"dial_timeout,omitempty"`
+
+	// The duration used to set a deadline when reading from the uwsgi server.
+	ReadTimeout caddy.Duration `json:"read_timeout,omitempty"`
+
+	// The duration used to set a deadline when sending to the uwsgi server.
+	WriteTimeout caddy.Duration `json:"write_timeout,omitempty"`
+
+	serverSoftware string
+	logger         *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (Transport) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.reverse_proxy.transport.uwsgi",
+		New: func() caddy.Module { return new(Transport) },
+	}
+}
+
+// Provision sets up t.
+func (t *Transport) Provision(ctx caddy.Context) error {
+	t.logger = ctx.Logger(t)
+	t.serverSoftware = "Caddy"
+	if mod := caddy.GoModule(); mod.Version != "" {
+		t.serverSoftware += "/" + mod.Version
+	}
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	env, err := t.buildEnv(r)
+	if err != nil {
+		return nil, fmt.Errorf("building environment: %v", err)
+	}
+
+	ctx := r.Context()
+
+	// extract dial information from request (should have been embedded by the reverse proxy)
+	network, address := "tcp", r.URL.Host
+	if dialInfo, ok := reverseproxy.GetDialInfo(ctx); ok {
+		network = dialInfo.Network
+		address = dialInfo.Address
+	}
+
+	t.logger.Debug("roundtrip",
+		zap.Object("request", caddyhttp.LoggableHTTPRequest{Request: r}),
+		zap.String("dial", address),
+	)
+
+	dialer := net.Dialer{Timeout: time.Duration(t.DialTimeout)}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("dialing backend: %v", err)
+	}
+
+	if t.WriteTimeout > 0 {
+		err = conn.SetWriteDeadline(time.Now().Add(time.Duration(t.WriteTimeout)))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("setting write timeout: %v", err)
+		}
+	}
+
+	err = writeRequest(conn, env, r.Body)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sending request to backend: %v", err)
+	}
+
+	if t.ReadTimeout > 0 {
+		err = conn.SetReadDeadline(time.Now().Add(time.Duration(t.ReadTimeout)))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("setting read timeout: %v", err)
+		}
+	}
+
+	// the backend answers with an ordinary HTTP response
+	resp, err := http.ReadResponse(bufio.NewReader(conn), r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading response from backend: %v", err)
+	}
+	resp.Body = bodyCloser{resp.Body, conn}
+
+	return resp, nil
+}
+
+// buildEnv returns a set of CGI environment variables for the request.
+func (t Transport) buildEnv(r *http.Request) (map[string]string, error) {
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+
+	// Separate remote IP and port; more lenient than net.SplitHostPort
+	var ip, port string
+	if idx := strings.LastIndex(r.RemoteAddr, ":"); idx > -1 {
+		ip = r.RemoteAddr[:idx]
+		port = r.RemoteAddr[idx+1:]
+	} else {
+		ip = r.RemoteAddr
+	}
+
+	// Remove [] from IPv6 addresses
+	ip = strings.Replace(ip, "[", "", 1)
+	ip = strings.Replace(ip, "]", "", 1)
+
+	// Get the request URL from context. The context stores the original URL in case
+	// it was changed by a middleware such as rewrite; most WSGI apps want the
+	// original URI, same as with FastCGI.
+	origReq, ok := r.Context().Value(caddyhttp.OriginalRequestCtxKey).(http.Request)
+	if !ok {
+		origReq = *r
+	}
+
+	requestScheme := "http"
+	if r.TLS != nil {
+		requestScheme = "https"
+	}
+
+	reqHost, reqPort, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		// whatever, just assume there was no port
+		reqHost = r.Host
+	}
+
+	env := map[string]string{
+		"REQUEST_METHOD":  r.Method,
+		"REQUEST_URI":     origReq.URL.RequestURI(),
+		"PATH_INFO":       r.URL.Path,
+		"SCRIPT_NAME":     "",
+		"QUERY_STRING":    r.URL.RawQuery,
+		"SERVER_PROTOCOL": r.Proto,
+		"SERVER_NAME":     reqHost,
+		"SERVER_SOFTWARE": t.serverSoftware,
+		"REQUEST_SCHEME":  requestScheme,
+		"REMOTE_ADDR":     ip,
+		"REMOTE_PORT":     port,
+		"CONTENT_LENGTH":  r.Header.Get("Content-Length"),
+		"CONTENT_TYPE":    r.Header.Get("Content-Type"),
+	}
+
+	if reqPort != "" {
+		env["SERVER_PORT"] = reqPort
+	}
+
+	if r.TLS != nil {
+		env["HTTPS"] = "on"
+	}
+
+	// Add env variables from config (with support for placeholders in values)
+	for key, value := range t.EnvVars {
+		env[key] = repl.ReplaceAll(value, "")
+	}
+
+	// Add all HTTP headers to env variables
+	for field, val := range r.Header {
+		header := strings.ToUpper(field)
+		header = headerNameReplacer.Replace(header)
+		env["HTTP_"+header] = strings.Join(val, ", ")
+	}
+	return env, nil
+}
+
+var headerNameReplacer = strings.NewReplacer(" ", "_", "-", "_")
+
+// bodyCloser makes sure closing the response body also closes
+// the backend connection.
+type bodyCloser struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b bodyCloser) Close() error {
+	err := b.ReadCloser.Close()
+	if err2 := b.conn.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner = (*Transport)(nil)
+	_ http.RoundTripper = (*Transport)(nil)
+)
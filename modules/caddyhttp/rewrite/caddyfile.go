@@ -54,12 +54,20 @@ func parseCaddyfileRewrite(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler,
 // parseCaddyfileURI sets up a handler for manipulating (but not "rewriting") the
 // URI from Caddyfile tokens. Syntax:
 //
-//     uri [<matcher>] strip_prefix|strip_suffix|replace <target> [<replacement> [<limit>]]
+//     uri [<matcher>] strip_prefix|strip_suffix|replace|path_regexp <target> [<replacement> [<limit>]]
+//     uri [<matcher>] query sort|-<key>|+<key> <value>|<old-key>><new-key>|<key> <value>
 //
 // If strip_prefix or strip_suffix are used, then <target> will be stripped
 // only if it is the beginning or the end, respectively, of the URI path. If
 // replace is used, then <target> will be replaced with <replacement> across
-// the whole URI, up to <limit> times (or unlimited if unspecified).
+// the whole URI, up to <limit> times (or unlimited if unspecified). If
+// path_regexp is used, then regular expression replacements will be performed
+// on the path portion of the URI (and a limit cannot be set).
+//
+// If query is used, a single query string operation is performed: setting a
+// parameter (overwriting existing values), adding one (+<key>, keeping
+// existing values), deleting one (-<key>), renaming one (<old>><new>), or
+// sorting parameters canonically by key (sort).
 func parseCaddyfileURI(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
 	var rewr Rewrite
 	for h.Next() {
@@ -108,6 +116,43 @@ func parseCaddyfileURI(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, err
 				Replace: replace,
 				Limit:   limInt,
 			})
+		case "path_regexp":
+			if len(args) != 3 {
+				return nil, h.ArgErr()
+			}
+			find, replace := args[1], args[2]
+			rewr.PathRegexp = append(rewr.PathRegexp, &regexReplacer{
+				Find:    find,
+				Replace: replace,
+			})
+		case "query":
+			if rewr.Query == nil {
+				rewr.Query = new(queryOps)
+			}
+			switch {
+			case len(args) == 2 && args[1] == "sort":
+				rewr.Query.Sort = true
+			case len(args) == 2 && strings.HasPrefix(args[1], "-"):
+				rewr.Query.Delete = append(rewr.Query.Delete, args[1][1:])
+			case len(args) == 2 && strings.Contains(args[1], ">"):
+				renamed := strings.SplitN(args[1], ">", 2)
+				if rewr.Query.Rename == nil {
+					rewr.Query.Rename = make(map[string]string)
+				}
+				rewr.Query.Rename[renamed[0]] = renamed[1]
+			case len(args) == 3 && strings.HasPrefix(args[1], "+"):
+				if rewr.Query.Add == nil {
+					rewr.Query.Add = make(map[string]string)
+				}
+				rewr.Query.Add[args[1][1:]] = args[2]
+			case len(args) == 3:
+				if rewr.Query.Set == nil {
+					rewr.Query.Set = make(map[string]string)
+				}
+				rewr.Query.Set[args[1]] = args[2]
+			default:
+				return nil, h.ArgErr()
+			}
 		default:
 			return nil, h.Errf("unrecognized URI manipulation '%s'", args[0])
 		}
@@ -165,8 +210,10 @@ func parseCaddyfileHandlePath(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigVal
 	}
 
 	// make a matcher on the path and everything below it
-	pathMatcher := caddy.ModuleMap{
-		"path": h.JSON(caddyhttp.MatchPath{path}),
+	pathMatcher := []caddy.ModuleMap{
+		{
+			"path": h.JSON(caddyhttp.MatchPath{path}),
+		},
 	}
 
 	// build a route with a rewrite handler to strip the path prefix
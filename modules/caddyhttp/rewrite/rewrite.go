@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -66,6 +68,14 @@ type Rewrite struct {
 	// Performs substring replacements on the URI.
 	URISubstring []replacer `json:"uri_substring,omitempty"`
 
+	// Performs regular expression replacements on the URI path,
+	// with support for capture group references ($1, ${name})
+	// in the replacement string.
+	PathRegexp []*regexReplacer `json:"path_regexp,omitempty"`
+
+	// Performs operations on the query string parameters.
+	Query *queryOps `json:"query,omitempty"`
+
 	logger *zap.Logger
 }
 
@@ -80,6 +90,18 @@ func (Rewrite) CaddyModule() caddy.ModuleInfo {
 // Provision sets up rewr.
 func (rewr *Rewrite) Provision(ctx caddy.Context) error {
 	rewr.logger = ctx.Logger(rewr)
+
+	for i, rep := range rewr.PathRegexp {
+		if rep.Find == "" {
+			return fmt.Errorf("path_regexp replacement %d: find is required", i)
+		}
+		re, err := regexp.Compile(rep.Find)
+		if err != nil {
+			return fmt.Errorf("path_regexp replacement %d: %v", i, err)
+		}
+		rep.re = re
+	}
+
 	return nil
 }
 
@@ -203,6 +225,16 @@ func (rewr Rewrite) rewrite(r *http.Request, repl *caddy.Replacer, logger *zap.L
 		rep.do(r, repl)
 	}
 
+	// regular expression replacements on the path
+	for _, rep := range rewr.PathRegexp {
+		rep.do(r, repl)
+	}
+
+	// query string operations
+	if rewr.Query != nil {
+		rewr.Query.do(r, repl)
+	}
+
 	// update the encoded copy of the URI
 	r.RequestURI = r.URL.RequestURI()
 
@@ -312,5 +344,146 @@ func (rep replacer) do(r *http.Request, repl *caddy.Replacer) bool {
 	return r.URL.Path != oldPath && r.URL.RawQuery != oldQuery
 }
 
+// regexReplacer describes a regular expression replacement
+// on the URI path.
+type regexReplacer struct {
+	// The regular expression to find, in RE2 syntax.
+	Find string `json:"find,omitempty"`
+
+	// The replacement string. Capture group references such as
+	// $1 or ${name} refer to groups in the find pattern; Caddy
+	// placeholders are expanded first.
+	Replace string `json:"replace,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// do performs the replacement on r's path.
+func (rep *regexReplacer) do(r *http.Request, repl *caddy.Replacer) {
+	if rep.Find == "" {
+		return
+	}
+	// expand placeholders before capture group references
+	// so that a placeholder value cannot inject references
+	replace := repl.ReplaceAll(rep.Replace, "")
+	r.URL.Path = rep.re.ReplaceAllString(r.URL.Path, replace)
+}
+
+// queryOps describes the manipulations to perform on the
+// request query string. Operations are applied in this order:
+// rename, set, add, delete, then sort. The order of untouched
+// parameters relative to each other is preserved unless Sort
+// is enabled. Keys and values support placeholders.
+type queryOps struct {
+	// Renames query keys, preserving their values.
+	// Maps old key -> new key.
+	Rename map[string]string `json:"rename,omitempty"`
+
+	// Sets query parameters, overwriting any existing
+	// values for the same key.
+	Set map[string]string `json:"set,omitempty"`
+
+	// Adds query parameters, keeping any existing
+	// values for the same key.
+	Add map[string]string `json:"add,omitempty"`
+
+	// Deletes the named query parameters.
+	Delete []string `json:"delete,omitempty"`
+
+	// Sorts the parameters by key in canonical
+	// (lexicographical) order.
+	Sort bool `json:"sort,omitempty"`
+}
+
+// do performs the query operations on r.
+func (ops queryOps) do(r *http.Request, repl *caddy.Replacer) {
+	pairs := parseQueryPairs(r.URL.RawQuery)
+
+	for from, to := range ops.Rename {
+		from = repl.ReplaceAll(from, "")
+		to = repl.ReplaceAll(to, "")
+		for i := range pairs {
+			if pairs[i].key == from {
+				pairs[i].key = to
+			}
+		}
+	}
+
+	for key, val := range ops.Set {
+		key = repl.ReplaceAll(key, "")
+		val = repl.ReplaceAll(val, "")
+		pairs = deleteQueryKey(pairs, key)
+		pairs = append(pairs, queryPair{key, val})
+	}
+
+	for key, val := range ops.Add {
+		pairs = append(pairs, queryPair{
+			repl.ReplaceAll(key, ""),
+			repl.ReplaceAll(val, ""),
+		})
+	}
+
+	for _, key := range ops.Delete {
+		pairs = deleteQueryKey(pairs, repl.ReplaceAll(key, ""))
+	}
+
+	if ops.Sort {
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return pairs[i].key < pairs[j].key
+		})
+	}
+
+	var sb strings.Builder
+	for i, pair := range pairs {
+		if i > 0 {
+			sb.WriteRune('&')
+		}
+		sb.WriteString(url.QueryEscape(pair.key))
+		sb.WriteRune('=')
+		sb.WriteString(url.QueryEscape(pair.val))
+	}
+	r.URL.RawQuery = sb.String()
+}
+
+// queryPair is a single query string parameter, decoded.
+type queryPair struct{ key, val string }
+
+// parseQueryPairs decodes qs into its parameters, preserving
+// their order and any duplicate keys. Malformed escapes are
+// kept verbatim rather than dropping the parameter.
+func parseQueryPairs(qs string) []queryPair {
+	var pairs []queryPair
+	for _, comp := range strings.Split(qs, "&") {
+		if comp == "" {
+			continue
+		}
+		var pair queryPair
+		if eq := strings.Index(comp, "="); eq >= 0 {
+			pair.key, pair.val = comp[:eq], comp[eq+1:]
+		} else {
+			pair.key = comp
+		}
+		if key, err := url.QueryUnescape(pair.key); err == nil {
+			pair.key = key
+		}
+		if val, err := url.QueryUnescape(pair.val); err == nil {
+			pair.val = val
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// deleteQueryKey removes all pairs having the given key.
+func deleteQueryKey(pairs []queryPair, key string) []queryPair {
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if pair.key != key {
+			kept = append(kept, pair)
+		}
+	}
+	return kept
+}
+
 // Interface guard
 var _ caddyhttp.MiddlewareHandler = (*Rewrite)(nil)
@@ -16,6 +16,7 @@ package rewrite
 
 import (
 	"net/http"
+	"regexp"
 	"testing"
 
 	"github.com/caddyserver/caddy/v2"
@@ -231,6 +232,48 @@ func TestRewrite(t *testing.T) {
 			input:  newRequest(t, "GET", "/foo/findme/bar"),
 			expect: newRequest(t, "GET", "/foo/replaced/bar"),
 		},
+
+		{
+			rule:   Rewrite{PathRegexp: []*regexReplacer{{Find: "/{2,}", Replace: "/", re: regexp.MustCompile("/{2,}")}}},
+			input:  newRequest(t, "GET", "/foo//bar///baz?a=b//c"),
+			expect: newRequest(t, "GET", "/foo/bar/baz?a=b//c"),
+		},
+		{
+			rule:   Rewrite{PathRegexp: []*regexReplacer{{Find: "^/article/([0-9]+)$", Replace: "/posts/$1", re: regexp.MustCompile("^/article/([0-9]+)$")}}},
+			input:  newRequest(t, "GET", "/article/123"),
+			expect: newRequest(t, "GET", "/posts/123"),
+		},
+		{
+			rule:   Rewrite{PathRegexp: []*regexReplacer{{Find: "^/article/([0-9]+)$", Replace: "/posts/$1", re: regexp.MustCompile("^/article/([0-9]+)$")}}},
+			input:  newRequest(t, "GET", "/article/abc"),
+			expect: newRequest(t, "GET", "/article/abc"),
+		},
+
+		{
+			rule:   Rewrite{Query: &queryOps{Set: map[string]string{"a": "c"}}},
+			input:  newRequest(t, "GET", "/?a=b&x=y"),
+			expect: newRequest(t, "GET", "/?x=y&a=c"),
+		},
+		{
+			rule:   Rewrite{Query: &queryOps{Add: map[string]string{"a": "c"}}},
+			input:  newRequest(t, "GET", "/?a=b"),
+			expect: newRequest(t, "GET", "/?a=b&a=c"),
+		},
+		{
+			rule:   Rewrite{Query: &queryOps{Delete: []string{"b"}}},
+			input:  newRequest(t, "GET", "/?a=1&b=2&b=3&c=4"),
+			expect: newRequest(t, "GET", "/?a=1&c=4"),
+		},
+		{
+			rule:   Rewrite{Query: &queryOps{Rename: map[string]string{"b": "z"}}},
+			input:  newRequest(t, "GET", "/?a=1&b=2"),
+			expect: newRequest(t, "GET", "/?a=1&z=2"),
+		},
+		{
+			rule:   Rewrite{Query: &queryOps{Sort: true}},
+			input:  newRequest(t, "GET", "/?c=3&a=1&b=2"),
+			expect: newRequest(t, "GET", "/?a=1&b=2&c=3"),
+		},
 	} {
 		// copy the original input just enough so that we can
 		// compare it after the rewrite to see if it changed
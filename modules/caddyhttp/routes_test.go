@@ -0,0 +1,79 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// recordingHandler appends its name to executed when invoked,
+// then calls the next handler.
+type recordingHandler struct {
+	name     string
+	executed *[]string
+}
+
+func (h recordingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next Handler) error {
+	*h.executed = append(*h.executed, h.name)
+	return next.ServeHTTP(w, r)
+}
+
+func TestRouteGroupMutualExclusion(t *testing.T) {
+	var executed []string
+
+	makeRoute := func(name, group string) Route {
+		route := Route{
+			Group:    group,
+			Handlers: []MiddlewareHandler{recordingHandler{name, &executed}},
+		}
+		route.middleware = []Middleware{
+			func(next Handler) Handler {
+				return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+					return route.Handlers[0].ServeHTTP(w, r, next)
+				})
+			},
+		}
+		return route
+	}
+
+	// all three routes match every request; the first two share
+	// a group, so only the first of them may run
+	routes := RouteList{
+		makeRoute("first", "g1"),
+		makeRoute("second", "g1"),
+		makeRoute("third", ""),
+	}
+
+	handler := routes.Compile(emptyHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := context.WithValue(req.Context(), caddy.ReplacerCtxKey, caddy.NewReplacer())
+	ctx = context.WithValue(ctx, routeGroupCtxKey, make(map[string]struct{}))
+	req = req.WithContext(ctx)
+
+	err := handler.ServeHTTP(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("ServeHTTP: %v", err)
+	}
+
+	if len(executed) != 2 || executed[0] != "first" || executed[1] != "third" {
+		t.Errorf("Expected [first third] to execute, got %v", executed)
+	}
+}
@@ -16,13 +16,16 @@ package caddyhttp
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
@@ -79,6 +82,17 @@ type Server struct {
 	// to indicate the server is working.
 	Routes RouteList `json:"routes,omitempty"`
 
+	// NamedRoutes defines route lists once, with a name, so that
+	// common handler chains can be executed from many places with
+	// the "invoke" handler rather than being duplicated.
+	NamedRoutes map[string]RouteList `json:"named_routes,omitempty"`
+
+	// NamedMatcherSetsRaw defines matcher sets once, with a name,
+	// so that many routes can reference them with the "named"
+	// matcher rather than repeating identical matcher blobs.
+	// Each value has the same structure as a route's "match".
+	NamedMatcherSetsRaw map[string]RawMatcherSets `json:"named_matcher_sets,omitempty"`
+
 	// Errors is how this server will handle errors returned from any
 	// of the handlers in the primary routes. If the primary handler
 	// chain returns an error, the error along with its recommended
@@ -109,6 +123,11 @@ type Server struct {
 	// to a non-null, empty struct.
 	Logs *ServerLogConfig `json:"logs,omitempty"`
 
+	// Enables Prometheus metrics observations for requests handled by
+	// this server. To minimally enable metrics, simply set this to a
+	// non-null, empty struct.
+	Metrics *Metrics `json:"metrics,omitempty"`
+
 	// Enable experimental HTTP/3 support. Note that HTTP/3 is not a
 	// finished standard and has extremely limited client support.
 	// This field is not subject to compatibility promises.
@@ -127,6 +146,8 @@ type Server struct {
 
 	name string
 
+	namedMatcherSets map[string]MatcherSets
+
 	primaryHandlerChain Handler
 	errorHandlerChain   Handler
 	listenerWrappers    []caddy.ListenerWrapper
@@ -161,11 +182,18 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	errLog := s.errorLogger.With(loggableReq)
 
 	var duration time.Duration
+	start := time.Now()
 
 	if s.shouldLogRequest(r) {
 		wrec := NewResponseRecorder(w, nil, nil)
 		w = wrec
 
+		var bodyReader *bodyCounter
+		if s.Logs != nil && s.Logs.logBytesRead && r.Body != nil {
+			bodyReader = &bodyCounter{body: r.Body}
+			r.Body = bodyReader
+		}
+
 		// capture the original version of the request
 		accLog := s.accessLogger.With(loggableReq)
 
@@ -174,6 +202,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			repl.Set("http.response.size", wrec.Size())
 			repl.Set("http.response.duration", duration)
 
+			if s.Logs != nil && !s.Logs.shouldLogResponse(wrec.Status()) {
+				return
+			}
+
 			logger := accLog
 			if s.Logs != nil {
 				logger = s.Logs.wrapLogger(logger, r.Host)
@@ -184,18 +216,20 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				log = logger.Error
 			}
 
-			log("handled request",
+			fields := []zapcore.Field{
 				zap.String("common_log", repl.ReplaceAll(commonLogFormat, commonLogEmptyValue)),
 				zap.Duration("duration", duration),
 				zap.Int("size", wrec.Size()),
 				zap.Int("status", wrec.Status()),
 				zap.Object("resp_headers", LoggableHTTPHeader(wrec.Header())),
-			)
+			}
+			if s.Logs != nil {
+				fields = s.Logs.appendExtraFields(fields, r, wrec, repl, start, bodyReader)
+			}
+			log("handled request", fields...)
 		}()
 	}
 
-	start := time.Now()
-
 	// guarantee ACME HTTP challenges; handle them
 	// separately from any user-defined handlers
 	if s.tlsApp.HandleHTTPChallenge(w, r) {
@@ -426,6 +460,10 @@ func (s *Server) shouldLogRequest(r *http.Request) bool {
 			return false
 		}
 	}
+	if len(s.Logs.skipMatcherSets) > 0 && s.Logs.skipMatcherSets.AnyMatch(r) {
+		// the request matches a skip rule
+		return false
+	}
 	if _, ok := s.Logs.LoggerNames[r.Host]; ok {
 		// this host is mapped to a particular logger name
 		return true
@@ -460,6 +498,191 @@ type ServerLogConfig struct {
 	// If true, requests to any host not appearing in the
 	// LoggerNames (logger_names) map will not be logged.
 	SkipUnmappedHosts bool `json:"skip_unmapped_hosts,omitempty"`
+
+	// Requests matching any of these matcher sets will not be
+	// logged. Useful for silencing health checks or other
+	// high-volume, low-value requests.
+	SkipMatcherSetsRaw RawMatcherSets `json:"skip,omitempty" caddy:"namespace=http.matchers"`
+
+	// Responses with these status codes will not be logged.
+	// A single digit stands for the whole status class; for
+	// example, 2 skips all 2xx responses while 404 skips only
+	// that code. Because the status is not known until the
+	// response is written, this is evaluated at log time.
+	SkipStatuses []int `json:"skip_statuses,omitempty"`
+
+	// Sampling configures sampling of access logs for responses
+	// with status codes below 400. Error responses are always
+	// logged in full, so sampling keeps logs affordable on
+	// high-traffic servers without losing visibility into
+	// failures.
+	Sampling *caddy.LogSampling `json:"sampling,omitempty"`
+
+	// Additional groups of fields to include in access logs:
+	// "tls" (negotiated TLS version, cipher suite, and server
+	// name), "upstream" (resolved upstream address and latency,
+	// populated by reverse_proxy), "timing" (time to first byte,
+	// alongside the usual total duration), and "bytes_read"
+	// (request body bytes consumed).
+	ExtraFields []string `json:"extra_fields,omitempty"`
+
+	skipMatcherSets MatcherSets
+	sampler         *logSampler
+	logTLS          bool
+	logUpstream     bool
+	logTiming       bool
+	logBytesRead    bool
+}
+
+// provision sets up the log configuration.
+func (slc *ServerLogConfig) provision(ctx caddy.Context) error {
+	if slc.SkipMatcherSetsRaw != nil {
+		matcherSets, err := ctx.LoadModule(slc, "SkipMatcherSetsRaw")
+		if err != nil {
+			return fmt.Errorf("loading skip matcher modules: %v", err)
+		}
+		err = slc.skipMatcherSets.FromInterface(matcherSets)
+		if err != nil {
+			return err
+		}
+	}
+	if slc.Sampling != nil {
+		// apply the same defaults as the core log sampler
+		interval := slc.Sampling.Interval
+		if interval == 0 {
+			interval = 1 * time.Second
+		}
+		first := slc.Sampling.First
+		if first == 0 {
+			first = 100
+		}
+		thereafter := slc.Sampling.Thereafter
+		if thereafter == 0 {
+			thereafter = 100
+		}
+		slc.sampler = &logSampler{
+			interval:   interval,
+			first:      first,
+			thereafter: thereafter,
+		}
+	}
+	for _, group := range slc.ExtraFields {
+		switch group {
+		case "tls":
+			slc.logTLS = true
+		case "upstream":
+			slc.logUpstream = true
+		case "timing":
+			slc.logTiming = true
+		case "bytes_read":
+			slc.logBytesRead = true
+		default:
+			return fmt.Errorf("unrecognized extra field group: %s", group)
+		}
+	}
+	return nil
+}
+
+// appendExtraFields appends the opt-in extra field groups for
+// one logged request.
+func (slc *ServerLogConfig) appendExtraFields(fields []zapcore.Field, r *http.Request, wrec ResponseRecorder, repl *caddy.Replacer, start time.Time, bodyReader *bodyCounter) []zapcore.Field {
+	if slc.logTLS && r.TLS != nil {
+		fields = append(fields,
+			zap.String("tls_version", tlsVersionName(r.TLS.Version)),
+			zap.String("tls_cipher", tls.CipherSuiteName(r.TLS.CipherSuite)),
+			zap.String("tls_server_name", r.TLS.ServerName),
+		)
+	}
+	if slc.logUpstream {
+		if hostport, ok := repl.GetString("http.reverse_proxy.upstream.hostport"); ok && hostport != "" {
+			fields = append(fields, zap.String("upstream", hostport))
+		}
+		if latency, ok := repl.Get("http.reverse_proxy.upstream.latency"); ok {
+			if dur, ok := latency.(time.Duration); ok {
+				fields = append(fields, zap.Duration("upstream_latency", dur))
+			}
+		}
+	}
+	if slc.logTiming {
+		if firstWrite := wrec.FirstWriteTime(); !firstWrite.IsZero() {
+			fields = append(fields, zap.Duration("ttfb", firstWrite.Sub(start)))
+		}
+	}
+	if slc.logBytesRead && bodyReader != nil {
+		fields = append(fields, zap.Int64("bytes_read", bodyReader.n))
+	}
+	return fields
+}
+
+// tlsVersionName returns the configuration name of a TLS
+// version number.
+func tlsVersionName(version uint16) string {
+	for name, num := range caddytls.SupportedProtocols {
+		if num == version {
+			return name
+		}
+	}
+	return fmt.Sprintf("%#x", version)
+}
+
+// bodyCounter wraps a request body to count the bytes read
+// from it.
+type bodyCounter struct {
+	body io.ReadCloser
+	n    int64
+}
+
+func (bc *bodyCounter) Read(p []byte) (int, error) {
+	n, err := bc.body.Read(p)
+	bc.n += int64(n)
+	return n, err
+}
+
+func (bc *bodyCounter) Close() error {
+	return bc.body.Close()
+}
+
+// shouldLogResponse returns true if a response with the given
+// status code should be logged, applying the status skip list
+// and, for non-error responses, the sampling policy.
+func (slc *ServerLogConfig) shouldLogResponse(status int) bool {
+	for _, skip := range slc.SkipStatuses {
+		if status == skip || (skip < 10 && status/100 == skip) {
+			return false
+		}
+	}
+	if slc.sampler != nil && status < 400 {
+		return slc.sampler.sample(time.Now())
+	}
+	return true
+}
+
+// logSampler limits log throughput by emitting the first several
+// entries of each interval and then only every nth thereafter,
+// like zap's sampler but applicable to a single decision point.
+type logSampler struct {
+	interval   time.Duration
+	first      int
+	thereafter int
+
+	mu            sync.Mutex
+	intervalStart time.Time
+	seen          int
+}
+
+// sample returns true if an entry observed at now should be kept.
+func (ls *logSampler) sample(now time.Time) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if now.Sub(ls.intervalStart) >= ls.interval {
+		ls.intervalStart = now
+		ls.seen = 0
+	}
+	ls.seen++
+	if ls.seen <= ls.first {
+		return true
+	}
+	return (ls.seen-ls.first)%ls.thereafter == 0
 }
 
 // wrapLogger wraps logger in a logger named according to user preferences for the given host.
@@ -0,0 +1,71 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signedurl
+
+import (
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	httpcaddyfile.RegisterHandlerDirective("signed_url", parseCaddyfile)
+}
+
+// parseCaddyfile unmarshals tokens from h into a new SignedURL.
+// Syntax:
+//
+//     signed_url [<matcher>] <key> {
+//         signature_param <name>
+//         expires_param   <name>
+//         bind_client_ip
+//         status_code     <code>
+//     }
+//
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	s := new(SignedURL)
+
+	for h.Next() {
+		if !h.Args(&s.Key) {
+			return nil, h.ArgErr()
+		}
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "signature_param":
+				if !h.AllArgs(&s.SignatureParam) {
+					return nil, h.ArgErr()
+				}
+			case "expires_param":
+				if !h.AllArgs(&s.ExpiresParam) {
+					return nil, h.ArgErr()
+				}
+			case "bind_client_ip":
+				if h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				s.BindClientIP = true
+			case "status_code":
+				var codeStr string
+				if !h.AllArgs(&codeStr) {
+					return nil, h.ArgErr()
+				}
+				s.StatusCode = caddyhttp.WeakString(codeStr)
+			default:
+				return nil, h.Errf("unrecognized subdirective '%s'", h.Val())
+			}
+		}
+	}
+
+	return s, nil
+}
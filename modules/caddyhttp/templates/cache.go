@@ -0,0 +1,138 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// RenderCache caches rendered template output in memory so that
+// expensive pages -- those with many includes or virtual
+// subrequests -- are not re-rendered on every hit. Entries are
+// evicted when they expire or when the total size cap is reached
+// (least recently used first). The cache belongs to the handler
+// instance, so a config reload starts with an empty cache.
+//
+// Only GET and HEAD requests are cached, and only the status code,
+// Content-Type, and body are replayed; renders that set cookies or
+// other per-visitor headers should not be cached.
+type RenderCache struct {
+	// How long rendered output may be served from memory before
+	// it is rendered anew. Default: 1m.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	// The cache key; evaluated with placeholders, so renders that
+	// vary by more than the default method, host, and URI (for
+	// example, by a query variable or header) can be keyed apart.
+	// Default: `{http.request.method} {http.request.hostport}{http.request.uri}`.
+	Key string `json:"key,omitempty"`
+
+	// The cap on the total bytes of rendered output held in
+	// memory at once. Default: 16 MiB.
+	MaxTotalSize int `json:"max_total_size,omitempty"`
+
+	mu        sync.Mutex
+	entries   map[string]*renderCacheEntry
+	lru       *list.List // of keys; front is most recent
+	totalSize int
+}
+
+// renderCacheEntry is one cached render: the response essentials
+// and when the entry must be rendered anew.
+type renderCacheEntry struct {
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+	elem        *list.Element
+}
+
+const (
+	defaultRenderCacheKey          = "{http.request.method} {http.request.hostport}{http.request.uri}"
+	defaultRenderCacheTTL          = caddy.Duration(time.Minute)
+	defaultRenderCacheMaxTotalSize = 16 << 20
+)
+
+// provision applies default limits and initializes state.
+func (c *RenderCache) provision() {
+	if c.TTL == 0 {
+		c.TTL = defaultRenderCacheTTL
+	}
+	if c.Key == "" {
+		c.Key = defaultRenderCacheKey
+	}
+	if c.MaxTotalSize == 0 {
+		c.MaxTotalSize = defaultRenderCacheMaxTotalSize
+	}
+	c.entries = make(map[string]*renderCacheEntry)
+	c.lru = list.New()
+}
+
+// get returns the cached render for key, if fresh.
+func (c *RenderCache) get(key string) (*renderCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		c.evict(key, entry)
+		return nil, false
+	}
+	c.lru.MoveToFront(entry.elem)
+	return entry, true
+}
+
+// put stores a rendered response under key, evicting the least
+// recently used entries as needed to stay within the size cap.
+func (c *RenderCache) put(key string, status int, contentType string, body []byte) {
+	if len(body) > c.MaxTotalSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, ok := c.entries[key]; ok {
+		c.evict(key, existing)
+	}
+	for c.totalSize+len(body) > c.MaxTotalSize && c.lru.Len() > 0 {
+		oldest := c.lru.Back()
+		oldestKey := oldest.Value.(string)
+		c.evict(oldestKey, c.entries[oldestKey])
+	}
+
+	entry := &renderCacheEntry{
+		status:      status,
+		contentType: contentType,
+		body:        body,
+		expires:     time.Now().Add(time.Duration(c.TTL)),
+	}
+	entry.elem = c.lru.PushFront(key)
+	c.entries[key] = entry
+	c.totalSize += len(body)
+}
+
+// evict removes the entry for key. The caller must hold c.mu.
+func (c *RenderCache) evict(key string, entry *renderCacheEntry) {
+	c.lru.Remove(entry.elem)
+	delete(c.entries, key)
+	c.totalSize -= len(entry.body)
+}
@@ -15,6 +15,9 @@
 package templates
 
 import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
@@ -29,6 +32,15 @@ func init() {
 //         mime <types...>
 //         between <open_delim> <close_delim>
 //         root <path>
+//         max_include_depth <depth>
+//         max_http_includes <count>
+//         execution_timeout <duration>
+//         cache [<ttl>]
+//         markdown {
+//             highlight_theme <style>
+//             unsafe_html <bool>
+//             hard_wraps
+//         }
 //     }
 //
 func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
@@ -50,6 +62,73 @@ func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error)
 				if !h.Args(&t.FileRoot) {
 					return nil, h.ArgErr()
 				}
+			case "max_include_depth":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				depth, err := strconv.Atoi(h.Val())
+				if err != nil {
+					return nil, h.Errf("bad include depth '%s': %v", h.Val(), err)
+				}
+				t.MaxIncludeDepth = depth
+			case "max_http_includes":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				count, err := strconv.Atoi(h.Val())
+				if err != nil {
+					return nil, h.Errf("bad include count '%s': %v", h.Val(), err)
+				}
+				t.MaxHTTPIncludes = count
+			case "execution_timeout":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(h.Val())
+				if err != nil {
+					return nil, h.Errf("bad duration value '%s': %v", h.Val(), err)
+				}
+				t.ExecutionTimeout = caddy.Duration(dur)
+			case "cache":
+				if t.Cache != nil {
+					return nil, h.Err("caching is already configured")
+				}
+				t.Cache = new(RenderCache)
+				if h.NextArg() {
+					ttl, err := caddy.ParseDuration(h.Val())
+					if err != nil {
+						return nil, h.Errf("parsing cache TTL: %v", err)
+					}
+					t.Cache.TTL = caddy.Duration(ttl)
+				}
+			case "markdown":
+				if t.Markdown == nil {
+					t.Markdown = new(MarkdownConfig)
+				}
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "highlight_theme":
+						if !h.Args(&t.Markdown.HighlightTheme) {
+							return nil, h.ArgErr()
+						}
+					case "unsafe_html":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						unsafe, err := strconv.ParseBool(h.Val())
+						if err != nil {
+							return nil, h.Errf("bad boolean value '%s': %v", h.Val(), err)
+						}
+						t.Markdown.UnsafeHTML = &unsafe
+					case "hard_wraps":
+						if h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						t.Markdown.HardWraps = true
+					default:
+						return nil, h.Errf("unrecognized markdown option '%s'", h.Val())
+					}
+				}
 			}
 		}
 	}
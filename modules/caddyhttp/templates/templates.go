@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
@@ -222,6 +223,64 @@ type Templates struct {
 
 	// The template action delimiters.
 	Delimiters []string `json:"delimiters,omitempty"`
+
+	// The maximum nesting depth of the include action, which
+	// prevents templates that include each other in a cycle
+	// from recursing forever. Default: 16.
+	MaxIncludeDepth int `json:"max_include_depth,omitempty"`
+
+	// The maximum number of virtual subrequests (the httpInclude
+	// action) a single render may make. Default: 3.
+	MaxHTTPIncludes int `json:"max_http_includes,omitempty"`
+
+	// How long a template may take to execute before rendering
+	// is aborted with an error. A runaway template cannot be
+	// forcibly stopped, but the request is released so clients
+	// are not left hanging. By default, there is no timeout.
+	ExecutionTimeout caddy.Duration `json:"execution_timeout,omitempty"`
+
+	// Customizes how the markdown template function renders
+	// its input.
+	Markdown *MarkdownConfig `json:"markdown,omitempty"`
+
+	// Caches rendered output in memory so that expensive pages
+	// are not re-rendered on every hit. Disabled by default.
+	Cache *RenderCache `json:"cache,omitempty"`
+
+	// Extra function sets to make available to templates, beyond
+	// the standard ones. Each key selects a module from the
+	// http.handlers.templates.functions namespace, so which sets
+	// are enabled can vary per route.
+	ExtensionsRaw caddy.ModuleMap `json:"extensions,omitempty" caddy:"namespace=http.handlers.templates.functions"`
+
+	customFuncs []template.FuncMap
+}
+
+// MarkdownConfig configures the Markdown renderer used by the
+// markdown template function.
+type MarkdownConfig struct {
+	// The name of a Chroma style to use for highlighting fenced
+	// code blocks; the highlighted code is then styled inline.
+	// If empty, code blocks are only annotated with CSS classes
+	// and it is up to the page to provide a stylesheet.
+	HighlightTheme string `json:"highlight_theme,omitempty"`
+
+	// Whether raw HTML in the Markdown input is passed through
+	// to the output. Enabled by default, since templates should
+	// only render trusted documents anyway; set to false to have
+	// raw HTML escaped instead.
+	UnsafeHTML *bool `json:"unsafe_html,omitempty"`
+
+	// If true, newlines in the input are rendered as hard line
+	// breaks.
+	HardWraps bool `json:"hard_wraps,omitempty"`
+}
+
+// CustomFunctions is the interface for registering custom template functions.
+type CustomFunctions interface {
+	// CustomTemplateFunctions should return the mapping
+	// from custom function names to implementations.
+	CustomTemplateFunctions() template.FuncMap
 }
 
 // CaddyModule returns the Caddy module information.
@@ -234,12 +293,28 @@ func (Templates) CaddyModule() caddy.ModuleInfo {
 
 // Provision provisions t.
 func (t *Templates) Provision(ctx caddy.Context) error {
+	mods, err := ctx.LoadModule(t, "ExtensionsRaw")
+	if err != nil {
+		return fmt.Errorf("loading template extensions: %v", err)
+	}
+	for _, modIface := range mods.(map[string]interface{}) {
+		t.customFuncs = append(t.customFuncs, modIface.(CustomFunctions).CustomTemplateFunctions())
+	}
 	if t.MIMETypes == nil {
 		t.MIMETypes = defaultMIMETypes
 	}
 	if t.FileRoot == "" {
 		t.FileRoot = "{http.vars.root}"
 	}
+	if t.MaxIncludeDepth == 0 {
+		t.MaxIncludeDepth = defaultMaxIncludeDepth
+	}
+	if t.MaxHTTPIncludes == 0 {
+		t.MaxHTTPIncludes = defaultMaxHTTPIncludes
+	}
+	if t.Cache != nil {
+		t.Cache.provision()
+	}
 	return nil
 }
 
@@ -252,6 +327,25 @@ func (t *Templates) Validate() error {
 }
 
 func (t *Templates) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	// replay a cached render, if there is a fresh one
+	var cacheKey string
+	cacheable := t.Cache != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead)
+	if cacheable {
+		repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+		cacheKey = repl.ReplaceAll(t.Cache.Key, "")
+		if entry, ok := t.Cache.get(cacheKey); ok {
+			if entry.contentType != "" {
+				w.Header().Set("Content-Type", entry.contentType)
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(entry.body)))
+			w.WriteHeader(entry.status)
+			if r.Method != http.MethodHead {
+				w.Write(entry.body)
+			}
+			return nil
+		}
+	}
+
 	buf := bufPool.Get().(*bytes.Buffer)
 	buf.Reset()
 	defer bufPool.Put(buf)
@@ -292,6 +386,16 @@ func (t *Templates) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddy
 	// refresh, so disable them until we find a better way to do this
 	rec.Header().Del("Etag")
 
+	if cacheable {
+		status := rec.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		body := make([]byte, buf.Len())
+		copy(body, buf.Bytes())
+		t.Cache.put(cacheKey, status, rec.Header().Get("Content-Type"), body)
+	}
+
 	return rec.WriteResponse()
 }
 
@@ -304,13 +408,14 @@ func (t *Templates) executeTemplate(rr caddyhttp.ResponseRecorder, r *http.Reque
 	}
 
 	ctx := &templateContext{
-		Root:       fs,
-		Req:        r,
-		RespHeader: tplWrappedHeader{rr.Header()},
-		config:     t,
+		Root:             fs,
+		Req:              r,
+		RespHeader:       tplWrappedHeader{rr.Header()},
+		config:           t,
+		httpIncludeCount: new(int),
 	}
 
-	err := ctx.executeTemplateInBuffer(r.URL.Path, rr.Buffer())
+	err := ctx.executeTemplateWithTimeout(r.URL.Path, rr.Buffer())
 	if err != nil {
 		return caddyhttp.Error(http.StatusInternalServerError, err)
 	}
@@ -344,6 +449,11 @@ var defaultMIMETypes = []string{
 	"text/markdown",
 }
 
+const (
+	defaultMaxIncludeDepth = 16
+	defaultMaxHTTPIncludes = 3
+)
+
 // Interface guards
 var (
 	_ caddy.Provisioner           = (*Templates)(nil)
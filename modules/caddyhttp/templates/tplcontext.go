@@ -26,6 +26,7 @@ import (
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/alecthomas/chroma/formatters/html"
@@ -35,6 +36,7 @@ import (
 	highlighting "github.com/yuin/goldmark-highlighting"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	gmhtml "github.com/yuin/goldmark/renderer/html"
 )
 
@@ -46,6 +48,14 @@ type templateContext struct {
 	RespHeader tplWrappedHeader
 
 	config *Templates
+
+	// includeDepth counts the nesting level of the include action;
+	// the struct is copied for each nested include, so this behaves
+	// like a stack depth. httpIncludeCount is shared by all copies
+	// because it bounds the total number of virtual subrequests in
+	// a single render.
+	includeDepth     int
+	httpIncludeCount *int
 }
 
 // OriginalReq returns the original, unmodified, un-rewritten request as
@@ -64,6 +74,11 @@ func (c templateContext) funcInclude(filename string, args ...interface{}) (stri
 		return "", fmt.Errorf("root file system not specified")
 	}
 
+	c.includeDepth++
+	if c.includeDepth > c.config.MaxIncludeDepth {
+		return "", fmt.Errorf("exceeded maximum include depth (%d)", c.config.MaxIncludeDepth)
+	}
+
 	file, err := c.Root.Open(filename)
 	if err != nil {
 		return "", err
@@ -94,6 +109,14 @@ func (c templateContext) funcInclude(filename string, args ...interface{}) (stri
 // are NOT escaped, so you should only include trusted resources.
 // If it is not trusted, be sure to use escaping functions yourself.
 func (c templateContext) funcHTTPInclude(uri string) (string, error) {
+	// bound the total number of virtual requests one render may make
+	if c.httpIncludeCount != nil {
+		*c.httpIncludeCount++
+		if *c.httpIncludeCount > c.config.MaxHTTPIncludes {
+			return "", fmt.Errorf("exceeded maximum number of virtual requests (%d)", c.config.MaxHTTPIncludes)
+		}
+	}
+
 	// prevent virtual request loops by counting how many levels
 	// deep we are; and if we get too deep, return an error
 	recursionCount := 1
@@ -102,7 +125,7 @@ func (c templateContext) funcHTTPInclude(uri string) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("parsing %s: %v", recursionPreventionHeader, err)
 		}
-		if num >= 3 {
+		if num >= c.config.MaxHTTPIncludes {
 			return "", fmt.Errorf("virtual request cycle")
 		}
 		recursionCount = num + 1
@@ -137,6 +160,42 @@ func (c templateContext) funcHTTPInclude(uri string) (string, error) {
 	return buf.String(), nil
 }
 
+// executeTemplateWithTimeout renders like executeTemplateInBuffer,
+// but enforces the configured execution timeout, if there is one.
+// A template that exceeds it cannot actually be stopped -- its
+// goroutine runs to completion -- but the request is released
+// with an error, and the runaway render is given a private buffer
+// so it cannot corrupt the pooled response buffer after we return.
+func (c templateContext) executeTemplateWithTimeout(tplName string, buf *bytes.Buffer) error {
+	if c.config.ExecutionTimeout <= 0 {
+		return c.executeTemplateInBuffer(tplName, buf)
+	}
+
+	tplBuf := new(bytes.Buffer)
+	tplBuf.Write(buf.Bytes())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.executeTemplateInBuffer(tplName, tplBuf)
+	}()
+
+	timeout := time.Duration(c.config.ExecutionTimeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		buf.Reset()
+		_, err = buf.Write(tplBuf.Bytes())
+		return err
+	case <-timer.C:
+		return fmt.Errorf("template execution exceeded timeout of %s", timeout)
+	}
+}
+
 func (c templateContext) executeTemplateInBuffer(tplName string, buf *bytes.Buffer) error {
 	tpl := template.New(tplName)
 	if len(c.config.Delimiters) == 2 {
@@ -145,6 +204,10 @@ func (c templateContext) executeTemplateInBuffer(tplName string, buf *bytes.Buff
 
 	tpl.Funcs(sprigFuncMap)
 
+	for _, funcMap := range c.config.customFuncs {
+		tpl.Funcs(funcMap)
+	}
+
 	tpl.Funcs(template.FuncMap{
 		"include":          c.funcInclude,
 		"httpInclude":      c.funcHTTPInclude,
@@ -243,27 +306,58 @@ func (templateContext) funcStripHTML(s string) string {
 	return buf.String()
 }
 
-// funcMarkdown renders the markdown body as HTML. The resulting
-// HTML is NOT escaped so that it can be rendered as HTML.
-func (templateContext) funcMarkdown(input interface{}) (string, error) {
+// funcMarkdown renders the markdown body as HTML. Any front
+// matter at the beginning of the input is stripped first; use
+// splitFrontMatter to access its fields. The resulting HTML is
+// NOT escaped so that it can be rendered as HTML.
+func (c templateContext) funcMarkdown(input interface{}) (string, error) {
 	inputStr := toString(input)
 
+	// strip any front matter so its delimiters do not end up in
+	// the rendered output; an error here just means the document
+	// did not begin with well-formed front matter after all
+	if meta, body, err := extractFrontMatter(inputStr); err == nil && meta != nil {
+		inputStr = body
+	}
+
+	var mdCfg *MarkdownConfig
+	if c.config != nil {
+		mdCfg = c.config.Markdown
+	}
+
+	// highlight fenced code blocks with the configured theme's
+	// inline styles, or emit bare CSS classes if no theme is set
+	hlOpts := []highlighting.Option{
+		highlighting.WithFormatOptions(
+			html.WithClasses(true),
+		),
+	}
+	if mdCfg != nil && mdCfg.HighlightTheme != "" {
+		hlOpts = []highlighting.Option{
+			highlighting.WithStyle(mdCfg.HighlightTheme),
+		}
+	}
+
+	// raw HTML has historically been passed through, since only
+	// trusted documents should be rendered in the first place
+	var rendererOpts []renderer.Option
+	if mdCfg == nil || mdCfg.UnsafeHTML == nil || *mdCfg.UnsafeHTML {
+		rendererOpts = append(rendererOpts, gmhtml.WithUnsafe())
+	}
+	if mdCfg != nil && mdCfg.HardWraps {
+		rendererOpts = append(rendererOpts, gmhtml.WithHardWraps())
+	}
+
 	md := goldmark.New(
 		goldmark.WithExtensions(
 			extension.GFM,
 			extension.Footnote,
-			highlighting.NewHighlighting(
-				highlighting.WithFormatOptions(
-					html.WithClasses(true),
-				),
-			),
+			highlighting.NewHighlighting(hlOpts...),
 		),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
-		goldmark.WithRendererOptions(
-			gmhtml.WithUnsafe(), // TODO: this is not awesome, maybe should be configurable?
-		),
+		goldmark.WithRendererOptions(rendererOpts...),
 	)
 
 	buf := bufPool.Get().(*bytes.Buffer)
@@ -0,0 +1,472 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+)
+
+func init() {
+	caddy.RegisterModule(AdminTestRequest{})
+
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "test-request",
+		Func:  cmdTestRequest,
+		Usage: "--config <path> [--adapter <name>] [--method <method>] [--host <host>] [--uri <uri>] [--headers <fields>] [--remote <addr>] [--server <name>]",
+		Short: "Shows how a config would route a request",
+		Long: `
+Evaluates a synthetic request against the HTTP routes of the given
+config and prints, as JSON, which routes match, which handlers would
+run, and the request's placeholder values. Nothing is started and no
+connections are made; only request matchers are exercised.
+
+The request is described with --method, --host, --uri, --remote
+(the client address), and --headers, a comma-separated list of
+Field:value pairs. By default all servers are evaluated; use
+--server to restrict the output to one.
+
+The same report is available from a running instance at the
+/test-request admin endpoint, using query parameters of the
+same names (header may be repeated).`,
+		Flags: func() *flag.FlagSet {
+			fs := flag.NewFlagSet("test-request", flag.ExitOnError)
+			fs.String("config", "", "Input configuration file")
+			fs.String("adapter", "", "Name of config adapter")
+			fs.String("method", "GET", "Request method")
+			fs.String("host", "localhost", "Request host")
+			fs.String("uri", "/", "Request URI")
+			fs.String("headers", "", "Request header fields, comma-separated Field:value pairs")
+			fs.String("remote", "127.0.0.1:12345", "Client address")
+			fs.String("server", "", "Only evaluate the named server")
+			return fs
+		}(),
+	})
+}
+
+// activeTraceApp tracks the currently-running HTTP app so the
+// admin endpoint can trace requests against live config.
+var (
+	activeTraceAppMu sync.RWMutex
+	activeTraceApp   *App
+)
+
+func setActiveTraceApp(app *App) {
+	activeTraceAppMu.Lock()
+	activeTraceApp = app
+	activeTraceAppMu.Unlock()
+}
+
+func clearActiveTraceApp(app *App) {
+	activeTraceAppMu.Lock()
+	if activeTraceApp == app {
+		activeTraceApp = nil
+	}
+	activeTraceAppMu.Unlock()
+}
+
+// RequestTrace reports how an HTTP app would handle a request:
+// which routes match, which handlers would run, and the values
+// of the request's placeholders.
+type RequestTrace struct {
+	Method       string            `json:"method"`
+	Host         string            `json:"host"`
+	URI          string            `json:"uri"`
+	Placeholders map[string]string `json:"placeholders"`
+	Servers      []ServerTrace     `json:"servers"`
+}
+
+// ServerTrace is the portion of a request trace for one server.
+type ServerTrace struct {
+	Server string       `json:"server"`
+	Listen []string     `json:"listen,omitempty"`
+	Routes []RouteTrace `json:"routes"`
+}
+
+// RouteTrace describes the evaluation of one route.
+type RouteTrace struct {
+	Matched        bool           `json:"matched"`
+	SkippedByGroup bool           `json:"skipped_by_group,omitempty"`
+	Group          string         `json:"group,omitempty"`
+	Match          RawMatcherSets `json:"match,omitempty"`
+	Handlers       []HandlerTrace `json:"handle,omitempty"`
+	Terminal       bool           `json:"terminal,omitempty"`
+}
+
+// HandlerTrace names a handler that would run; for subroutes,
+// it also contains the traces of the nested routes.
+type HandlerTrace struct {
+	Handler string       `json:"handler"`
+	Routes  []RouteTrace `json:"routes,omitempty"`
+}
+
+// newTraceRequest builds the synthetic request and prepares it
+// with the same context values a real request would have.
+func newTraceRequest(method, host, uri, remote string, hdr http.Header) (*http.Request, *caddy.Replacer, error) {
+	req, err := http.NewRequest(method, "http://"+host+uri, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("building request: %v", err)
+	}
+	for field, vals := range hdr {
+		req.Header[http.CanonicalHeaderKey(field)] = vals
+	}
+	req.RemoteAddr = remote
+	repl := caddy.NewReplacer()
+	req = PrepareRequest(req, repl, nil, nil)
+	return req, repl, nil
+}
+
+// tracer evaluates routes against a prepared request. If ctx is
+// set, matcher sets are provisioned on the fly (for configs that
+// are not running); otherwise routes must already be provisioned.
+type tracer struct {
+	ctx    *caddy.Context
+	req    *http.Request
+	groups map[string]struct{}
+}
+
+// traceRoutes evaluates a route list the way route compilation
+// would execute it: matcher sets are OR'ed, groups are satisfied
+// by the first matching route, and a matching terminal route
+// stops evaluation of the rest of the list.
+func (t *tracer) traceRoutes(routes RouteList) ([]RouteTrace, error) {
+	var traces []RouteTrace
+	for i := range routes {
+		if t.ctx != nil && len(routes[i].MatcherSets) == 0 && len(routes[i].MatcherSetsRaw) > 0 {
+			matchersIface, err := t.ctx.LoadModule(&routes[i], "MatcherSetsRaw")
+			if err != nil {
+				return nil, fmt.Errorf("route %d: loading matchers: %v", i, err)
+			}
+			err = routes[i].MatcherSets.FromInterface(matchersIface)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: %v", i, err)
+			}
+		}
+
+		trace := RouteTrace{
+			Matched: routes[i].MatcherSets.AnyMatch(t.req),
+			Group:   routes[i].Group,
+			Match:   routes[i].MatcherSetsRaw,
+		}
+
+		if trace.Matched && routes[i].Group != "" {
+			if _, ok := t.groups[routes[i].Group]; ok {
+				trace.SkippedByGroup = true
+			} else {
+				t.groups[routes[i].Group] = struct{}{}
+			}
+		}
+
+		if trace.Matched && !trace.SkippedByGroup {
+			handlers, err := t.traceHandlers(routes[i])
+			if err != nil {
+				return nil, fmt.Errorf("route %d: %v", i, err)
+			}
+			trace.Handlers = handlers
+			trace.Terminal = routes[i].Terminal
+		}
+
+		traces = append(traces, trace)
+
+		if trace.Matched && !trace.SkippedByGroup && routes[i].Terminal {
+			break
+		}
+	}
+	return traces, nil
+}
+
+// traceHandlers names the handlers of a matched route and
+// descends into subroutes.
+func (t *tracer) traceHandlers(route Route) ([]HandlerTrace, error) {
+	var traces []HandlerTrace
+
+	// provisioned routes carry the handler instances; otherwise
+	// the handler modules are identified from the raw config
+	if len(route.Handlers) > 0 {
+		for _, handler := range route.Handlers {
+			trace := HandlerTrace{Handler: handlerName(handler)}
+			if sub, ok := handler.(*Subroute); ok {
+				routes, err := t.traceRoutes(sub.Routes)
+				if err != nil {
+					return nil, err
+				}
+				trace.Routes = routes
+			}
+			traces = append(traces, trace)
+		}
+		return traces, nil
+	}
+
+	for _, handlerRaw := range route.HandlersRaw {
+		var probe struct {
+			Handler string `json:"handler"`
+		}
+		if err := json.Unmarshal(handlerRaw, &probe); err != nil {
+			return nil, fmt.Errorf("decoding handler: %v", err)
+		}
+		trace := HandlerTrace{Handler: probe.Handler}
+		if probe.Handler == "subroute" {
+			var sub Subroute
+			if err := json.Unmarshal(handlerRaw, &sub); err != nil {
+				return nil, fmt.Errorf("decoding subroute: %v", err)
+			}
+			routes, err := t.traceRoutes(sub.Routes)
+			if err != nil {
+				return nil, err
+			}
+			trace.Routes = routes
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+// handlerName returns the name of a handler's module.
+func handlerName(handler MiddlewareHandler) string {
+	if mod, ok := handler.(caddy.Module); ok {
+		return strings.TrimPrefix(string(mod.CaddyModule().ID), "http.handlers.")
+	}
+	return fmt.Sprintf("%T", handler)
+}
+
+// tracePlaceholders is the set of placeholders whose values
+// are included in a request trace.
+var tracePlaceholders = []string{
+	"http.request.method",
+	"http.request.scheme",
+	"http.request.host",
+	"http.request.port",
+	"http.request.uri",
+	"http.request.uri.path",
+	"http.request.uri.query",
+	"http.request.remote",
+	"http.request.remote.host",
+	"http.request.remote.port",
+}
+
+// traceRequest evaluates the request against the app's servers
+// (or just the named one) and builds the full report.
+func traceRequest(ctx *caddy.Context, servers map[string]*Server, serverName string, req *http.Request, repl *caddy.Replacer) (*RequestTrace, error) {
+	trace := &RequestTrace{
+		Method:       req.Method,
+		Host:         req.Host,
+		URI:          req.RequestURI,
+		Placeholders: make(map[string]string),
+	}
+	if trace.URI == "" {
+		trace.URI = req.URL.RequestURI()
+	}
+	for _, key := range tracePlaceholders {
+		if val, ok := repl.GetString(key); ok {
+			trace.Placeholders[key] = val
+		}
+	}
+
+	srvNames := make([]string, 0, len(servers))
+	for name := range servers {
+		if serverName != "" && name != serverName {
+			continue
+		}
+		srvNames = append(srvNames, name)
+	}
+	if len(srvNames) == 0 {
+		return nil, fmt.Errorf("no server named '%s'", serverName)
+	}
+	sort.Strings(srvNames)
+
+	for _, name := range srvNames {
+		srv := servers[name]
+		t := &tracer{ctx: ctx, req: req, groups: make(map[string]struct{})}
+		routes, err := t.traceRoutes(srv.Routes)
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %v", name, err)
+		}
+		trace.Servers = append(trace.Servers, ServerTrace{
+			Server: name,
+			Listen: srv.Listen,
+			Routes: routes,
+		})
+	}
+	return trace, nil
+}
+
+func cmdTestRequest(fl caddycmd.Flags) (int, error) {
+	configFlag := fl.String("config")
+	if configFlag == "" {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("input file required (use --config flag)")
+	}
+	input, err := ioutil.ReadFile(configFlag)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("reading input file: %v", err)
+	}
+	if adapterFlag := fl.String("adapter"); adapterFlag != "" {
+		adapter := caddyconfig.GetAdapter(adapterFlag)
+		if adapter == nil {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("unrecognized config adapter: %s", adapterFlag)
+		}
+		input, _, err = adapter.Adapt(input, map[string]interface{}{"filename": configFlag})
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("adapting config: %v", err)
+		}
+	}
+
+	var cfg caddy.Config
+	err = json.Unmarshal(caddy.RemoveMetaFields(input), &cfg)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding config: %v", err)
+	}
+	var app App
+	if appRaw, ok := cfg.AppsRaw["http"]; ok {
+		err = json.Unmarshal(appRaw, &app)
+		if err != nil {
+			return caddy.ExitCodeFailedStartup, fmt.Errorf("decoding http app: %v", err)
+		}
+	}
+
+	hdr := make(http.Header)
+	if headersFlag := fl.String("headers"); headersFlag != "" {
+		for _, pair := range strings.Split(headersFlag, ",") {
+			field, val, err := splitHeaderPair(pair)
+			if err != nil {
+				return caddy.ExitCodeFailedStartup, err
+			}
+			hdr.Add(field, val)
+		}
+	}
+
+	req, repl, err := newTraceRequest(fl.String("method"), fl.String("host"),
+		fl.String("uri"), fl.String("remote"), hdr)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	// a throwaway context to provision the matchers with
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	trace, err := traceRequest(&ctx, app.Servers, fl.String("server"), req, repl)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+
+	result, err := caddyconfig.JSONIndent(trace)
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	fmt.Println(string(result))
+
+	return caddy.ExitCodeSuccess, nil
+}
+
+// splitHeaderPair splits a "Field:value" pair.
+func splitHeaderPair(pair string) (string, string, error) {
+	parts := strings.SplitN(pair, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", fmt.Errorf("malformed header '%s' (expecting Field:value)", pair)
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// AdminTestRequest is a module that traces a synthetic request
+// against the currently-running HTTP app. It is mounted at
+// "/test-request" on the admin API; describe the request with
+// the method, host, uri, remote, and (repeatable) header query
+// parameters, and optionally restrict the report with server.
+type AdminTestRequest struct{}
+
+// CaddyModule returns the Caddy module information.
+func (AdminTestRequest) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.test_request",
+		New: func() caddy.Module { return new(AdminTestRequest) },
+	}
+}
+
+// Routes returns a route for the /test-request endpoint.
+func (a *AdminTestRequest) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{{Pattern: "/test-request", Handler: caddy.AdminHandlerFunc(a.handleTestRequest)}}
+}
+
+func (a *AdminTestRequest) handleTestRequest(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+
+	activeTraceAppMu.RLock()
+	app := activeTraceApp
+	activeTraceAppMu.RUnlock()
+	if app == nil {
+		return caddy.APIError{
+			Code: http.StatusServiceUnavailable,
+			Err:  fmt.Errorf("no http app is running"),
+		}
+	}
+
+	query := r.URL.Query()
+	method := query.Get("method")
+	if method == "" {
+		method = http.MethodGet
+	}
+	host := query.Get("host")
+	if host == "" {
+		host = "localhost"
+	}
+	uri := query.Get("uri")
+	if uri == "" {
+		uri = "/"
+	}
+	remote := query.Get("remote")
+	if remote == "" {
+		remote = "127.0.0.1:12345"
+	}
+	hdr := make(http.Header)
+	for _, pair := range query["header"] {
+		field, val, err := splitHeaderPair(pair)
+		if err != nil {
+			return caddy.APIError{Code: http.StatusBadRequest, Err: err}
+		}
+		hdr.Add(field, val)
+	}
+
+	req, repl, err := newTraceRequest(method, host, uri, remote, hdr)
+	if err != nil {
+		return caddy.APIError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	trace, err := traceRequest(nil, app.Servers, query.Get("server"), req, repl)
+	if err != nil {
+		return caddy.APIError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(trace)
+}
+
+// Interface guard
+var _ caddy.AdminRouter = (*AdminTestRequest)(nil)
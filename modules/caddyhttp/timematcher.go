@@ -0,0 +1,216 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(MatchTime{})
+}
+
+// MatchTime matches requests by the wall-clock time at which they
+// arrive. A request matches if the current time falls within any
+// of the configured windows. This makes it possible to serve
+// maintenance pages, apply stricter policies, or route differently
+// during defined windows without reloading the config.
+type MatchTime struct {
+	// The IANA time zone in which windows are interpreted,
+	// e.g. "America/New_York". Default is the system's local
+	// time zone.
+	Timezone string `json:"timezone,omitempty"`
+
+	// The time windows to match against.
+	Windows []TimeWindow `json:"windows,omitempty"`
+
+	location *time.Location
+}
+
+// TimeWindow is a recurring window of wall-clock time.
+type TimeWindow struct {
+	// Days of the week this window applies to, e.g. "Monday"
+	// or the abbreviated "Mon". An empty list means every day.
+	Days []string `json:"days,omitempty"`
+
+	// The start of the window, inclusive, in 24-hour "HH:MM"
+	// format.
+	Start string `json:"start"`
+
+	// The end of the window, exclusive, in 24-hour "HH:MM"
+	// format. If the end is at or before the start, the window
+	// wraps past midnight into the following day.
+	End string `json:"end"`
+
+	days       map[time.Weekday]bool
+	start, end int // minutes since midnight
+}
+
+// CaddyModule returns the Caddy module information.
+func (MatchTime) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.matchers.time",
+		New: func() caddy.Module { return new(MatchTime) },
+	}
+}
+
+// Provision parses the time zone and windows.
+func (m *MatchTime) Provision(_ caddy.Context) error {
+	m.location = time.Local
+	if m.Timezone != "" {
+		loc, err := time.LoadLocation(m.Timezone)
+		if err != nil {
+			return fmt.Errorf("loading time zone: %v", err)
+		}
+		m.location = loc
+	}
+	if len(m.Windows) == 0 {
+		return fmt.Errorf("at least one time window is required")
+	}
+	for i := range m.Windows {
+		err := m.Windows[i].provision()
+		if err != nil {
+			return fmt.Errorf("window %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (w *TimeWindow) provision() error {
+	var err error
+	w.start, err = parseClock(w.Start)
+	if err != nil {
+		return fmt.Errorf("parsing start: %v", err)
+	}
+	w.end, err = parseClock(w.End)
+	if err != nil {
+		return fmt.Errorf("parsing end: %v", err)
+	}
+	if len(w.Days) > 0 {
+		w.days = make(map[time.Weekday]bool)
+		for _, day := range w.Days {
+			wd, err := parseWeekday(day)
+			if err != nil {
+				return err
+			}
+			w.days[wd] = true
+		}
+	}
+	return nil
+}
+
+// Match returns true if the current time matches m.
+func (m MatchTime) Match(_ *http.Request) bool {
+	return m.matchTime(time.Now())
+}
+
+func (m MatchTime) matchTime(now time.Time) bool {
+	now = now.In(m.location)
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range m.Windows {
+		if w.contains(now.Weekday(), minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns whether the given weekday and minute-of-day
+// fall within w.
+func (w TimeWindow) contains(day time.Weekday, minute int) bool {
+	if w.start < w.end {
+		if minute < w.start || minute >= w.end {
+			return false
+		}
+		return w.dayAllowed(day)
+	}
+	// window wraps past midnight: the portion after the start
+	// belongs to the day the window began, and the portion
+	// before the end belongs to the previous day's window
+	if minute >= w.start {
+		return w.dayAllowed(day)
+	}
+	if minute < w.end {
+		return w.dayAllowed((day + 6) % 7)
+	}
+	return false
+}
+
+func (w TimeWindow) dayAllowed(day time.Weekday) bool {
+	return w.days == nil || w.days[day]
+}
+
+// parseClock parses a 24-hour "HH:MM" string into minutes
+// since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("time must be in 24-hour HH:MM format: %v", err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseWeekday parses a full or abbreviated English day name.
+func parseWeekday(s string) (time.Weekday, error) {
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := wd.String()
+		if strings.EqualFold(s, name) || strings.EqualFold(s, name[:3]) {
+			return wd, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized day of week: %s", s)
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler. Syntax:
+//
+//     time [<timezone>] {
+//         window [<days...>] <start> <end>
+//     }
+//
+func (m *MatchTime) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			m.Timezone = d.Val()
+		}
+		for d.NextBlock(0) {
+			if d.Val() != "window" {
+				return d.Errf("unrecognized subdirective '%s'", d.Val())
+			}
+			args := d.RemainingArgs()
+			if len(args) < 2 {
+				return d.ArgErr()
+			}
+			m.Windows = append(m.Windows, TimeWindow{
+				Days:  args[:len(args)-2],
+				Start: args[len(args)-2],
+				End:   args[len(args)-1],
+			})
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner     = (*MatchTime)(nil)
+	_ RequestMatcher        = (*MatchTime)(nil)
+	_ caddyfile.Unmarshaler = (*MatchTime)(nil)
+)
@@ -0,0 +1,99 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestTimeMatcher(t *testing.T) {
+	for i, tc := range []struct {
+		match  MatchTime
+		now    time.Time // in UTC
+		expect bool
+	}{
+		{
+			match: MatchTime{
+				Timezone: "UTC",
+				Windows:  []TimeWindow{{Start: "09:00", End: "17:00"}},
+			},
+			now:    time.Date(2020, 12, 7, 12, 0, 0, 0, time.UTC), // Monday
+			expect: true,
+		},
+		{
+			match: MatchTime{
+				Timezone: "UTC",
+				Windows:  []TimeWindow{{Start: "09:00", End: "17:00"}},
+			},
+			now:    time.Date(2020, 12, 7, 18, 30, 0, 0, time.UTC),
+			expect: false,
+		},
+		{
+			match: MatchTime{
+				Timezone: "UTC",
+				Windows:  []TimeWindow{{Days: []string{"Sat", "Sunday"}, Start: "00:00", End: "23:59"}},
+			},
+			now:    time.Date(2020, 12, 6, 12, 0, 0, 0, time.UTC), // Sunday
+			expect: true,
+		},
+		{
+			match: MatchTime{
+				Timezone: "UTC",
+				Windows:  []TimeWindow{{Days: []string{"Sat", "Sun"}, Start: "00:00", End: "23:59"}},
+			},
+			now:    time.Date(2020, 12, 7, 12, 0, 0, 0, time.UTC), // Monday
+			expect: false,
+		},
+		{
+			// window wrapping past midnight: Monday 22:00 - Tuesday 02:00
+			match: MatchTime{
+				Timezone: "UTC",
+				Windows:  []TimeWindow{{Days: []string{"Mon"}, Start: "22:00", End: "02:00"}},
+			},
+			now:    time.Date(2020, 12, 8, 1, 0, 0, 0, time.UTC), // Tuesday 01:00
+			expect: true,
+		},
+		{
+			match: MatchTime{
+				Timezone: "UTC",
+				Windows:  []TimeWindow{{Days: []string{"Mon"}, Start: "22:00", End: "02:00"}},
+			},
+			now:    time.Date(2020, 12, 8, 3, 0, 0, 0, time.UTC), // Tuesday 03:00
+			expect: false,
+		},
+		{
+			// timezone offset changes the matching window
+			match: MatchTime{
+				Timezone: "America/New_York",
+				Windows:  []TimeWindow{{Start: "09:00", End: "17:00"}},
+			},
+			now:    time.Date(2020, 12, 7, 15, 0, 0, 0, time.UTC), // 10:00 in New York
+			expect: true,
+		},
+	} {
+		err := tc.match.Provision(caddy.Context{})
+		if err != nil {
+			t.Errorf("Test %d: Provisioning: %v", i, err)
+			continue
+		}
+		actual := tc.match.matchTime(tc.now)
+		if actual != tc.expect {
+			t.Errorf("Test %d: Expected %t, got %t at %v", i, tc.expect, actual, tc.now)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	httpcaddyfile.RegisterHandlerDirective("tracing", parseCaddyfile)
+}
+
+// parseCaddyfile sets up the handler from Caddyfile tokens. Syntax:
+//
+//     tracing [<matcher>] {
+//         service_name <name>
+//         span_name <name>
+//         otlp <endpoint> {
+//             header <field> <value>
+//             timeout <duration>
+//         }
+//     }
+//
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	t := new(Tracing)
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "service_name":
+				if !h.Args(&t.ServiceName) {
+					return nil, h.ArgErr()
+				}
+			case "span_name":
+				if !h.Args(&t.SpanName) {
+					return nil, h.ArgErr()
+				}
+			case "otlp":
+				t.OTLP = new(OTLPConfig)
+				if !h.Args(&t.OTLP.Endpoint) {
+					return nil, h.ArgErr()
+				}
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "header":
+						args := h.RemainingArgs()
+						if len(args) != 2 {
+							return nil, h.ArgErr()
+						}
+						if t.OTLP.Headers == nil {
+							t.OTLP.Headers = make(map[string]string)
+						}
+						t.OTLP.Headers[args[0]] = args[1]
+					case "timeout":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						dur, err := caddy.ParseDuration(h.Val())
+						if err != nil {
+							return nil, h.Errf("bad timeout value '%s': %v", h.Val(), err)
+						}
+						t.OTLP.Timeout = caddy.Duration(dur)
+					default:
+						return nil, h.Errf("unrecognized otlp option '%s'", h.Val())
+					}
+				}
+			default:
+				return nil, h.Errf("unrecognized subdirective '%s'", h.Val())
+			}
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// OTLPConfig configures span export over OTLP/HTTP.
+type OTLPConfig struct {
+	// The base URL of the OTLP/HTTP receiver; spans are POSTed
+	// to its /v1/traces path as JSON.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Extra headers to send with each export request, such as
+	// authentication tokens.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// How long to wait for the receiver to accept an export.
+	// Default: 10s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+}
+
+// span is one completed request span, pending export.
+type span struct {
+	traceID      string
+	spanID       string
+	parentSpanID string
+	name         string
+	start, end   time.Time
+	method       string
+	target       string
+	host         string
+	status       int
+	handlerErr   bool
+}
+
+// export batching tuning
+const (
+	exportInterval = 5 * time.Second
+	exportBatchMax = 512
+)
+
+// otlpExporter buffers spans and ships them to an OTLP/HTTP
+// receiver in batches.
+type otlpExporter struct {
+	cfg         *OTLPConfig
+	serviceName string
+	httpClient  *http.Client
+	spans       chan span
+	done        chan struct{}
+	stopped     chan struct{}
+	logger      *zap.Logger
+}
+
+func newOTLPExporter(cfg *OTLPConfig, serviceName string, logger *zap.Logger) *otlpExporter {
+	timeout := time.Duration(cfg.Timeout)
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	e := &otlpExporter{
+		cfg:         cfg,
+		serviceName: serviceName,
+		httpClient:  &http.Client{Timeout: timeout},
+		spans:       make(chan span, exportBatchMax),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		logger:      logger,
+	}
+	go e.loop()
+	return e
+}
+
+// export enqueues a span; if the exporter is not keeping up,
+// the span is dropped rather than blocking the request.
+func (e *otlpExporter) export(s span) {
+	select {
+	case e.spans <- s:
+	default:
+	}
+}
+
+// stop flushes pending spans and shuts the exporter down.
+func (e *otlpExporter) stop() {
+	close(e.done)
+	<-e.stopped
+}
+
+// loop collects spans and flushes them periodically, when a batch
+// fills up, and once more at shutdown.
+func (e *otlpExporter) loop() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			e.logger.Error("exporting spans", zap.Error(err))
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= exportBatchMax {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			// drain whatever is queued, then flush and exit
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts one batch to the receiver in the OTLP/HTTP JSON format.
+func (e *otlpExporter) send(batch []span) error {
+	spans := make([]interface{}, len(batch))
+	for i, s := range batch {
+		attrs := []interface{}{
+			otlpAttr("http.method", s.method),
+			otlpAttr("http.target", s.target),
+			otlpAttr("http.host", s.host),
+			otlpIntAttr("http.status_code", s.status),
+		}
+		otlpSpan := map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              2, // SPAN_KIND_SERVER
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        attrs,
+		}
+		if s.parentSpanID != "" {
+			otlpSpan["parentSpanId"] = s.parentSpanID
+		}
+		if s.handlerErr || s.status >= 500 {
+			otlpSpan["status"] = map[string]interface{}{"code": 2} // STATUS_CODE_ERROR
+		}
+		spans[i] = otlpSpan
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []interface{}{
+						otlpAttr("service.name", e.serviceName),
+					},
+				},
+				"instrumentationLibrarySpans": []interface{}{
+					map[string]interface{}{
+						"instrumentationLibrary": map[string]interface{}{"name": "caddy"},
+						"spans":                  spans,
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.cfg.Endpoint+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range e.cfg.Headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("receiver returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func otlpAttr(key, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"key":   key,
+		"value": map[string]interface{}{"stringValue": value},
+	}
+}
+
+func otlpIntAttr(key string, value int) map[string]interface{} {
+	return map[string]interface{}{
+		"key":   key,
+		"value": map[string]interface{}{"intValue": strconv.Itoa(value)},
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing implements distributed tracing for HTTP requests.
+// Each request gets a span; trace context from W3C traceparent or
+// B3 headers is honored and propagated to upstreams (reverse_proxy
+// forwards the rewritten headers), spans can be exported over
+// OTLP/HTTP, and the trace and span IDs are made available as the
+// `{http.trace_id}` and `{http.span_id}` placeholders for logs and
+// response headers.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Tracing{})
+}
+
+// Tracing is a middleware that starts a span for each request.
+type Tracing struct {
+	// The service name reported with exported spans.
+	// Default: caddy.
+	ServiceName string `json:"service_name,omitempty"`
+
+	// The name given to request spans. Placeholders are supported.
+	// Default: `{http.request.method}`.
+	SpanName string `json:"span_name,omitempty"`
+
+	// Where to export spans, using the OTLP/HTTP protocol. If
+	// unset, spans are not exported, but trace context is still
+	// created and propagated.
+	OTLP *OTLPConfig `json:"otlp,omitempty"`
+
+	exporter *otlpExporter
+	logger   *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (Tracing) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.tracing",
+		New: func() caddy.Module { return new(Tracing) },
+	}
+}
+
+// Provision sets up the handler.
+func (t *Tracing) Provision(ctx caddy.Context) error {
+	t.logger = ctx.Logger(t)
+	if t.ServiceName == "" {
+		t.ServiceName = "caddy"
+	}
+	if t.SpanName == "" {
+		t.SpanName = "{http.request.method}"
+	}
+	if t.OTLP != nil {
+		if t.OTLP.Endpoint == "" {
+			return fmt.Errorf("an OTLP endpoint is required to export spans")
+		}
+		t.exporter = newOTLPExporter(t.OTLP, t.ServiceName, t.logger)
+	}
+	return nil
+}
+
+// Cleanup stops the span exporter, flushing any pending spans.
+func (t *Tracing) Cleanup() error {
+	if t.exporter != nil {
+		t.exporter.stop()
+	}
+	return nil
+}
+
+func (t Tracing) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+
+	// continue the caller's trace if it sent context, else start one
+	traceID, parentSpanID, b3 := extractTraceContext(r.Header)
+	if traceID == "" {
+		traceID = randomHex(16)
+	}
+	spanID := randomHex(8)
+
+	repl.Set("http.trace_id", traceID)
+	repl.Set("http.span_id", spanID)
+
+	// propagate our span downstream; reverse_proxy copies these
+	// headers to the upstream request
+	r.Header.Set("Traceparent", "00-"+traceID+"-"+spanID+"-01")
+	if b3 {
+		r.Header.Set("X-B3-Traceid", traceID)
+		r.Header.Set("X-B3-Spanid", spanID)
+		if parentSpanID != "" {
+			r.Header.Set("X-B3-Parentspanid", parentSpanID)
+		}
+	}
+
+	if t.exporter == nil {
+		return next.ServeHTTP(w, r)
+	}
+
+	start := time.Now()
+	wrec := caddyhttp.NewResponseRecorder(w, nil, nil)
+	err := next.ServeHTTP(wrec, r)
+	end := time.Now()
+
+	status := wrec.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	t.exporter.export(span{
+		traceID:      traceID,
+		spanID:       spanID,
+		parentSpanID: parentSpanID,
+		name:         repl.ReplaceAll(t.SpanName, "request"),
+		start:        start,
+		end:          end,
+		method:       r.Method,
+		target:       r.RequestURI,
+		host:         r.Host,
+		status:       status,
+		handlerErr:   err != nil,
+	})
+
+	return err
+}
+
+// extractTraceContext reads incoming W3C or B3 trace context from
+// headers, returning the trace ID, the caller's span ID, and
+// whether the caller used B3 headers.
+func extractTraceContext(header http.Header) (traceID, parentSpanID string, b3 bool) {
+	// W3C Trace Context: traceparent = version-traceid-spanid-flags
+	if tp := header.Get("Traceparent"); tp != "" {
+		parts := strings.Split(tp, "-")
+		if len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+			return strings.ToLower(parts[1]), strings.ToLower(parts[2]), false
+		}
+	}
+
+	// B3 multiple headers
+	if tid := header.Get("X-B3-Traceid"); tid != "" {
+		return strings.ToLower(tid), strings.ToLower(header.Get("X-B3-Spanid")), true
+	}
+
+	// B3 single header: b3 = traceid-spanid[-flags[-parentspanid]]
+	if b3Header := header.Get("B3"); b3Header != "" {
+		parts := strings.Split(b3Header, "-")
+		if len(parts) >= 2 {
+			return strings.ToLower(parts[0]), strings.ToLower(parts[1]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// randomHex returns n random bytes in lowercase hex form.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Tracing)(nil)
+	_ caddy.CleanerUpper          = (*Tracing)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Tracing)(nil)
+)
@@ -0,0 +1,111 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(NormalizeURI{})
+}
+
+// NormalizeURI is a middleware which normalizes the request URI
+// path before later routes match against it: duplicate slashes
+// are collapsed, dot segments ("." and "..") are resolved, and
+// the path may optionally be lowercased. It can also reject
+// requests whose escaped path contains percent-encoded path
+// traversal sequences, which are a common way to smuggle paths
+// past naive matchers.
+//
+// Percent decoding of the path itself is performed by the
+// standard library when the request is read; this handler only
+// operates on the decoded form and never re-decodes an encoded
+// slash, so path semantics are preserved.
+//
+// Because handlers run in route order, this middleware should be
+// placed before any routes whose matchers should see the
+// normalized path.
+type NormalizeURI struct {
+	// If true, the path is lowercased. Useful for
+	// case-insensitive matching and file systems.
+	LowercasePath bool `json:"lowercase_path,omitempty"`
+
+	// If true, requests whose escaped path contains a
+	// percent-encoded traversal sequence (such as "%2e%2e"
+	// or "..%2f") are rejected with HTTP 400.
+	RejectEncodedTraversal bool `json:"reject_encoded_traversal,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (NormalizeURI) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.uri_normalize",
+		New: func() caddy.Module { return new(NormalizeURI) },
+	}
+}
+
+func (n NormalizeURI) ServeHTTP(w http.ResponseWriter, r *http.Request, next Handler) error {
+	if n.RejectEncodedTraversal && hasEncodedTraversal(r.URL.EscapedPath()) {
+		return Error(http.StatusBadRequest,
+			fmt.Errorf("encoded traversal sequence in path: %s", r.URL.EscapedPath()))
+	}
+
+	r.URL.Path = normalizePath(r.URL.Path, n.LowercasePath)
+	r.RequestURI = r.URL.RequestURI()
+
+	return next.ServeHTTP(w, r)
+}
+
+// normalizePath collapses duplicate slashes in p, resolves any
+// dot segments, and lowercases it if lowercase is true. A
+// trailing slash is preserved since it is often significant
+// for routing.
+func normalizePath(p string, lowercase bool) string {
+	if p == "" {
+		return p
+	}
+	trailingSlash := strings.HasSuffix(p, "/")
+	p = path.Clean(p)
+	if trailingSlash && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	if lowercase {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+// hasEncodedTraversal reports whether escapedPath contains a
+// percent-encoded path traversal sequence, in any case.
+func hasEncodedTraversal(escapedPath string) bool {
+	lowered := strings.ToLower(escapedPath)
+	for _, seq := range []string{
+		"%2e%2e", "..%2f", "%2f..", "..%5c", "%5c..",
+	} {
+		if strings.Contains(lowered, seq) {
+			return true
+		}
+	}
+	return false
+}
+
+// Interface guard
+var _ MiddlewareHandler = (*NormalizeURI)(nil)
@@ -0,0 +1,63 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyhttp
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	for i, tc := range []struct {
+		input     string
+		lowercase bool
+		expect    string
+	}{
+		{input: "", expect: ""},
+		{input: "/", expect: "/"},
+		{input: "/foo/bar", expect: "/foo/bar"},
+		{input: "/foo//bar///baz", expect: "/foo/bar/baz"},
+		{input: "/foo/./bar", expect: "/foo/bar"},
+		{input: "/foo/../bar", expect: "/bar"},
+		{input: "/../../etc/passwd", expect: "/etc/passwd"},
+		{input: "/foo/bar/", expect: "/foo/bar/"},
+		{input: "/foo//", expect: "/foo/"},
+		{input: "/Foo/BAR", lowercase: true, expect: "/foo/bar"},
+		{input: "/Foo/BAR", expect: "/Foo/BAR"},
+	} {
+		if actual := normalizePath(tc.input, tc.lowercase); actual != tc.expect {
+			t.Errorf("Test %d: normalizePath(%q, %t): expected %q but got %q",
+				i, tc.input, tc.lowercase, tc.expect, actual)
+		}
+	}
+}
+
+func TestHasEncodedTraversal(t *testing.T) {
+	for i, tc := range []struct {
+		input  string
+		expect bool
+	}{
+		{"/foo/bar", false},
+		{"/foo/../bar", false}, // not encoded; resolved by normalization
+		{"/%2e%2e/etc/passwd", true},
+		{"/%2E%2E/etc/passwd", true},
+		{"/foo/..%2fbar", true},
+		{"/foo/%2f..", true},
+		{"/foo/..%5cbar", true},
+		{"/foo%20bar", false},
+	} {
+		if actual := hasEncodedTraversal(tc.input); actual != tc.expect {
+			t.Errorf("Test %d: hasEncodedTraversal(%q): expected %t but got %t",
+				i, tc.input, tc.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package waf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(WAF{})
+}
+
+// WAF is a middleware implementing a rule-based web application
+// firewall. Rules inspect parts of the request (URI, query,
+// headers, body, method) with regular expression operators, in
+// the spirit of ModSecurity SecRules, and either block the
+// request or merely record the match depending on the engine
+// mode. Every match is emitted to a structured audit log.
+//
+// Rule sets converted from ModSecurity-compatible sources (such
+// as the OWASP Core Rule Set) can be loaded from files in this
+// module's native JSON rule format.
+type WAF struct {
+	// Rules to evaluate, in order, for each request.
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Files containing additional rules, each a JSON array
+	// of rule objects. These are appended to the inline rules
+	// at provision time.
+	RuleFiles []string `json:"rule_files,omitempty"`
+
+	// The engine mode: "block" (default) rejects requests that
+	// match a rule; "detect" only logs matches, which is useful
+	// for tuning a new rule set before enforcing it.
+	Mode string `json:"mode,omitempty"`
+
+	// IDs of rules to disable, so that individual rules from a
+	// shared rule set can be excluded without editing the set.
+	ExcludeRules []int `json:"exclude_rules,omitempty"`
+
+	// The HTTP status code for blocked requests. Default: 403.
+	StatusCode caddyhttp.WeakString `json:"status_code,omitempty"`
+
+	// How many bytes of the request body rules may inspect.
+	// Bodies are buffered up to this size and then restored
+	// for later handlers. Default: 1 MiB.
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+
+	rules      []Rule
+	excluded   map[int]bool
+	statusCode int
+	logger     *zap.Logger
+}
+
+// Rule is a single firewall rule.
+type Rule struct {
+	// A unique numeric identifier for the rule, used for
+	// exclusions and audit logging.
+	ID int `json:"id"`
+
+	// The request elements this rule inspects. Supported
+	// targets are "uri", "query", "method", "body", "headers",
+	// or "header:Name" for a single header. Default: "uri".
+	Targets []string `json:"targets,omitempty"`
+
+	// The regular expression the targets are matched against.
+	Pattern string `json:"pattern"`
+
+	// A human-readable description logged with each match.
+	Message string `json:"message,omitempty"`
+
+	// Severity label recorded in the audit log, e.g.
+	// "critical", "warning", "notice".
+	Severity string `json:"severity,omitempty"`
+
+	// If true, a match is logged but never blocks, even when
+	// the engine mode is "block".
+	DetectionOnly bool `json:"detection_only,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// CaddyModule returns the Caddy module information.
+func (WAF) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.waf",
+		New: func() caddy.Module { return new(WAF) },
+	}
+}
+
+// Provision sets up w.
+func (w *WAF) Provision(ctx caddy.Context) error {
+	w.logger = ctx.Logger(w)
+
+	switch w.Mode {
+	case "":
+		w.Mode = "block"
+	case "block", "detect":
+	default:
+		return fmt.Errorf("unrecognized engine mode '%s'", w.Mode)
+	}
+
+	w.statusCode = http.StatusForbidden
+	if w.StatusCode != "" {
+		w.statusCode = w.StatusCode.Int()
+	}
+	if w.MaxBodyBytes == 0 {
+		w.MaxBodyBytes = 1024 * 1024
+	}
+
+	w.excluded = make(map[int]bool)
+	for _, id := range w.ExcludeRules {
+		w.excluded[id] = true
+	}
+
+	w.rules = append(w.rules, w.Rules...)
+	for _, filename := range w.RuleFiles {
+		loaded, err := loadRuleFile(filename)
+		if err != nil {
+			return fmt.Errorf("loading rule file %s: %v", filename, err)
+		}
+		w.rules = append(w.rules, loaded...)
+	}
+
+	seen := make(map[int]bool)
+	for i := range w.rules {
+		rule := &w.rules[i]
+		if rule.Pattern == "" {
+			return fmt.Errorf("rule %d: a pattern is required", rule.ID)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("duplicate rule ID %d", rule.ID)
+		}
+		seen[rule.ID] = true
+		if len(rule.Targets) == 0 {
+			rule.Targets = []string{"uri"}
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %d: compiling pattern: %v", rule.ID, err)
+		}
+		rule.re = re
+	}
+
+	return nil
+}
+
+func (w WAF) ServeHTTP(rw http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	var body []byte
+	if r.Body != nil && w.inspectsBody() {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, w.MaxBodyBytes))
+		if err != nil {
+			return caddyhttp.Error(http.StatusBadRequest, err)
+		}
+		// restore the body for later handlers: replay the inspected
+		// prefix, then continue with whatever remains past the
+		// inspection limit; the original body is closed when the
+		// request is done with it, not before
+		r.Body = inspectedBody{
+			Reader: io.MultiReader(bytes.NewReader(body), r.Body),
+			closer: r.Body,
+		}
+	}
+
+	for i := range w.rules {
+		rule := &w.rules[i]
+		if w.excluded[rule.ID] {
+			continue
+		}
+		target, value, matched := rule.match(r, body)
+		if !matched {
+			continue
+		}
+
+		blocking := w.Mode == "block" && !rule.DetectionOnly
+		w.logger.Warn("rule matched",
+			zap.Int("rule_id", rule.ID),
+			zap.String("message", rule.Message),
+			zap.String("severity", rule.Severity),
+			zap.String("target", target),
+			zap.String("matched_value", value),
+			zap.Bool("blocked", blocking),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("host", r.Host),
+			zap.String("uri", r.RequestURI))
+
+		if blocking {
+			return caddyhttp.Error(w.statusCode, fmt.Errorf("request blocked by firewall rule %d", rule.ID))
+		}
+	}
+
+	return next.ServeHTTP(rw, r)
+}
+
+// match reports whether rule matches r (with the buffered body),
+// returning the target and value that matched.
+func (rule *Rule) match(r *http.Request, body []byte) (target, value string, matched bool) {
+	for _, t := range rule.Targets {
+		var values []string
+		switch {
+		case t == "uri":
+			values = []string{r.RequestURI}
+		case t == "query":
+			values = []string{r.URL.RawQuery}
+		case t == "method":
+			values = []string{r.Method}
+		case t == "body":
+			values = []string{string(body)}
+		case t == "headers":
+			for name, vals := range r.Header {
+				for _, v := range vals {
+					values = append(values, name+": "+v)
+				}
+			}
+		case strings.HasPrefix(t, "header:"):
+			values = r.Header.Values(strings.TrimPrefix(t, "header:"))
+		}
+		for _, v := range values {
+			if rule.re.MatchString(v) {
+				return t, v, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// inspectsBody returns whether any active rule targets the body,
+// so request bodies are only buffered when necessary.
+func (w WAF) inspectsBody() bool {
+	for i := range w.rules {
+		if w.excluded[w.rules[i].ID] {
+			continue
+		}
+		for _, t := range w.rules[i].Targets {
+			if t == "body" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inspectedBody stitches the inspected prefix of a request body
+// back in front of its unread remainder, while Close still
+// reaches the original body.
+type inspectedBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (ib inspectedBody) Close() error { return ib.closer.Close() }
+
+// loadRuleFile reads a JSON array of rules from filename.
+func loadRuleFile(filename string) ([]Rule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []Rule
+	err = json.NewDecoder(f).Decode(&rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*WAF)(nil)
+	_ caddyhttp.MiddlewareHandler = (*WAF)(nil)
+)
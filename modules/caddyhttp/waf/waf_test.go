@@ -0,0 +1,228 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package waf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// serveWAF provisions w, runs req through it, and reports the
+// status code the request would get and whether it reached the
+// next handler. The next handler also captures the request body
+// it sees, so body restoration can be verified.
+func serveWAF(t *testing.T, w *WAF, req *http.Request) (status int, reachedNext bool, nextBody string) {
+	t.Helper()
+	err := w.Provision(caddy.Context{})
+	if err != nil {
+		t.Fatalf("provisioning: %v", err)
+	}
+
+	next := caddyhttp.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) error {
+		reachedNext = true
+		if r.Body != nil {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatalf("reading body in next handler: %v", err)
+			}
+			nextBody = string(body)
+		}
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	err = w.ServeHTTP(rec, req, next)
+	if err != nil {
+		handlerErr, ok := err.(caddyhttp.HandlerError)
+		if !ok {
+			t.Fatalf("expected a HandlerError, got %T: %v", err, err)
+		}
+		return handlerErr.StatusCode, reachedNext, nextBody
+	}
+	return rec.Code, reachedNext, nextBody
+}
+
+func TestWAFModesAndExclusions(t *testing.T) {
+	rule := Rule{ID: 100, Targets: []string{"uri"}, Pattern: `(?i)union\s+select`}
+
+	for i, tc := range []struct {
+		waf        *WAF
+		uri        string
+		wantStatus int
+		wantNext   bool
+	}{
+		// block mode rejects a matching request
+		{
+			waf:        &WAF{Rules: []Rule{rule}},
+			uri:        "/search?q=UNION%20SELECT%201",
+			wantStatus: http.StatusForbidden,
+			wantNext:   false,
+		},
+		// non-matching requests pass through
+		{
+			waf:        &WAF{Rules: []Rule{rule}},
+			uri:        "/search?q=hello",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		// detect mode logs but never blocks
+		{
+			waf:        &WAF{Rules: []Rule{rule}, Mode: "detect"},
+			uri:        "/search?q=UNION%20SELECT%201",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		// a detection-only rule never blocks, even in block mode
+		{
+			waf:        &WAF{Rules: []Rule{{ID: 100, Targets: []string{"uri"}, Pattern: `select`, DetectionOnly: true}}},
+			uri:        "/select",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		// an excluded rule is not evaluated
+		{
+			waf:        &WAF{Rules: []Rule{rule}, ExcludeRules: []int{100}},
+			uri:        "/search?q=UNION%20SELECT%201",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		// a custom status code is honored
+		{
+			waf:        &WAF{Rules: []Rule{rule}, StatusCode: "404"},
+			uri:        "/search?q=UNION%20SELECT%201",
+			wantStatus: http.StatusNotFound,
+			wantNext:   false,
+		},
+	} {
+		req := httptest.NewRequest("GET", tc.uri, nil)
+		req.RequestURI = tc.uri
+		status, reachedNext, _ := serveWAF(t, tc.waf, req)
+		if status != tc.wantStatus {
+			t.Errorf("Test %d: expected status %d but got %d", i, tc.wantStatus, status)
+		}
+		if reachedNext != tc.wantNext {
+			t.Errorf("Test %d: expected reachedNext=%v but got %v", i, tc.wantNext, reachedNext)
+		}
+	}
+}
+
+func TestWAFBodyInspection(t *testing.T) {
+	bodyRule := Rule{ID: 200, Targets: []string{"body"}, Pattern: `<script>`}
+
+	// a matching body is blocked
+	req := httptest.NewRequest("POST", "/submit", strings.NewReader(`name=<script>alert(1)</script>`))
+	status, reachedNext, _ := serveWAF(t, &WAF{Rules: []Rule{bodyRule}}, req)
+	if status != http.StatusForbidden {
+		t.Errorf("expected status 403 for matching body but got %d", status)
+	}
+	if reachedNext {
+		t.Error("expected matching body to be blocked before the next handler")
+	}
+
+	// a clean body is passed through intact
+	const clean = "name=jane&comment=hi"
+	req = httptest.NewRequest("POST", "/submit", strings.NewReader(clean))
+	_, reachedNext, nextBody := serveWAF(t, &WAF{Rules: []Rule{bodyRule}}, req)
+	if !reachedNext {
+		t.Fatal("expected clean body to reach the next handler")
+	}
+	if nextBody != clean {
+		t.Errorf("expected next handler to see body %q but got %q", clean, nextBody)
+	}
+
+	// a body larger than the inspection limit must still reach the
+	// next handler in full, not truncated at MaxBodyBytes
+	large := strings.Repeat("a", 64) + "tail-beyond-the-limit"
+	req = httptest.NewRequest("POST", "/submit", strings.NewReader(large))
+	_, reachedNext, nextBody = serveWAF(t, &WAF{Rules: []Rule{bodyRule}, MaxBodyBytes: 16}, req)
+	if !reachedNext {
+		t.Fatal("expected oversized body to reach the next handler")
+	}
+	if nextBody != large {
+		t.Errorf("next handler saw %d of %d body bytes", len(nextBody), len(large))
+	}
+
+	// without a body-targeting rule, the body is not buffered but
+	// still arrives intact
+	uriRule := Rule{ID: 201, Targets: []string{"uri"}, Pattern: `nomatch`}
+	req = httptest.NewRequest("POST", "/submit", strings.NewReader(clean))
+	_, reachedNext, nextBody = serveWAF(t, &WAF{Rules: []Rule{uriRule}}, req)
+	if !reachedNext || nextBody != clean {
+		t.Errorf("expected untouched body %q to reach the next handler, got %q (reached: %v)", clean, nextBody, reachedNext)
+	}
+}
+
+func TestWAFHeaderTargets(t *testing.T) {
+	for i, tc := range []struct {
+		rule       Rule
+		header     http.Header
+		wantStatus int
+	}{
+		// a single-header target matches only that header
+		{
+			rule:       Rule{ID: 300, Targets: []string{"header:User-Agent"}, Pattern: `(?i)sqlmap`},
+			header:     http.Header{"User-Agent": []string{"sqlmap/1.5"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			rule:       Rule{ID: 300, Targets: []string{"header:User-Agent"}, Pattern: `(?i)sqlmap`},
+			header:     http.Header{"User-Agent": []string{"Mozilla/5.0"}, "X-Tool": []string{"sqlmap"}},
+			wantStatus: http.StatusOK,
+		},
+		// the headers target matches any header, by name or value
+		{
+			rule:       Rule{ID: 301, Targets: []string{"headers"}, Pattern: `sqlmap`},
+			header:     http.Header{"User-Agent": []string{"Mozilla/5.0"}, "X-Tool": []string{"sqlmap"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			rule:       Rule{ID: 301, Targets: []string{"headers"}, Pattern: `sqlmap`},
+			header:     http.Header{"User-Agent": []string{"Mozilla/5.0"}},
+			wantStatus: http.StatusOK,
+		},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		for field, vals := range tc.header {
+			for _, val := range vals {
+				req.Header.Add(field, val)
+			}
+		}
+		status, _, _ := serveWAF(t, &WAF{Rules: []Rule{tc.rule}}, req)
+		if status != tc.wantStatus {
+			t.Errorf("Test %d: expected status %d but got %d", i, tc.wantStatus, status)
+		}
+	}
+}
+
+func TestWAFProvisionErrors(t *testing.T) {
+	for i, waf := range []*WAF{
+		{Mode: "bogus"},
+		{Rules: []Rule{{ID: 1}}}, // missing pattern
+		{Rules: []Rule{{ID: 1, Pattern: `a`}, {ID: 1, Pattern: `b`}}},            // duplicate ID
+		{Rules: []Rule{{ID: 1, Pattern: `(`}}},                                   // bad regexp
+		{RuleFiles: []string{"testdata/does-not-exist.json"}},                    // missing rule file
+		{Rules: []Rule{{ID: 1, Pattern: `a`}}, ExcludeRules: nil, Mode: "BLOCK"}, // mode is case-sensitive
+	} {
+		if err := waf.Provision(caddy.Context{}); err == nil {
+			t.Errorf("Test %d: expected provision error but got none", i)
+		}
+	}
+}
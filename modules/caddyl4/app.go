@@ -0,0 +1,356 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caddyl4 implements a layer 4 (TCP/UDP) app for Caddy. It
+// accepts raw socket connections, matches them by inspecting the
+// first bytes of the stream (TLS ClientHello, HTTP request, SSH
+// banner, or arbitrary prefixes), and hands matching connections to
+// handlers such as a raw proxy. This makes it possible to multiplex
+// several protocols on one port -- for example, passing certain TLS
+// server names through on port 443 while the HTTP app terminates
+// the rest.
+package caddyl4
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(App{})
+}
+
+// App is a layer 4 proxy that routes raw TCP and UDP connections.
+type App struct {
+	// The set of servers, keyed by arbitrary names chosen
+	// at your discretion for your own convenience.
+	Servers map[string]*Server `json:"servers,omitempty"`
+
+	listeners   []net.Listener
+	packetConns []net.PacketConn
+	logger      *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (App) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "layer4",
+		New: func() caddy.Module { return new(App) },
+	}
+}
+
+// Provision sets up the app.
+func (a *App) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger(a)
+	for name, srv := range a.Servers {
+		srv.name = name
+		srv.logger = a.logger.Named(name)
+		if srv.MatchingTimeout == 0 {
+			srv.MatchingTimeout = caddy.Duration(defaultMatchingTimeout)
+		}
+		err := srv.Routes.Provision(ctx)
+		if err != nil {
+			return fmt.Errorf("server '%s': setting up routes: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Start starts the app.
+func (a *App) Start() error {
+	for _, srv := range a.Servers {
+		for _, addr := range srv.Listen {
+			listenAddr, err := caddy.ParseNetworkAddress(addr)
+			if err != nil {
+				return fmt.Errorf("%s: parsing listen address '%s': %v", srv.name, addr, err)
+			}
+			for portOffset := uint(0); portOffset < listenAddr.PortRangeSize(); portOffset++ {
+				hostport := listenAddr.JoinHostPort(portOffset)
+
+				if isUDPNetwork(listenAddr.Network) {
+					pc, err := caddy.ListenPacket(listenAddr.Network, hostport)
+					if err != nil {
+						return fmt.Errorf("%s: listening on %s: %v", srv.name, hostport, err)
+					}
+					a.packetConns = append(a.packetConns, pc)
+					go srv.servePacket(pc)
+					continue
+				}
+
+				ln, err := caddy.Listen(listenAddr.Network, hostport)
+				if err != nil {
+					return fmt.Errorf("%s: listening on %s: %v", srv.name, hostport, err)
+				}
+				a.listeners = append(a.listeners, ln)
+				go srv.serve(ln)
+			}
+		}
+	}
+	return nil
+}
+
+// Stop stops the app.
+func (a *App) Stop() error {
+	for _, ln := range a.listeners {
+		err := ln.Close()
+		if err != nil {
+			a.logger.Error("closing listener",
+				zap.String("address", ln.Addr().String()),
+				zap.Error(err))
+		}
+	}
+	for _, pc := range a.packetConns {
+		err := pc.Close()
+		if err != nil {
+			a.logger.Error("closing packet listener",
+				zap.String("address", pc.LocalAddr().String()),
+				zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func isUDPNetwork(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+// Server represents a set of listeners and the routes
+// that connections accepted on them flow through.
+type Server struct {
+	// Socket addresses to which to bind listeners. Accepts network
+	// addresses that may include ports and port ranges, for example:
+	// `tcp/0.0.0.0:8443` or `udp/127.0.0.1:5353`.
+	Listen []string `json:"listen,omitempty"`
+
+	// The list of connection routes. The first route whose
+	// matchers all pass handles the connection.
+	Routes RouteList `json:"routes,omitempty"`
+
+	// How long to allow matchers to inspect a connection before
+	// giving up on finding a matching route. Default: 3s.
+	MatchingTimeout caddy.Duration `json:"matching_timeout,omitempty"`
+
+	name   string
+	logger *zap.Logger
+}
+
+const (
+	defaultMatchingTimeout = 3 * time.Second
+
+	// how long a UDP session may go without traffic
+	// before its resources are released
+	udpSessionIdleTimeout = 30 * time.Second
+)
+
+// serve accepts stream connections until the listener is closed.
+// Transient accept errors (like running out of file descriptors)
+// are retried with exponential backoff, as net/http does, so one
+// hiccup does not kill the listener until the next config reload.
+func (s *Server) serve(ln net.Listener) {
+	var tempDelay time.Duration // how long to sleep on accept failure
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				s.logger.Error("accept error; retrying",
+					zap.Duration("retry_in", tempDelay),
+					zap.Error(err))
+				time.Sleep(tempDelay)
+				continue
+			}
+			return
+		}
+		tempDelay = 0
+		go s.handle(conn)
+	}
+}
+
+// handle routes one accepted connection.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	cx := newConnection(conn)
+
+	start := time.Now()
+	err := s.Routes.handle(cx, time.Duration(s.MatchingTimeout))
+	duration := time.Since(start)
+
+	if err != nil {
+		s.logger.Error("handling connection",
+			zap.String("remote", conn.RemoteAddr().String()),
+			zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("connection stats",
+		zap.String("remote", conn.RemoteAddr().String()),
+		zap.Uint64("read", cx.bytesRead),
+		zap.Uint64("written", cx.bytesWritten),
+		zap.Duration("duration", duration))
+}
+
+// servePacket reads packets from pc and demultiplexes them into
+// per-remote sessions, each of which is handled like a stream
+// connection so the same matchers and handlers apply.
+func (s *Server) servePacket(pc net.PacketConn) {
+	sessions := make(map[string]*packetSession)
+	var sessionsMu sync.Mutex
+
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			sessionsMu.Lock()
+			for _, sess := range sessions {
+				close(sess.in)
+			}
+			sessions = make(map[string]*packetSession)
+			sessionsMu.Unlock()
+			return
+		}
+
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+
+		key := addr.String()
+		sessionsMu.Lock()
+		sess, ok := sessions[key]
+		if !ok {
+			sess = &packetSession{
+				pc:     pc,
+				remote: addr,
+				in:     make(chan []byte, 16),
+				done: func() {
+					sessionsMu.Lock()
+					delete(sessions, key)
+					sessionsMu.Unlock()
+				},
+			}
+			sessions[key] = sess
+			go s.handle(sess)
+		}
+		sessionsMu.Unlock()
+
+		select {
+		case sess.in <- packet:
+		default:
+			// session is not keeping up; drop the packet
+		}
+	}
+}
+
+// packetSession adapts the flow of UDP packets from a single remote
+// address into a net.Conn.
+type packetSession struct {
+	pc           net.PacketConn
+	remote       net.Addr
+	in           chan []byte
+	extra        []byte
+	done         func()
+	closed       bool
+	readDeadline time.Time
+}
+
+func (ps *packetSession) Read(p []byte) (int, error) {
+	if len(ps.extra) > 0 {
+		n := copy(p, ps.extra)
+		ps.extra = ps.extra[n:]
+		return n, nil
+	}
+
+	idle := time.NewTimer(udpSessionIdleTimeout)
+	defer idle.Stop()
+
+	// honor the read deadline so MatchingTimeout applies to UDP
+	// sessions the same as to stream connections
+	var deadline <-chan time.Time
+	if !ps.readDeadline.IsZero() {
+		remaining := time.Until(ps.readDeadline)
+		if remaining <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	select {
+	case packet, ok := <-ps.in:
+		if !ok {
+			return 0, io.EOF
+		}
+		n := copy(p, packet)
+		ps.extra = packet[n:]
+		return n, nil
+	case <-deadline:
+		return 0, os.ErrDeadlineExceeded
+	case <-idle.C:
+		return 0, io.EOF
+	}
+}
+
+func (ps *packetSession) Write(p []byte) (int, error) {
+	return ps.pc.WriteTo(p, ps.remote)
+}
+
+func (ps *packetSession) Close() error {
+	if !ps.closed {
+		ps.closed = true
+		ps.done()
+	}
+	return nil
+}
+
+func (ps *packetSession) LocalAddr() net.Addr  { return ps.pc.LocalAddr() }
+func (ps *packetSession) RemoteAddr() net.Addr { return ps.remote }
+
+func (ps *packetSession) SetDeadline(t time.Time) error {
+	ps.readDeadline = t
+	return nil
+}
+
+func (ps *packetSession) SetReadDeadline(t time.Time) error {
+	ps.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline is a no-op; writes go straight to the packet
+// conn and do not block on the session.
+func (ps *packetSession) SetWriteDeadline(t time.Time) error { return nil }
+
+// Interface guards
+var (
+	_ caddy.App         = (*App)(nil)
+	_ caddy.Provisioner = (*App)(nil)
+	_ net.Conn          = (*packetSession)(nil)
+)
@@ -0,0 +1,261 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyl4
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// streamConn is a net.Conn that reads from a fixed byte stream;
+// only the methods Connection itself uses are implemented.
+type streamConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (sc streamConn) Read(p []byte) (int, error) { return sc.r.Read(p) }
+
+func TestConnectionRecordRewind(t *testing.T) {
+	const stream = "hello world"
+	cx := newConnection(streamConn{r: bytes.NewReader([]byte(stream))})
+
+	// first matcher records while reading a prefix
+	cx.record()
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(cx, buf); err != nil {
+		t.Fatalf("first recorded read: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("expected first matcher to read 'hello' but got '%s'", buf)
+	}
+
+	// a second matcher must see the stream from the beginning,
+	// and may read further than the first did
+	cx.record()
+	longer := make([]byte, 8)
+	if _, err := io.ReadFull(cx, longer); err != nil {
+		t.Fatalf("second recorded read: %v", err)
+	}
+	if string(longer) != "hello wo" {
+		t.Errorf("expected second matcher to read 'hello wo' but got '%s'", longer)
+	}
+
+	// after rewinding, the handler gets the entire stream even
+	// though the matchers consumed most of it
+	cx.rewind()
+	all, err := ioutil.ReadAll(cx)
+	if err != nil {
+		t.Fatalf("reading full stream: %v", err)
+	}
+	if string(all) != stream {
+		t.Errorf("expected handler to read '%s' but got '%s'", stream, all)
+	}
+}
+
+func TestPacketSessionRead(t *testing.T) {
+	newSession := func() *packetSession {
+		return &packetSession{in: make(chan []byte, 4), done: func() {}}
+	}
+
+	// a queued packet larger than the read buffer is delivered
+	// across multiple reads
+	ps := newSession()
+	ps.in <- []byte("abcdef")
+	buf := make([]byte, 4)
+	n, err := ps.Read(buf)
+	if err != nil || string(buf[:n]) != "abcd" {
+		t.Fatalf("expected to read 'abcd' but got '%s' (err: %v)", buf[:n], err)
+	}
+	n, err = ps.Read(buf)
+	if err != nil || string(buf[:n]) != "ef" {
+		t.Fatalf("expected to read 'ef' but got '%s' (err: %v)", buf[:n], err)
+	}
+
+	// an expired read deadline fails the read, so the matching
+	// timeout applies to UDP sessions too
+	ps = newSession()
+	if err := ps.SetReadDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("setting deadline: %v", err)
+	}
+	if _, err := ps.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected deadline error but got %v", err)
+	}
+
+	// a pending deadline fires while a read is blocked
+	ps = newSession()
+	if err := ps.SetReadDeadline(time.Now().Add(20 * time.Millisecond)); err != nil {
+		t.Fatalf("setting deadline: %v", err)
+	}
+	if _, err := ps.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected deadline error but got %v", err)
+	}
+
+	// clearing the deadline makes reads block for data again
+	if err := ps.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatalf("clearing deadline: %v", err)
+	}
+	ps.in <- []byte("hi")
+	n, err = ps.Read(buf)
+	if err != nil || string(buf[:n]) != "hi" {
+		t.Fatalf("expected to read 'hi' but got '%s' (err: %v)", buf[:n], err)
+	}
+
+	// a closed inbound channel means the session is over
+	ps = newSession()
+	close(ps.in)
+	if _, err := ps.Read(buf); err != io.EOF {
+		t.Errorf("expected EOF on closed session but got %v", err)
+	}
+}
+
+// acceptResult is one return value of a stub listener's Accept.
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+type stubListener struct {
+	results chan acceptResult
+}
+
+func (l stubListener) Accept() (net.Conn, error) {
+	res := <-l.results
+	return res.conn, res.err
+}
+func (stubListener) Close() error   { return nil }
+func (stubListener) Addr() net.Addr { return nil }
+
+// tempError is a transient net.Error, like EMFILE during accept.
+type tempError struct{}
+
+func (tempError) Error() string   { return "temporary accept error" }
+func (tempError) Temporary() bool { return true }
+func (tempError) Timeout() bool   { return false }
+
+func TestServeRetriesTemporaryAcceptErrors(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	ln := stubListener{results: make(chan acceptResult, 4)}
+	ln.results <- acceptResult{err: tempError{}}
+	ln.results <- acceptResult{conn: server}
+	ln.results <- acceptResult{err: tempError{}}
+	ln.results <- acceptResult{err: errors.New("listener closed")}
+
+	s := &Server{logger: zap.NewNop()}
+	served := make(chan struct{})
+	go func() {
+		s.serve(ln)
+		close(served)
+	}()
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return on a permanent accept error")
+	}
+	if len(ln.results) != 0 {
+		t.Errorf("serve returned with %d accept results still pending; temporary errors were not retried", len(ln.results))
+	}
+
+	// the accepted connection had no matching route, so the server
+	// should have closed it
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected accepted connection to be closed but read returned %v", err)
+	}
+}
+
+func TestProxyHandleHalfClose(t *testing.T) {
+	// upstream echoes everything it receives once the client is done
+	// sending; it can only do that if the proxy half-closes instead
+	// of tearing the whole connection down on client EOF
+	upstreamLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting upstream: %v", err)
+	}
+	defer upstreamLn.Close()
+	go func() {
+		conn, err := upstreamLn.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, err := ioutil.ReadAll(conn)
+		if err != nil {
+			return
+		}
+		conn.Write(append([]byte("echo:"), data...))
+	}()
+
+	downstreamLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting downstream listener: %v", err)
+	}
+	defer downstreamLn.Close()
+
+	h := &ProxyHandler{Upstreams: []string{upstreamLn.Addr().String()}}
+	if err := h.Provision(caddy.Context{}); err != nil {
+		t.Fatalf("provisioning: %v", err)
+	}
+
+	handled := make(chan error, 1)
+	go func() {
+		conn, err := downstreamLn.Accept()
+		if err != nil {
+			handled <- err
+			return
+		}
+		defer conn.Close()
+		handled <- h.Handle(newConnection(conn))
+	}()
+
+	client, err := net.Dial("tcp", downstreamLn.Addr().String())
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := client.Write([]byte("ping")); err != nil {
+		t.Fatalf("writing request: %v", err)
+	}
+	// half-close: the client is done sending but still expects
+	// the full response
+	if err := client.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("half-closing client: %v", err)
+	}
+
+	resp, err := ioutil.ReadAll(client)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	if string(resp) != "echo:ping" {
+		t.Errorf("expected full response 'echo:ping' but got '%s'", resp)
+	}
+	if err := <-handled; err != nil {
+		t.Errorf("expected Handle to return nil but got %v", err)
+	}
+}
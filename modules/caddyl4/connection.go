@@ -0,0 +1,82 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyl4
+
+import (
+	"net"
+)
+
+// Connection wraps an accepted connection so that matchers can
+// inspect the beginning of the stream without consuming it: while
+// recording, everything read is retained, and a rewind replays the
+// retained bytes before reading from the socket again. Handlers
+// therefore see the stream from its very first byte, no matter how
+// much the matchers peeked at.
+type Connection struct {
+	net.Conn
+
+	buf       []byte // bytes read while recording
+	bufOffset int    // how far into buf replaying has gotten
+	recording bool
+
+	bytesRead, bytesWritten uint64
+}
+
+func newConnection(conn net.Conn) *Connection {
+	return &Connection{Conn: conn}
+}
+
+func (cx *Connection) Read(p []byte) (int, error) {
+	// first, replay any bytes retained during matching
+	if cx.bufOffset < len(cx.buf) {
+		n := copy(p, cx.buf[cx.bufOffset:])
+		cx.bufOffset += n
+		if !cx.recording && cx.bufOffset == len(cx.buf) {
+			// replay finished; the buffer is no longer needed
+			cx.buf = nil
+			cx.bufOffset = 0
+		}
+		return n, nil
+	}
+
+	n, err := cx.Conn.Read(p)
+	cx.bytesRead += uint64(n)
+	if cx.recording {
+		cx.buf = append(cx.buf, p[:n]...)
+		cx.bufOffset = len(cx.buf)
+	}
+	return n, err
+}
+
+func (cx *Connection) Write(p []byte) (int, error) {
+	n, err := cx.Conn.Write(p)
+	cx.bytesWritten += uint64(n)
+	return n, err
+}
+
+// record starts retaining bytes read from the connection, and
+// replays any bytes retained by a previous recording first, so each
+// matcher sees the stream from the beginning.
+func (cx *Connection) record() {
+	cx.recording = true
+	cx.bufOffset = 0
+}
+
+// rewind stops recording and resets the replay position, so the
+// next reader gets the stream from the start.
+func (cx *Connection) rewind() {
+	cx.recording = false
+	cx.bufOffset = 0
+}
@@ -0,0 +1,208 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyl4
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(MatchTLS{})
+	caddy.RegisterModule(MatchHTTP{})
+	caddy.RegisterModule(MatchSSH{})
+	caddy.RegisterModule(MatchPrefix{})
+}
+
+// MatchTLS matches connections that begin a TLS handshake,
+// optionally only those with certain server names (SNI).
+type MatchTLS struct {
+	// The server names to match, as sent by the client in the TLS
+	// ClientHello (SNI). An empty list matches any TLS connection.
+	SNI []string `json:"sni,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (MatchTLS) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "layer4.matchers.tls",
+		New: func() caddy.Module { return new(MatchTLS) },
+	}
+}
+
+// Match returns true if the connection is a TLS handshake with a
+// matching server name.
+func (m MatchTLS) Match(cx *Connection) (bool, error) {
+	hello, err := readClientHello(cx)
+	if err != nil {
+		// not a TLS handshake (or a malformed one)
+		return false, nil
+	}
+	if len(m.SNI) == 0 {
+		return true, nil
+	}
+	for _, sni := range m.SNI {
+		if strings.EqualFold(sni, hello.ServerName) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readClientHello captures the TLS ClientHello from r without
+// completing a handshake: the stub handshake fails as soon as a
+// reply would be needed, but by then the hello has been parsed.
+func readClientHello(r io.Reader) (*tls.ClientHelloInfo, error) {
+	var hello *tls.ClientHelloInfo
+	err := tls.Server(readOnlyConn{r}, &tls.Config{
+		GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = chi
+			return nil, nil
+		},
+	}).Handshake()
+	if hello == nil {
+		return nil, err
+	}
+	return hello, nil
+}
+
+// MatchHTTP matches connections that begin with a plaintext HTTP
+// request, optionally only those for certain hosts.
+type MatchHTTP struct {
+	// The Host values to match. An empty list matches
+	// any HTTP request.
+	Host []string `json:"host,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (MatchHTTP) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "layer4.matchers.http",
+		New: func() caddy.Module { return new(MatchHTTP) },
+	}
+}
+
+// Match returns true if the connection starts with an HTTP request
+// for a matching host.
+func (m MatchHTTP) Match(cx *Connection) (bool, error) {
+	req, err := http.ReadRequest(bufio.NewReader(cx))
+	if err != nil {
+		// not an HTTP request
+		return false, nil
+	}
+	if len(m.Host) == 0 {
+		return true, nil
+	}
+	reqHost := req.Host
+	if idx := strings.LastIndex(reqHost, ":"); idx > -1 && !strings.HasSuffix(reqHost, "]") {
+		reqHost = reqHost[:idx]
+	}
+	for _, host := range m.Host {
+		if strings.EqualFold(host, reqHost) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MatchSSH matches connections that look like the start
+// of an SSH session.
+type MatchSSH struct{}
+
+// CaddyModule returns the Caddy module information.
+func (MatchSSH) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "layer4.matchers.ssh",
+		New: func() caddy.Module { return new(MatchSSH) },
+	}
+}
+
+// Match returns true if the connection begins with the SSH protocol
+// version exchange banner (RFC 4253 section 4.2).
+func (m MatchSSH) Match(cx *Connection) (bool, error) {
+	return hasPrefix(cx, "SSH-")
+}
+
+// MatchPrefix matches connections whose stream begins
+// with any of the configured byte prefixes.
+type MatchPrefix struct {
+	// The prefixes to look for at the very start of the stream.
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (MatchPrefix) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "layer4.matchers.prefix",
+		New: func() caddy.Module { return new(MatchPrefix) },
+	}
+}
+
+// Match returns true if the connection begins with any
+// of the configured prefixes.
+func (m MatchPrefix) Match(cx *Connection) (bool, error) {
+	for _, prefix := range m.Prefixes {
+		matched, err := hasPrefix(cx, prefix)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+		// replay the consumed bytes for the next prefix
+		cx.record()
+	}
+	return false, nil
+}
+
+// hasPrefix reports whether the stream begins with prefix.
+func hasPrefix(r io.Reader, prefix string) (bool, error) {
+	buf := make([]byte, len(prefix))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		// a stream shorter than the prefix simply doesn't match
+		return false, nil
+	}
+	return string(buf) == prefix, nil
+}
+
+// readOnlyConn is a net.Conn that only supports reading;
+// everything else fails fast so a stub TLS handshake aborts
+// right after the ClientHello is parsed.
+type readOnlyConn struct{ r io.Reader }
+
+func (conn readOnlyConn) Read(p []byte) (int, error)  { return conn.r.Read(p) }
+func (conn readOnlyConn) Write(p []byte) (int, error) { return 0, io.ErrClosedPipe }
+func (conn readOnlyConn) Close() error                { return nil }
+
+func (readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// Interface guards
+var (
+	_ Matcher = (*MatchTLS)(nil)
+	_ Matcher = (*MatchHTTP)(nil)
+	_ Matcher = (*MatchSSH)(nil)
+	_ Matcher = (*MatchPrefix)(nil)
+)
@@ -0,0 +1,132 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyl4
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(ProxyHandler{})
+}
+
+// ProxyHandler proxies the raw connection to an upstream,
+// copying bytes in both directions until either side closes.
+// Because no bytes were consumed during matching, the upstream
+// sees the stream from its first byte -- this is what enables
+// TLS passthrough by SNI.
+type ProxyHandler struct {
+	// The addresses of the upstreams to proxy to, in
+	// caddy network address form (e.g. `10.0.0.1:443` or
+	// `unix//run/app.sock`). Connections are distributed
+	// among multiple upstreams round-robin.
+	Upstreams []string `json:"upstreams,omitempty"`
+
+	// The duration used to set a deadline when connecting
+	// to an upstream.
+	DialTimeout caddy.Duration `json:"dial_timeout,omitempty"`
+
+	upstreams []caddy.NetworkAddress
+	counter   uint32
+}
+
+// CaddyModule returns the Caddy module information.
+func (ProxyHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "layer4.handlers.proxy",
+		New: func() caddy.Module { return new(ProxyHandler) },
+	}
+}
+
+// Provision sets up the handler.
+func (h *ProxyHandler) Provision(ctx caddy.Context) error {
+	if len(h.Upstreams) == 0 {
+		return fmt.Errorf("at least one upstream is required")
+	}
+	for _, upstream := range h.Upstreams {
+		addr, err := caddy.ParseNetworkAddress(upstream)
+		if err != nil {
+			// assume a host:port with the default network
+			addr, err = caddy.ParseNetworkAddress("tcp/" + upstream)
+			if err != nil {
+				return fmt.Errorf("parsing upstream address '%s': %v", upstream, err)
+			}
+		}
+		h.upstreams = append(h.upstreams, addr)
+	}
+	return nil
+}
+
+// Handle proxies the connection to the next upstream.
+func (h *ProxyHandler) Handle(cx *Connection) error {
+	upstream := h.upstreams[int(atomic.AddUint32(&h.counter, 1))%len(h.upstreams)]
+
+	dialer := net.Dialer{Timeout: time.Duration(h.DialTimeout)}
+	up, err := dialer.Dial(upstream.Network, upstream.JoinHostPort(0))
+	if err != nil {
+		return fmt.Errorf("dialing upstream %s: %v", upstream, err)
+	}
+	defer up.Close()
+
+	// copy in both directions; when one side finishes sending,
+	// propagate the half-close so the other side can flush what it
+	// has in flight (a client EOF must not truncate the upstream's
+	// response), and only tear down once both directions are done
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(up, cx)
+		closeWrite(up)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(cx, up)
+		closeWrite(cx.Conn)
+		errc <- err
+	}()
+
+	var firstErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil && err != io.EOF && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// closeWriter is implemented by connections that can close just
+// their write side (like *net.TCPConn), signaling EOF to the peer
+// while reads continue.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// closeWrite half-closes conn's write side, if it supports that.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(closeWriter); ok {
+		cw.CloseWrite() //nolint:errcheck
+	}
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner = (*ProxyHandler)(nil)
+	_ Handler           = (*ProxyHandler)(nil)
+)
@@ -0,0 +1,160 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddyl4
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// Matcher decides whether a connection qualifies for a route by
+// inspecting it. Matchers may read from the connection; the bytes
+// they consume are replayed for the next matcher or handler.
+type Matcher interface {
+	Match(*Connection) (bool, error)
+}
+
+// Handler handles a matched connection. Handlers run in the order
+// they are configured; a handler that proxies or otherwise fully
+// consumes the connection should be last.
+type Handler interface {
+	Handle(*Connection) error
+}
+
+// Route consists of a set of rules for matching a connection,
+// and the list of handlers to execute when it matches.
+type Route struct {
+	// The matcher sets which will be used to qualify this route for
+	// a connection. Each matcher set is OR'ed, but matchers within
+	// a set are AND'ed together. A route with no matchers matches
+	// every connection.
+	MatcherSetsRaw []caddy.ModuleMap `json:"match,omitempty" caddy:"namespace=layer4.matchers"`
+
+	// The list of handlers for this route, executed in order.
+	HandlersRaw []json.RawMessage `json:"handle,omitempty" caddy:"namespace=layer4.handlers inline_key=handler"`
+
+	// decoded values
+	matcherSets []MatcherSet
+	handlers    []Handler
+}
+
+// MatcherSet is a set of matchers which must all match
+// for the set to be considered a match.
+type MatcherSet []Matcher
+
+// Match returns true if the connection matches all matchers in the set.
+func (ms MatcherSet) Match(cx *Connection) (bool, error) {
+	for _, m := range ms {
+		// each matcher gets the stream from the beginning
+		cx.record()
+		matched, err := m.Match(cx)
+		if err != nil {
+			return false, err
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// RouteList is a list of connection routes that
+// are tried in order until one matches.
+type RouteList []*Route
+
+// Provision sets up both the matchers and handlers in the routes.
+func (routes RouteList) Provision(ctx caddy.Context) error {
+	for i, route := range routes {
+		// matchers
+		matchersIface, err := ctx.LoadModule(route, "MatcherSetsRaw")
+		if err != nil {
+			return fmt.Errorf("route %d: loading matcher modules: %v", i, err)
+		}
+		for _, matcherSetIface := range matchersIface.([]map[string]interface{}) {
+			var matcherSet MatcherSet
+			for _, matcherIface := range matcherSetIface {
+				matcher, ok := matcherIface.(Matcher)
+				if !ok {
+					return fmt.Errorf("route %d: matcher module is not a connection matcher: %T", i, matcherIface)
+				}
+				matcherSet = append(matcherSet, matcher)
+			}
+			route.matcherSets = append(route.matcherSets, matcherSet)
+		}
+
+		// handlers
+		handlersIface, err := ctx.LoadModule(route, "HandlersRaw")
+		if err != nil {
+			return fmt.Errorf("route %d: loading handler modules: %v", i, err)
+		}
+		for _, handlerIface := range handlersIface.([]interface{}) {
+			handler, ok := handlerIface.(Handler)
+			if !ok {
+				return fmt.Errorf("route %d: handler module is not a connection handler: %T", i, handlerIface)
+			}
+			route.handlers = append(route.handlers, handler)
+		}
+	}
+	return nil
+}
+
+// handle finds the first route matching cx and runs its handlers.
+// Matching is bounded by matchingTimeout; connections that no
+// route matches are dropped.
+func (routes RouteList) handle(cx *Connection, matchingTimeout time.Duration) error {
+	// matchers must not be able to stall forever on a connection
+	// that never sends the bytes they are waiting for
+	err := cx.Conn.SetReadDeadline(time.Now().Add(matchingTimeout))
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		matched := len(route.matcherSets) == 0
+		for _, ms := range route.matcherSets {
+			match, err := ms.Match(cx)
+			if err != nil {
+				return fmt.Errorf("matching connection: %v", err)
+			}
+			if match {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		// matching is done; hand the full stream to the handlers
+		cx.rewind()
+		err = cx.Conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return err
+		}
+
+		for _, handler := range route.handlers {
+			err = handler.Handle(cx)
+			if err != nil {
+				return fmt.Errorf("handling connection: %v", err)
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no route matched connection from %s", cx.RemoteAddr())
+}
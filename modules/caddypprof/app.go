@@ -0,0 +1,176 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caddypprof provides an app that serves Go's pprof
+// profiling endpoints and runtime stats on a dedicated listener,
+// separate from any site routes. This way production CPU and heap
+// profiles can be captured without wiring debug endpoints into
+// the HTTP app where they might be exposed publicly.
+package caddypprof
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(App{})
+}
+
+// App serves profiling endpoints under /debug/pprof/ and expvar
+// runtime stats under /debug/vars.
+type App struct {
+	// The address to listen on. Must resolve to loopback
+	// interfaces unless credentials are configured.
+	// Default: localhost:2021.
+	Listen string `json:"listen,omitempty"`
+
+	// Optional HTTP basic auth credentials, required for every
+	// request when set. Configuring credentials also permits
+	// listening on non-loopback addresses.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	ln     net.Listener
+	server *http.Server
+	logger *zap.Logger
+}
+
+const defaultListenAddr = "localhost:2021"
+
+// CaddyModule returns the Caddy module information.
+func (App) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "pprof",
+		New: func() caddy.Module { return new(App) },
+	}
+}
+
+// Provision sets up the app.
+func (a *App) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger(a)
+	if a.Listen == "" {
+		a.Listen = defaultListenAddr
+	}
+	if (a.Username == "") != (a.Password == "") {
+		return fmt.Errorf("username and password must be configured together")
+	}
+	return nil
+}
+
+// Start starts the app.
+func (a *App) Start() error {
+	listenAddr, err := caddy.ParseNetworkAddress(a.Listen)
+	if err != nil {
+		listenAddr, err = caddy.ParseNetworkAddress("tcp/" + a.Listen)
+		if err != nil {
+			return fmt.Errorf("parsing listen address '%s': %v", a.Listen, err)
+		}
+	}
+
+	// profiles can leak sensitive internals, so an address that is
+	// reachable from other hosts requires credentials
+	if !listenAddr.IsUnixNetwork() && a.Username == "" {
+		uniqueLoopbackOK, err := isLoopback(listenAddr.Host)
+		if err != nil {
+			return err
+		}
+		if !uniqueLoopbackOK {
+			return fmt.Errorf("refusing to serve profiling endpoints on non-loopback address %s without credentials", a.Listen)
+		}
+	}
+
+	ln, err := caddy.Listen(listenAddr.Network, listenAddr.JoinHostPort(0))
+	if err != nil {
+		return fmt.Errorf("listening on %s: %v", a.Listen, err)
+	}
+	a.ln = ln
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	a.server = &http.Server{Handler: a.auth(mux)}
+	go a.server.Serve(ln)
+
+	a.logger.Info("serving profiling endpoints",
+		zap.String("address", ln.Addr().String()))
+
+	return nil
+}
+
+// Stop stops the app.
+func (a *App) Stop() error {
+	if a.server != nil {
+		return a.server.Close()
+	}
+	return nil
+}
+
+// auth wraps h with a basic auth check, if credentials are configured.
+func (a *App) auth(h http.Handler) http.Handler {
+	if a.Username == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(a.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(a.Password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pprof"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isLoopback returns true if host is a loopback address
+// or a hostname that resolves only to loopback addresses.
+func isLoopback(host string) (bool, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback(), nil
+	}
+	if host == "localhost" {
+		return true, nil
+	}
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return false, fmt.Errorf("resolving listen address %s: %v", host, err)
+	}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil || !ip.IsLoopback() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Interface guards
+var (
+	_ caddy.App         = (*App)(nil)
+	_ caddy.Provisioner = (*App)(nil)
+)
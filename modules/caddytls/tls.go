@@ -260,6 +260,17 @@ func (t *TLS) Stop() error {
 	return nil
 }
 
+// Status returns a summary of the TLS app for the startup
+// report and the admin /status endpoint: the certificate
+// subjects being managed automatically.
+func (t *TLS) Status() interface{} {
+	return struct {
+		Managing []string `json:"managing,omitempty"`
+	}{
+		Managing: t.automateNames,
+	}
+}
+
 // Cleanup frees up resources allocated during Provision.
 func (t *TLS) Cleanup() error {
 	// stop the certificate cache
@@ -500,10 +511,11 @@ var (
 
 // Interface guards
 var (
-	_ caddy.App          = (*TLS)(nil)
-	_ caddy.Provisioner  = (*TLS)(nil)
-	_ caddy.Validator    = (*TLS)(nil)
-	_ caddy.CleanerUpper = (*TLS)(nil)
+	_ caddy.App            = (*TLS)(nil)
+	_ caddy.Provisioner    = (*TLS)(nil)
+	_ caddy.Validator      = (*TLS)(nil)
+	_ caddy.CleanerUpper   = (*TLS)(nil)
+	_ caddy.StatusReporter = (*TLS)(nil)
 )
 
 // TODO: This is temporary until the release candidates
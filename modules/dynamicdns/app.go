@@ -0,0 +1,236 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dynamicdns provides an app that keeps DNS records pointed
+// at the host's current public IP address. It periodically asks
+// configurable HTTP sources what the public IP is and, when it
+// changes, updates the configured records through a dns.providers
+// module -- a natural complement to automatic HTTPS for home
+// servers on dynamic IPs.
+package dynamicdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/libdns/libdns"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(App{})
+}
+
+// App is the dynamic DNS updater.
+type App struct {
+	// The DNS provider module through which to update records.
+	DNSProviderRaw json.RawMessage `json:"dns_provider,omitempty" caddy:"namespace=dns.providers inline_key=name"`
+
+	// The records to keep updated, keyed by DNS zone; each name is
+	// relative to its zone ("@" for the zone apex). For example,
+	// `{"example.com.": ["@", "www"]}`.
+	Domains map[string][]string `json:"domains,omitempty"`
+
+	// The URLs of services that answer a plain GET request with
+	// the requester's public IP address as plain text. They are
+	// tried in order until one succeeds.
+	// Default: `["https://api.ipify.org", "https://icanhazip.com"]`.
+	IPSources []string `json:"ip_sources,omitempty"`
+
+	// How often to check whether the public IP has changed.
+	// Default: 30m.
+	CheckInterval caddy.Duration `json:"check_interval,omitempty"`
+
+	// The TTL to set on updated records. Default: 5m.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	dnsProvider libdns.RecordSetter
+	httpClient  *http.Client
+	lastIP      net.IP
+	ctx         context.Context
+	cancel      context.CancelFunc
+	logger      *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (App) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "dynamic_dns",
+		New: func() caddy.Module { return new(App) },
+	}
+}
+
+// Provision sets up the app.
+func (a *App) Provision(ctx caddy.Context) error {
+	a.logger = ctx.Logger(a)
+
+	if a.DNSProviderRaw == nil {
+		return fmt.Errorf("a DNS provider is required")
+	}
+	val, err := ctx.LoadModule(a, "DNSProviderRaw")
+	if err != nil {
+		return fmt.Errorf("loading DNS provider module: %v", err)
+	}
+	prov, ok := val.(libdns.RecordSetter)
+	if !ok {
+		return fmt.Errorf("DNS provider module is not a record setter: %T", val)
+	}
+	a.dnsProvider = prov
+
+	if len(a.Domains) == 0 {
+		return fmt.Errorf("at least one domain is required")
+	}
+	if len(a.IPSources) == 0 {
+		a.IPSources = []string{
+			"https://api.ipify.org",
+			"https://icanhazip.com",
+		}
+	}
+	if a.CheckInterval == 0 {
+		a.CheckInterval = caddy.Duration(30 * time.Minute)
+	}
+	if a.TTL == 0 {
+		a.TTL = caddy.Duration(5 * time.Minute)
+	}
+	a.httpClient = &http.Client{Timeout: 30 * time.Second}
+
+	return nil
+}
+
+// Start starts the app.
+func (a *App) Start() error {
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	go a.checkerLoop()
+	return nil
+}
+
+// Stop stops the app.
+func (a *App) Stop() error {
+	a.cancel()
+	return nil
+}
+
+// checkerLoop checks the public IP on an interval,
+// starting immediately.
+func (a *App) checkerLoop() {
+	ticker := time.NewTicker(time.Duration(a.CheckInterval))
+	defer ticker.Stop()
+
+	a.checkIPAndUpdateDNS()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.checkIPAndUpdateDNS()
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// checkIPAndUpdateDNS looks up the current public IP and, if it
+// differs from the last-known one, updates the DNS records.
+func (a *App) checkIPAndUpdateDNS() {
+	ip, err := a.lookupCurrentIP()
+	if err != nil {
+		a.logger.Error("looking up public IP", zap.Error(err))
+		return
+	}
+	if ip.Equal(a.lastIP) {
+		return
+	}
+
+	a.logger.Info("public IP changed",
+		zap.String("current_ip", ip.String()),
+		zap.String("previous_ip", a.lastIP.String()))
+
+	recType := "A"
+	if ip.To4() == nil {
+		recType = "AAAA"
+	}
+
+	allOK := true
+	for zone, names := range a.Domains {
+		records := make([]libdns.Record, 0, len(names))
+		for _, name := range names {
+			records = append(records, libdns.Record{
+				Type:  recType,
+				Name:  name,
+				Value: ip.String(),
+				TTL:   time.Duration(a.TTL),
+			})
+		}
+		_, err := a.dnsProvider.SetRecords(a.ctx, zone, records)
+		if err != nil {
+			a.logger.Error("updating DNS records",
+				zap.String("zone", zone),
+				zap.Error(err))
+			allOK = false
+		}
+	}
+
+	// only remember the new IP if every zone was updated, so
+	// failed zones are retried on the next check
+	if allOK {
+		a.lastIP = ip
+	}
+}
+
+// lookupCurrentIP asks the configured sources for
+// the host's public IP address.
+func (a *App) lookupCurrentIP() (net.IP, error) {
+	var lastErr error
+	for _, source := range a.IPSources {
+		req, err := http.NewRequest(http.MethodGet, source, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp, err := a.httpClient.Do(req.WithContext(a.ctx))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("%s: status %d", source, resp.StatusCode)
+			continue
+		}
+		ip := net.ParseIP(strings.TrimSpace(string(body)))
+		if ip == nil {
+			lastErr = fmt.Errorf("%s: invalid IP address in response", source)
+			continue
+		}
+		return ip, nil
+	}
+	return nil, fmt.Errorf("all IP sources failed; last error: %v", lastErr)
+}
+
+// Interface guards
+var (
+	_ caddy.App         = (*App)(nil)
+	_ caddy.Provisioner = (*App)(nil)
+)
@@ -0,0 +1,316 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	caddy.RegisterModule(CommonLogEncoder{})
+	caddy.RegisterModule(W3CExtendedEncoder{})
+}
+
+// CommonLogEncoder writes access log entries in the Common Log
+// Format, or optionally the Combined Log Format (Common plus the
+// Referer and User-Agent headers), so existing log analyzers can
+// consume them without transformation. Entries that do not look
+// like access logs are dropped.
+type CommonLogEncoder struct {
+	nopEncoder
+
+	// Use the Combined Log Format, which appends the quoted
+	// Referer and User-Agent request headers to each entry.
+	Combined bool `json:"combined,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (CommonLogEncoder) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.encoders.common_log",
+		New: func() caddy.Module { return new(CommonLogEncoder) },
+	}
+}
+
+// Clone returns a copy of the encoder. This is necessary
+// because we implement our own EncodeEntry; see the same
+// method on SingleFieldEncoder.
+func (cle CommonLogEncoder) Clone() zapcore.Encoder {
+	return CommonLogEncoder{Combined: cle.Combined}
+}
+
+// EncodeEntry partially implements the zapcore.Encoder interface.
+func (cle CommonLogEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	entry := accessLogEntry(ent, fields)
+	if entry == nil {
+		return bufferpool.Get(), nil
+	}
+
+	buf := bufferpool.Get()
+	buf.AppendString(entry.remoteHost)
+	buf.AppendString(" - ")
+	buf.AppendString(entry.user)
+	buf.AppendString(" [")
+	buf.AppendString(ent.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	buf.AppendString(`] "`)
+	buf.AppendString(entry.method)
+	buf.AppendByte(' ')
+	buf.AppendString(entry.uri)
+	buf.AppendByte(' ')
+	buf.AppendString(entry.proto)
+	buf.AppendString(`" `)
+	buf.AppendInt(entry.status)
+	buf.AppendByte(' ')
+	if entry.size == 0 {
+		buf.AppendByte('-')
+	} else {
+		buf.AppendInt(entry.size)
+	}
+	if cle.Combined {
+		buf.AppendString(` "`)
+		buf.AppendString(entry.header("Referer"))
+		buf.AppendString(`" "`)
+		buf.AppendString(entry.header("User-Agent"))
+		buf.AppendByte('"')
+	}
+	buf.AppendByte('\n')
+	return buf, nil
+}
+
+// UnmarshalCaddyfile sets up the module from Caddyfile tokens. Syntax:
+//
+//     common_log [combined]
+//
+func (cle *CommonLogEncoder) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			if d.Val() != "combined" {
+				return d.Errf("unrecognized argument %s", d.Val())
+			}
+			cle.Combined = true
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+	}
+	return nil
+}
+
+// w3cFields is the field list emitted in the #Fields directive
+// and written, in order, for each entry.
+const w3cFields = "date time c-ip cs-username cs-method cs-uri cs-version sc-status sc-bytes time-taken cs(Referer) cs(User-Agent)"
+
+// W3CExtendedEncoder writes access log entries in the W3C Extended
+// Log File Format, preceding the first entry with the directive
+// lines that declare the field layout. Entries that do not look
+// like access logs are dropped.
+type W3CExtendedEncoder struct {
+	nopEncoder
+
+	wroteDirectives *sync.Once
+}
+
+// CaddyModule returns the Caddy module information.
+func (W3CExtendedEncoder) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.encoders.w3c",
+		New: func() caddy.Module { return new(W3CExtendedEncoder) },
+	}
+}
+
+// Provision sets up the encoder.
+func (we *W3CExtendedEncoder) Provision(ctx caddy.Context) error {
+	we.wroteDirectives = new(sync.Once)
+	return nil
+}
+
+// Clone returns a copy of the encoder. The directive-tracking
+// state is shared with the clone so the header is only written
+// once per log output, not once per derived logger.
+func (we W3CExtendedEncoder) Clone() zapcore.Encoder {
+	return W3CExtendedEncoder{wroteDirectives: we.wroteDirectives}
+}
+
+// EncodeEntry partially implements the zapcore.Encoder interface.
+func (we W3CExtendedEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	entry := accessLogEntry(ent, fields)
+	if entry == nil {
+		return bufferpool.Get(), nil
+	}
+
+	buf := bufferpool.Get()
+	we.wroteDirectives.Do(func() {
+		buf.AppendString("#Software: Caddy\n")
+		buf.AppendString("#Version: 1.0\n")
+		buf.AppendString("#Date: ")
+		buf.AppendString(ent.Time.UTC().Format("2006-01-02 15:04:05"))
+		buf.AppendByte('\n')
+		buf.AppendString("#Fields: ")
+		buf.AppendString(w3cFields)
+		buf.AppendByte('\n')
+	})
+
+	ts := ent.Time.UTC()
+	buf.AppendString(ts.Format("2006-01-02"))
+	buf.AppendByte(' ')
+	buf.AppendString(ts.Format("15:04:05"))
+	buf.AppendByte(' ')
+	buf.AppendString(entry.remoteHost)
+	buf.AppendByte(' ')
+	buf.AppendString(entry.user)
+	buf.AppendByte(' ')
+	buf.AppendString(entry.method)
+	buf.AppendByte(' ')
+	buf.AppendString(w3cValue(entry.uri))
+	buf.AppendByte(' ')
+	buf.AppendString(entry.proto)
+	buf.AppendByte(' ')
+	buf.AppendInt(entry.status)
+	buf.AppendByte(' ')
+	buf.AppendInt(entry.size)
+	buf.AppendByte(' ')
+	buf.AppendString(strconv.FormatFloat(entry.duration.Seconds(), 'f', 3, 64))
+	buf.AppendByte(' ')
+	buf.AppendString(w3cValue(entry.header("Referer")))
+	buf.AppendByte(' ')
+	buf.AppendString(w3cValue(entry.header("User-Agent")))
+	buf.AppendByte('\n')
+	return buf, nil
+}
+
+// UnmarshalCaddyfile sets up the module from Caddyfile tokens.
+func (we *W3CExtendedEncoder) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	return nil
+}
+
+// w3cValue encodes s as a W3C extended log field value: spaces
+// are replaced with '+' so each entry stays whitespace-delimited,
+// and empty values become a dash.
+func w3cValue(s string) string {
+	if s == "" || s == "-" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "+")
+}
+
+// accessLog holds the parts of an access log entry that the
+// single-line encoders emit.
+type accessLog struct {
+	remoteHost string
+	user       string
+	method     string
+	uri        string
+	proto      string
+	status     int64
+	size       int64
+	duration   time.Duration
+	headers    map[string]interface{}
+}
+
+// header returns the first value of the named request header,
+// or a dash if it was absent.
+func (a accessLog) header(name string) string {
+	vals, ok := a.headers[name].([]interface{})
+	if !ok || len(vals) == 0 {
+		return "-"
+	}
+	val, ok := vals[0].(string)
+	if !ok {
+		return "-"
+	}
+	return val
+}
+
+// accessLogEntry extracts the access log parts from a structured
+// log entry, or returns nil if the entry does not carry a request
+// object (i.e. it is not an access log).
+func accessLogEntry(ent zapcore.Entry, fields []zapcore.Field) *accessLog {
+	mapEnc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(mapEnc)
+	}
+
+	req, ok := mapEnc.Fields["request"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	entry := &accessLog{
+		user:   logString(mapEnc.Fields, "user_id"),
+		method: logString(req, "method"),
+		uri:    logString(req, "uri"),
+		proto:  logString(req, "proto"),
+		status: logInt(mapEnc.Fields, "status"),
+		size:   logInt(mapEnc.Fields, "size"),
+	}
+	if dur, ok := mapEnc.Fields["duration"].(time.Duration); ok {
+		entry.duration = dur
+	}
+	if headers, ok := req["headers"].(map[string]interface{}); ok {
+		entry.headers = headers
+	}
+
+	remote := logString(req, "remote_addr")
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if remote == "" {
+		remote = "-"
+	}
+	entry.remoteHost = remote
+
+	return entry
+}
+
+// logString returns the string stored under key, or a dash if
+// it is absent or empty.
+func logString(m map[string]interface{}, key string) string {
+	val, ok := m[key].(string)
+	if !ok || val == "" {
+		return "-"
+	}
+	return val
+}
+
+// logInt returns the integer stored under key, or zero.
+func logInt(m map[string]interface{}, key string) int64 {
+	switch val := m[key].(type) {
+	case int64:
+		return val
+	case int:
+		return int64(val)
+	case float64:
+		return int64(val)
+	}
+	return 0
+}
+
+// Interface guards
+var (
+	_ zapcore.Encoder       = (*CommonLogEncoder)(nil)
+	_ zapcore.Encoder       = (*W3CExtendedEncoder)(nil)
+	_ caddy.Provisioner     = (*W3CExtendedEncoder)(nil)
+	_ caddyfile.Unmarshaler = (*CommonLogEncoder)(nil)
+	_ caddyfile.Unmarshaler = (*W3CExtendedEncoder)(nil)
+)
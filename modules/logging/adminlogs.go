@@ -0,0 +1,133 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	caddy.RegisterModule(AdminLogs{})
+}
+
+// AdminLogs is a module that streams this instance's logs over
+// the admin API, so logs can be tailed in real time from remote
+// instances much like `docker logs -f`. It is permanently
+// mounted at "/logs/stream" and is not configurable.
+type AdminLogs struct{}
+
+// CaddyModule returns the Caddy module information.
+func (AdminLogs) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.logs",
+		New: func() caddy.Module { return new(AdminLogs) },
+	}
+}
+
+// Routes returns a route for the /logs/stream endpoint.
+func (al AdminLogs) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/logs/stream",
+			Handler: caddy.AdminHandlerFunc(al.handleStream),
+		},
+	}
+}
+
+// handleStream streams log entries as server-sent events. The
+// stream can be narrowed with query parameters: "level" sets
+// the minimum level, and "name" (repeatable) keeps only loggers
+// with one of the given name prefixes.
+func (al AdminLogs) handleStream(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+
+	minLevel := zapcore.DebugLevel
+	if levelStr := r.URL.Query().Get("level"); levelStr != "" {
+		if err := minLevel.UnmarshalText([]byte(levelStr)); err != nil {
+			return caddy.APIError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("invalid level: %v", err),
+			}
+		}
+	}
+	names := r.URL.Query()["name"]
+
+	filter := func(loggerName string, level zapcore.Level) bool {
+		if level < minLevel {
+			return false
+		}
+		if len(names) == 0 {
+			return true
+		}
+		for _, name := range names {
+			if strings.HasPrefix(loggerName, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return caddy.APIError{
+			Code: http.StatusInternalServerError,
+			Err:  fmt.Errorf("streaming not supported"),
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	entries, cancel := caddy.WatchLogs(filter)
+	defer cancel()
+
+	// periodic comments keep intermediaries from timing out the
+	// stream and let us notice when the client goes away
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case entry := <-entries:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", strings.TrimRight(string(entry), "\n")); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Interface guard
+var _ caddy.AdminRouter = (*AdminLogs)(nil)
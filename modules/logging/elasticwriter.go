@@ -0,0 +1,207 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(ElasticsearchWriter{})
+}
+
+// ElasticsearchWriter implements a log writer that pushes entries
+// to an Elasticsearch or OpenSearch cluster via the bulk API,
+// batching them in memory with optional disk spillover so no
+// sidecar shipper is needed. JSON-encoded entries are indexed
+// as-is; other entries are wrapped in a document with message
+// and @timestamp fields.
+type ElasticsearchWriter struct {
+	PushConfig
+
+	// The base URL of the cluster; batches are POSTed to its
+	// /_bulk path. Required.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// The index to write to, as a Go time layout so indexes
+	// can roll over by date. Default: caddy-2006.01.02.
+	Index string `json:"index,omitempty"`
+
+	httpClient *http.Client
+}
+
+// CaddyModule returns the Caddy module information.
+func (ElasticsearchWriter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.writers.elasticsearch",
+		New: func() caddy.Module { return new(ElasticsearchWriter) },
+	}
+}
+
+// Provision sets up the module.
+func (ew *ElasticsearchWriter) Provision(ctx caddy.Context) error {
+	if ew.Endpoint == "" {
+		return fmt.Errorf("endpoint is required")
+	}
+	if ew.Index == "" {
+		ew.Index = "caddy-2006.01.02"
+	}
+	ew.PushConfig.fillDefaults()
+	ew.httpClient = &http.Client{Timeout: time.Duration(ew.Timeout)}
+	return nil
+}
+
+func (ew ElasticsearchWriter) String() string {
+	return "elasticsearch:" + ew.Endpoint
+}
+
+// WriterKey returns a unique key representing this ew.
+func (ew ElasticsearchWriter) WriterKey() string {
+	return "elasticsearch:" + ew.Endpoint
+}
+
+// OpenWriter starts the background delivery of log entries.
+func (ew ElasticsearchWriter) OpenWriter() (io.WriteCloser, error) {
+	return openPushConn(ew.PushConfig, ew)
+}
+
+// push sends one batch to the bulk API.
+func (ew ElasticsearchWriter) push(batch []pushEntry) error {
+	body := new(bytes.Buffer)
+	for _, entry := range batch {
+		action, err := json.Marshal(map[string]interface{}{
+			"create": map[string]interface{}{
+				"_index": entry.ts.Format(ew.Index),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+
+		if len(entry.line) > 0 && entry.line[0] == '{' && json.Valid(entry.line) {
+			body.Write(entry.line)
+		} else {
+			doc, err := json.Marshal(map[string]interface{}{
+				"@timestamp": entry.ts.Format(time.RFC3339Nano),
+				"message":    string(entry.line),
+			})
+			if err != nil {
+				return err
+			}
+			body.Write(doc)
+		}
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ew.Endpoint+"/_bulk", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for key, val := range ew.Headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := ew.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("bulk API returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// UnmarshalCaddyfile sets up the module from Caddyfile tokens. Syntax:
+//
+//     elasticsearch <endpoint> {
+//         index <layout>
+//         header <field> <value>
+//         batch_size <n>
+//         flush_interval <duration>
+//         spool_file <path>
+//     }
+//
+func (ew *ElasticsearchWriter) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			ew.Endpoint = d.Val()
+		}
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "index":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				ew.Index = d.Val()
+			case "header":
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				if ew.Headers == nil {
+					ew.Headers = make(map[string]string)
+				}
+				ew.Headers[args[0]] = args[1]
+			case "batch_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				size, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid batch size: %v", err)
+				}
+				ew.BatchSize = size
+			case "flush_interval":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid flush interval: %v", err)
+				}
+				ew.FlushInterval = caddy.Duration(dur)
+			case "spool_file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				ew.SpoolFile = d.Val()
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner     = (*ElasticsearchWriter)(nil)
+	_ caddy.WriterOpener    = (*ElasticsearchWriter)(nil)
+	_ caddyfile.Unmarshaler = (*ElasticsearchWriter)(nil)
+	_ pushSender            = (*ElasticsearchWriter)(nil)
+)
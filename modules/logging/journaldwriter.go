@@ -0,0 +1,187 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(JournaldWriter{})
+}
+
+// JournaldWriter implements a log writer that sends each log
+// entry to systemd-journald using its native datagram protocol,
+// so no external library or journalctl shim is needed. The
+// encoded entry becomes the MESSAGE field; additional journal
+// fields may be attached to every entry.
+type JournaldWriter struct {
+	// The path to the journald socket.
+	// Default: /run/systemd/journal/socket.
+	Socket string `json:"socket,omitempty"`
+
+	// The SYSLOG_IDENTIFIER field. Default: caddy.
+	Identifier string `json:"identifier,omitempty"`
+
+	// Extra journal fields to attach to every entry. Keys are
+	// uppercased as required by journald; values are sent
+	// verbatim.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (JournaldWriter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.writers.journald",
+		New: func() caddy.Module { return new(JournaldWriter) },
+	}
+}
+
+// Provision sets up the module.
+func (jw *JournaldWriter) Provision(ctx caddy.Context) error {
+	if jw.Socket == "" {
+		jw.Socket = "/run/systemd/journal/socket"
+	}
+	if jw.Identifier == "" {
+		jw.Identifier = "caddy"
+	}
+	for key := range jw.Fields {
+		upper := strings.ToUpper(key)
+		if strings.HasPrefix(upper, "_") {
+			return fmt.Errorf("journal field %s: fields starting with _ are reserved by journald", key)
+		}
+		if upper != key {
+			jw.Fields[upper] = jw.Fields[key]
+			delete(jw.Fields, key)
+		}
+	}
+	return nil
+}
+
+func (jw JournaldWriter) String() string {
+	return "journald:" + jw.Socket
+}
+
+// WriterKey returns a unique key representing this jw.
+func (jw JournaldWriter) WriterKey() string {
+	return "journald:" + jw.Socket
+}
+
+// OpenWriter opens a connection to the journald socket.
+func (jw JournaldWriter) OpenWriter() (io.WriteCloser, error) {
+	conn, err := net.Dial("unixgram", jw.Socket)
+	if err != nil {
+		return nil, err
+	}
+	return &journaldConn{conn: conn, jw: jw}, nil
+}
+
+// UnmarshalCaddyfile sets up the module from Caddyfile tokens. Syntax:
+//
+//     journald {
+//         socket <path>
+//         identifier <name>
+//         field <name> <value>
+//     }
+//
+func (jw *JournaldWriter) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "socket":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				jw.Socket = d.Val()
+			case "identifier":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				jw.Identifier = d.Val()
+			case "field":
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				if jw.Fields == nil {
+					jw.Fields = make(map[string]string)
+				}
+				jw.Fields[args[0]] = args[1]
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// journaldConn sends each write to journald as one datagram.
+type journaldConn struct {
+	conn net.Conn
+	jw   JournaldWriter
+}
+
+// Write sends b to journald as the MESSAGE field of one entry.
+func (jc *journaldConn) Write(b []byte) (int, error) {
+	payload := new(bytes.Buffer)
+	appendJournalField(payload, "MESSAGE", string(bytes.TrimRight(b, "\n")))
+	appendJournalField(payload, "SYSLOG_IDENTIFIER", jc.jw.Identifier)
+	appendJournalField(payload, "PRIORITY", "6")
+	for key, val := range jc.jw.Fields {
+		appendJournalField(payload, key, val)
+	}
+	if _, err := jc.conn.Write(payload.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the connection to journald.
+func (jc *journaldConn) Close() error {
+	return jc.conn.Close()
+}
+
+// appendJournalField serializes one field in journald's native
+// format: simple NAME=VALUE lines for plain values, and the
+// length-prefixed binary form for values containing newlines.
+func appendJournalField(buf *bytes.Buffer, name, value string) {
+	if strings.Contains(value, "\n") {
+		buf.WriteString(name)
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteString(name)
+	buf.WriteByte('=')
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner     = (*JournaldWriter)(nil)
+	_ caddy.WriterOpener    = (*JournaldWriter)(nil)
+	_ caddyfile.Unmarshaler = (*JournaldWriter)(nil)
+)
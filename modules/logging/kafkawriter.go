@@ -0,0 +1,266 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+func init() {
+	caddy.RegisterModule(KafkaWriter{})
+}
+
+// KafkaWriter implements a log writer that publishes each entry
+// to a Kafka topic. Entries are batched asynchronously so log
+// writes do not block on broker round trips.
+type KafkaWriter struct {
+	// The addresses of the Kafka brokers. Required.
+	Brokers []string `json:"brokers,omitempty"`
+
+	// The topic to publish to. Required.
+	Topic string `json:"topic,omitempty"`
+
+	// The partition key for each message, evaluated with a
+	// replacer so it can contain global placeholders such as
+	// {system.hostname}. Messages with the same key go to the
+	// same partition. If empty, messages are distributed
+	// round-robin.
+	Key string `json:"key,omitempty"`
+
+	// How many entries to accumulate before producing a batch.
+	// Default: 100.
+	BatchSize int `json:"batch_size,omitempty"`
+
+	// How long to wait before producing a partial batch.
+	// Default: 1s.
+	BatchTimeout caddy.Duration `json:"batch_timeout,omitempty"`
+
+	// Enables TLS for broker connections.
+	TLS bool `json:"tls,omitempty"`
+
+	// Disables verification of the broker certificates.
+	// NOT RECOMMENDED except for testing.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+
+	// The SASL mechanism to authenticate with: plain,
+	// scram-sha-256, or scram-sha-512. Authentication is
+	// disabled if empty.
+	SASLMechanism string `json:"sasl_mechanism,omitempty"`
+
+	// The SASL username.
+	Username string `json:"username,omitempty"`
+
+	// The SASL password.
+	Password string `json:"password,omitempty"`
+
+	dialer *kafka.Dialer
+}
+
+// CaddyModule returns the Caddy module information.
+func (KafkaWriter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.writers.kafka",
+		New: func() caddy.Module { return new(KafkaWriter) },
+	}
+}
+
+// Provision sets up the module.
+func (kw *KafkaWriter) Provision(ctx caddy.Context) error {
+	if len(kw.Brokers) == 0 {
+		return fmt.Errorf("at least one broker is required")
+	}
+	if kw.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+	if kw.BatchSize == 0 {
+		kw.BatchSize = 100
+	}
+	if kw.BatchTimeout == 0 {
+		kw.BatchTimeout = caddy.Duration(1 * time.Second)
+	}
+
+	kw.dialer = &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+	if kw.TLS {
+		kw.dialer.TLS = &tls.Config{InsecureSkipVerify: kw.InsecureSkipVerify}
+	}
+	switch kw.SASLMechanism {
+	case "":
+	case "plain":
+		kw.dialer.SASLMechanism = plain.Mechanism{
+			Username: kw.Username,
+			Password: kw.Password,
+		}
+	case "scram-sha-256", "scram-sha-512":
+		algo := scram.SHA256
+		if kw.SASLMechanism == "scram-sha-512" {
+			algo = scram.SHA512
+		}
+		mechanism, err := scram.Mechanism(algo, kw.Username, kw.Password)
+		if err != nil {
+			return fmt.Errorf("setting up SCRAM: %v", err)
+		}
+		kw.dialer.SASLMechanism = mechanism
+	default:
+		return fmt.Errorf("unrecognized SASL mechanism: %s", kw.SASLMechanism)
+	}
+
+	return nil
+}
+
+func (kw KafkaWriter) String() string {
+	return "kafka:" + strings.Join(kw.Brokers, ",") + "/" + kw.Topic
+}
+
+// WriterKey returns a unique key representing this kw.
+func (kw KafkaWriter) WriterKey() string {
+	return "kafka:" + strings.Join(kw.Brokers, ",") + "/" + kw.Topic
+}
+
+// OpenWriter starts the async Kafka producer.
+func (kw KafkaWriter) OpenWriter() (io.WriteCloser, error) {
+	var balancer kafka.Balancer = &kafka.RoundRobin{}
+	if kw.Key != "" {
+		balancer = &kafka.Hash{}
+	}
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      kw.Brokers,
+		Topic:        kw.Topic,
+		Dialer:       kw.dialer,
+		Balancer:     balancer,
+		BatchSize:    kw.BatchSize,
+		BatchTimeout: time.Duration(kw.BatchTimeout),
+		Async:        true,
+	})
+	return &kafkaConn{writer: writer, kw: kw}, nil
+}
+
+// UnmarshalCaddyfile sets up the module from Caddyfile tokens. Syntax:
+//
+//     kafka <brokers...> {
+//         topic <name>
+//         key <template>
+//         batch_size <n>
+//         batch_timeout <duration>
+//         tls [insecure_skip_verify]
+//         sasl <mechanism> <username> <password>
+//     }
+//
+func (kw *KafkaWriter) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		kw.Brokers = append(kw.Brokers, d.RemainingArgs()...)
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "topic":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				kw.Topic = d.Val()
+			case "key":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				kw.Key = d.Val()
+			case "batch_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				size, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid batch size: %v", err)
+				}
+				kw.BatchSize = size
+			case "batch_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid batch timeout: %v", err)
+				}
+				kw.BatchTimeout = caddy.Duration(dur)
+			case "tls":
+				kw.TLS = true
+				if d.NextArg() {
+					if d.Val() != "insecure_skip_verify" {
+						return d.Errf("unrecognized tls option %s", d.Val())
+					}
+					kw.InsecureSkipVerify = true
+				}
+			case "sasl":
+				args := d.RemainingArgs()
+				if len(args) != 3 {
+					return d.ArgErr()
+				}
+				kw.SASLMechanism = args[0]
+				kw.Username = args[1]
+				kw.Password = args[2]
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// kafkaConn publishes each write as one Kafka message.
+type kafkaConn struct {
+	writer *kafka.Writer
+	kw     KafkaWriter
+}
+
+// Write publishes b to the topic; with the async producer,
+// batching and delivery happen in the background.
+func (kc *kafkaConn) Write(b []byte) (int, error) {
+	msg := kafka.Message{
+		Value: append([]byte(nil), bytes.TrimRight(b, "\n")...),
+	}
+	if kc.kw.Key != "" {
+		repl := caddy.NewReplacer()
+		msg.Key = []byte(repl.ReplaceAll(kc.kw.Key, ""))
+	}
+	err := kc.writer.WriteMessages(context.Background(), msg)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close flushes buffered messages and closes the producer.
+func (kc *kafkaConn) Close() error {
+	return kc.writer.Close()
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner     = (*KafkaWriter)(nil)
+	_ caddy.WriterOpener    = (*KafkaWriter)(nil)
+	_ caddyfile.Unmarshaler = (*KafkaWriter)(nil)
+)
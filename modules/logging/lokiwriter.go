@@ -0,0 +1,207 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(LokiWriter{})
+}
+
+// LokiWriter implements a log writer that pushes entries to a
+// Grafana Loki server, batching them in memory with optional
+// disk spillover so no sidecar shipper is needed.
+type LokiWriter struct {
+	PushConfig
+
+	// The base URL of the Loki server; batches are POSTed to
+	// its /loki/api/v1/push path. Required.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// The stream labels to attach to all entries.
+	// Default: {"job": "caddy"}.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	httpClient *http.Client
+}
+
+// CaddyModule returns the Caddy module information.
+func (LokiWriter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.writers.loki",
+		New: func() caddy.Module { return new(LokiWriter) },
+	}
+}
+
+// Provision sets up the module.
+func (lw *LokiWriter) Provision(ctx caddy.Context) error {
+	if lw.Endpoint == "" {
+		return fmt.Errorf("endpoint is required")
+	}
+	if lw.Labels == nil {
+		lw.Labels = map[string]string{"job": "caddy"}
+	}
+	lw.PushConfig.fillDefaults()
+	lw.httpClient = &http.Client{Timeout: time.Duration(lw.Timeout)}
+	return nil
+}
+
+func (lw LokiWriter) String() string {
+	return "loki:" + lw.Endpoint
+}
+
+// WriterKey returns a unique key representing this lw.
+func (lw LokiWriter) WriterKey() string {
+	return "loki:" + lw.Endpoint
+}
+
+// OpenWriter starts the background delivery of log entries.
+func (lw LokiWriter) OpenWriter() (io.WriteCloser, error) {
+	return openPushConn(lw.PushConfig, lw)
+}
+
+// push sends one batch to Loki.
+func (lw LokiWriter) push(batch []pushEntry) error {
+	// Loki requires entries within a stream to be in
+	// ascending timestamp order
+	sort.SliceStable(batch, func(i, j int) bool {
+		return batch[i].ts.Before(batch[j].ts)
+	})
+
+	values := make([][2]string, len(batch))
+	for i, entry := range batch {
+		values[i] = [2]string{
+			strconv.FormatInt(entry.ts.UnixNano(), 10),
+			string(entry.line),
+		}
+	}
+	payload := map[string]interface{}{
+		"streams": []interface{}{
+			map[string]interface{}{
+				"stream": lw.Labels,
+				"values": values,
+			},
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, lw.Endpoint+"/loki/api/v1/push", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range lw.Headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := lw.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("loki returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// UnmarshalCaddyfile sets up the module from Caddyfile tokens. Syntax:
+//
+//     loki <endpoint> {
+//         label <name> <value>
+//         header <field> <value>
+//         batch_size <n>
+//         flush_interval <duration>
+//         spool_file <path>
+//     }
+//
+func (lw *LokiWriter) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			lw.Endpoint = d.Val()
+		}
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "label":
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				if lw.Labels == nil {
+					lw.Labels = make(map[string]string)
+				}
+				lw.Labels[args[0]] = args[1]
+			case "header":
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				if lw.Headers == nil {
+					lw.Headers = make(map[string]string)
+				}
+				lw.Headers[args[0]] = args[1]
+			case "batch_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				size, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid batch size: %v", err)
+				}
+				lw.BatchSize = size
+			case "flush_interval":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid flush interval: %v", err)
+				}
+				lw.FlushInterval = caddy.Duration(dur)
+			case "spool_file":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				lw.SpoolFile = d.Val()
+			default:
+				return d.Errf("unrecognized subdirective %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner     = (*LokiWriter)(nil)
+	_ caddy.WriterOpener    = (*LokiWriter)(nil)
+	_ caddyfile.Unmarshaler = (*LokiWriter)(nil)
+	_ pushSender            = (*LokiWriter)(nil)
+)
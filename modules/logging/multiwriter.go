@@ -0,0 +1,309 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(MultiWriter{})
+	caddy.RegisterModule(FailoverWriter{})
+}
+
+// MultiWriter is a log writer that fans each entry out to
+// several other writers. A failure of one writer does not
+// prevent delivery to the others.
+type MultiWriter struct {
+	// The writers to fan out to. Required.
+	WritersRaw []json.RawMessage `json:"writers,omitempty" caddy:"namespace=caddy.logging.writers inline_key=output"`
+
+	writers []caddy.WriterOpener
+}
+
+// CaddyModule returns the Caddy module information.
+func (MultiWriter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.writers.multi",
+		New: func() caddy.Module { return new(MultiWriter) },
+	}
+}
+
+// Provision sets up the module.
+func (mw *MultiWriter) Provision(ctx caddy.Context) error {
+	if mw.WritersRaw == nil {
+		return fmt.Errorf("at least one writer is required")
+	}
+	vals, err := ctx.LoadModule(mw, "WritersRaw")
+	if err != nil {
+		return fmt.Errorf("loading writer modules: %v", err)
+	}
+	for _, val := range vals.([]interface{}) {
+		mw.writers = append(mw.writers, val.(caddy.WriterOpener))
+	}
+	return nil
+}
+
+func (mw MultiWriter) String() string {
+	return "multi:" + joinWriterKeys(mw.writers)
+}
+
+// WriterKey returns a unique key representing this mw.
+func (mw MultiWriter) WriterKey() string {
+	return "multi:" + joinWriterKeys(mw.writers)
+}
+
+// OpenWriter opens all the underlying writers.
+func (mw MultiWriter) OpenWriter() (io.WriteCloser, error) {
+	writers, err := openAllWriters(mw.writers)
+	if err != nil {
+		return nil, err
+	}
+	return &fanoutConn{writers: writers}, nil
+}
+
+// fanoutConn writes each entry to all underlying writers.
+type fanoutConn struct {
+	writers []io.WriteCloser
+}
+
+// Write writes b to every writer; it succeeds as long as at
+// least one delivery succeeds.
+func (fc *fanoutConn) Write(b []byte) (int, error) {
+	var firstErr error
+	ok := false
+	for _, w := range fc.writers {
+		if _, err := w.Write(b); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			ok = true
+		}
+	}
+	if ok {
+		return len(b), nil
+	}
+	return 0, firstErr
+}
+
+// Close closes all underlying writers.
+func (fc *fanoutConn) Close() error {
+	var firstErr error
+	for _, w := range fc.writers {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// FailoverWriter is a log writer that writes each entry to the
+// first healthy writer in an ordered list; for example, a
+// network sink with a local file as fallback. Entries delivered
+// to a fallback are buffered and replayed to the primary writer
+// once it recovers, so a collector outage loses no entries as
+// long as the buffer suffices.
+type FailoverWriter struct {
+	// The writers in order of preference; the first is the
+	// primary, the rest are fallbacks. Required.
+	WritersRaw []json.RawMessage `json:"writers,omitempty" caddy:"namespace=caddy.logging.writers inline_key=output"`
+
+	// How often to probe the primary writer for recovery
+	// while failed over. Default: 10s.
+	RetryInterval caddy.Duration `json:"retry_interval,omitempty"`
+
+	// How many entries to buffer for replay while failed
+	// over; beyond this, the oldest buffered entries are
+	// dropped (they remain in the fallback output).
+	// Default: 10000.
+	MaxReplay int `json:"max_replay,omitempty"`
+
+	writers []caddy.WriterOpener
+}
+
+// CaddyModule returns the Caddy module information.
+func (FailoverWriter) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.writers.failover",
+		New: func() caddy.Module { return new(FailoverWriter) },
+	}
+}
+
+// Provision sets up the module.
+func (fw *FailoverWriter) Provision(ctx caddy.Context) error {
+	if fw.WritersRaw == nil {
+		return fmt.Errorf("at least one writer is required")
+	}
+	vals, err := ctx.LoadModule(fw, "WritersRaw")
+	if err != nil {
+		return fmt.Errorf("loading writer modules: %v", err)
+	}
+	for _, val := range vals.([]interface{}) {
+		fw.writers = append(fw.writers, val.(caddy.WriterOpener))
+	}
+	if len(fw.writers) < 2 {
+		return fmt.Errorf("failover requires at least two writers")
+	}
+	if fw.RetryInterval == 0 {
+		fw.RetryInterval = caddy.Duration(10 * time.Second)
+	}
+	if fw.MaxReplay == 0 {
+		fw.MaxReplay = 10000
+	}
+	return nil
+}
+
+func (fw FailoverWriter) String() string {
+	return "failover:" + joinWriterKeys(fw.writers)
+}
+
+// WriterKey returns a unique key representing this fw.
+func (fw FailoverWriter) WriterKey() string {
+	return "failover:" + joinWriterKeys(fw.writers)
+}
+
+// OpenWriter opens all the underlying writers.
+func (fw FailoverWriter) OpenWriter() (io.WriteCloser, error) {
+	writers, err := openAllWriters(fw.writers)
+	if err != nil {
+		return nil, err
+	}
+	return &failoverConn{
+		writers:       writers,
+		retryInterval: time.Duration(fw.RetryInterval),
+		maxReplay:     fw.MaxReplay,
+	}, nil
+}
+
+// failoverConn writes to the first writer that accepts each
+// entry, preferring earlier writers, and replays entries to
+// the primary when it comes back.
+type failoverConn struct {
+	writers       []io.WriteCloser
+	retryInterval time.Duration
+	maxReplay     int
+
+	mu        sync.Mutex
+	active    int // index of the writer currently in use
+	lastRetry time.Time
+	replay    [][]byte
+}
+
+// Write writes b to the active writer, failing over to later
+// writers as needed.
+func (fc *failoverConn) Write(b []byte) (int, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.active > 0 && time.Since(fc.lastRetry) >= fc.retryInterval {
+		fc.tryRecover()
+	}
+
+	var lastErr error
+	for i := fc.active; i < len(fc.writers); i++ {
+		if _, err := fc.writers[i].Write(b); err != nil {
+			lastErr = err
+			continue
+		}
+		if i > 0 {
+			// delivered to a fallback; remember the entry so it
+			// can be replayed to the primary on recovery
+			fc.buffer(b)
+			if fc.active == 0 {
+				fc.lastRetry = time.Now()
+			}
+		}
+		fc.active = i
+		return len(b), nil
+	}
+	return 0, lastErr
+}
+
+// Close closes all underlying writers.
+func (fc *failoverConn) Close() error {
+	var firstErr error
+	for _, w := range fc.writers {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// tryRecover probes the primary writer by replaying the buffered
+// entries to it; if they all go through, the primary becomes
+// active again. Callers must hold mu.
+func (fc *failoverConn) tryRecover() {
+	fc.lastRetry = time.Now()
+	for len(fc.replay) > 0 {
+		if _, err := fc.writers[0].Write(fc.replay[0]); err != nil {
+			return
+		}
+		fc.replay = fc.replay[1:]
+	}
+	fc.active = 0
+}
+
+// buffer stores b for later replay, dropping the oldest entry
+// if the buffer is full. Callers must hold mu.
+func (fc *failoverConn) buffer(b []byte) {
+	if len(fc.replay) >= fc.maxReplay {
+		fc.replay = fc.replay[1:]
+	}
+	fc.replay = append(fc.replay, append([]byte(nil), b...))
+}
+
+// openAllWriters opens each writer, closing any already opened
+// if one of them fails.
+func openAllWriters(openers []caddy.WriterOpener) ([]io.WriteCloser, error) {
+	writers := make([]io.WriteCloser, 0, len(openers))
+	for _, wo := range openers {
+		w, err := wo.OpenWriter()
+		if err != nil {
+			for _, opened := range writers {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("opening writer %s: %v", wo.WriterKey(), err)
+		}
+		writers = append(writers, w)
+	}
+	return writers, nil
+}
+
+// joinWriterKeys builds a composite key from the keys of the
+// underlying writers.
+func joinWriterKeys(openers []caddy.WriterOpener) string {
+	keys := make([]string, len(openers))
+	for i, wo := range openers {
+		keys[i] = wo.WriterKey()
+	}
+	return strings.Join(keys, ",")
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner  = (*MultiWriter)(nil)
+	_ caddy.WriterOpener = (*MultiWriter)(nil)
+	_ caddy.Provisioner  = (*FailoverWriter)(nil)
+	_ caddy.WriterOpener = (*FailoverWriter)(nil)
+)
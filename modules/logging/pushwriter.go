@@ -0,0 +1,320 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// PushConfig holds the batching and delivery knobs shared by the
+// log writers that push entries to a remote ingestion API.
+type PushConfig struct {
+	// How many entries to accumulate before sending a batch.
+	// A batch is also sent when the flush interval elapses.
+	// Default: 500.
+	BatchSize int `json:"batch_size,omitempty"`
+
+	// How long to wait before sending a partial batch.
+	// Default: 5s.
+	FlushInterval caddy.Duration `json:"flush_interval,omitempty"`
+
+	// How many times to retry a failed batch before giving up
+	// on it (spilling it to disk, or dropping it if no spool
+	// file is configured). Retries back off exponentially.
+	// Default: 3.
+	MaxRetries int `json:"max_retries,omitempty"`
+
+	// How many entries may be queued in memory awaiting
+	// delivery. When the queue is full, entries spill over to
+	// the spool file; without one, writers block, applying
+	// backpressure to the logger. Default: 10000.
+	QueueSize int `json:"queue_size,omitempty"`
+
+	// How long to wait for the remote API to accept a batch.
+	// Default: 15s.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	// A file used to spill entries to disk when the in-memory
+	// queue is full or a batch cannot be delivered after all
+	// retries. Spooled entries are replayed once deliveries
+	// succeed again; delivery is at-least-once. If empty,
+	// spillover is disabled.
+	SpoolFile string `json:"spool_file,omitempty"`
+
+	// Extra headers to send with each push request, such as
+	// authentication tokens or tenant IDs.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// fillDefaults applies default values to unset fields.
+func (pc *PushConfig) fillDefaults() {
+	if pc.BatchSize == 0 {
+		pc.BatchSize = 500
+	}
+	if pc.FlushInterval == 0 {
+		pc.FlushInterval = caddy.Duration(5 * time.Second)
+	}
+	if pc.MaxRetries == 0 {
+		pc.MaxRetries = 3
+	}
+	if pc.QueueSize == 0 {
+		pc.QueueSize = 10000
+	}
+	if pc.Timeout == 0 {
+		pc.Timeout = caddy.Duration(15 * time.Second)
+	}
+}
+
+// pushEntry is one log entry awaiting delivery, with the time
+// it was written so batches preserve original timestamps.
+type pushEntry struct {
+	ts   time.Time
+	line []byte
+}
+
+// pushSender delivers one batch of entries to the remote API.
+type pushSender interface {
+	push(batch []pushEntry) error
+}
+
+// pushConn is the io.WriteCloser handed to the logging
+// infrastructure; it queues entries and lets a background
+// goroutine batch and deliver them.
+type pushConn struct {
+	cfg     PushConfig
+	sender  pushSender
+	entries chan pushEntry
+	done    chan struct{}
+	stopped chan struct{}
+
+	spoolMu sync.Mutex
+	spool   *os.File
+	// in-memory offsets into the spool file; entries between
+	// readOff and writeOff are pending replay
+	readOff, writeOff int64
+}
+
+// openPushConn starts the delivery goroutine for the given sender.
+func openPushConn(cfg PushConfig, sender pushSender) (io.WriteCloser, error) {
+	pc := &pushConn{
+		cfg:     cfg,
+		sender:  sender,
+		entries: make(chan pushEntry, cfg.QueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if cfg.SpoolFile != "" {
+		spool, err := os.OpenFile(cfg.SpoolFile, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		// any entries left over from a previous run are pending
+		end, err := spool.Seek(0, io.SeekEnd)
+		if err != nil {
+			spool.Close()
+			return nil, err
+		}
+		pc.spool = spool
+		pc.writeOff = end
+	}
+	go pc.loop()
+	return pc, nil
+}
+
+// Write queues one encoded log entry for delivery. If the queue
+// is full, the entry spills to disk when a spool file is
+// configured; otherwise Write blocks until there is room.
+func (pc *pushConn) Write(b []byte) (int, error) {
+	entry := pushEntry{
+		ts:   time.Now(),
+		line: append([]byte(nil), bytes.TrimRight(b, "\n")...),
+	}
+	if pc.spool == nil {
+		pc.entries <- entry
+		return len(b), nil
+	}
+	select {
+	case pc.entries <- entry:
+	default:
+		if err := pc.spoolEntries([]pushEntry{entry}); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Close flushes pending entries and stops the delivery goroutine.
+func (pc *pushConn) Close() error {
+	close(pc.done)
+	<-pc.stopped
+	if pc.spool != nil {
+		return pc.spool.Close()
+	}
+	return nil
+}
+
+// loop batches queued entries and delivers them, replaying
+// spooled entries whenever the queue has caught up.
+func (pc *pushConn) loop() {
+	defer close(pc.stopped)
+
+	ticker := time.NewTicker(time.Duration(pc.cfg.FlushInterval))
+	defer ticker.Stop()
+
+	var batch []pushEntry
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := pc.sendWithRetry(batch); err != nil {
+			// couldn't deliver after all retries; spill to disk
+			// if we can, otherwise the batch is dropped
+			if pc.spool != nil {
+				pc.spoolEntries(batch) //nolint:errcheck
+			}
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case entry := <-pc.entries:
+			batch = append(batch, entry)
+			if len(batch) >= pc.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			pc.replaySpool()
+		case <-pc.done:
+			// drain whatever is queued, then flush and exit
+			for {
+				select {
+				case entry := <-pc.entries:
+					batch = append(batch, entry)
+					if len(batch) >= pc.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendWithRetry delivers a batch, retrying with exponential
+// backoff up to the configured number of retries.
+func (pc *pushConn) sendWithRetry(batch []pushEntry) error {
+	backoff := 1 * time.Second
+	var err error
+	for attempt := 0; attempt <= pc.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-pc.done:
+				// shutting down; one last immediate try
+			}
+			backoff *= 2
+			if backoff > 30*time.Second {
+				backoff = 30 * time.Second
+			}
+		}
+		if err = pc.sender.push(batch); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// spoolEntries appends entries to the spool file. Each record is
+// the entry timestamp (unix nanoseconds), the line length, and
+// the line bytes.
+func (pc *pushConn) spoolEntries(batch []pushEntry) error {
+	pc.spoolMu.Lock()
+	defer pc.spoolMu.Unlock()
+
+	buf := new(bytes.Buffer)
+	for _, entry := range batch {
+		binary.Write(buf, binary.LittleEndian, entry.ts.UnixNano()) //nolint:errcheck
+		binary.Write(buf, binary.LittleEndian, uint32(len(entry.line)))
+		buf.Write(entry.line)
+	}
+	n, err := pc.spool.WriteAt(buf.Bytes(), pc.writeOff)
+	pc.writeOff += int64(n)
+	return err
+}
+
+// replaySpool attempts to deliver spooled entries, one batch at
+// a time; once the spool is fully drained it is truncated. A
+// delivery failure leaves the remaining entries for next time.
+func (pc *pushConn) replaySpool() {
+	if pc.spool == nil {
+		return
+	}
+	for {
+		pc.spoolMu.Lock()
+		if pc.readOff >= pc.writeOff {
+			if pc.writeOff > 0 {
+				if err := pc.spool.Truncate(0); err == nil {
+					pc.readOff, pc.writeOff = 0, 0
+				}
+			}
+			pc.spoolMu.Unlock()
+			return
+		}
+		batch, next, err := pc.readSpooled(pc.readOff)
+		pc.spoolMu.Unlock()
+		if err != nil || len(batch) == 0 {
+			return
+		}
+		if pc.sender.push(batch) != nil {
+			return
+		}
+		pc.spoolMu.Lock()
+		pc.readOff = next
+		pc.spoolMu.Unlock()
+	}
+}
+
+// readSpooled reads up to one batch of entries starting at the
+// given offset, returning the offset just past what was read.
+// Callers must hold spoolMu.
+func (pc *pushConn) readSpooled(off int64) ([]pushEntry, int64, error) {
+	var batch []pushEntry
+	header := make([]byte, 12)
+	for off < pc.writeOff && len(batch) < pc.cfg.BatchSize {
+		if _, err := pc.spool.ReadAt(header, off); err != nil {
+			return batch, off, err
+		}
+		ts := int64(binary.LittleEndian.Uint64(header[:8]))
+		size := binary.LittleEndian.Uint32(header[8:12])
+		line := make([]byte, size)
+		if _, err := pc.spool.ReadAt(line, off+12); err != nil {
+			return batch, off, err
+		}
+		batch = append(batch, pushEntry{ts: time.Unix(0, ts), line: line})
+		off += 12 + int64(size)
+	}
+	return batch, off, nil
+}
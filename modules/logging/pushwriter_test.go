@@ -0,0 +1,263 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// recordingSender is a pushSender that records delivered batches,
+// and can be made to fail to simulate a remote outage.
+type recordingSender struct {
+	mu        sync.Mutex
+	fail      bool
+	failAfter int // if > 0, fail once this many batches are recorded
+	batches   [][]pushEntry
+}
+
+func (s *recordingSender) push(batch []pushEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail || (s.failAfter > 0 && len(s.batches) >= s.failAfter) {
+		return errors.New("remote unavailable")
+	}
+	cp := make([]pushEntry, len(batch))
+	copy(cp, batch)
+	s.batches = append(s.batches, cp)
+	return nil
+}
+
+func (s *recordingSender) setFailing(fail bool) {
+	s.mu.Lock()
+	s.fail = fail
+	s.mu.Unlock()
+}
+
+// lines flattens all delivered batches into their lines, in order.
+func (s *recordingSender) lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lines []string
+	for _, batch := range s.batches {
+		for _, entry := range batch {
+			lines = append(lines, string(entry.line))
+		}
+	}
+	return lines
+}
+
+// newSpooledConn makes a pushConn with an open spool file in a
+// temp directory, without starting the delivery loop, so spool
+// behavior can be exercised directly.
+func newSpooledConn(t *testing.T, cfg PushConfig, sender pushSender) *pushConn {
+	t.Helper()
+	cfg.fillDefaults()
+	spool, err := os.OpenFile(filepath.Join(t.TempDir(), "spool"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatalf("opening spool file: %v", err)
+	}
+	t.Cleanup(func() { spool.Close() })
+	return &pushConn{
+		cfg:     cfg,
+		sender:  sender,
+		entries: make(chan pushEntry, cfg.QueueSize),
+		spool:   spool,
+	}
+}
+
+func TestSpoolRoundTrip(t *testing.T) {
+	pc := newSpooledConn(t, PushConfig{BatchSize: 2}, &recordingSender{})
+
+	wrote := []pushEntry{
+		{ts: time.Unix(0, 1600000000000000001), line: []byte("first")},
+		{ts: time.Unix(0, 1600000000000000002), line: []byte("")},
+		{ts: time.Unix(0, 1600000000000000003), line: []byte("third entry, somewhat longer")},
+	}
+	if err := pc.spoolEntries(wrote[:2]); err != nil {
+		t.Fatalf("spooling first batch: %v", err)
+	}
+	if err := pc.spoolEntries(wrote[2:]); err != nil {
+		t.Fatalf("spooling second batch: %v", err)
+	}
+
+	// reading back honors the batch size and resumes at the
+	// returned offset
+	batch, next, err := pc.readSpooled(0)
+	if err != nil {
+		t.Fatalf("reading first batch: %v", err)
+	}
+	if len(batch) != 2 {
+		t.Fatalf("expected batch of 2 entries but got %d", len(batch))
+	}
+	rest, end, err := pc.readSpooled(next)
+	if err != nil {
+		t.Fatalf("reading second batch: %v", err)
+	}
+	if len(rest) != 1 {
+		t.Fatalf("expected 1 remaining entry but got %d", len(rest))
+	}
+	if end != pc.writeOff {
+		t.Errorf("expected final offset %d to be the write offset %d", end, pc.writeOff)
+	}
+
+	// every entry survives with its timestamp and line intact
+	got := append(batch, rest...)
+	for i, entry := range got {
+		if !entry.ts.Equal(wrote[i].ts) {
+			t.Errorf("entry %d: expected timestamp %v but got %v", i, wrote[i].ts, entry.ts)
+		}
+		if string(entry.line) != string(wrote[i].line) {
+			t.Errorf("entry %d: expected line %q but got %q", i, wrote[i].line, entry.line)
+		}
+	}
+}
+
+func TestReplaySpool(t *testing.T) {
+	sender := &recordingSender{fail: true}
+	pc := newSpooledConn(t, PushConfig{BatchSize: 2}, sender)
+
+	entries := []pushEntry{
+		{ts: time.Now(), line: []byte("one")},
+		{ts: time.Now(), line: []byte("two")},
+		{ts: time.Now(), line: []byte("three")},
+	}
+	if err := pc.spoolEntries(entries); err != nil {
+		t.Fatalf("spooling: %v", err)
+	}
+
+	// while the remote is down, nothing is delivered and the
+	// spooled entries are kept for next time
+	pc.replaySpool()
+	if got := sender.lines(); len(got) != 0 {
+		t.Fatalf("expected no deliveries during outage but got %v", got)
+	}
+	if pc.readOff != 0 {
+		t.Errorf("expected read offset to stay at 0 during outage, got %d", pc.readOff)
+	}
+
+	// once the remote recovers, a replay delivers everything in
+	// order and truncates the drained spool
+	sender.setFailing(false)
+	pc.replaySpool()
+	got := sender.lines()
+	if len(got) != 3 || got[0] != "one" || got[1] != "two" || got[2] != "three" {
+		t.Errorf("expected entries replayed in order but got %v", got)
+	}
+	if pc.readOff != 0 || pc.writeOff != 0 {
+		t.Errorf("expected offsets reset after drain, got read=%d write=%d", pc.readOff, pc.writeOff)
+	}
+	fi, err := pc.spool.Stat()
+	if err != nil {
+		t.Fatalf("stat spool: %v", err)
+	}
+	if fi.Size() != 0 {
+		t.Errorf("expected drained spool to be truncated, size is %d", fi.Size())
+	}
+
+	// a partial delivery failure keeps only the undelivered tail
+	if err := pc.spoolEntries(entries); err != nil {
+		t.Fatalf("spooling again: %v", err)
+	}
+	sender.batches = nil
+	sender.failAfter = 1
+	pc.replaySpool()
+	if got := sender.lines(); len(got) != 2 || got[0] != "one" || got[1] != "two" {
+		t.Errorf("expected first batch delivered before failure but got %v", got)
+	}
+	if pc.readOff >= pc.writeOff {
+		t.Error("expected undelivered entries to remain pending in the spool")
+	}
+}
+
+func TestWriteSpillsWhenQueueFull(t *testing.T) {
+	pc := newSpooledConn(t, PushConfig{QueueSize: 1}, &recordingSender{})
+
+	if _, err := pc.Write([]byte("fits in queue\n")); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	if _, err := pc.Write([]byte("spills to disk\n")); err != nil {
+		t.Fatalf("second write: %v", err)
+	}
+	if pc.writeOff == 0 {
+		t.Fatal("expected second write to spill to the spool file")
+	}
+	batch, _, err := pc.readSpooled(0)
+	if err != nil {
+		t.Fatalf("reading spool: %v", err)
+	}
+	if len(batch) != 1 || string(batch[0].line) != "spills to disk" {
+		t.Errorf("expected spilled entry without trailing newline, got %v", batch)
+	}
+}
+
+func TestOpenPushConnResumesSpool(t *testing.T) {
+	spoolFile := filepath.Join(t.TempDir(), "spool")
+	cfg := PushConfig{
+		FlushInterval: caddy.Duration(10 * time.Millisecond),
+		SpoolFile:     spoolFile,
+	}
+	cfg.fillDefaults()
+
+	// simulate a previous run that left undelivered entries behind
+	leftover := &pushConn{cfg: cfg}
+	spool, err := os.OpenFile(spoolFile, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatalf("creating spool: %v", err)
+	}
+	leftover.spool = spool
+	err = leftover.spoolEntries([]pushEntry{
+		{ts: time.Now(), line: []byte("from last run")},
+	})
+	spool.Close()
+	if err != nil {
+		t.Fatalf("seeding spool: %v", err)
+	}
+
+	sender := &recordingSender{}
+	w, err := openPushConn(cfg, sender)
+	if err != nil {
+		t.Fatalf("opening push conn: %v", err)
+	}
+
+	// the delivery loop replays the leftover entries on its own
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sender.lines()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("leftover spool entries were never replayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := sender.lines(); got[0] != "from last run" {
+		t.Errorf("expected leftover entry replayed, got %v", got)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("closing: %v", err)
+	}
+	data, err := ioutil.ReadFile(spoolFile)
+	if err != nil {
+		t.Fatalf("reading spool file: %v", err)
+	}
+	if len(data) != 0 {
+		t.Errorf("expected replayed spool to be truncated, %d bytes remain", len(data))
+	}
+}
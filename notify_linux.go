@@ -0,0 +1,120 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package caddy
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Support for the systemd notification protocol (sd_notify),
+// so units can use Type=notify and get accurate readiness:
+// READY=1 is sent once a config is applied, RELOADING=1 when
+// a running config is being replaced, and STOPPING=1 when a
+// graceful shutdown begins. If the unit enables WatchdogSec,
+// keep-alive pings are sent at half the watchdog interval.
+// All of this is a no-op unless systemd set NOTIFY_SOCKET in
+// our environment.
+
+// sdNotify sends payload to the socket systemd named in the
+// NOTIFY_SOCKET environment variable. It is a no-op if the
+// variable is not set.
+func sdNotify(payload string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// abstract socket namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: socket,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(payload))
+	return err
+}
+
+// notifyReady tells the service manager that we are ready to
+// receive traffic, and starts watchdog pings if the unit has
+// a watchdog configured.
+func notifyReady() {
+	if err := sdNotify("READY=1"); err != nil {
+		Log().Named("systemd").Warn("unable to notify readiness", zap.Error(err))
+	}
+	watchdogOnce.Do(startWatchdog)
+}
+
+// notifyReloading tells the service manager that we are
+// replacing the running config; a READY=1 notification
+// follows once the new config is applied.
+func notifyReloading() {
+	if err := sdNotify("RELOADING=1"); err != nil {
+		Log().Named("systemd").Warn("unable to notify reloading", zap.Error(err))
+	}
+}
+
+// notifyStopping tells the service manager that we have begun
+// shutting down.
+func notifyStopping() {
+	if err := sdNotify("STOPPING=1"); err != nil {
+		Log().Named("systemd").Warn("unable to notify stopping", zap.Error(err))
+	}
+}
+
+var watchdogOnce sync.Once
+
+// startWatchdog begins sending keep-alive pings at half the
+// interval given by WATCHDOG_USEC, if the watchdog is enabled
+// for this process.
+func startWatchdog() {
+	usecStr := os.Getenv("WATCHDOG_USEC")
+	if usecStr == "" {
+		return
+	}
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		if pid, err := strconv.Atoi(pidStr); err != nil || pid != os.Getpid() {
+			return
+		}
+	}
+	usec, err := strconv.ParseInt(usecStr, 10, 64)
+	if err != nil || usec <= 0 {
+		Log().Named("systemd").Warn("invalid watchdog interval",
+			zap.String("WATCHDOG_USEC", usecStr))
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	go func() {
+		for range time.Tick(interval) {
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				Log().Named("systemd").Warn("unable to ping watchdog", zap.Error(err))
+			}
+		}
+	}()
+	Log().Named("systemd").Info("watchdog pings enabled",
+		zap.Duration("interval", interval))
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import "sync"
+
+// PlaceholderProvider is the interface for modules in the
+// caddy.placeholders namespace. Such modules make new global
+// placeholders (like "{geoip.*}" or "{k8s.*}") resolvable by
+// every replacer while the config that loaded them is running,
+// without each handler having to set its own variables.
+// Providers are consulted lazily, only when a placeholder is
+// actually being resolved, and after the standard global
+// placeholders.
+type PlaceholderProvider interface {
+	// Placeholder returns the value for the given key and
+	// whether the provider recognizes it. Providers should
+	// claim a distinct key prefix (like "geoip.") and return
+	// false for keys outside of it, so that they compose
+	// with other providers.
+	Placeholder(key string) (interface{}, bool)
+}
+
+// setPlaceholderProviders replaces the set of placeholder
+// providers consulted by all replacers. It is called when a
+// config starts or stops running.
+func setPlaceholderProviders(providers []PlaceholderProvider) {
+	placeholderProvidersMu.Lock()
+	placeholderProviders = providers
+	placeholderProvidersMu.Unlock()
+}
+
+// providedPlaceholders resolves key against the placeholder
+// provider modules of the currently-running config.
+func providedPlaceholders(key string) (interface{}, bool) {
+	placeholderProvidersMu.RLock()
+	providers := placeholderProviders
+	placeholderProvidersMu.RUnlock()
+	for _, provider := range providers {
+		if val, ok := provider.Placeholder(key); ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	placeholderProvidersMu sync.RWMutex
+	placeholderProviders   []PlaceholderProvider
+)
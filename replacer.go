@@ -15,12 +15,17 @@
 package caddy
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -31,6 +36,7 @@ func NewReplacer() *Replacer {
 	}
 	rep.providers = []ReplacerFunc{
 		globalDefaultReplacements,
+		providedPlaceholders,
 		rep.fromStatic,
 	}
 	return rep
@@ -57,7 +63,18 @@ func (r *Replacer) Set(variable string, value interface{}) {
 
 // Get gets a value from the replacer. It returns
 // the value and whether the variable was known.
+// The variable may have transformations appended
+// to it, separated by '|'; see getTransformed.
 func (r *Replacer) Get(variable string) (interface{}, bool) {
+	if strings.IndexByte(variable, '|') >= 0 {
+		return r.getTransformed(variable)
+	}
+	return r.getRaw(variable)
+}
+
+// getRaw resolves variable against the value providers,
+// without interpreting any transformations.
+func (r *Replacer) getRaw(variable string) (interface{}, bool) {
 	for _, mapFunc := range r.providers {
 		if val, ok := mapFunc(variable); ok {
 			return val, true
@@ -66,6 +83,91 @@ func (r *Replacer) Get(variable string) (interface{}, bool) {
 	return nil, false
 }
 
+// getTransformed resolves a variable that has transformations
+// appended to it, like "{http.request.host | upper}". The part
+// before the first '|' is the actual variable; each remaining
+// part names a transformation, with any arguments separated by
+// spaces, applied to the value in order:
+//
+//	upper                 uppercase the value
+//	lower                 lowercase the value
+//	trim                  trim surrounding whitespace
+//	substring <from> [<to>]  slice the value by byte positions
+//	sha256                hex-encoded SHA-256 digest
+//	base64                standard base64 encoding
+//	url-encode            escape the value for use in a query
+//	default <value>       substitute value if empty or unknown
+//
+// A variable with an unrecognized or malformed transformation
+// is treated the same as an unrecognized variable.
+func (r *Replacer) getTransformed(variable string) (interface{}, bool) {
+	parts := strings.Split(variable, "|")
+
+	val, found := r.getRaw(strings.TrimSpace(parts[0]))
+	s := toString(val)
+
+	for _, part := range parts[1:] {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			return nil, false
+		}
+		name, args := fields[0], fields[1:]
+		switch name {
+		case "upper":
+			s = strings.ToUpper(s)
+		case "lower":
+			s = strings.ToLower(s)
+		case "trim":
+			s = strings.TrimSpace(s)
+		case "substring":
+			if len(args) < 1 || len(args) > 2 {
+				return nil, false
+			}
+			from, err := strconv.Atoi(args[0])
+			if err != nil || from < 0 {
+				return nil, false
+			}
+			to := len(s)
+			if len(args) == 2 {
+				to, err = strconv.Atoi(args[1])
+				if err != nil || to < from {
+					return nil, false
+				}
+			}
+			if from > len(s) {
+				from = len(s)
+			}
+			if to > len(s) {
+				to = len(s)
+			}
+			s = s[from:to]
+		case "sha256":
+			sum := sha256.Sum256([]byte(s))
+			s = hex.EncodeToString(sum[:])
+		case "base64":
+			s = base64.StdEncoding.EncodeToString([]byte(s))
+		case "url-encode":
+			s = url.QueryEscape(s)
+		case "default":
+			// substituting a default makes an unknown
+			// variable known, so ReplaceKnown callers
+			// get the fallback instead of the literal
+			if !found || s == "" {
+				s = strings.Join(args, " ")
+			}
+			found = true
+		default:
+			return nil, false
+		}
+	}
+
+	if !found {
+		return nil, false
+	}
+
+	return s, true
+}
+
 // GetString  is the same as Get, but coerces the value to a
 // string representation.
 func (r *Replacer) GetString(variable string) (string, bool) {
@@ -122,18 +224,73 @@ func (r *Replacer) replace(input, empty string,
 	if !strings.Contains(input, string(phOpen)) {
 		return input, nil
 	}
+	return templateFor(input).evaluate(r, empty,
+		treatUnknownAsEmpty, errOnEmpty, errOnUnknown, f)
+}
 
-	var sb strings.Builder
+// ReplacerTemplate is a string with placeholders that has been
+// precompiled, so that evaluating it against a Replacer does not
+// re-scan the string. Code on hot paths that replaces the same
+// config-provided string for every request should compile it once
+// at provision time with CompileTemplate and keep the template.
+// The zero value evaluates to the empty string; use
+// CompileTemplate to make a useful one.
+type ReplacerTemplate struct {
+	root *replacerNode
+}
+
+// replacerNode is one segment of a compiled template: static
+// text followed by at most one placeholder. Because a string
+// like "{a{b}" means different things depending on whether
+// "a{b" is a recognized placeholder, each node carries two
+// continuations; which one is taken is decided at evaluation
+// time, when the Replacer's providers are known.
+type replacerNode struct {
+	// static text written before the placeholder is evaluated
+	static string
+
+	// the placeholder key, without braces; only
+	// meaningful if this is not a terminal node
+	key string
+
+	// continuation after the placeholder's closing brace,
+	// taken when the key is recognized; nil only on the
+	// terminal node
+	known *replacerNode
+
+	// continuation from just inside the opening brace,
+	// taken when the key is not recognized and unknown
+	// placeholders are left in the output
+	unknown *replacerNode
+}
+
+// CompileTemplate precompiles input into a template that can be
+// evaluated repeatedly without re-scanning the string. It always
+// succeeds; input that contains no placeholders compiles to a
+// template of only static text.
+func CompileTemplate(input string) ReplacerTemplate {
+	return ReplacerTemplate{
+		root: compileFrom(input, 0, make(map[int]*replacerNode)),
+	}
+}
 
-	// it is reasonable to assume that the output
-	// will be approximately as long as the input
-	sb.Grow(len(input))
+// compileFrom compiles the suffix of input beginning at start.
+// It mirrors the scanning the replacer used to do at replace
+// time, including the handling of escaped and unbalanced braces.
+// Positions are memoized since the unknown-key continuations of
+// overlapping placeholders revisit the same suffixes.
+func compileFrom(input string, start int, memo map[int]*replacerNode) *replacerNode {
+	if node, ok := memo[start]; ok {
+		return node
+	}
+	node := new(replacerNode)
+	memo[start] = node
 
-	// iterate the input to find each placeholder
-	var lastWriteCursor int
+	var sb strings.Builder
+	lastWriteCursor := start
 
 scan:
-	for i := 0; i < len(input); i++ {
+	for i := start; i < len(input); i++ {
 
 		// check for escaped braces
 		if i > 0 && input[i-1] == phEscape && (input[i] == phClose || input[i] == phOpen) {
@@ -164,20 +321,80 @@ scan:
 		// write the substring from the last cursor to this point
 		sb.WriteString(input[lastWriteCursor:i])
 
-		// trim opening bracket
-		key := input[i+1 : end]
+		node.static = sb.String()
+		node.key = input[i+1 : end]
+		node.known = compileFrom(input, end+1, memo)
+		node.unknown = compileFrom(input, i+1, memo)
+		return node
+	}
+
+	// no placeholder found; the rest is static text
+	sb.WriteString(input[lastWriteCursor:])
+	node.static = sb.String()
+	return node
+}
+
+// Evaluate evaluates the template against r, replacing all
+// placeholders whether they are recognized or not, like
+// Replacer.ReplaceAll. Values that are empty string will be
+// substituted with empty.
+func (t ReplacerTemplate) Evaluate(r *Replacer, empty string) string {
+	out, _ := t.evaluate(r, empty, true, false, false, nil)
+	return out
+}
+
+// EvaluateKnown is like Evaluate, but only replaces placeholders
+// that are recognized; unrecognized placeholders remain in the
+// output, like Replacer.ReplaceKnown.
+func (t ReplacerTemplate) EvaluateKnown(r *Replacer, empty string) string {
+	out, _ := t.evaluate(r, empty, false, false, false, nil)
+	return out
+}
+
+// EvaluateOrErr is like Evaluate, but placeholders that are
+// empty or not recognized cause an error to be returned, like
+// Replacer.ReplaceOrErr.
+func (t ReplacerTemplate) EvaluateOrErr(r *Replacer, errOnEmpty, errOnUnknown bool) (string, error) {
+	return t.evaluate(r, "", false, errOnEmpty, errOnUnknown, nil)
+}
+
+func (t ReplacerTemplate) evaluate(r *Replacer, empty string,
+	treatUnknownAsEmpty, errOnEmpty, errOnUnknown bool,
+	f ReplacementFunc) (string, error) {
+	if t.root == nil {
+		return "", nil
+	}
+
+	// fast path: the whole template is static text
+	if t.root.known == nil {
+		return t.root.static, nil
+	}
+
+	var sb strings.Builder
+
+	// walk the compiled nodes, writing static parts verbatim
+	// and resolving one placeholder per node
+	for node := t.root; node != nil; {
+		sb.WriteString(node.static)
+
+		// the terminal node has no placeholder
+		if node.known == nil {
+			break
+		}
 
 		// try to get a value for this key, handle empty values accordingly
-		val, found := r.Get(key)
+		val, found := r.Get(node.key)
 		if !found {
 			// placeholder is unknown (unrecognized); handle accordingly
 			if errOnUnknown {
 				return "", fmt.Errorf("unrecognized placeholder %s%s%s",
-					string(phOpen), key, string(phClose))
+					string(phOpen), node.key, string(phClose))
 			} else if !treatUnknownAsEmpty {
-				// if treatUnknownAsEmpty is true, we'll handle an empty
-				// val later; so only continue otherwise
-				lastWriteCursor = i
+				// leave the opening brace in the output and
+				// resume scanning from just inside it, since
+				// a shorter placeholder may begin there
+				sb.WriteByte(phOpen)
+				node = node.unknown
 				continue
 			}
 		}
@@ -185,7 +402,7 @@ scan:
 		// apply any transformations
 		if f != nil {
 			var err error
-			val, err = f(key, val)
+			val, err = f(node.key, val)
 			if err != nil {
 				return "", err
 			}
@@ -199,7 +416,7 @@ scan:
 		if valStr == "" {
 			if errOnEmpty {
 				return "", fmt.Errorf("evaluated placeholder %s%s%s is empty",
-					string(phOpen), key, string(phClose))
+					string(phOpen), node.key, string(phClose))
 			} else if empty != "" {
 				sb.WriteString(empty)
 			}
@@ -207,17 +424,51 @@ scan:
 			sb.WriteString(valStr)
 		}
 
-		// advance cursor to end of placeholder
-		i = end
-		lastWriteCursor = i + 1
+		node = node.known
 	}
 
-	// flush any unwritten remainder
-	sb.WriteString(input[lastWriteCursor:])
-
 	return sb.String(), nil
 }
 
+// templateFor returns a compiled template for input, consulting
+// a process-wide cache so that strings replaced repeatedly (like
+// config values on request hot paths) are only compiled once.
+// The cache is bounded: when full, an arbitrary entry is evicted,
+// so replacement of dynamic one-off strings cannot grow memory
+// without limit.
+func templateFor(input string) ReplacerTemplate {
+	templateCacheMu.RLock()
+	tmpl, ok := templateCache[input]
+	templateCacheMu.RUnlock()
+	if ok {
+		return tmpl
+	}
+
+	tmpl = CompileTemplate(input)
+
+	templateCacheMu.Lock()
+	if len(templateCache) >= maxTemplateCacheSize {
+		for key := range templateCache {
+			delete(templateCache, key)
+			break
+		}
+	}
+	templateCache[input] = tmpl
+	templateCacheMu.Unlock()
+
+	return tmpl
+}
+
+var (
+	templateCacheMu sync.RWMutex
+	templateCache   = make(map[string]ReplacerTemplate)
+)
+
+// maxTemplateCacheSize limits how many compiled templates are
+// kept; a config is unlikely to have anywhere near this many
+// distinct replaceable strings.
+const maxTemplateCacheSize = 4096
+
 func toString(val interface{}) string {
 	switch v := val.(type) {
 	case nil:
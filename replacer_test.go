@@ -304,6 +304,90 @@ func TestReplacerReplaceKnown(t *testing.T) {
 	}
 }
 
+func TestReplacerTransforms(t *testing.T) {
+	rep := NewReplacer()
+	rep.Set("value", " Hello, World! ")
+	rep.Set("empty", "")
+
+	for i, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{
+			input:  "{value | upper}",
+			expect: " HELLO, WORLD! ",
+		},
+		{
+			input:  "{value | lower}",
+			expect: " hello, world! ",
+		},
+		{
+			input:  "{value | trim}",
+			expect: "Hello, World!",
+		},
+		{
+			// transformations chain in order
+			input:  "{value | trim | lower}",
+			expect: "hello, world!",
+		},
+		{
+			input:  "{value | trim | substring 0 5}",
+			expect: "Hello",
+		},
+		{
+			input:  "{value | trim | substring 7}",
+			expect: "World!",
+		},
+		{
+			// out-of-range positions are clamped
+			input:  "{value | trim | substring 7 100}",
+			expect: "World!",
+		},
+		{
+			input:  "{value | trim | url-encode}",
+			expect: "Hello%2C+World%21",
+		},
+		{
+			input:  "{value | trim | base64}",
+			expect: "SGVsbG8sIFdvcmxkIQ==",
+		},
+		{
+			input:  "{empty | sha256}",
+			expect: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			input:  "{empty | default fallback}",
+			expect: "fallback",
+		},
+		{
+			// default also applies to unknown variables
+			input:  "{nonexistent | default fallback}",
+			expect: "fallback",
+		},
+		{
+			input:  "{value | trim | default fallback}",
+			expect: "Hello, World!",
+		},
+		{
+			// an unrecognized transformation makes the
+			// whole placeholder unrecognized
+			input:  "{value | bogus}",
+			expect: "{value | bogus}",
+		},
+		{
+			// a malformed substring does too
+			input:  "{value | substring x}",
+			expect: "{value | substring x}",
+		},
+	} {
+		actual := rep.ReplaceKnown(tc.input, "")
+		if actual != tc.expect {
+			t.Errorf("Test %d: '%s': expected '%s' but got '%s'",
+				i, tc.input, tc.expect, actual)
+		}
+	}
+}
+
 func TestReplacerDelete(t *testing.T) {
 	rep := Replacer{
 		static: map[string]interface{}{
@@ -367,8 +451,8 @@ func TestReplacerMap(t *testing.T) {
 func TestReplacerNew(t *testing.T) {
 	rep := NewReplacer()
 
-	if len(rep.providers) != 2 {
-		t.Errorf("Expected providers length '%v' got length '%v'", 2, len(rep.providers))
+	if len(rep.providers) != 3 {
+		t.Errorf("Expected providers length '%v' got length '%v'", 3, len(rep.providers))
 	} else {
 		// test if default global replacements are added  as the first provider
 		hostname, _ := os.Hostname()
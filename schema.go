@@ -0,0 +1,183 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// handleSchema responds to GET /schema with a JSON Schema that
+// describes the config structure of every module compiled into
+// this binary, so editors and CI pipelines can validate configs
+// against exactly the module set this instance contains.
+func handleSchema(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(buildConfigSchema())
+}
+
+// buildConfigSchema generates a JSON Schema for the top-level
+// config structure, with a definition for each registered module.
+func buildConfigSchema() map[string]interface{} {
+	defs := make(map[string]interface{})
+	for _, name := range Modules() {
+		mod, err := GetModule(name)
+		if err != nil {
+			continue
+		}
+		visited := make(map[reflect.Type]bool)
+		defs[name] = typeSchema(reflect.TypeOf(mod.New()), visited)
+	}
+
+	schema := typeSchema(reflect.TypeOf(Config{}), make(map[reflect.Type]bool))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "Caddy config"
+	schema["definitions"] = defs
+	return schema
+}
+
+// typeSchema generates a JSON Schema fragment for typ. The
+// visited set breaks cycles in recursive config structures.
+func typeSchema(typ reflect.Type, visited map[reflect.Type]bool) map[string]interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case reflect.String:
+		// durations are expressed as strings (or nanoseconds)
+		if typ == reflect.TypeOf(Duration(0)) {
+			return map[string]interface{}{
+				"type":        []string{"string", "integer"},
+				"description": "duration; either a Go duration string or nanoseconds",
+			}
+		}
+		return map[string]interface{}{"type": "string"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if typ == reflect.TypeOf(Duration(0)) {
+			return map[string]interface{}{
+				"type":        []string{"string", "integer"},
+				"description": "duration; either a Go duration string or nanoseconds",
+			}
+		}
+		return map[string]interface{}{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+
+	case reflect.Slice, reflect.Array:
+		if isJSONRawMessage(typ) {
+			return map[string]interface{}{}
+		}
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(typ.Elem(), visited),
+		}
+
+	case reflect.Map:
+		if isModuleMapType(typ) {
+			return map[string]interface{}{
+				"type":        "object",
+				"description": "map of module name to module config",
+			}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(typ.Elem(), visited),
+		}
+
+	case reflect.Struct:
+		if visited[typ] {
+			// recursive structure; stop descending
+			return map[string]interface{}{"type": "object"}
+		}
+		visited[typ] = true
+		defer delete(visited, typ)
+		return structSchema(typ, visited)
+	}
+
+	// interfaces and anything else: any value allowed
+	return map[string]interface{}{}
+}
+
+// structSchema generates a JSON Schema object for a struct type,
+// using its json struct tags for property names and its caddy
+// struct tags to describe module fields.
+func structSchema(typ reflect.Type, visited map[reflect.Type]bool) map[string]interface{} {
+	props := make(map[string]interface{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+
+		jsonTag := field.Tag.Get("json")
+		name := strings.Split(jsonTag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			if field.Anonymous {
+				// embedded struct: fold its properties in
+				embedded := typeSchema(field.Type, visited)
+				if embProps, ok := embedded["properties"].(map[string]interface{}); ok {
+					for k, v := range embProps {
+						props[k] = v
+					}
+				}
+			}
+			continue
+		}
+
+		fieldSchema := typeSchema(field.Type, visited)
+
+		// a caddy struct tag means this field is filled by
+		// guest module(s) from a certain namespace
+		if caddyTag := field.Tag.Get("caddy"); caddyTag != "" {
+			tagInfo, err := ParseStructTag(caddyTag)
+			if err == nil {
+				if ns, ok := tagInfo["namespace"]; ok {
+					desc := fmt.Sprintf("module config from namespace '%s'", ns)
+					if inlineKey, ok := tagInfo["inline_key"]; ok {
+						desc += fmt.Sprintf(" (module name in field '%s')", inlineKey)
+					}
+					fieldSchema["description"] = desc
+				}
+			}
+		}
+
+		props[name] = fieldSchema
+	}
+
+	schema := map[string]interface{}{"type": "object"}
+	if len(props) > 0 {
+		schema["properties"] = props
+	}
+	return schema
+}
@@ -55,6 +55,11 @@ func trapSignalsCrossPlatform() {
 // gracefulStop exits the process as gracefully as possible.
 // It always exits, even if there are errors shutting down.
 func gracefulStop(sigName string) {
+	// fail readiness checks immediately so load balancers
+	// can drain this instance while it shuts down
+	setShuttingDown()
+	notifyStopping()
+
 	exitCode := ExitCodeSuccess
 	defer func() {
 		Log().Info("shutdown done", zap.String("signal", sigName))
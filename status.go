@@ -0,0 +1,103 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// StatusReporter is an optional interface that apps may
+// implement to contribute a summary of their running state to
+// the startup report and the admin /status endpoint. The
+// returned value must be JSON-marshalable.
+type StatusReporter interface {
+	Status() interface{}
+}
+
+// StatusReport summarizes the state of the running process:
+// the admin endpoint address, per-app summaries from apps that
+// implement StatusReporter, and the installed modules.
+type StatusReport struct {
+	// Whether the process is ready to receive traffic
+	// (see the /readyz endpoint).
+	Ready bool `json:"ready"`
+
+	// The address of the admin endpoint, if enabled.
+	Admin string `json:"admin,omitempty"`
+
+	// Per-app summaries of running state.
+	Apps map[string]interface{} `json:"apps,omitempty"`
+
+	// The modules installed in this build.
+	Modules []string `json:"modules"`
+}
+
+// CurrentStatus returns a status report for the
+// currently-running config.
+func CurrentStatus() StatusReport {
+	currentCfgMu.RLock()
+	defer currentCfgMu.RUnlock()
+	return unsyncedStatus(currentCfg)
+}
+
+// unsyncedStatus builds a status report for cfg. A read lock
+// on currentCfgMu is required if cfg is the current config.
+func unsyncedStatus(cfg *Config) StatusReport {
+	report := StatusReport{
+		Ready:   Ready(),
+		Modules: Modules(),
+	}
+	if cfg == nil {
+		return report
+	}
+
+	adminCfg := DefaultAdminConfig
+	if cfg.Admin != nil {
+		adminCfg = cfg.Admin
+	}
+	if !adminCfg.Disabled {
+		if addr, err := adminCfg.listenAddr(); err == nil {
+			report.Admin = addr.String()
+		}
+	}
+
+	for name, app := range cfg.apps {
+		reporter, ok := app.(StatusReporter)
+		if !ok {
+			continue
+		}
+		if report.Apps == nil {
+			report.Apps = make(map[string]interface{})
+		}
+		report.Apps[name] = reporter.Status()
+	}
+
+	return report
+}
+
+// handleStatus reports the status of the currently-running
+// config on the admin endpoint.
+func handleStatus(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return APIError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  fmt.Errorf("method not allowed"),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(CurrentStatus())
+}
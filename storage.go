@@ -156,5 +156,9 @@ func AppDataDir() string {
 // ConfigAutosavePath is the default path to which the last config will be persisted.
 var ConfigAutosavePath = filepath.Join(AppConfigDir(), "autosave.json")
 
+// ConfigAutosaveStorageKey is the storage key under which the last
+// config is also persisted when a storage module is configured.
+const ConfigAutosaveStorageKey = "config/autosave.json"
+
 // DefaultStorage is Caddy's default storage module.
 var DefaultStorage = &certmagic.FileStorage{Path: AppDataDir()}